@@ -0,0 +1,86 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// SniffSize is the size of the beginning of the input DetectEncoding looks at.
+const SniffSize = 32 << 10
+
+// sniffCandidates are the 8-bit encodings DetectEncoding chooses from, in the order of preference.
+var sniffCandidates = []NamedEncoding{
+	{Encoding: charmap.ISO8859_2, Name: "iso-8859-2"},
+	{Encoding: charmap.Windows1250, Name: "windows-1250"},
+	{Encoding: charmap.ISO8859_1, Name: "iso-8859-1"},
+	{Encoding: charmap.Windows1252, Name: "windows-1252"},
+}
+
+// commonLetters are the accented letters expected in the texts: the Hungarian and the common Western ones.
+const commonLetters = "áéíóöőúüűÁÉÍÓÖŐÚÜŰàâäçèêëîïñôùûßÀÂÄÇÈÊËÎÏÑÔÙÛ"
+
+// DetectEncoding returns the encoding of the beginning of a text:
+// by its BOM, UTF-8 if it is valid UTF-8,
+// else the one of ISO-8859-2, windows-1250, ISO-8859-1 and windows-1252 that gives the most sensible text.
+func DetectEncoding(b []byte) NamedEncoding {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return NamedEncoding{Encoding: xunicode.UTF8BOM, Name: "utf-8"}
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return NamedEncoding{Encoding: xunicode.UTF16(xunicode.LittleEndian, xunicode.ExpectBOM), Name: "utf-16le"}
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return NamedEncoding{Encoding: xunicode.UTF16(xunicode.BigEndian, xunicode.ExpectBOM), Name: "utf-16be"}
+	}
+	// the sample may end in the middle of a rune
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				b = b[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(b) {
+		return NamedEncoding{Encoding: encoding.Nop, Name: "utf-8"}
+	}
+
+	best, bestScore := sniffCandidates[0], -1<<31
+	for _, ne := range sniffCandidates {
+		s, err := ne.NewDecoder().Bytes(b)
+		if err != nil {
+			continue
+		}
+		if score := textScore(string(s)); score > bestScore {
+			best, bestScore = ne, score
+		}
+	}
+	return best
+}
+
+// textScore scores the non-ASCII runes of the text: the common letters are good,
+// the control characters and the undecodable bytes are bad.
+func textScore(s string) int {
+	var score int
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+		case r == utf8.RuneError || unicode.IsControl(r):
+			score -= 10
+		case strings.ContainsRune(commonLetters, r):
+			score += 2
+		case unicode.IsLetter(r):
+			score++
+		}
+	}
+	return score
+}
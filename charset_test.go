@@ -0,0 +1,40 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv_test
+
+import (
+	"testing"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	encode := func(enc *charmap.Charmap, s string) []byte {
+		b, err := enc.NewEncoder().Bytes([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	const hu = "id;név\n1;árvíztűrő tükörfúrógép\n2;ÁRVÍZTŰRŐ TÜKÖRFÚRÓGÉP\n"
+	for nm, tc := range map[string]struct {
+		b    []byte
+		want string
+	}{
+		"ascii":        {b: []byte("id;name\n1;x\n"), want: "utf-8"},
+		"utf-8":        {b: []byte(hu), want: "utf-8"},
+		"utf-8-cut":    {b: []byte(hu[:len("id;n")+1]), want: "utf-8"},
+		"bom":          {b: append([]byte{0xef, 0xbb, 0xbf}, hu...), want: "utf-8"},
+		"utf-16le":     {b: []byte{0xff, 0xfe, 'i', 0, 'd', 0}, want: "utf-16le"},
+		"iso-8859-2":   {b: encode(charmap.ISO8859_2, hu), want: "iso-8859-2"},
+		"windows-1250": {b: encode(charmap.Windows1250, hu+"3;„idézet”\n"), want: "windows-1250"},
+		"iso-8859-1":   {b: encode(charmap.ISO8859_1, "id;nom\n1;très à côté\n"), want: "iso-8859-1"},
+	} {
+		if got := dbcsv.DetectEncoding(tc.b); got.Name != tc.want {
+			t.Errorf("%s: got %q, wanted %q", nm, got.Name, tc.want)
+		}
+	}
+}
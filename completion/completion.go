@@ -0,0 +1,210 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package completion generates the shell (bash, zsh, fish) completion scripts of the tools:
+// the flags, the subcommands and the values of the enumerated flags (such as -format).
+package completion
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Shells are the supported shells.
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Command is a command to complete.
+type Command struct {
+	Name, Help  string
+	Flags       []Flag
+	Subcommands []Command
+}
+
+// Flag is a flag of a command.
+type Flag struct {
+	Name, Usage string
+	// Values are the possible values of the flag.
+	Values []string
+	Bool   bool
+}
+
+// commonValues are the values of the flags shared by the tools.
+var commonValues = map[string][]string{
+	"log-format": {"console", "json"},
+	"protocol":   {"tcp", "tcps"},
+}
+
+// AddFlags adds the flags of the FlagSet, with the values (by the flag name).
+func (cmd *Command) AddFlags(fs *flag.FlagSet, values map[string][]string) {
+	seen := make(map[string]struct{}, len(cmd.Flags))
+	for _, f := range cmd.Flags {
+		seen[f.Name] = struct{}{}
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := seen[f.Name]; ok {
+			return
+		}
+		seen[f.Name] = struct{}{}
+		fl := Flag{Name: f.Name, Usage: f.Usage, Values: values[f.Name]}
+		if fl.Values == nil {
+			fl.Values = commonValues[f.Name]
+		}
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			fl.Bool = bf.IsBoolFlag()
+		}
+		cmd.Flags = append(cmd.Flags, fl)
+	})
+}
+
+type collectCtxKey struct{}
+
+// WithCollect returns a context which makes Collect add the flags to cmd.
+func WithCollect(ctx context.Context, cmd *Command) context.Context {
+	return context.WithValue(ctx, collectCtxKey{}, cmd)
+}
+
+// Collect adds the flags of the FlagSets to the Command of the context (see WithCollect),
+// and reports whether the context has a Command - the caller should return then, without running.
+func Collect(ctx context.Context, values map[string][]string, fss ...*flag.FlagSet) bool {
+	cmd, ok := ctx.Value(collectCtxKey{}).(*Command)
+	if !ok || cmd == nil {
+		return false
+	}
+	for _, fs := range fss {
+		cmd.AddFlags(fs, values)
+	}
+	return true
+}
+
+// Write the completion script of the command for the shell.
+func Write(w io.Writer, shell string, cmd Command) error {
+	switch shell {
+	case "bash":
+		return writeBash(w, cmd)
+	case "zsh":
+		// the bash completion works with bashcompinit
+		if _, err := io.WriteString(w, "#compdef "+cmd.Name+"\n\nautoload -U +X bashcompinit && bashcompinit\n\n"); err != nil {
+			return err
+		}
+		return writeBash(w, cmd)
+	case "fish":
+		return writeFish(w, cmd)
+	}
+	return fmt.Errorf("unknown shell %q (wanted %s)", shell, strings.Join(Shells, ", "))
+}
+
+func (cmd Command) words() string {
+	words := make([]string, 0, len(cmd.Flags)+len(cmd.Subcommands))
+	for _, f := range cmd.Flags {
+		words = append(words, "-"+f.Name)
+	}
+	for _, sub := range cmd.Subcommands {
+		words = append(words, sub.Name)
+	}
+	return strings.Join(words, " ")
+}
+
+func (cmd Command) writeBashValues(w io.Writer, indent string) {
+	var started bool
+	for _, f := range cmd.Flags {
+		if len(f.Values) == 0 {
+			continue
+		}
+		if !started {
+			fmt.Fprintf(w, "%scase \"$prev\" in\n", indent)
+			started = true
+		}
+		fmt.Fprintf(w, "%s-%s) values=%q ;;\n", indent, f.Name, strings.Join(f.Values, " "))
+	}
+	if started {
+		fmt.Fprintf(w, "%sesac\n", indent)
+	}
+}
+
+func writeBash(w io.Writer, cmd Command) error {
+	fun := "_" + strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, cmd.Name) + "_complete"
+	fmt.Fprintf(w, "# %s completion\n%s() {\n", cmd.Name, fun)
+	io.WriteString(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+	# -flag=value is split at the =
+	if [[ "$cur" == "=" ]]; then
+		cur=""
+	elif [[ "$prev" == "=" ]]; then
+		prev="${COMP_WORDS[COMP_CWORD-2]}"
+	fi
+	local sub="" w
+`)
+	if len(cmd.Subcommands) != 0 {
+		names := make([]string, len(cmd.Subcommands))
+		for i, sub := range cmd.Subcommands {
+			names[i] = sub.Name
+		}
+		fmt.Fprintf(w, `	for w in "${COMP_WORDS[@]:1:COMP_CWORD-1}"; do
+		case "$w" in
+		%s) sub="$w"; break ;;
+		esac
+	done
+`, strings.Join(names, "|"))
+	}
+	io.WriteString(w, "\tlocal words=\"\" values=\"\"\n\tcase \"$sub\" in\n")
+	for _, sub := range cmd.Subcommands {
+		fmt.Fprintf(w, "\t%s)\n\t\twords=%q\n", sub.Name, sub.words())
+		sub.writeBashValues(w, "\t\t")
+		io.WriteString(w, "\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\t*)\n\t\twords=%q\n", cmd.words())
+	cmd.writeBashValues(w, "\t\t")
+	io.WriteString(w, "\t\t;;\n\tesac\n")
+	_, err := fmt.Fprintf(w, `	if [[ -n "$values" ]]; then
+		COMPREPLY=($(compgen -W "$values" -- "$cur"))
+	elif [[ "$cur" == -* || -z "$sub" ]]; then
+		COMPREPLY=($(compgen -W "$words" -- "$cur"))
+	fi
+}
+complete -o bashdefault -o default -F %s %s
+`, fun, cmd.Name)
+	return err
+}
+
+var fishQuote = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func writeFishFlags(w io.Writer, name, cond string, flags []Flag) {
+	for _, f := range flags {
+		fmt.Fprintf(w, "complete -c %s -n '%s' -o %s", name, cond, f.Name)
+		if len(f.Values) != 0 {
+			fmt.Fprintf(w, " -x -a '%s'", fishQuote.Replace(strings.Join(f.Values, " ")))
+		} else if !f.Bool {
+			io.WriteString(w, " -r")
+		}
+		usage, _, _ := strings.Cut(f.Usage, "\n")
+		fmt.Fprintf(w, " -d '%s'\n", fishQuote.Replace(usage))
+	}
+}
+
+func writeFish(w io.Writer, cmd Command) error {
+	fmt.Fprintf(w, "# %s completion\n", cmd.Name)
+	subs := make([]Command, len(cmd.Subcommands))
+	copy(subs, cmd.Subcommands)
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Name < subs[j].Name })
+	for _, sub := range subs {
+		fmt.Fprintf(w, "complete -c %s -n '__fish_use_subcommand' -f -a %s -d '%s'\n", cmd.Name, sub.Name, fishQuote.Replace(sub.Help))
+	}
+	cond := "__fish_use_subcommand"
+	if len(subs) == 0 {
+		cond = "true"
+	}
+	writeFishFlags(w, cmd.Name, cond, cmd.Flags)
+	for _, sub := range subs {
+		writeFishFlags(w, cmd.Name, "__fish_seen_subcommand_from "+sub.Name, sub.Flags)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package completion_test
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/dbcsv/completion"
+)
+
+func TestWrite(t *testing.T) {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	fs.String("format", "csv", "output format")
+	fs.Bool("header", true, "print the header")
+	fs.String("log-format", "", "log format")
+	sub := completion.Command{Name: "dump", Help: "dump a query"}
+	if !completion.Collect(completion.WithCollect(context.Background(), &sub), map[string][]string{"format": {"csv", "typed"}}, fs) {
+		t.Fatal("Collect returned false")
+	}
+	if completion.Collect(context.Background(), nil, fs) {
+		t.Error("Collect without WithCollect returned true")
+	}
+	cmd := completion.Command{Name: "dbcsv", Subcommands: []completion.Command{sub}}
+	for shell, want := range map[string][]string{
+		"bash": {`dump)`, `-format) values="csv typed" ;;`, `-log-format) values="console json" ;;`, "complete -o bashdefault -o default -F _dbcsv_complete dbcsv"},
+		"zsh":  {"#compdef dbcsv", "bashcompinit"},
+		"fish": {
+			"complete -c dbcsv -n '__fish_use_subcommand' -f -a dump -d 'dump a query'",
+			"complete -c dbcsv -n '__fish_seen_subcommand_from dump' -o format -x -a 'csv typed'",
+			"complete -c dbcsv -n '__fish_seen_subcommand_from dump' -o header -d 'print the header'",
+		},
+	} {
+		var buf strings.Builder
+		if err := completion.Write(&buf, shell, cmd); err != nil {
+			t.Fatalf("%s: %+v", shell, err)
+		}
+		for _, w := range want {
+			if !strings.Contains(buf.String(), w) {
+				t.Errorf("%s: %q is missing from\n%s", shell, w, buf.String())
+			}
+		}
+	}
+	if err := completion.Write(&strings.Builder{}, "tcsh", cmd); err == nil {
+		t.Error("tcsh: wanted error")
+	}
+}
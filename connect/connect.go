@@ -0,0 +1,329 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package connect resolves the database connection strings of the tools:
+// the -connect flag, falling back to the DB_ID, BRUNO_OWNER_ID or BRUNO_ID environment variables,
+// and the named profiles of the config file (~/.dbcsv.yaml, or $DBCSV_CONFIG):
+//
+//	profiles:
+//	  prod:
+//	    connect: "user/passw@prod"
+//	  test:
+//	    connect: "user/${TEST_PASSWORD}@test"
+//	  batch:
+//	    connect: "/@batch"
+//	    tns_admin: /etc/oracle/batch
+//	    wallet: /etc/oracle/wallet
+//	  cloud:
+//	    connect: "user/${CLOUD_PASSWORD}@adb.example.com:1522/svc_high"
+//	    protocol: tcps
+//	    wallet: /etc/oracle/cloud-wallet
+//	    ssl_server_dn_match: true
+//	    ssl_server_cert_dn: "CN=adb.example.com,O=Example,C=US"
+//
+// A "/@alias" connection is externally authenticated (such as by the credentials stored in a wallet),
+// so the password does not appear on the command line or in the environment.
+//
+// A proxy connection (appuser[schema]/passw@sid, or [schema]/@alias externally authenticated)
+// authenticates as appuser, but works as schema - see LogSession.
+//
+// The options of the profile (tns_admin, wallet, ...) are overridden by the explicit flags.
+package connect
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/godror/godror"
+	"gopkg.in/yaml.v3"
+)
+
+// Usage is the usage of the -connect flag.
+const Usage = "user/passw@sid (or /@alias for external authentication, appuser[schema]/passw@sid for a proxy) to connect to, or a profile of ~/.dbcsv.yaml (defaults to $DB_ID, $BRUNO_OWNER_ID or $BRUNO_ID)"
+
+// Config is the config file.
+type Config struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile is a named connection.
+type Profile struct {
+	Connect string `yaml:"connect"`
+	Options `yaml:",inline"`
+}
+
+// Options are the connection options beside the connection string.
+type Options struct {
+	// TNSAdmin is the directory of tnsnames.ora and sqlnet.ora (as $TNS_ADMIN).
+	TNSAdmin string `yaml:"tns_admin"`
+	// Wallet is the directory of the Oracle Wallet.
+	Wallet string `yaml:"wallet"`
+	// Protocol is the protocol of an Easy Connect string: tcp or tcps (TLS).
+	Protocol string `yaml:"protocol"`
+	// SSLServerCertDN is the expected distinguished name of the server's certificate.
+	SSLServerCertDN string `yaml:"ssl_server_cert_dn"`
+	// SSLServerDNMatch enforces the matching of the server's certificate.
+	SSLServerDNMatch bool `yaml:"ssl_server_dn_match"`
+}
+
+// AddFlags adds the -tns-admin, -wallet, -protocol, -ssl-server-dn-match and -ssl-server-cert-dn flags to the FlagSet.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.TNSAdmin, "tns-admin", "", "the directory of tnsnames.ora and sqlnet.ora (defaults to $TNS_ADMIN)")
+	fs.StringVar(&o.Wallet, "wallet", "", "the directory of the Oracle Wallet (for an alias, its sqlnet.ora and tnsnames.ora are used, if -tns-admin is not given)")
+	fs.StringVar(&o.Protocol, "protocol", "", "protocol of an Easy Connect string: tcp or tcps (TLS)")
+	fs.BoolVar(&o.SSLServerDNMatch, "ssl-server-dn-match", false, "check the distinguished name of the server's certificate (TLS)")
+	fs.StringVar(&o.SSLServerCertDN, "ssl-server-cert-dn", "", "the expected distinguished name of the server's certificate (TLS)")
+}
+
+// Args returns the flags (as AddFlags adds them) of the set options.
+func (o Options) Args() []string {
+	var args []string
+	for _, kv := range [][2]string{
+		{"tns-admin", o.TNSAdmin}, {"wallet", o.Wallet}, {"protocol", o.Protocol},
+		{"ssl-server-cert-dn", o.SSLServerCertDN},
+	} {
+		if kv[1] != "" {
+			args = append(args, "-"+kv[0]+"="+kv[1])
+		}
+	}
+	if o.SSLServerDNMatch {
+		args = append(args, "-ssl-server-dn-match")
+	}
+	return args
+}
+
+// merge the unset options with the defaults (SSLServerDNMatch is set if either sets it).
+func (o Options) merge(defaults Options) Options {
+	if o.TNSAdmin == "" {
+		o.TNSAdmin = defaults.TNSAdmin
+	}
+	if o.Wallet == "" {
+		o.Wallet = defaults.Wallet
+	}
+	if o.Protocol == "" {
+		o.Protocol = defaults.Protocol
+	}
+	if o.SSLServerCertDN == "" {
+		o.SSLServerCertDN = defaults.SSLServerCertDN
+	}
+	o.SSLServerDNMatch = o.SSLServerDNMatch || defaults.SSLServerDNMatch
+	return o
+}
+
+// ConfigFile returns the name of the config file: $DBCSV_CONFIG, or ~/.dbcsv.yaml.
+func ConfigFile() string {
+	if fn := os.Getenv("DBCSV_CONFIG"); fn != "" {
+		return fn
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".dbcsv.yaml")
+}
+
+// LoadConfig reads the config file - a missing file is an empty config.
+func LoadConfig(fileName string) (Config, error) {
+	var cfg Config
+	if fileName == "" {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+	if err = yaml.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %q: %w", fileName, err)
+	}
+	return cfg, nil
+}
+
+// Default returns the connection string of the environment: $DB_ID, $BRUNO_OWNER_ID or $BRUNO_ID.
+func Default() string {
+	for _, k := range []string{"DB_ID", "BRUNO_OWNER_ID", "BRUNO_ID"} {
+		if s := os.Getenv(k); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// Resolve returns the profile for s: the Default for the empty string,
+// the profile named s, or s itself - with the environment variables expanded.
+func Resolve(s string) (Profile, error) {
+	if s == "" {
+		s = Default()
+	}
+	cfg, err := LoadConfig(ConfigFile())
+	if err != nil {
+		return Profile{}, err
+	}
+	p, ok := cfg.Profiles[s]
+	if !ok {
+		p.Connect = s
+	}
+	if p.Connect == "" {
+		return p, errors.New("no database connection given (-connect, DB_ID, BRUNO_OWNER_ID or BRUNO_ID)")
+	}
+	p.Connect = os.ExpandEnv(p.Connect)
+	return p, nil
+}
+
+// ParseConnString returns the godror connection parameters for s (as Resolve),
+// with the options (the explicit flags override the profile's).
+func ParseConnString(s string, opts Options) (godror.ConnectionParams, error) {
+	p, err := Resolve(s)
+	if err != nil {
+		return godror.ConnectionParams{}, err
+	}
+	P, err := godror.ParseConnString(p.Connect)
+	if err != nil {
+		return P, fmt.Errorf("parse connection string: %w", err)
+	}
+	if user, schema := ProxyUser(P.Username); user == "" && schema != "" && P.Password.IsZero() {
+		// externally authenticated proxy: the pool cannot be homogeneous
+		P.ExternalAuth, P.Heterogeneous = true, true
+	}
+	// the profile is applied first, then the explicit flags
+	opts = opts.merge(p.Options)
+	if opts.TNSAdmin != "" {
+		P.ConfigDir = opts.TNSAdmin
+	}
+	switch strings.ToLower(opts.Protocol) {
+	case "", "tcp", "tcps":
+	default:
+		return P, fmt.Errorf("unknown protocol %q (wanted tcp or tcps)", opts.Protocol)
+	}
+	if isEasyConnect(P.ConnectString) {
+		P.ConnectString = opts.easyConnect(P.ConnectString)
+	} else {
+		if opts.Protocol != "" || opts.SSLServerDNMatch || opts.SSLServerCertDN != "" {
+			return P, errors.New("the TLS options need an Easy Connect string (host[:port]/service), set them in tnsnames.ora for an alias")
+		}
+		if opts.Wallet != "" && P.ConfigDir == "" {
+			P.ConfigDir = opts.Wallet
+		}
+	}
+	return P, nil
+}
+
+// easyConnect returns the Easy Connect string s with the protocol and the parameters of the options.
+func (o Options) easyConnect(s string) string {
+	if o.Protocol != "" && !strings.Contains(s, "://") {
+		s = strings.ToLower(o.Protocol) + "://" + s
+	}
+	var params []string
+	if o.Wallet != "" {
+		params = append(params, "wallet_location="+o.Wallet)
+	}
+	if o.SSLServerDNMatch {
+		params = append(params, "ssl_server_dn_match=on")
+	}
+	if o.SSLServerCertDN != "" {
+		params = append(params, `ssl_server_cert_dn="`+o.SSLServerCertDN+`"`)
+	}
+	if len(params) == 0 {
+		return s
+	}
+	sep := "?"
+	if strings.Contains(s, "?") {
+		sep = "&"
+	}
+	return s + sep + strings.Join(params, "&")
+}
+
+// isEasyConnect reports whether the connect string is an Easy Connect string (host[:port]/service),
+// not an alias or a descriptor.
+func isEasyConnect(s string) bool {
+	return s != "" && !strings.HasPrefix(strings.TrimSpace(s), "(") && strings.ContainsAny(s, "/:")
+}
+
+// DSN returns the data source name for s (as Resolve) for the driver:
+// the godror connection parameters with the options, or the connection string for the other drivers.
+func DSN(driverName, s string, opts Options) (string, error) {
+	if driverName != "godror" && driverName != "oracle" {
+		p, err := Resolve(s)
+		return p.Connect, err
+	}
+	P, err := ParseConnString(s, opts)
+	if err != nil {
+		return "", err
+	}
+	return P.StringWithPassword(), nil
+}
+
+// Open the Oracle database for s (as ParseConnString).
+func Open(s string, opts Options) (*sql.DB, error) {
+	P, err := ParseConnString(s, opts)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(godror.NewConnector(P)), nil
+}
+
+// ProxyUser splits the user name of a proxy connection (appuser[schema])
+// to the authenticated user and the target schema.
+// The schema is empty for a non-proxy user name.
+func ProxyUser(username string) (user, schema string) {
+	if i := strings.IndexByte(username, '['); i >= 0 && strings.HasSuffix(username, "]") {
+		return username[:i], username[i+1 : len(username)-1]
+	}
+	return username, ""
+}
+
+// Session is the identity of a database session.
+type Session struct {
+	// User is the session user: the target schema of a proxy connection.
+	User string
+	// ProxyUser is the authenticated user of a proxy connection.
+	ProxyUser string
+	// CurrentSchema is the effective schema of the unqualified names.
+	CurrentSchema string
+}
+
+// LogValue implements slog.LogValuer.
+func (s Session) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("user", s.User)}
+	if s.ProxyUser != "" {
+		attrs = append(attrs, slog.String("proxyUser", s.ProxyUser))
+	}
+	return slog.GroupValue(append(attrs, slog.String("currentSchema", s.CurrentSchema))...)
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// CurrentSession returns the identity of the (Oracle) database session.
+func CurrentSession(ctx context.Context, db queryRower) (Session, error) {
+	const qry = `SELECT SYS_CONTEXT('USERENV', 'SESSION_USER'), SYS_CONTEXT('USERENV', 'PROXY_USER'), SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') FROM DUAL`
+	var s Session
+	var proxy sql.NullString
+	if err := db.QueryRowContext(ctx, qry).Scan(&s.User, &proxy, &s.CurrentSchema); err != nil {
+		return s, fmt.Errorf("%s: %w", qry, err)
+	}
+	s.ProxyUser = proxy.String
+	return s, nil
+}
+
+// LogSession logs the identity of the database session, with the effective CURRENT_SCHEMA.
+func LogSession(ctx context.Context, logger *slog.Logger, db queryRower) error {
+	s, err := CurrentSession(ctx, db)
+	if err != nil {
+		return err
+	}
+	logger.Info("connected", "session", s)
+	return nil
+}
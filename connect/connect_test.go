@@ -0,0 +1,101 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package connect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "dbcsv.yaml")
+	if err := os.WriteFile(fn, []byte("profiles:\n  prod:\n    connect: \"user/${PROD_PASSWORD}@prod\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DBCSV_CONFIG", fn)
+	t.Setenv("PROD_PASSWORD", "secret")
+	t.Setenv("DB_ID", "")
+	t.Setenv("BRUNO_OWNER_ID", "")
+	t.Setenv("BRUNO_ID", "bruno/pw@db")
+	for in, want := range map[string]string{
+		"":              "bruno/pw@db",
+		"prod":          "user/secret@prod",
+		"scott/tiger@x": "scott/tiger@x",
+		"/@batch":       "/@batch",
+	} {
+		p, err := Resolve(in)
+		if err != nil {
+			t.Errorf("%q: %+v", in, err)
+		} else if got := p.Connect; got != want {
+			t.Errorf("%q: got %q, wanted %q", in, got, want)
+		}
+	}
+}
+
+func TestParseConnString(t *testing.T) {
+	t.Setenv("DBCSV_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	for _, tc := range []struct {
+		In                       string
+		Opts                     Options
+		ConnectString, ConfigDir string
+		External                 bool
+	}{
+		{In: "/@batch", Opts: Options{Wallet: "/w"}, ConnectString: "batch", ConfigDir: "/w", External: true},
+		{In: "/@batch", Opts: Options{Wallet: "/w", TNSAdmin: "/t"}, ConnectString: "batch", ConfigDir: "/t", External: true},
+		{In: "scott/tiger@db.example.com:1522/svc", Opts: Options{Wallet: "/w"}, ConnectString: "db.example.com:1522/svc?wallet_location=/w"},
+		{In: "app[scott]/passw@db", ConnectString: "db"},
+		{In: "scott/tiger@db.example.com:1522/svc", Opts: Options{Protocol: "tcps", Wallet: "/w", SSLServerDNMatch: true, SSLServerCertDN: "CN=db,O=Example"},
+			ConnectString: `tcps://db.example.com:1522/svc?wallet_location=/w&ssl_server_dn_match=on&ssl_server_cert_dn="CN=db,O=Example"`},
+		{In: "[scott]/@batch", ConnectString: "batch", External: true},
+	} {
+		P, err := ParseConnString(tc.In, tc.Opts)
+		if err != nil {
+			t.Errorf("%q: %+v", tc.In, err)
+			continue
+		}
+		if P.ConnectString != tc.ConnectString || P.ConfigDir != tc.ConfigDir {
+			t.Errorf("%q: got %q, %q, wanted %q, %q", tc.In, P.ConnectString, P.ConfigDir, tc.ConnectString, tc.ConfigDir)
+		}
+		if external := P.ExternalAuth || P.Username == "" && P.Password.IsZero(); external != tc.External {
+			t.Errorf("%q: got external=%t, wanted %t", tc.In, external, tc.External)
+		}
+	}
+}
+
+func TestParseConnStringProfile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "dbcsv.yaml")
+	if err := os.WriteFile(fn, []byte("profiles:\n  batch:\n    connect: \"/@batch\"\n    tns_admin: /profile\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DBCSV_CONFIG", fn)
+	for _, tc := range []struct {
+		Opts      Options
+		ConfigDir string
+	}{
+		{ConfigDir: "/profile"},
+		{Opts: Options{TNSAdmin: "/flag"}, ConfigDir: "/flag"},
+		{Opts: Options{Wallet: "/w"}, ConfigDir: "/profile"},
+	} {
+		P, err := ParseConnString("batch", tc.Opts)
+		if err != nil {
+			t.Errorf("%+v: %+v", tc.Opts, err)
+		} else if P.ConfigDir != tc.ConfigDir {
+			t.Errorf("%+v: got %q, wanted %q", tc.Opts, P.ConfigDir, tc.ConfigDir)
+		}
+	}
+}
+
+func TestProxyUser(t *testing.T) {
+	for in, want := range map[string][2]string{
+		"scott":      {"scott", ""},
+		"app[scott]": {"app", "scott"},
+		"[scott]":    {"", "scott"},
+	} {
+		if user, schema := ProxyUser(in); user != want[0] || schema != want[1] {
+			t.Errorf("%q: got %q, %q, wanted %q", in, user, schema, want)
+		}
+	}
+}
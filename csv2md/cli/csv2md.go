@@ -0,0 +1,276 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cli is the csv2md command: it prints a CSV or a spreadsheet as a Markdown (AsciiDoc, reStructuredText) table.
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/renameio/v2"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/completion"
+	csvload "github.com/UNO-SOFT/dbcsv/csvload/lib"
+)
+
+// Main runs the command with the arguments (args[0] is the name of the program).
+func Main(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	// the CSV is read once, so can be streamed from stdin
+	cfg := dbcsv.Config{Stream: true}
+	fs.IntVar(&cfg.Sheet, "sheet", -1, "the (0-based) index of the sheet to convert (by default, all)")
+	fs.StringVar(&cfg.Delim, "delim", "", "CSV separator")
+	fs.StringVar(&cfg.Charset, "charset", "", "input charset (detected by default)")
+	fs.IntVar(&cfg.Skip, "skip", 0, "skip rows")
+	flagMaxWidth := fs.Int("max-width", 0, "truncate the cell values longer than this many characters")
+	flagEllipsis := fs.String("ellipsis", "…", "the suffix of the truncated values")
+	flagFormat := fs.String("format", "md", "output format: md (Markdown), adoc (AsciiDoc) or rst (reStructuredText)")
+	flagNoHeader := fs.Bool("no-header", false, "the first row is data, too (the header is Col1..ColN)")
+	flagHeaderRow := fs.Int("header-row", 1, "the (1-based) number of the header row among the read (non-empty) rows, the rows before it are dropped")
+	flagTranspose := fs.Bool("transpose", false, "print the columns as rows (field name, then the value of each record)")
+	flagOut := fs.String("o", "-", "output file (written atomically)")
+	flagVersion := fs.Bool("version", false, "print the version and exit")
+	if completion.Collect(ctx, map[string][]string{"format": {"md", "adoc", "rst"}}, fs) {
+		return nil
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *flagVersion {
+		fmt.Println(dbcsv.Version())
+		return nil
+	}
+	ctx, stop := dbcsv.Wrap(ctx)
+	defer stop()
+
+	switch *flagFormat {
+	case "md", "adoc", "rst":
+	default:
+		return fmt.Errorf("unknown format %q (wanted md, adoc or rst)", *flagFormat)
+	}
+
+	if *flagHeaderRow < 1 {
+		return fmt.Errorf("-header-row=%d: must be at least 1", *flagHeaderRow)
+	}
+
+	fh := io.WriteCloser(os.Stdout)
+	if !(*flagOut == "" || *flagOut == "-") {
+		pfh, err := renameio.NewPendingFile(*flagOut, renameio.WithPermissions(0640))
+		if err != nil {
+			return fmt.Errorf("%s: %w", *flagOut, err)
+		}
+		defer pfh.Cleanup()
+		fh = pfh
+	}
+	defer fh.Close()
+	bw := bufio.NewWriter(fh)
+
+	if err := cfg.OpenContext(ctx, fs.Arg(0)); err != nil {
+		return err
+	}
+	defer cfg.Close()
+	typ, err := cfg.Type()
+	if err != nil {
+		return err
+	}
+	isSheet := typ.Type == dbcsv.Xls || typ.Type == dbcsv.XlsX || typ.Type == dbcsv.Ods
+	sheets := []int{cfg.Sheet}
+	if cfg.Sheet < 0 {
+		if !isSheet {
+			sheets[0] = 0
+		} else {
+			m, err := cfg.ReadSheets(ctx)
+			if err != nil {
+				return err
+			}
+			// the sheets are read by their (0-based) index
+			sheets = sheets[:0]
+			for k := range len(m) {
+				sheets = append(sheets, k)
+			}
+		}
+	}
+	// the rows of the sheet are collected, to know the type of the columns before the separator row
+	var rows [][]string
+	for _, k := range sheets {
+		cfg.Sheet = k
+		var sheet string
+		rows = rows[:0]
+		if err := cfg.ReadRows(ctx,
+			func(ctx context.Context, sheetName string, row dbcsv.Row) error {
+				if isSheet {
+					sheet = sheetName
+				}
+				rows = append(rows, append([]string(nil), row.Values...))
+				return nil
+			},
+		); err != nil {
+			return err
+		}
+		rows = setHeader(rows, *flagHeaderRow, *flagNoHeader)
+		if *flagTranspose {
+			rows = transpose(rows)
+		}
+		// the numeric columns are detected before the truncation, as "1234…" is not a number
+		numeric := numericColumns(rows[min(1, len(rows)):])
+		for _, row := range rows {
+			for i, v := range row {
+				row[i] = truncate(v, *flagMaxWidth, *flagEllipsis)
+			}
+		}
+		if err := printTable(bw, *flagFormat, sheet, rows, numeric); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if pfh, ok := fh.(*renameio.PendingFile); ok {
+		return pfh.CloseAtomicallyReplace()
+	}
+	return fh.Close()
+}
+
+// printTable prints the rows of the sheet as a table in the format (md, adoc or rst), the first row as the header.
+// The numeric columns are right-aligned.
+func printTable(w io.Writer, format, sheetName string, rows [][]string, numeric []bool) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	switch format {
+	case "adoc":
+		return printAsciiDoc(w, sheetName, trimEmptyRows(rows), numeric)
+	case "rst":
+		return printRST(w, sheetName, trimEmptyRows(rows))
+	}
+	return printMarkdown(w, sheetName, rows, numeric)
+}
+
+// printMarkdown prints the rows as a Markdown table.
+func printMarkdown(w io.Writer, sheetName string, rows [][]string, numeric []bool) error {
+	io.WriteString(w, "# "+sheetName+"\n")
+	var buf bytes.Buffer
+	var emptyRows []string
+	for i, row := range rows {
+		buf.Reset()
+		if err := printRow(&buf, row); err != nil {
+			return err
+		}
+		if bytes.IndexFunc(buf.Bytes(), func(r rune) bool { return !(r == '|' || r == ' ' || r == '-' || r == '\n') }) < 0 {
+			// empty row
+			emptyRows = append(emptyRows, buf.String())
+			continue
+		}
+		for _, s := range emptyRows {
+			io.WriteString(w, s)
+		}
+		emptyRows = emptyRows[:0]
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		if i == 0 {
+			// the separator row
+			buf.Reset()
+			for j, v := range row {
+				if j == 0 {
+					buf.WriteByte('|')
+				}
+				n := len(quote.Replace(v))
+				if j < len(numeric) && numeric[j] {
+					buf.WriteString(" " + strings.Repeat("-", max(n-1, 1)) + ": |")
+				} else {
+					buf.WriteString(" " + strings.Repeat("-", n) + " |")
+				}
+			}
+			buf.WriteByte('\n')
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setHeader drops the rows before the headerRow (1-based),
+// and prepends a Col1..ColN header if noHeader.
+func setHeader(rows [][]string, headerRow int, noHeader bool) [][]string {
+	rows = rows[min(headerRow-1, len(rows)):]
+	if !noHeader || len(rows) == 0 {
+		return rows
+	}
+	var n int
+	for _, row := range rows {
+		n = max(n, len(row))
+	}
+	header := make([]string, n)
+	for i := range header {
+		header[i] = "Col" + strconv.Itoa(i+1)
+	}
+	return append([][]string{header}, rows...)
+}
+
+// numericColumns reports which columns have only numbers (or empty values), at least one.
+func numericColumns(rows [][]string) []bool {
+	var numeric, seen []bool
+	for _, row := range rows {
+		for len(numeric) < len(row) {
+			numeric, seen = append(numeric, true), append(seen, false)
+		}
+		for i, v := range row {
+			if !numeric[i] {
+				continue
+			}
+			switch csvload.TypeOf(strings.TrimSpace(v), false) {
+			case csvload.Unknown:
+			case csvload.Int, csvload.Float:
+				seen[i] = true
+			default:
+				numeric[i] = false
+			}
+		}
+	}
+	for i := range numeric {
+		numeric[i] = numeric[i] && seen[i]
+	}
+	return numeric
+}
+
+// truncate the string to maxWidth characters (with the ellipsis), if maxWidth is positive.
+func truncate(s string, maxWidth int, ellipsis string) string {
+	if maxWidth <= 0 || utf8.RuneCountInString(s) <= maxWidth {
+		return s
+	}
+	n := max(maxWidth-utf8.RuneCountInString(ellipsis), 0)
+	for i := range s {
+		if n == 0 {
+			return s[:i] + ellipsis
+		}
+		n--
+	}
+	return s + ellipsis
+}
+
+var quote = strings.NewReplacer("|", "&#124;", "\n", "<br/>")
+
+func printRow(w io.Writer, row []string) error {
+	for i, v := range row {
+		if i == 0 {
+			w.Write([]byte("|"))
+		}
+		io.WriteString(w, " "+quote.Replace(v))
+		w.Write([]byte(" |"))
+	}
+	_, err := w.Write([]byte("\n"))
+	return err
+}
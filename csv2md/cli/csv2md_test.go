@@ -0,0 +1,84 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		In       string
+		MaxWidth int
+		Ellipsis string
+		Want     string
+	}{
+		{"abcdef", 0, "…", "abcdef"},
+		{"abcdef", 6, "…", "abcdef"},
+		{"abcdef", 5, "…", "abcd…"},
+		{"árvíztűrő", 4, "…", "árv…"},
+		{"abcdef", 4, "...", "a..."},
+		{"abcdef", 2, "...", "..."},
+		{"abcdef", 3, "", "abc"},
+	} {
+		if got := truncate(tc.In, tc.MaxWidth, tc.Ellipsis); got != tc.Want {
+			t.Errorf("%q/%d/%q: got %q, wanted %q", tc.In, tc.MaxWidth, tc.Ellipsis, got, tc.Want)
+		}
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	rows := [][]string{{"title"}, {"a", "b"}, {"1", "2", "3"}}
+	for _, tc := range []struct {
+		HeaderRow int
+		NoHeader  bool
+		Want      [][]string
+	}{
+		{1, false, rows},
+		{2, false, rows[1:]},
+		{5, false, [][]string{}},
+		{2, true, [][]string{{"Col1", "Col2", "Col3"}, {"a", "b"}, {"1", "2", "3"}}},
+		{5, true, [][]string{}},
+	} {
+		if got := setHeader(rows, tc.HeaderRow, tc.NoHeader); !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%d/%t: got %q, wanted %q", tc.HeaderRow, tc.NoHeader, got, tc.Want)
+		}
+	}
+}
+
+func TestNumericColumns(t *testing.T) {
+	got := numericColumns([][]string{
+		{"1", "a", "", "3.14", "2024-03-15", "1"},
+		{" 2 ", "3", "", "", "1", "x"},
+		{"10", "", "", "1.5"},
+	})
+	if want := []bool{true, false, false, true, false, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	if got := numericColumns(nil); len(got) != 0 {
+		t.Errorf("got %v for no rows", got)
+	}
+}
+
+func TestMainTruncated(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.csv"), filepath.Join(dir, "out.md")
+	if err := os.WriteFile(in, []byte("id;description\n1234567;a long description\n42;short\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main(context.Background(), []string{"csv2md", "-max-width=5", "-delim=;", "-o", out, in}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the truncated numbers are still right-aligned
+	golden(t, "truncated.md", b)
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// transpose returns the columns as rows: the header ("field", then "value" or the number of the record),
+// then the name of each field with its value in each record.
+func transpose(rows [][]string) [][]string {
+	if len(rows) == 0 {
+		return rows
+	}
+	rows = trimEmptyRows(rows)
+	header := make([]string, len(rows))
+	header[0] = "field"
+	if len(rows) == 2 {
+		header[1] = "value"
+	} else {
+		for i := 1; i < len(rows); i++ {
+			header[i] = strconv.Itoa(i)
+		}
+	}
+	transposed := make([][]string, 1, len(rows[0])+1)
+	transposed[0] = header
+	for j := range rows[0] {
+		row := make([]string, len(rows))
+		for i := range rows {
+			row[i] = rows[i][j]
+		}
+		transposed = append(transposed, row)
+	}
+	return transposed
+}
+
+// trimEmptyRows returns the rows without the trailing empty ones,
+// each padded to the same number of columns.
+func trimEmptyRows(rows [][]string) [][]string {
+	for len(rows) > 1 && isEmptyRow(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+	var n int
+	for _, row := range rows {
+		n = max(n, len(row))
+	}
+	for i, row := range rows {
+		for len(row) < n {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+func isEmptyRow(row []string) bool {
+	for _, v := range row {
+		if strings.Trim(v, " -") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+var adocQuote = strings.NewReplacer("|", "\\|", "\n", " +\n")
+
+// printAsciiDoc prints the rows as an AsciiDoc table.
+func printAsciiDoc(w io.Writer, sheetName string, rows [][]string, numeric []bool) error {
+	if sheetName != "" {
+		io.WriteString(w, "== "+sheetName+"\n\n")
+	}
+	cols := make([]string, len(rows[0]))
+	for i := range cols {
+		cols[i] = "<"
+		if i < len(numeric) && numeric[i] {
+			cols[i] = ">"
+		}
+	}
+	io.WriteString(w, `[cols="`+strings.Join(cols, ",")+`",options="header"]`+"\n|===\n")
+	for _, row := range rows {
+		for i, v := range row {
+			if i != 0 {
+				io.WriteString(w, " ")
+			}
+			io.WriteString(w, "|"+adocQuote.Replace(v))
+		}
+		io.WriteString(w, "\n")
+	}
+	_, err := io.WriteString(w, "|===\n\n")
+	return err
+}
+
+var rstQuote = strings.NewReplacer("\\", "\\\\", "*", "\\*", "`", "\\`", "|", "\\|", "_", "\\_", "\n", "\n       ")
+
+// printRST prints the rows as a reStructuredText list-table.
+func printRST(w io.Writer, sheetName string, rows [][]string) error {
+	if sheetName != "" {
+		io.WriteString(w, sheetName+"\n"+strings.Repeat("=", len([]rune(sheetName)))+"\n\n")
+	}
+	io.WriteString(w, ".. list-table::\n   :header-rows: 1\n\n")
+	for _, row := range rows {
+		for i, v := range row {
+			prefix := "     - "
+			if i == 0 {
+				prefix = "   * - "
+			}
+			io.WriteString(w, strings.TrimRight(prefix+rstQuote.Replace(v), " ")+"\n")
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var flagUpdate = flag.Bool("update", false, "update the golden files in testdata")
+
+// golden compares got with the content of testdata/name (or writes it, with -update).
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	fn := filepath.Join("testdata", name)
+	if *flagUpdate {
+		if err := os.WriteFile(fn, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: got\n%s\nwanted\n%s", name, got, want)
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		In, Want [][]string
+	}{
+		{"empty", nil, nil},
+		{"one record",
+			[][]string{{"a", "b", "c"}, {"1", "2"}, {"", " - "}},
+			[][]string{{"field", "value"}, {"a", "1"}, {"b", "2"}, {"c", ""}}},
+		{"records",
+			[][]string{{"a", "b"}, {"1", "2"}, {"3", "4"}},
+			[][]string{{"field", "1", "2"}, {"a", "1", "3"}, {"b", "2", "4"}}},
+		{"header only",
+			[][]string{{"a", "b"}},
+			[][]string{{"field"}, {"a"}, {"b"}}},
+	} {
+		if got := transpose(tc.In); !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%s: got %q, wanted %q", tc.Name, got, tc.Want)
+		}
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	for _, format := range []string{"md", "adoc", "rst"} {
+		rows := [][]string{
+			{"id", "name", "amount"},
+			{"1", "alma|körte", "3.14"},
+			{"2", "a*b_c`x`\nd", ""},
+			{"", "", ""},
+			{"3", "", "12.5"},
+			{"", "", ""},
+		}
+		var buf bytes.Buffer
+		if err := printTable(&buf, format, "Sheet 1", rows, numericColumns(rows[1:])); err != nil {
+			t.Fatal(err)
+		}
+		golden(t, "table."+format, buf.Bytes())
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package main in csv2md prints a CSV or a spreadsheet as a Markdown table.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/UNO-SOFT/dbcsv/csv2md/cli"
+)
+
+func main() {
+	// the interrupts are handled by cli.Main
+	if err := cli.Main(context.Background(), os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
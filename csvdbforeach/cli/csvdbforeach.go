@@ -0,0 +1,386 @@
+// Copyright 2020 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cli is the csvdbforeach command: it calls a database procedure with each row of the files.
+package cli
+
+// nosemgrep: go.lang.security.audit.xss.import-text-template.import-text-template
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/completion"
+	"github.com/UNO-SOFT/dbcsv/connect"
+	"github.com/UNO-SOFT/dbcsv/tracing"
+	"github.com/UNO-SOFT/zlog/v2"
+
+	_ "github.com/godror/godror"
+)
+
+var (
+	stdout = io.Writer(os.Stdout)
+	stderr = io.Writer(os.Stderr)
+
+	logCfg dbcsv.LogConfig
+	logger = zlog.NewLogger(zlog.MaybeConsoleHandler(&logCfg, os.Stderr)).SLog()
+)
+
+// Main runs the command with the arguments (args[0] is the name of the program).
+func Main(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	if lang := os.Getenv("LANG"); lang != "" {
+		if i := strings.LastIndex(lang, "."); i >= 0 {
+			lang = lang[i+1:]
+			enc, err := htmlindex.Get(lang)
+			if err != nil {
+				return fmt.Errorf("get encoding for %q: %w", lang, err)
+			}
+			stdout = transform.NewWriter(stdout, enc.NewEncoder())
+			stderr = transform.NewWriter(stderr, enc.NewEncoder())
+		}
+	}
+
+	// the CSV is read once, so can be streamed from stdin
+	cfg := dbcsv.Config{Stream: true}
+	fs.IntVar(&cfg.Sheet, "sheet", 0, "Index of sheet to convert, zero based")
+	flagConnect := fs.String("connect", "", connect.Usage)
+	var connOpts connect.Options
+	connOpts.AddFlags(fs)
+	flagFunc := fs.String("call", "DBMS_OUTPUT.PUT_LINE", "function name to be called with each line")
+	flagSQL := fs.String("sql", "", "DML to execute with each line instead of -call, with :1, :2... placeholders, or text/template with the header's names ({{.id}})")
+	flagFixParams := fs.String("fix", "p_file_name=>{{.FileName}}", "fix parameters to add; uses text/template")
+	flagFuncRetOk := fs.String("call-ret-ok", "0", "OK return values, separated by comma, may contain ranges (0,1,100-199)")
+	flagFuncRetWarn := fs.String("call-ret-warn", "", "return values (as -call-ret-ok) which are just logged as warnings, without a rollback")
+	flagOneTx := fs.Bool("one-tx", true, "one transaction, or commit after each row")
+	flagMapByHeader := fs.Bool("map-by-header", false, "match the header row's names to the argument names, instead of the column order")
+	flagSavepoints := fs.Bool("savepoints", false, "wrap each call in a savepoint, and on failure roll back only that row, writing it into -reject")
+	flagReject := fs.String("reject", "", "write the failed rows into this CSV file")
+	flagProgress := fs.Duration("progress", 30*time.Second, "log the progress this often (0 to disable)")
+	flagRetries := fs.Int("retry", 3, "retry the call this many times on transient errors (deadlock, package state discarded, lost connection)")
+	flagRetryBackoff := fs.Duration("retry-backoff", time.Second, "wait this long before the first retry, doubled each time")
+	flagJSONSummary := fs.String("json-summary", "", "write the totals (processed, ok, failed, return codes, duration) as JSON into this file (- for stdout)")
+	flagJustPrint := fs.Bool("just-print", false, "just print the PL/SQL block and the converted bind values of each row, without executing")
+	flagCommitRows := fs.Int("commit-rows", 0, "commit after every N rows (a failing row rolls back the uncommitted ones and stops)")
+	flagBulk := fs.Int("bulk", 0, "bind this many rows at once as PL/SQL arrays, calling the function in a loop (no OUT arguments)")
+	flagOutCSV := fs.String("out-csv", "", "write the key columns, the return code and the OUT parameters of each call into this CSV file")
+	flagOutKeys := fs.String("out-keys", "", "input column numbers to write into -out-csv, separated by comma, starts with 1 (default all)")
+	fs.StringVar(&cfg.Delim, "d", "", "Delimiter to use between fields")
+	fs.StringVar(&cfg.Charset, "charset", "", "input charset (detected by default)")
+	fs.IntVar(&cfg.Skip, "skip", 1, "skip first N rows")
+	fs.IntVar(&cfg.Offset, "offset", 0, "skip this many data rows after the header")
+	fs.IntVar(&cfg.MaxRows, "max-rows", 0, "process at most this many data rows (0 for all)")
+	fs.StringVar(&cfg.ColumnsString, "columns", "", "column numbers (or ranges, such as 1-5,8,12-) to use, separated by comma, in param order, starts with 1")
+	fs.StringVar(&cfg.Filter, "filter", "", `process only the rows this (Starlark) boolean expression of the header's names is true for, such as 'STATUS == "A" and len(col(3)) > 0'`)
+	logCfg.AddFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `%s
+
+	The specified code will be called with the cells as (string) arguments
+	(except dates, where DATE will be provided), for each row.
+
+Usage:
+	%s [flags] <xlsx/xls/csv-to-be-read>...
+
+	The files (or glob patterns) are processed sequentially, each with its own {{.FileName}}.
+`, args[0], args[0])
+		fs.PrintDefaults()
+	}
+
+	flagVersion := fs.Bool("version", false, "print the version and exit")
+	if completion.Collect(ctx, nil, fs) {
+		return nil
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *flagVersion {
+		fmt.Println(dbcsv.Version())
+		return nil
+	}
+	h, err := logCfg.Handler(os.Stderr, "csvdbforeach")
+	if err != nil {
+		return err
+	}
+	logger = slog.New(h)
+	ctx, stop := dbcsv.WrapLogger(ctx, logger)
+	defer stop()
+	shutdown, err := tracing.Init(ctx, "csvdbforeach")
+	if err != nil {
+		return err
+	}
+	defer shutdown(context.WithoutCancel(ctx))
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("the file names are needed")
+	}
+	headerMapped := *flagMapByHeader || strings.Contains(*flagSQL, "{{")
+	if headerMapped && cfg.ColumnsString != "" {
+		return errors.New("-map-by-header (or -sql template) and -columns are mutually exclusive")
+	}
+	// the last skipped row is the header: it is read for the -filter, -offset and -max-rows, too,
+	// then dropped, if not mapped; with -skip 0, there is no header (except for the mapping)
+	var dropHeader bool
+	if cfg.Skip > 0 {
+		cfg.Skip--
+		dropHeader = !headerMapped
+	} else {
+		cfg.NoHeader = !headerMapped
+	}
+
+	slog.SetDefault(logger)
+
+	fileNames, err := expandFileNames(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = zlog.NewSContext(ctx, logger)
+
+	db, err := connect.Open(*flagConnect, connOpts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err = connect.LogSession(ctx, logger, db); err != nil {
+		return err
+	}
+
+	ec := execConfig{
+		Func:  *flagFunc,
+		OneTx: *flagOneTx, CommitRows: *flagCommitRows, Bulk: *flagBulk,
+		JustPrint: *flagJustPrint, MapByHeader: *flagMapByHeader,
+		Savepoints: *flagSavepoints, SQL: *flagSQL,
+		Stats:   new(execStats),
+		Retries: *flagRetries, RetryBackoff: *flagRetryBackoff,
+	}
+	if ec.RetOk, err = parseRetCodes(*flagFuncRetOk); err != nil {
+		return fmt.Errorf("-call-ret-ok: %w", err)
+	}
+	if ec.RetWarn, err = parseRetCodes(*flagFuncRetWarn); err != nil {
+		return fmt.Errorf("-call-ret-warn: %w", err)
+	}
+	if *flagOutKeys != "" {
+		for _, x := range strings.Split(*flagOutKeys, ",") {
+			i, err := strconv.Atoi(strings.TrimSpace(x))
+			if err != nil || i < 1 {
+				return fmt.Errorf("bad -out-keys column %q", x)
+			}
+			ec.OutKeys = append(ec.OutKeys, i-1)
+		}
+	}
+	var outFh *os.File
+	if *flagOutCSV != "" {
+		if outFh, err = os.Create(*flagOutCSV); err != nil {
+			return err
+		}
+		defer outFh.Close()
+		ec.OutCSV = csv.NewWriter(outFh)
+	}
+	var rejectFh *os.File
+	if *flagReject != "" {
+		if rejectFh, err = os.Create(*flagReject); err != nil {
+			return err
+		}
+		defer rejectFh.Close()
+		ec.Reject = csv.NewWriter(rejectFh)
+	}
+
+	var n int
+	var current atomic.Pointer[dbcsv.Config]
+	start := time.Now()
+	if *flagProgress > 0 && !ec.JustPrint {
+		progressCtx, progressCancel := context.WithCancel(ctx)
+		defer progressCancel()
+		go reportProgress(progressCtx, *flagProgress, ec.Stats, func() (int64, int64, error) {
+			if cfg := current.Load(); cfg != nil {
+				return cfg.Position()
+			}
+			return 0, 0, nil
+		})
+	}
+	for _, fn := range fileNames {
+		var fileN int
+		fileStart := time.Now()
+		fileN, err = func() (int, error) {
+			var err error
+			if ec.FixParams, err = fixParamsFor(*flagFixParams, fn); err != nil {
+				return 0, err
+			}
+			fileCfg := cfg
+			if err = fileCfg.OpenContext(ctx, fn); err != nil {
+				return 0, err
+			}
+			defer fileCfg.Close()
+			current.Store(&fileCfg)
+			defer current.Store(nil)
+			fileCtx, span := tracing.Start(ctx, "file", attribute.String("file", fn))
+			n, err := processFile(fileCtx, db, ec, &fileCfg, dropHeader)
+			tracing.End(span, err, attribute.Int("rows", n))
+			return n, err
+		}()
+		n += fileN
+		logger.Info("file processed", "file", fn, "rows", fileN, "duration", time.Since(fileStart).String(), "error", err)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", fn, err)
+			break
+		}
+	}
+	if ec.OutCSV != nil {
+		ec.OutCSV.Flush()
+		if flushErr := ec.OutCSV.Error(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+		if closeErr := outFh.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if ec.Reject != nil {
+		ec.Reject.Flush()
+		if flushErr := ec.Reject.Error(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+		if closeErr := rejectFh.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	d := time.Since(start)
+	level := slog.LevelInfo
+	if ctx.Err() != nil { // interrupted: the processed rows are committed
+		level = slog.LevelWarn
+	}
+	logger.Log(ctx, level, "processed", "rows", n, "ok", ec.Stats.OK.Load(), "failed", ec.Stats.Failed.Load(),
+		"duration", d.String(), "rowsPerSec", int64(float64(n)/d.Seconds()), "error", err)
+	if *flagJSONSummary != "" {
+		if sumErr := ec.Stats.writeSummary(*flagJSONSummary, n, d, err); sumErr != nil {
+			logger.Error("write summary", "file", *flagJSONSummary, "error", sumErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("exec %q: %w", *flagFunc, err)
+	}
+	return nil
+}
+
+// expandFileNames expands the glob patterns among the arguments.
+func expandFileNames(args []string) ([]string, error) {
+	fileNames := make([]string, 0, len(args))
+	for _, a := range args {
+		if _, err := os.Stat(a); err == nil || !strings.ContainsAny(a, "*?[") {
+			fileNames = append(fileNames, a)
+			continue
+		}
+		matches, err := filepath.Glob(a)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", a, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%q: no such file", a)
+		}
+		fileNames = append(fileNames, matches...)
+	}
+	return fileNames, nil
+}
+
+// fixParamsFor returns the fix parameters, executing their templates with the file name.
+func fixParamsFor(spec, fileName string) ([][2]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	ctxData := struct {
+		FileName string
+	}{FileName: fileName}
+	var fixParams [][2]string
+	var buf bytes.Buffer
+	for _, tup := range strings.Split(spec, ",") {
+		parts := strings.SplitN(tup, "=>", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad fix parameter %q (wanted name=>value)", tup)
+		}
+		tpl, err := template.New(parts[0]).Parse(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", tup, err)
+		}
+		buf.Reset()
+		if err := tpl.Execute(&buf, ctxData); err != nil {
+			return nil, err
+		}
+		fixParams = append(fixParams, [2]string{parts[0], buf.String()})
+	}
+	return fixParams, nil
+}
+
+// processFile reads the rows of the opened file (without the first one if dropHeader) and calls dbExec with them.
+func processFile(ctx context.Context, db *sql.DB, ec execConfig, cfg *dbcsv.Config, dropHeader bool) (int, error) {
+	// the rows are read with the columns already selected
+	if _, err := cfg.Columns(); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows := make(chan dbcsv.Row, 8)
+	grp, grpCtx := errgroup.WithContext(ctx)
+	grp.Go(func() error {
+		defer close(rows)
+		return cfg.ReadRows(grpCtx,
+			func(ctx context.Context, _ string, row dbcsv.Row) error {
+				logger.Debug("read", "row", row)
+				if dropHeader {
+					dropHeader = false
+					return nil
+				}
+				// filter out empty rows
+				empty := true
+				for _, s := range row.Values {
+					if s != "" {
+						empty = false
+						break
+					}
+				}
+				if empty {
+					return nil
+				}
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case rows <- row:
+					logger.Debug("filtered", "row", row)
+				}
+				return nil
+			},
+		)
+	})
+	n, err := dbExec(ctx, db, ec, rows)
+	if err != nil {
+		cancel() // stop the reader
+		_ = grp.Wait()
+		return n, err
+	}
+	return n, grp.Wait()
+}
+
+// vim: set fileencoding=utf-8 noet:
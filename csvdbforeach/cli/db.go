@@ -0,0 +1,1159 @@
+// Copyright 2020 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/godror/godror"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/tracing"
+)
+
+const (
+	DateFormat     = "20060102"
+	DateTimeFormat = "20060102150405"
+)
+
+func safeConvert(conv func(string) (interface{}, error), s string) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			if err, ok = r.(error); !ok {
+				err = fmt.Errorf("PANIC: %v", r)
+			}
+		}
+	}()
+	return conv(s)
+}
+
+// execConfig is the configuration of dbExec.
+type execConfig struct {
+	Func      string
+	FixParams [][2]string
+	// RetOk are the OK return codes, RetWarn are the return codes which are just logged, without a rollback.
+	RetOk, RetWarn retCodes
+	OneTx          bool
+	// CommitRows is the number of rows to commit at once, overriding OneTx if positive.
+	CommitRows int
+	// Bulk is the number of rows bound at once, as PL/SQL associative arrays.
+	Bulk int
+	// OutCSV receives a row for each call: the line number, the key columns,
+	// the return code and the OUT parameters.
+	OutCSV *csv.Writer
+	// SQL is a DML statement to execute for each row, instead of calling Func.
+	// If it is a text/template, the {{.column}} references of the header row's names
+	// are replaced by the placeholders of the column.
+	SQL string
+	// MapByHeader matches the first row's names to the argument names, instead of using the column order.
+	MapByHeader bool
+	// JustPrint prints the statement and the converted values of each row, without executing them.
+	JustPrint bool
+	// Savepoints wraps each call in a savepoint, and rolls back only that on failure,
+	// so a failing row does not roll back the whole transaction.
+	Savepoints bool
+	// Reject receives the failed rows: the line number, the error or return code and the values.
+	Reject *csv.Writer
+	// Retries is the number of re-executions on transient errors (deadlock, discarded package state, lost connection),
+	// waiting RetryBackoff, doubled after each try.
+	Retries      int
+	RetryBackoff time.Duration
+	// Stats counts the OK and failed rows, if not nil.
+	Stats *execStats
+	// OutKeys are the indexes of the input columns written to OutCSV (all if nil).
+	OutKeys []int
+}
+
+func dbExec(ctx context.Context, db *sql.DB, cfg execConfig, rows <-chan dbcsv.Row) (int, error) {
+	var st Statement
+	var err error
+	if cfg.SQL == "" {
+		st, err = getQuery(db, cfg.Func, cfg.FixParams)
+	} else if !strings.Contains(cfg.SQL, "{{") {
+		st = sqlStatement(cfg.SQL)
+	} else {
+		hdr, ok := <-rows
+		if !ok {
+			return 0, nil
+		}
+		qry, binds, err := expandSQLTemplate(cfg.SQL, hdr.Values)
+		if err != nil {
+			return 0, err
+		}
+		st = sqlStatement(qry)
+		idx, err := bindMapping(hdr.Values, binds, st.ArgNames)
+		if err != nil {
+			return 0, err
+		}
+		logger.Info("sql template", "qry", qry, "header", hdr.Values, "indexes", idx)
+		rows = remapRows(rows, idx)
+		cfg.MapByHeader = false
+	}
+	if err != nil {
+		return 0, err
+	}
+	if cfg.MapByHeader {
+		hdr, ok := <-rows
+		if !ok {
+			return 0, nil
+		}
+		idx, err := headerMapping(hdr.Values, st.ArgNames)
+		if err != nil {
+			return 0, err
+		}
+		logger.Info("map by header", "header", hdr.Values, "args", st.ArgNames, "indexes", idx)
+		rows = remapRows(rows, idx)
+	}
+	var (
+		stmt     *sql.Stmt
+		tx       *sql.Tx
+		values   = make([]interface{}, 0, st.ParamCount)
+		startIdx int
+		ret      int64
+		n        int
+		buf      bytes.Buffer
+	)
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	if st.Returns {
+		values = append(values, &ret)
+		startIdx = 1
+	}
+	var outRecord []string
+	writeOut := func(row dbcsv.Row, ret string) error {
+		if cfg.OutCSV == nil {
+			return nil
+		}
+		keys := row.Values
+		if cfg.OutKeys != nil {
+			keys = make([]string, len(cfg.OutKeys))
+			for i, j := range cfg.OutKeys {
+				if j < len(row.Values) {
+					keys[i] = row.Values[j]
+				}
+			}
+		}
+		if outRecord == nil {
+			outRecord = append(outRecord, "line")
+			for i := range keys {
+				j := i
+				if cfg.OutKeys != nil {
+					j = cfg.OutKeys[i]
+				}
+				outRecord = append(outRecord, fmt.Sprintf("col%d", j+1))
+			}
+			outRecord = append(append(outRecord, "ret"), st.OutNames...)
+			if err := cfg.OutCSV.Write(outRecord); err != nil {
+				return err
+			}
+		}
+		outRecord = append(append(append(outRecord[:0], strconv.Itoa(row.Line)), keys...), ret)
+		outRecord = append(outRecord, st.outValues()...)
+		return cfg.OutCSV.Write(outRecord)
+	}
+	begin := func() error {
+		if tx != nil {
+			return nil
+		}
+		if tx, err = db.Begin(); err != nil {
+			return err
+		}
+		if stmt != nil {
+			stmt.Close()
+		}
+		if stmt, err = tx.Prepare(st.Qry); err != nil {
+			tx.Rollback()
+			tx = nil
+			return err
+		}
+		return nil
+	}
+	convert := func(values []interface{}, row dbcsv.Row) ([]interface{}, error) {
+		if len(row.Values) > len(st.Converters) {
+			logger.Warn("converter number mismatch", "values", len(row.Values), "converters", len(st.Converters), "params", st.ParamCount)
+		}
+		for i, s := range row.Values {
+			var conv ConvFunc
+			if i < len(st.Converters) {
+				conv = st.Converters[i]
+			}
+			if conv == nil {
+				values = append(values, s)
+				continue
+			}
+			v, convErr := safeConvert(conv, s)
+			if convErr != nil {
+				logger.Error("convert", "row", row, "error", convErr)
+				var argName string
+				if i < len(st.ArgNames) {
+					argName = st.ArgNames[i]
+				}
+				return values, fmt.Errorf("convert %q (row %d, col %d, argument %s): %w", s, row.Line, i+1, argName, convErr)
+			}
+			values = append(values, v)
+		}
+		for i := len(values) + 1; i < st.ParamCount-len(st.FixParams); i++ {
+			values = append(values, "")
+		}
+		return values, nil
+	}
+
+	// with one transaction, or committing every N rows, a failing row rolls back the uncommitted rows,
+	// so stop processing.
+	stopOnError := (cfg.OneTx || cfg.CommitRows > 0) && !cfg.Savepoints
+	reject := func(row dbcsv.Row, reason string) error {
+		if cfg.Reject == nil {
+			return nil
+		}
+		if err := cfg.Reject.Write(append([]string{strconv.Itoa(row.Line), reason}, row.Values...)); err != nil {
+			return fmt.Errorf("write reject: %w", err)
+		}
+		return nil
+	}
+	savepoint := func(name string) error {
+		if !cfg.Savepoints {
+			return nil
+		}
+		_, err := tx.Exec("SAVEPOINT " + name)
+		return err
+	}
+	rollbackTo := func(name string) error {
+		_, err := tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+		return err
+	}
+	var pending int
+	commit := func(rows int) error {
+		pending += rows
+		if tx == nil || (cfg.CommitRows > 0 && pending < cfg.CommitRows) || (cfg.CommitRows <= 0 && cfg.OneTx) {
+			return nil
+		}
+		logger.Info("COMMIT", "rows", pending)
+		_, span := tracing.Start(ctx, "commit", attribute.Int("rows", pending))
+		pending = 0
+		err := tx.Commit()
+		tracing.End(span, err)
+		tx = nil
+		return err
+	}
+
+	if cfg.JustPrint {
+		if cfg.Bulk > 1 {
+			fmt.Fprintln(stdout, st.bulkQuery())
+		} else {
+			fmt.Fprintln(stdout, st.Qry)
+		}
+		for row := range rows {
+			vals, err := convert(make([]interface{}, startIdx, st.ParamCount), row)
+			if err != nil {
+				return n, err
+			}
+			vals = append(vals, st.FixParams...)
+			fmt.Fprintf(stdout, "%d:", row.Line)
+			for i, v := range vals {
+				if i < startIdx {
+					continue
+				}
+				switch x := v.(type) {
+				case sql.Out:
+					v = "OUT"
+				case sql.NullTime:
+					if x.Valid {
+						v = x.Time.Format(time.RFC3339)
+					} else {
+						v = nil
+					}
+				}
+				fmt.Fprintf(stdout, " %d=%#v", i+1, v)
+			}
+			fmt.Fprintln(stdout)
+			n++
+		}
+		return n, nil
+	}
+
+	// withRetry calls exec, and on transient errors re-prepares and calls it again, at most cfg.Retries times.
+	// The savepoint named spName is rolled back to before the retry, if cfg.Savepoints.
+	withRetry := func(spName string, exec func() error) error {
+		for attempt := 0; ; attempt++ {
+			err := exec()
+			if err == nil {
+				return nil
+			}
+			retry, reconnect := transientError(err)
+			if !retry || attempt >= cfg.Retries {
+				return err
+			}
+			if reconnect && pending != 0 {
+				// the uncommitted rows are lost with the connection
+				return err
+			}
+			wait := cfg.RetryBackoff << attempt
+			logger.Warn("transient error, retrying", "attempt", attempt+1, "wait", wait.String(), "reconnect", reconnect, "error", err)
+			time.Sleep(wait)
+			if reconnect {
+				tx.Rollback()
+				tx = nil
+				if err := begin(); err != nil {
+					return err
+				}
+				if err := savepoint(spName); err != nil {
+					return err
+				}
+				continue
+			}
+			if cfg.Savepoints {
+				if err := rollbackTo(spName); err != nil {
+					return err
+				}
+			}
+			stmt.Close()
+			if stmt, err = tx.Prepare(st.Qry); err != nil {
+				return err
+			}
+		}
+	}
+
+	execRow := func(row dbcsv.Row) error {
+		logger.Debug("dbExec", "row", row)
+		if err := begin(); err != nil {
+			return err
+		}
+		if values, err = convert(values[:startIdx], row); err != nil {
+			return err
+		}
+		values = append(values, st.FixParams...)
+		if err := savepoint("dbcsv_row"); err != nil {
+			return err
+		}
+		//log.Printf("%q %#v", st.Qry, values)
+		logger.Info("Exec", "values", values)
+		if err = withRetry("dbcsv_row", func() error {
+			_, err := stmt.Exec(values...)
+			return err
+		}); err != nil {
+			logger.Error("execute", "qry", st.Qry, "line", row.Line, "values", values, "error", err)
+			if !cfg.Savepoints {
+				return fmt.Errorf("qry=%q params=%#v: %w", st.Qry, values, err)
+			}
+			if rbErr := rollbackTo("dbcsv_row"); rbErr != nil {
+				return fmt.Errorf("rollback to savepoint after %v: %w", err, rbErr)
+			}
+			cfg.Stats.failed()
+			return reject(row, err.Error())
+		}
+		n++
+		retS := ""
+		if st.Returns {
+			retS = strconv.FormatInt(ret, 10)
+		}
+		if err := writeOut(row, retS); err != nil {
+			return fmt.Errorf("write out-csv: %w", err)
+		}
+		if st.Returns && values[0] != nil {
+			cfg.Stats.ret(ret)
+			out := strings.Join(deref(st.FixParams), ", ")
+			logger.Debug("returns", "out", out, "ret", ret, "retOk", cfg.RetOk, "ok", cfg.RetOk.Contains(ret))
+			if cfg.RetOk.Contains(ret) {
+				fmt.Fprintf(stdout, "%d: OK [%s]\t%s\n", ret, out, row.Values)
+				cfg.Stats.ok(1)
+				return commit(1)
+			}
+			if cfg.RetWarn.Contains(ret) {
+				fmt.Fprintf(stderr, "%d: WARN [%s]\t%s\n", ret, out, row.Values)
+				logger.Warn("returned", "ret", ret, "line", row.Line)
+				cfg.Stats.ok(1)
+				return commit(1)
+			}
+			cfg.Stats.failed()
+			fmt.Fprintf(stderr, "%d: %s\t%s\n", ret, out, row.Values)
+			logger.Warn("ROLLBACK", "ret", ret)
+			if cfg.Savepoints {
+				if err := rollbackTo("dbcsv_row"); err != nil {
+					return err
+				}
+			} else {
+				tx.Rollback()
+				tx = nil
+			}
+			if err := reject(row, strconv.FormatInt(ret, 10)); err != nil {
+				return err
+			}
+			buf.Reset()
+			cw := csv.NewWriter(&buf)
+			_ = cw.Write(append([]string{fmt.Sprintf("%d", ret), out}, row.Values...))
+			cw.Flush()
+			stdout.Write(buf.Bytes())
+			if stopOnError {
+				return fmt.Errorf("returned %v (%s) for line %d (%q)",
+					ret, out, row.Line, row.Values)
+			}
+			return nil
+		}
+		cfg.Stats.ok(1)
+		return commit(1)
+	}
+
+	if cfg.Bulk <= 1 {
+		for row := range rows {
+			if err := execRow(row); err != nil {
+				return n, err
+			}
+		}
+	} else {
+		if st.HasOut {
+			return 0, errors.New("-bulk does not support OUT arguments")
+		}
+		if st.HasBool {
+			return 0, errors.New("-bulk does not support BOOLEAN arguments")
+		}
+		bulkQry := st.bulkQuery()
+		logger.Debug("bulk", "qry", bulkQry)
+		batch := make([]dbcsv.Row, 0, cfg.Bulk)
+		rowValues := make([][]interface{}, 0, cfg.Bulk)
+		execBatch := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			defer func() { batch, rowValues = batch[:0], rowValues[:0] }()
+			if err := begin(); err != nil {
+				return err
+			}
+			for _, row := range batch {
+				vals, err := convert(make([]interface{}, startIdx, st.ParamCount), row)
+				if err != nil {
+					return err
+				}
+				rowValues = append(rowValues, vals)
+			}
+			args, rets := bulkArgs(rowValues, startIdx, st.FixParams)
+			if err := savepoint("dbcsv_batch"); err != nil {
+				return err
+			}
+			execErr := withRetry("dbcsv_batch", func() error {
+				_, err := tx.Exec(bulkQry, args...)
+				return err
+			})
+			allOK := execErr == nil
+			if allOK && st.Returns {
+				for _, r := range *rets {
+					if allOK = cfg.RetOk.Contains(r) || cfg.RetWarn.Contains(r); !allOK {
+						break
+					}
+				}
+			}
+			if allOK {
+				for i, row := range batch {
+					var retS string
+					if st.Returns {
+						cfg.Stats.ret((*rets)[i])
+						if r := (*rets)[i]; cfg.RetOk.Contains(r) {
+							fmt.Fprintf(stdout, "%d: OK []\t%s\n", r, row.Values)
+						} else {
+							fmt.Fprintf(stderr, "%d: WARN []\t%s\n", r, row.Values)
+						}
+						retS = strconv.FormatInt((*rets)[i], 10)
+					}
+					if err := writeOut(row, retS); err != nil {
+						return fmt.Errorf("write out-csv: %w", err)
+					}
+				}
+				n += len(batch)
+				cfg.Stats.ok(len(batch))
+				return commit(len(batch))
+			}
+			if stopOnError {
+				if execErr != nil {
+					return fmt.Errorf("qry=%q: %w", bulkQry, execErr)
+				}
+				for i, r := range *rets {
+					if !(cfg.RetOk.Contains(r) || cfg.RetWarn.Contains(r)) {
+						return fmt.Errorf("returned %v for line %d (%q)", r, batch[i].Line, batch[i].Values)
+					}
+				}
+			}
+			// replay the batch row-by-row, to find and skip the bad ones
+			logger.Warn("bulk failed, replaying row-by-row", "rows", len(batch), "error", execErr)
+			if cfg.Savepoints {
+				if err := rollbackTo("dbcsv_batch"); err != nil {
+					return err
+				}
+			} else {
+				tx.Rollback()
+				tx = nil
+			}
+			for _, row := range batch {
+				if err := execRow(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for row := range rows {
+			if batch = append(batch, row); len(batch) == cfg.Bulk {
+				if err := execBatch(); err != nil {
+					return n, err
+				}
+			}
+		}
+		if err := execBatch(); err != nil {
+			return n, err
+		}
+	}
+	if stmt != nil {
+		stmt.Close()
+	}
+	if tx != nil {
+		logger.Info("COMMIT")
+		_, span := tracing.Start(ctx, "commit")
+		err := tx.Commit()
+		tracing.End(span, err)
+		return n, err
+	}
+	return n, nil
+}
+
+// retCodes is a set of return code ranges.
+type retCodes [][2]int64
+
+// parseRetCodes parses the comma-separated list of return codes and ranges, as "0,1,100-199".
+func parseRetCodes(spec string) (retCodes, error) {
+	var rc retCodes
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		loS, hiS := part, part
+		// the first char may be a minus sign
+		if i := strings.IndexByte(part[1:], '-'); i >= 0 {
+			loS, hiS = part[:i+1], part[i+2:]
+		}
+		lo, err := strconv.ParseInt(loS, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", part, err)
+		}
+		hi, err := strconv.ParseInt(hiS, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", part, err)
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("%q: empty range", part)
+		}
+		rc = append(rc, [2]int64{lo, hi})
+	}
+	return rc, nil
+}
+
+// Contains reports whether n is in the set.
+func (rc retCodes) Contains(n int64) bool {
+	for _, r := range rc {
+		if r[0] <= n && n <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// transientError reports whether the error is worth a retry,
+// and whether it needs a new connection.
+func transientError(err error) (retry, reconnect bool) {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true, true
+	}
+	if oe, ok := godror.AsOraErr(err); ok {
+		switch oe.Code() {
+		case 60, // deadlock
+			4061, 4065, 4068: // package state discarded
+			return true, false
+		case 28, 1012, 3113, 3114, 3135, 12170, 12537, 12541, 12547, 12570: // lost connection
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// headerKey returns the upper-cased name without accents and non-alphanumeric characters.
+func headerKey(s string) string {
+	s, _, _ = transform.String(norm.NFD, s)
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, s)
+}
+
+// headerMapping returns the index of the header column for each argument.
+// The argument names match with or without their P_ prefix.
+func headerMapping(header, argNames []string) ([]int, error) {
+	keys := make(map[string]int, len(header))
+	for i, h := range header {
+		keys[headerKey(h)] = i
+	}
+	idx := make([]int, len(argNames))
+	for i, a := range argNames {
+		j, ok := keys[headerKey(a)]
+		if !ok {
+			if a2 := strings.ToUpper(a); strings.HasPrefix(a2, "P_") {
+				j, ok = keys[headerKey(a2[2:])]
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("no column found for argument %q in %q", a, header)
+		}
+		idx[i] = j
+	}
+	return idx, nil
+}
+
+// bindMapping returns the index of the header column for each argument,
+// by the placeholders of expandSQLTemplate, or by headerMapping for the placeholders written into the template.
+func bindMapping(header []string, binds map[string]int, argNames []string) ([]int, error) {
+	idx := make([]int, len(argNames))
+	for i, a := range argNames {
+		j, ok := binds[a]
+		if !ok {
+			m, err := headerMapping(header, []string{a})
+			if err != nil {
+				return nil, err
+			}
+			j = m[0]
+		}
+		idx[i] = j
+	}
+	return idx, nil
+}
+
+// remapRows reorders the values of the rows, in the order of idx.
+func remapRows(rows <-chan dbcsv.Row, idx []int) <-chan dbcsv.Row {
+	out := make(chan dbcsv.Row, cap(rows))
+	go func() {
+		defer close(out)
+		for row := range rows {
+			values := make([]string, len(idx))
+			for i, j := range idx {
+				if j < len(row.Values) {
+					values[i] = row.Values[j]
+				}
+			}
+			row.Values = values
+			out <- row
+		}
+	}()
+	return out
+}
+
+// bulkQuery returns the statement wrapped into a loop over the :bulk_n
+// elements of the PL/SQL associative arrays bound in place of the per-row parameters.
+func (st Statement) bulkQuery() string {
+	var perRow int
+	replacePlaceholders(st.Qry, func(ph string) string { perRow++; return ph })
+	perRow -= len(st.FixParams)
+	var k int
+	inner := replacePlaceholders(st.Qry, func(ph string) string {
+		k++
+		if k <= perRow {
+			return ph + "(i)"
+		}
+		return ph
+	})
+	if inner = strings.TrimSpace(inner); strings.HasPrefix(inner, "BEGIN ") {
+		inner = strings.TrimSuffix(strings.TrimPrefix(inner, "BEGIN "), "END;")
+	} else { // DML
+		inner += ";"
+	}
+	return "BEGIN FOR i IN 1 .. :bulk_n LOOP " + inner + " END LOOP; END;"
+}
+
+// reQryPart matches the string literals, the quoted identifiers, the comments and the placeholders.
+var reQryPart = regexp.MustCompile(`'[^']*'|"[^"]*"|--[^\n]*|(?s:/\*.*?\*/)|:[a-zA-Z0-9][a-zA-Z0-9_]*`)
+
+// replacePlaceholders replaces the placeholders of the statement (outside of the literals and comments)
+// with the result of repl.
+func replacePlaceholders(qry string, repl func(string) string) string {
+	return reQryPart.ReplaceAllStringFunc(qry, func(s string) string {
+		if s[0] != ':' {
+			return s
+		}
+		return repl(s)
+	})
+}
+
+// sqlStatement returns the Statement for the DML, with the placeholders as arguments.
+func sqlStatement(qry string) Statement {
+	qry = strings.TrimSuffix(strings.TrimSpace(qry), ";")
+	var names []string
+	replacePlaceholders(qry, func(ph string) string {
+		names = append(names, ph[1:])
+		return ph
+	})
+	return Statement{
+		Qry: qry, ArgNames: names,
+		ParamCount: len(names), Converters: make([]ConvFunc, len(names)),
+	}
+}
+
+// expandSQLTemplate executes the text/template, replacing the {{.column}} references
+// with the column's placeholder, returning the header index of each placeholder name, too.
+func expandSQLTemplate(qry string, header []string) (string, map[string]int, error) {
+	tpl, err := template.New("sql").Option("missingkey=error").Parse(qry)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse %q: %w", qry, err)
+	}
+	m := make(map[string]string, len(header))
+	binds := make(map[string]int, len(header))
+	for i, h := range header {
+		k := strings.ToLower(headerKey(h))
+		if k == "" || '0' <= k[0] && k[0] <= '9' {
+			k = "c" + k
+		}
+		if _, ok := binds[k]; ok {
+			k += "_" + strconv.Itoa(i+1)
+		}
+		m[h], binds[k] = ":"+k, i
+	}
+	var buf strings.Builder
+	if err = tpl.Execute(&buf, m); err != nil {
+		return "", nil, fmt.Errorf("execute %q with %q: %w", qry, header, err)
+	}
+	return buf.String(), binds, nil
+}
+
+// bulkArgs transposes the rows' values into arrays, returning the args for bulkQuery,
+// and the pointer of the returned values' array, if startIdx is 1.
+func bulkArgs(rowValues [][]interface{}, startIdx int, fixParams []interface{}) ([]interface{}, *[]int64) {
+	args := append(make([]interface{}, 0, 3+len(rowValues[0])+len(fixParams)),
+		godror.PlSQLArrays, len(rowValues))
+	rets := make([]int64, len(rowValues))
+	if startIdx == 1 {
+		args = append(args, sql.Out{Dest: &rets})
+	}
+	for j := startIdx; j < len(rowValues[0]); j++ {
+		var isTime bool
+		for _, vals := range rowValues {
+			if _, isTime = vals[j].(sql.NullTime); isTime {
+				break
+			}
+		}
+		if isTime {
+			arr := make([]godror.NullTime, len(rowValues))
+			for i, vals := range rowValues {
+				if t, ok := vals[j].(sql.NullTime); ok {
+					arr[i] = godror.NullTime(t)
+				}
+			}
+			args = append(args, arr)
+			continue
+		}
+		arr := make([]string, len(rowValues))
+		for i, vals := range rowValues {
+			if vals[j] != nil {
+				arr[i] = fmt.Sprintf("%v", vals[j])
+			}
+		}
+		args = append(args, arr)
+	}
+	return append(args, fixParams...), &rets
+}
+
+type ConvFunc func(string) (interface{}, error)
+
+type Statement struct {
+	Qry        string
+	Converters []ConvFunc
+	FixParams  []interface{}
+	ParamCount int
+	Returns    bool
+	// HasOut is true if there are OUT arguments
+	HasOut bool
+	// HasBool is true if there are BOOLEAN IN arguments
+	HasBool bool
+	// OutNames are the names of the OUT arguments
+	OutNames []string
+	// ArgNames are the names of the arguments filled from the rows
+	ArgNames []string
+}
+
+// outValues returns the current values of the OUT parameters.
+func (st Statement) outValues() []string {
+	vals := make([]string, 0, len(st.OutNames))
+	for _, p := range st.FixParams {
+		if o, ok := p.(sql.Out); ok {
+			vals = append(vals, deref([]interface{}{o.Dest})...)
+		}
+	}
+	return vals
+}
+
+type querier interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}
+
+func getQuery(db querier, fun string, fixParams [][2]string) (Statement, error) {
+	var st Statement
+	args := make([]Arg, 0, 32)
+	fun = strings.TrimSpace(fun)
+
+	if strings.HasPrefix(fun, "BEGIN ") && strings.HasSuffix(fun, "END;") {
+		st.Qry = fun
+		if i := strings.IndexByte(fun, '('); i >= 0 && strings.Contains(fun[5:i], ":=") { //function
+			st.Returns = true
+		}
+		var nm []byte
+		var state uint8
+		names := make([]string, 0, strings.Count(fun, ":"))
+		_ = strings.Map(func(r rune) rune {
+			switch state {
+			case 0:
+				if r == ':' {
+					state = 1
+					nm = nm[:0]
+				}
+			case 1:
+				if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' ||
+					'0' <= r && r <= '9' ||
+					len(nm) > 0 && r == '_' {
+					nm = append(nm, byte(r))
+				} else {
+					names = append(names, string(nm))
+					nm = nm[:0]
+					state = 0
+				}
+			}
+			return -1
+		},
+			fun)
+		if len(nm) > 0 {
+			names = append(names, string(nm))
+		}
+		st.ParamCount = len(names)
+		st.Converters = make([]ConvFunc, len(names))
+		st.ArgNames = names
+		if st.Returns && len(names) != 0 {
+			st.ArgNames = names[1:]
+		}
+		return st, nil
+	}
+
+	parts := strings.Split(fun, ".")
+	qry := "SELECT argument_name, data_type, in_out, data_length, data_precision, data_scale FROM "
+	params := make([]interface{}, 0, 3)
+	switch len(parts) {
+	case 1:
+		qry += "all_arguments WHERE owner = SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') AND object_name = UPPER(:1)"
+		params = append(params, fun)
+	case 2:
+		qry += "all_arguments WHERE owner = SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA') AND package_name = UPPER(:1) AND object_name = UPPER(:2)"
+		params = append(params, parts[0], parts[1])
+	case 3:
+		qry += "all_arguments WHERE owner = UPPER(:1) AND package_name = UPPER(:2) AND object_name = UPPER(:3)"
+		params = append(params, parts[0], parts[1], parts[2])
+	default:
+		return st, fmt.Errorf("bad function name: %s", fun)
+	}
+	qry += " ORDER BY sequence"
+	rows, err := db.Query(qry, params...)
+	if err != nil {
+		return st, fmt.Errorf("%s: %w", qry, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var arg Arg
+		var length, precision, scale sql.NullInt64
+		if err = rows.Scan(&arg.Name, &arg.Type, &arg.InOut, &length, &precision, &scale); err != nil {
+			return st, err
+		}
+		if length.Valid {
+			arg.Length = int(length.Int64)
+			if precision.Valid {
+				arg.Precision = int(precision.Int64)
+				if scale.Valid {
+					arg.Scale = int(scale.Int64)
+				}
+			}
+		}
+		args = append(args, arg)
+	}
+	if err = rows.Err(); err != nil {
+		return st, fmt.Errorf("%s: %w", qry, err)
+	}
+	if len(args) == 0 {
+		return st, fmt.Errorf("%s has no arguments", fun)
+	}
+
+	st.Qry = "BEGIN "
+	i := 1
+	if args[0].Name == "" { // function
+		st.Qry += ":x1 := "
+		args = args[1:]
+		st.Returns = true
+		i++
+	}
+	fixParamNames := make([]string, len(fixParams))
+	for j, x := range fixParams {
+		fixParamNames[j] = strings.ToUpper(x[0])
+	}
+	vals := make([]string, 0, len(args))
+	st.Converters = make([]ConvFunc, cap(vals))
+ArgLoop:
+	for _, arg := range args {
+		for _, x := range fixParamNames {
+			if x == arg.Name {
+				continue ArgLoop
+			}
+		}
+		// the OUT arguments are not filled from the rows, so they are bound after the others
+		if arg.InOut == "OUT" {
+			st.HasOut = true
+			st.OutNames = append(st.OutNames, strings.ToLower(arg.Name))
+			switch arg.baseType() {
+			case "DATE":
+				var t sql.NullTime
+				st.FixParams = append(st.FixParams, sql.Out{Dest: &t})
+			case "NUMBER":
+				var f float64
+				st.FixParams = append(st.FixParams, sql.Out{Dest: &f})
+			case "INTEGER", "PLS_INTEGER", "BINARY_INTEGER":
+				var i int64
+				st.FixParams = append(st.FixParams, sql.Out{Dest: &i})
+			case "BOOLEAN":
+				var b bool
+				st.FixParams = append(st.FixParams, sql.Out{Dest: &b})
+			default:
+				var s string
+				st.FixParams = append(st.FixParams, sql.Out{Dest: &s})
+			}
+			continue
+		}
+		vals = append(vals, fmt.Sprintf("%s=>:x%d", strings.ToLower(arg.Name), i))
+		st.ArgNames = append(st.ArgNames, arg.Name)
+		st.Converters[len(st.ArgNames)-1] = arg.converter()
+		st.HasBool = st.HasBool || arg.baseType() == "BOOLEAN"
+		i++
+	}
+	for _, nm := range st.OutNames {
+		vals = append(vals, fmt.Sprintf("%s=>:x%d", nm, i))
+		i++
+	}
+	for _, p := range fixParams {
+		vals = append(vals, fmt.Sprintf("%s=>:x%d", p[0], i))
+		st.FixParams = append(st.FixParams, p[1])
+		i++
+	}
+	st.ParamCount = i
+	st.Qry += fun + "(" + strings.Join(vals, ", ") + "); END;"
+	return st, err
+}
+
+type Arg struct {
+	Name, Type, InOut        string
+	Length, Precision, Scale int
+}
+
+// baseType returns the type without the "PL/SQL " prefix, with underscores instead of spaces
+// ("PL/SQL PLS INTEGER" is "PLS_INTEGER").
+func (arg Arg) baseType() string {
+	return strings.ReplaceAll(strings.TrimPrefix(arg.Type, "PL/SQL "), " ", "_")
+}
+
+// converter returns the converter for the argument's type, or nil.
+func (arg Arg) converter() ConvFunc {
+	switch arg.baseType() {
+	case "DATE":
+		return strToDate
+	case "NUMBER":
+		if arg.Precision > 0 && arg.Scale == 0 {
+			return strToInt
+		}
+		return strToNumber
+	case "INTEGER", "PLS_INTEGER", "BINARY_INTEGER":
+		return strToInt
+	case "FLOAT", "BINARY_FLOAT", "BINARY_DOUBLE":
+		return strToNumber
+	case "BOOLEAN":
+		return strToBool
+	}
+	return nil
+}
+
+// cleanNumber removes the spaces and the thousands separators,
+// and changes the decimal comma to a point.
+//
+// If both ',' and '.' is present, the last one is the decimal separator;
+// a lone ',' is a decimal comma, a repeated ',' or '.' is a thousands separator.
+func cleanNumber(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '\'' || r == '_' {
+			return -1
+		}
+		return r
+	}, s)
+	comma, point := strings.LastIndexByte(s, ','), strings.LastIndexByte(s, '.')
+	switch {
+	case comma < 0:
+		if strings.Count(s, ".") > 1 { // thousands separators
+			return strings.ReplaceAll(s, ".", "")
+		}
+		return s
+	case point < 0:
+		if strings.Count(s, ",") > 1 { // thousands separators
+			return strings.ReplaceAll(s, ",", "")
+		}
+		return strings.Replace(s, ",", ".", 1)
+	case comma < point:
+		return strings.ReplaceAll(s, ",", "")
+	default:
+		return strings.Replace(strings.ReplaceAll(s, ".", ""), ",", ".", 1)
+	}
+}
+
+func strToNumber(s string) (interface{}, error) {
+	if s = cleanNumber(s); s == "" {
+		return nil, nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return nil, fmt.Errorf("not a number: %w", err)
+	}
+	return s, nil
+}
+
+func strToInt(s string) (interface{}, error) {
+	if s = cleanNumber(s); s == "" {
+		return nil, nil
+	}
+	// allow 12.0
+	if i := strings.IndexByte(s, '.'); i >= 0 && strings.Trim(s[i+1:], "0") == "" {
+		s = s[:i]
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("not an integer: %w", err)
+	}
+	return i, nil
+}
+
+func strToBool(s string) (interface{}, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return nil, nil
+	case "1", "t", "true", "y", "yes", "on", "x", "i", "igen":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off", "nem":
+		return false, nil
+	}
+	return nil, fmt.Errorf("not a boolean: %q", s)
+}
+
+func strToDate(s string) (interface{}, error) {
+	if justNums(s, 14) == "" {
+		return nil, nil
+	}
+	var buf strings.Builder
+	buf.Grow(14)
+	fields := strings.FieldsFunc(s, func(r rune) bool { return !('0' <= r && r <= '9') })
+	if len(fields) >= 3 && len(fields[0]) < 4 && len(fields[2]) == 4 { // mm/dd/yyyy
+		fields[0], fields[1], fields[2] = fields[2], fields[0], fields[1]
+	}
+	for i, f := range fields {
+		reqLen := 2
+		if i == 0 {
+			reqLen = 4
+		}
+		for j := reqLen - len(f); j > 0; j-- {
+			buf.WriteByte('0')
+		}
+		buf.WriteString(f)
+	}
+	s = buf.String()
+	if len(s) > 14 {
+		s = s[:14]
+	}
+	format := DateTimeFormat
+	if length := len(s); length < len(format) {
+		if length < len(DateFormat) {
+			return sql.NullTime{}, fmt.Errorf("date %q too short", s)
+		} else if length > len(DateFormat) {
+			s = s[:8]
+		}
+		format = DateFormat
+	}
+	t, err := time.ParseInLocation(format, s, time.Local)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Valid: !t.IsZero(), Time: t}, nil
+}
+func justNums(s string, maxLen int) string {
+	var i int
+	return strings.Map(
+		func(r rune) rune {
+			if maxLen >= 0 {
+				if i > maxLen {
+					return -1
+				}
+			}
+			if '0' <= r && r <= '9' {
+				i++
+				return r
+			}
+			return -1
+		},
+		s)
+}
+
+func deref(in []interface{}) []string {
+	out := make([]string, 0, len(in))
+	for _, v := range in {
+		if v == nil {
+			out = append(out, "")
+			continue
+		}
+		switch x := v.(type) {
+		case *string:
+			out = append(out, *x)
+		case *int64:
+			out = append(out, strconv.FormatInt(*x, 10))
+		case *float64:
+			out = append(out, fmt.Sprintf("%f", *x))
+		case *sql.NullTime:
+			if x.Valid {
+				out = append(out, x.Time.Format("2006-01-02"))
+			} else {
+				out = append(out, "")
+			}
+		case *time.Time:
+			out = append(out, x.Format("2006-01-02"))
+		default:
+			rv := reflect.ValueOf(v)
+			if rv.Kind() != reflect.Ptr {
+				continue
+			}
+			out = append(out, fmt.Sprintf("%v", rv.Elem().Interface()))
+		}
+	}
+	return out
+}
+
+// vim: set fileencoding=utf-8 noet:
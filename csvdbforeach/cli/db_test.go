@@ -0,0 +1,215 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestBulkQuery(t *testing.T) {
+	for _, tc := range []struct {
+		Name, Qry, Want string
+		FixParams       []interface{}
+	}{
+		{Name: "proc",
+			Qry:       "BEGIN pkg.proc(p_a=>:x1, p_b=>:x2, p_file_name=>:x3); END;",
+			FixParams: []interface{}{"a.csv"},
+			Want:      "BEGIN FOR i IN 1 .. :bulk_n LOOP pkg.proc(p_a=>:x1(i), p_b=>:x2(i), p_file_name=>:x3);  END LOOP; END;",
+		},
+		{Name: "literal",
+			Qry:  "BEGIN proc(TO_DATE(:1, 'HH24:MI'), :2 /* :3 */); -- :4\nEND;",
+			Want: "BEGIN FOR i IN 1 .. :bulk_n LOOP proc(TO_DATE(:1(i), 'HH24:MI'), :2(i) /* :3 */); -- :4\n END LOOP; END;",
+		},
+	} {
+		st := Statement{Qry: tc.Qry, FixParams: tc.FixParams}
+		if got := st.bulkQuery(); got != tc.Want {
+			t.Errorf("%s: got\n%q\nwanted\n%q", tc.Name, got, tc.Want)
+		}
+	}
+}
+
+func TestCleanNumber(t *testing.T) {
+	for in, want := range map[string]string{
+		"":             "",
+		"12":           "12",
+		" 1 234,5 ":    "1234.5",
+		"1 234":        "1234",
+		"1,234.56":     "1234.56",
+		"1.234,56":     "1234.56",
+		"1,234,567":    "1234567",
+		"1.234.567":    "1234567",
+		"-1.234.567":   "-1234567",
+		"1.234.567,89": "1234567.89",
+		"1,234,567.89": "1234567.89",
+		"1.5":          "1.5",
+		"-3,14":        "-3.14",
+		"1'000'000.25": "1000000.25",
+	} {
+		if got := cleanNumber(in); got != want {
+			t.Errorf("%q: got %q, wanted %q", in, got, want)
+		}
+	}
+}
+
+func TestSQLTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		Template, Want string
+		Header         []string
+		WantArgs       []string
+		WantIdx        []int
+	}{
+		{
+			Template: "UPDATE t SET x = {{.Amount}}, d = TO_DATE('12:00', 'HH24:MI') WHERE id = {{.ID}};",
+			Header:   []string{"ID", "Név", "Amount"},
+			Want:     "UPDATE t SET x = :amount, d = TO_DATE('12:00', 'HH24:MI') WHERE id = :id;",
+			WantArgs: []string{"amount", "id"}, WantIdx: []int{2, 0},
+		},
+		{
+			Template: `UPDATE t SET x = {{index . "1st"}}, y = {{index . ""}}, z = {{index . "Nev"}} WHERE id = {{.ID}}`,
+			Header:   []string{"ID", "1st", "", "Név", "Nev"},
+			Want:     "UPDATE t SET x = :c1st, y = :c, z = :nev_5 WHERE id = :id",
+			WantArgs: []string{"c1st", "c", "nev_5", "id"}, WantIdx: []int{1, 2, 4, 0},
+		},
+		{
+			Template: "UPDATE t SET x = {{.Amount}} WHERE id = :id",
+			Header:   []string{"ID", "Amount"},
+			Want:     "UPDATE t SET x = :amount WHERE id = :id",
+			WantArgs: []string{"amount", "id"}, WantIdx: []int{1, 0},
+		},
+	} {
+		qry, binds, err := expandSQLTemplate(tc.Template, tc.Header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if qry != tc.Want {
+			t.Errorf("got %q, wanted %q", qry, tc.Want)
+		}
+		st := sqlStatement(qry)
+		if !slices.Equal(st.ArgNames, tc.WantArgs) {
+			t.Errorf("%q: got %q, wanted %q", qry, st.ArgNames, tc.WantArgs)
+		}
+		idx, err := bindMapping(tc.Header, binds, st.ArgNames)
+		if err != nil {
+			t.Fatalf("%q: %+v", qry, err)
+		}
+		if !slices.Equal(idx, tc.WantIdx) {
+			t.Errorf("%q: got %v, wanted %v", qry, idx, tc.WantIdx)
+		}
+	}
+}
+
+func TestGetQueryOut(t *testing.T) {
+	db := sql.OpenDB(argsConnector{
+		{"", "NUMBER", "OUT"},
+		{"P_ID", "NUMBER", "IN"},
+		{"P_ERR", "VARCHAR2", "OUT"},
+		{"P_AMOUNT", "NUMBER", "IN/OUT"},
+		{"P_FILE", "VARCHAR2", "IN"},
+	})
+	defer db.Close()
+	st, err := getQuery(db, "pkg.proc", [][2]string{{"p_file", "a.csv"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "BEGIN :x1 := pkg.proc(p_id=>:x2, p_amount=>:x3, p_err=>:x4, p_file=>:x5); END;"; st.Qry != want {
+		t.Errorf("got\n%q\nwanted\n%q", st.Qry, want)
+	}
+	if len(st.ArgNames) != 2 || st.ArgNames[0] != "P_ID" || st.ArgNames[1] != "P_AMOUNT" {
+		t.Errorf("got args %q, wanted [P_ID P_AMOUNT]", st.ArgNames)
+	}
+	if len(st.OutNames) != 1 || st.OutNames[0] != "p_err" || len(st.FixParams) != 2 {
+		t.Errorf("got out %q, fix %v", st.OutNames, st.FixParams)
+	}
+	idx, err := headerMapping([]string{"amount", "id"}, st.ArgNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx[0] != 1 || idx[1] != 0 {
+		t.Errorf("got %v", idx)
+	}
+}
+
+// argsConnector is a fake database returning the rows of all_arguments (name, type, in_out).
+type argsConnector [][3]string
+
+func (c argsConnector) Connect(context.Context) (driver.Conn, error) { return argsConn(c), nil }
+func (c argsConnector) Driver() driver.Driver                        { return nil }
+
+type argsConn [][3]string
+
+func (c argsConn) Prepare(string) (driver.Stmt, error) { return argsStmt(c), nil }
+func (c argsConn) Close() error                        { return nil }
+func (c argsConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type argsStmt [][3]string
+
+func (s argsStmt) Close() error                               { return nil }
+func (s argsStmt) NumInput() int                              { return -1 }
+func (s argsStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s argsStmt) Query([]driver.Value) (driver.Rows, error)  { return &argsRows{rows: s}, nil }
+
+type argsRows struct{ rows [][3]string }
+
+func (r *argsRows) Columns() []string {
+	return []string{"argument_name", "data_type", "in_out", "data_length", "data_precision", "data_scale"}
+}
+func (r *argsRows) Close() error { return nil }
+func (r *argsRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	dest[0], dest[1], dest[2] = r.rows[0][0], r.rows[0][1], r.rows[0][2]
+	dest[3], dest[4], dest[5] = nil, nil, nil
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestRetCodes(t *testing.T) {
+	rc, err := parseRetCodes("0, 1,100-199,-5--3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, want := range map[int64]bool{0: true, 1: true, 2: false, 100: true, 150: true, 200: false, -4: true, -2: false} {
+		if got := rc.Contains(n); got != want {
+			t.Errorf("%d: got %t, wanted %t", n, got, want)
+		}
+	}
+	if _, err := parseRetCodes("5-1"); err == nil {
+		t.Error("wanted error for 5-1")
+	}
+}
+
+func TestArgConverter(t *testing.T) {
+	for _, tc := range []struct {
+		Arg  Arg
+		In   string
+		Want interface{}
+	}{
+		{Arg{Type: "PL/SQL BOOLEAN"}, "Igen", true},
+		{Arg{Type: "BOOLEAN"}, "0", false},
+		{Arg{Type: "PL/SQL PLS INTEGER"}, " 1 024 ", int64(1024)},
+		{Arg{Type: "PLS_INTEGER"}, "12,0", int64(12)},
+		{Arg{Type: "NUMBER"}, "3,14", "3.14"},
+	} {
+		conv := tc.Arg.converter()
+		if conv == nil {
+			t.Errorf("%s: no converter", tc.Arg.Type)
+			continue
+		}
+		if got, err := conv(tc.In); err != nil {
+			t.Errorf("%s: %q: %+v", tc.Arg.Type, tc.In, err)
+		} else if got != tc.Want {
+			t.Errorf("%s: %q: got %#v, wanted %#v", tc.Arg.Type, tc.In, got, tc.Want)
+		}
+	}
+	if _, err := strToBool("maybe"); err == nil {
+		t.Error("wanted error for maybe")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UNO-SOFT/dbcsv"
+)
+
+// execStats counts the processed rows.
+type execStats struct {
+	OK, Failed atomic.Int64
+
+	mu      sync.Mutex
+	retCode map[int64]int64
+}
+
+func (st *execStats) ret(code int64) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	if st.retCode == nil {
+		st.retCode = make(map[int64]int64)
+	}
+	st.retCode[code]++
+	st.mu.Unlock()
+}
+
+func (st *execStats) ok(n int) {
+	if st != nil {
+		st.OK.Add(int64(n))
+	}
+}
+func (st *execStats) failed() {
+	if st != nil {
+		st.Failed.Add(1)
+	}
+}
+
+// reportProgress logs the progress at each interval, till the context is canceled.
+// The ETA is estimated from the read position of the input file.
+func reportProgress(ctx context.Context, interval time.Duration, stats *execStats, position func() (int64, int64, error)) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, failed := stats.OK.Load(), stats.Failed.Load()
+		dur := time.Since(start)
+		attrs := []any{"ok", ok, "failed", failed, "rowsPerSec", int64(float64(ok+failed) / dur.Seconds())}
+		if offset, size, err := position(); err == nil && size > 0 && offset > 0 {
+			ratio := float64(offset) / float64(size)
+			attrs = append(attrs, "percent", int(ratio*100),
+				"eta", (time.Duration(float64(dur)/ratio) - dur).Truncate(time.Second).String())
+		}
+		logger.Info("progress", attrs...)
+	}
+}
+
+// writeSummary writes the totals as JSON into fileName ("-" for stdout).
+func (st *execStats) writeSummary(fileName string, processed int, dur time.Duration, runErr error) error {
+	st.mu.Lock()
+	retCodes := make(map[string]int64, len(st.retCode))
+	for k, v := range st.retCode {
+		retCodes[strconv.FormatInt(k, 10)] = v
+	}
+	st.mu.Unlock()
+	summary := struct {
+		Version     dbcsv.BuildInfo  `json:"version"`
+		Processed   int              `json:"processed"`
+		OK          int64            `json:"ok"`
+		Failed      int64            `json:"failed"`
+		ReturnCodes map[string]int64 `json:"returnCodes,omitempty"`
+		Duration    string           `json:"duration"`
+		Seconds     float64          `json:"seconds"`
+		Error       string           `json:"error,omitempty"`
+	}{
+		Version:   dbcsv.Version(),
+		Processed: processed, OK: st.OK.Load(), Failed: st.Failed.Load(),
+		ReturnCodes: retCodes,
+		Duration:    dur.String(), Seconds: dur.Seconds(),
+	}
+	if runErr != nil {
+		summary.Error = runErr.Error()
+	}
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if fileName == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(fileName, b, 0644)
+}
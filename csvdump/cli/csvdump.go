@@ -0,0 +1,627 @@
+// Copyright 2020, 2023 Tamás Gulácsi.
+//
+//
+// SPDX-License-Identifier: UPL-1.0 OR Apache-2.0
+
+// Package cli in csvdump represents a cursor->csv dumper
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+
+	"github.com/google/renameio/v2"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/godror/godror"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/completion"
+	"github.com/UNO-SOFT/dbcsv/connect"
+	"github.com/UNO-SOFT/dbcsv/csvdump/lib"
+	"github.com/UNO-SOFT/dbcsv/objstore"
+	"github.com/UNO-SOFT/dbcsv/tracing"
+	"github.com/UNO-SOFT/spreadsheet"
+	"github.com/UNO-SOFT/spreadsheet/ods"
+	"github.com/UNO-SOFT/spreadsheet/xlsx"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+var (
+	logCfg dbcsv.LogConfig
+	logger = zlog.NewLogger(zlog.MaybeConsoleHandler(&logCfg, os.Stderr)).SLog()
+)
+
+// Main runs the command with the arguments (args[0] is the name of the program).
+func Main(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	flagConnect := fs.String("connect", "", connect.Usage)
+	var connOpts connect.Options
+	connOpts.AddFlags(fs)
+	flagDateFormat := fs.String("date", "2006-01-02T15:04:05", "date format, in Go notation")
+	flagSep := fs.String("sep", ",", "separator")
+	flagHeader := fs.Bool("header", true, "print header")
+	flagEnc := fs.String("encoding", dbcsv.DefaultEncoding.Name, "encoding to use for output")
+	flagOut := fs.String("o", "-", "output (defaults to stdout), may be an s3://bucket/key or gs://bucket/object URL")
+	flagFormat := fs.String("format", "csv", "output format for non-spreadsheet output: csv, or typed (for csvload -input-type=typed, without losing precision)")
+	flagRaw := fs.Bool("raw", false, "not real csv, just dump the raw data")
+	flagSort := fs.Bool("sort", false, "sort data by all the non-LOB columns, for stable diffs")
+	flagSheets := dbcsv.FlagStrings()
+	fs.Var(flagSheets, "sheet", "each -sheet=name:SELECT will become a separate sheet on the output ods")
+	flagParams := dbcsv.FlagStrings()
+	fs.Var(flagParams, "param", "each -param=asdf will becoma separate parameter (:1, :2, ...)")
+	logCfg.AddFlags(fs)
+	flagCompress := fs.String("compress", "", "compress output with gz/gzip or zst/zstd/zstandard")
+	flagCall := fs.Bool("call", false, "the first argument is not the WHERE, but the PL/SQL block to be called, the followings are not the columns but the arguments")
+	flagCursors := fs.Int("cursors", 1, "number of OUT ref cursors (:1, :2, ...) of the -call PL/SQL block, each dumped to its own sheet/file")
+	flagRemote := fs.Bool("remote", false, `the rows are XLSX commands in JSON {"c":"command_name", "a":[{"f":"float_value","s":"string_value", "i":"int_value"}]} format`)
+	flagRemoteStream := fs.Bool("remote-stream", false, "write the row arrays of the remote commands with a streaming writer, using much less memory")
+	flagAQ := fs.Bool("aq", false, "get the remote commands from AQ/correlation")
+	flagAQConc := fs.Int("aq-concurrency", 1, "number of concurrent dequeuers in -aq mode: only 1 is supported, as the remote commands and the CSV lines must be processed in order")
+	flagAQMax := fs.Int("aq-max", 0, "maximum number of messages to consume in -aq mode (0 means unlimited)")
+	flagAQEnqueue := fs.String("aq-enqueue", "", "put the result rows into this queue[/correlation] (with PAYLOAD BLOB attribute), instead of the output")
+	flagAQChunk := fs.Int("aq-chunk", 1, "number of rows per message in -aq-enqueue mode")
+	flagAQFormat := fs.String("aq-format", "json", "message format in -aq-enqueue mode: json (JSON lines) or csv")
+	flagAQIdle := fs.Duration("aq-idle", 0, "exit when no message arrives for this long in -aq mode (0 means wait forever)")
+	flagTimeout := fs.Duration("timeout", 0, "timeout")
+	flagFetchBytes := fs.Int("fetch-bytes", csvdump.DefaultFetchBytes, "targeted size of a fetch round trip: the fetch array size is computed from the average width of the first 1024 rows of the query, fetched before the query (0: 1024 rows, or the FETCH FIRST limit)")
+	flagResumeKey := fs.String("resume-key", "", "comma-separated list of unique key columns: order by them, and continue after the last dumped key on ORA-01555 (snapshot too old); CSV output only, without the read-only transaction")
+	flagServe := fs.String("serve", "", "serve the -reports over HTTP on this address (GET /report/name?param=value&format=csv|xlsx|jsonl)")
+	flagReports := fs.String("reports", "", `JSON file of the allow-listed reports for -serve: {"name": {"query": "SELECT ... WHERE x = :from", "params": ["from"]}}`)
+	flagSchedule := fs.String("schedule", "", `run repeatedly, by this cron schedule ("0 6 * * *"); {{date}}, {{time}} in -o are replaced by the time of the run`)
+	flagOnFailure := fs.String("on-failure", "", "shell command to execute when a scheduled run fails (with CSVDUMP_ERROR in the environment)")
+	flagTZ := fs.String("tz", "", "convert the dates/timestamps into this time zone (e.g. UTC, Europe/Budapest) before formatting")
+	flagSummary := fs.String("summary", "", "write a JSON summary of the run (rows, bytes, files, checksums) to this file, or to stderr with -")
+	flagSchemaOut := fs.String("schema-out", "", "write the column metadata of the queries as JSON to this file")
+	flagCompute := dbcsv.FlagStrings()
+	fs.Var(flagCompute, "compute", `each -compute='NAME = EXPRESSION' computes an output column (Starlark), such as 'TOTAL = PRICE * QTY'`)
+
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.Replace(`Usage of {{.prog}}:
+	{{.prog}} [options] 'T_able' 'F_ield=1'
+
+will execute a "SELECT * FROM T_able WHERE F_ield=1" and dump all the columns;
+
+	{{.prog}} -call [options] 'DB_lista.csv' 'p_a=1' 'p_b=c'
+
+will execute "BEGIN :1 := DB_lista.csv(p_a=>:2, p_b=>3); END" with p_a=1, p_b=c
+and dump all the columns of the cursor returned by the function.
+
+	{{.prog}} -call -cursors=2 -o out.csv 'BEGIN :1 := pkg.fn(:3); :2 := pkg.details(:3); END;' 'a'
+
+will execute the PL/SQL block with :3='a', and dump the first cursor into out.csv,
+the second into out_2.csv (or into separate sheets for .ods/.xlsx output).
+
+`, "{{.prog}}", fs.Name(), -1))
+		fs.PrintDefaults()
+	}
+	flagVersion := fs.Bool("version", false, "print the version and exit")
+	if completion.Collect(ctx, map[string][]string{
+		"format": {"csv", "typed"}, "compress": {"gz", "zst"}, "aq-format": {"json", "csv"},
+	}, fs) {
+		return nil
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *flagVersion {
+		fmt.Println(dbcsv.Version())
+		return nil
+	}
+	h, err := logCfg.Handler(os.Stderr, "csvdump")
+	if err != nil {
+		return err
+	}
+	logger = slog.New(h)
+	ctx, stop := dbcsv.WrapLogger(ctx, logger)
+	defer stop()
+	shutdown, err := tracing.Init(ctx, "csvdump")
+	if err != nil {
+		return err
+	}
+	defer shutdown(context.WithoutCancel(ctx))
+
+	enc, err := dbcsv.EncFromName(*flagEnc)
+	if err != nil {
+		return err
+	}
+	dec := enc.Encoding.NewDecoder()
+	args = fs.Args()
+	if dec != nil {
+		for i, a := range args {
+			if args[i], err = dec.String(a); err != nil {
+				return fmt.Errorf("%q: %w", a, err)
+			}
+		}
+		for i, q := range flagSheets.Strings {
+			if flagSheets.Strings[i], err = dec.String(q); err != nil {
+				return fmt.Errorf("%q: %w", q, err)
+			}
+		}
+	}
+
+	dbcsv.DateFormat = *flagDateFormat
+	dbcsv.DateEnd = `"` + strings.NewReplacer(
+		"2006", "9999",
+		"01", "12",
+		"02", "31",
+		"15", "23",
+		"04", "59",
+		"05", "59",
+	).Replace(dbcsv.DateFormat) + `"`
+	if *flagTZ != "" {
+		if dbcsv.DateLocation, err = time.LoadLocation(*flagTZ); err != nil {
+			return fmt.Errorf("-tz=%q: %w", *flagTZ, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = zlog.NewSContext(ctx, logger)
+	if len(flagCompute.Strings) != 0 {
+		if *flagFormat == "typed" || *flagRemote || *flagAQ || *flagAQEnqueue != "" || *flagServe != "" {
+			return errors.New("-compute cannot be used with -format=typed, -remote, -aq, -aq-enqueue or -serve")
+		}
+		ctx = dbcsv.WithTransform(ctx, flagCompute.Strings)
+	}
+
+	if *flagAQ && *flagAQConc > 1 {
+		return fmt.Errorf("-aq-concurrency=%d: concurrent dequeuers would reorder the messages of -aq, which must be processed in order", *flagAQConc)
+	}
+
+	db, err := connect.Open(*flagConnect, connOpts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err = connect.LogSession(ctx, logger, db); err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(2)
+	db.SetMaxIdleConns(1)
+
+	if !(*flagFormat == "csv" || *flagFormat == "typed") {
+		return fmt.Errorf("-format=%q: unknown format", *flagFormat)
+	}
+	if *flagFormat == "typed" && (len(flagSheets.Strings) != 0 || *flagRemote ||
+		strings.HasSuffix(*flagOut, ".ods") || strings.HasSuffix(*flagOut, ".xlsx")) {
+		return errors.New("-format=typed cannot be used with -sheet, -remote or an .ods/.xlsx output")
+	}
+	cfg := csvdump.Config{
+		Logger: logger, Encoding: enc, Format: *flagFormat,
+		Sep: *flagSep, Header: *flagHeader, Raw: *flagRaw,
+		FetchBytes: *flagFetchBytes, Call: *flagCall, Sort: *flagSort,
+		CursorCount: *flagCursors,
+	}
+	if *flagServe != "" {
+		reports, err := loadReports(*flagReports)
+		if err != nil {
+			return fmt.Errorf("-reports=%q: %w", *flagReports, err)
+		}
+		db.SetMaxOpenConns(16)
+		return serve(ctx, *flagServe, reportServer{db: db, reports: reports, cfg: cfg})
+	}
+
+	dump := func(ctx context.Context, outFn string) (err error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		if *flagTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, *flagTimeout)
+			defer cancel()
+		}
+
+		var queries []Query
+		var params []interface{}
+
+		logger.Debug("flags", "sheets", flagSheets.Strings, "call", *flagCall, "args", args)
+		if len(flagSheets.Strings) != 0 {
+			queries = make([]Query, len(flagSheets.Strings))
+			for i, q := range flagSheets.Strings {
+				if j := strings.IndexByte(q, ':'); j > 0 {
+					queries[i] = Query{Name: q[:j], Query: q[j+1:]}
+				} else {
+					queries[i] = Query{Query: q}
+				}
+			}
+			if *flagAQ {
+				Q := queries[0]
+				Q.ParseQueue()
+				queries[0] = Q
+				for i, q := range queries[1:] {
+					q.ParseQueue()
+					if q.QueueName == "" {
+						q.QueueName = Q.QueueName
+					}
+					queries[i+1] = q
+				}
+			} else if *flagCall {
+				Q := queries[0]
+				Q.Query, params = csvdump.SplitParamArgs(Q.Query, args)
+				queries[0] = Q
+				for i, Q := range queries[1:] {
+					queries[i+1].Query, _ = csvdump.SplitParamArgs(Q.Query, args)
+				}
+				logger.Info("call", "queries", queries, "params", params)
+			}
+		} else if *flagCall {
+			var qry string
+			qry, params = csvdump.SplitParamArgs(args[0], args[1:])
+			logger.Debug("call", "qry", qry, "params", params)
+			queries = append(queries, Query{Query: qry})
+		} else if *flagAQ {
+			Q := Query{Query: args[0]}
+			Q.ParseQueue()
+			queries = append(queries, Q)
+		} else {
+			params = make([]interface{}, len(flagParams.Strings))
+			for i, p := range flagParams.Strings {
+				params[i] = p
+			}
+			var (
+				qry, where string
+				columns    []string
+			)
+			if len(args) > 0 {
+				qry = args[0]
+			}
+			if len(args) > 1 {
+				where = args[1]
+				if len(args) > 2 {
+					columns = args[2:]
+				}
+			}
+			qry = csvdump.GetQuery(qry, where, columns, dbcsv.DefaultEncoding)
+			queries = append(queries, Query{Query: qry})
+		}
+
+		sum := newRunSummary(queries, params)
+		defer func() {
+			if ctx.Err() != nil {
+				logger.Warn("interrupted", "rows", sum.rows.Load(), "file", outFn)
+			}
+			if *flagSummary == "" {
+				return
+			}
+			if wErr := sum.Write(*flagSummary, err); wErr != nil && err == nil {
+				err = wErr
+			}
+		}()
+
+		fh := interface {
+			io.WriteCloser
+			Name() string
+		}(os.Stdout)
+		defer fh.Close()
+		var origFn string
+		if !(outFn == "" || outFn == "-") {
+			if !objstore.IsURL(outFn) {
+				// nosemgrep: go.lang.correctness.permissions.file_permission.incorrect-default-permission
+				_ = os.MkdirAll(filepath.Dir(outFn), 0750)
+			}
+			pfh, err := newPendingFile(ctx, outFn)
+			if err != nil {
+				return fmt.Errorf("%s: %w", outFn, err)
+			}
+			defer pfh.Cleanup()
+			fh = pfh
+			origFn = outFn
+		}
+		cw := newCountingWriter(fh)
+		wfh := io.WriteCloser(cw)
+		if *flagCompress != "" {
+			switch (strings.TrimSpace(strings.ToLower(*flagCompress)) + "  ")[:2] {
+			case "gz":
+				wfh = gzip.NewWriter(cw)
+			case "zs":
+				var err error
+				if wfh, err = zstd.NewWriter(cw); err != nil {
+					return err
+				}
+			}
+		}
+
+		logger.Debug("writing", "file", fh.Name(), "encoding", enc)
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			log.Printf("[WARN] Read-Only transaction: %v", err)
+			if tx, err = db.BeginTx(ctx, nil); err != nil {
+				return fmt.Errorf("%s: %w", "beginTx", err)
+			}
+		}
+		defer tx.Rollback()
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			godror.SetLogger(logger.With("lib", "godror"))
+			defer godror.SetLogger(zlog.Discard().SLog())
+		}
+
+		var schemas []tableSchema
+		if len(flagSheets.Strings) == 0 &&
+			!strings.HasSuffix(origFn, ".ods") &&
+			!strings.HasSuffix(origFn, ".xlsx") {
+			w := encoding.ReplaceUnsupported(enc.NewEncoder()).Writer(wfh)
+			logger.Debug("encoding", "env", dbcsv.DefaultEncoding.Name)
+
+			if queries[0].QueueName != "" {
+				Q, openErr := queries[0].OpenQueue(ctx, tx)
+				if openErr != nil {
+					return openErr
+				}
+				defer Q.Close()
+				err = dumpRemoteCSVQueue(ctx, w,
+					queueNext(ctx, Q, newDequeueControl(*flagAQMax, *flagAQIdle)),
+					*flagSep)
+			} else {
+				if *flagCall && *flagCursors > 1 {
+					if origFn == "" || *flagRemote {
+						return errors.New("multiple cursors need -o and cannot be used with -remote")
+					}
+					cursors, cursorColumns, qErr := cfg.Cursors(ctx, tx, queries[0].Query, params, *flagCursors)
+					if qErr != nil {
+						return qErr
+					}
+					for i, rows := range cursors[1:] {
+						defer rows.Close()
+						fn := cursorFileName(origFn, i+2)
+						schemas = append(schemas, newTableSchema(fn, cursorColumns[i+1]))
+						if err = dumpCSVFile(ctx, sum, fn, *flagCompress, enc, rows, cursorColumns[i+1], *flagHeader, *flagSep, *flagRaw); err != nil {
+							return err
+						}
+					}
+					defer cursors[0].Close()
+					schemas = append(schemas, newTableSchema(origFn, cursorColumns[0]))
+					var n int
+					n, err = dbcsv.DumpCSVCount(ctx, w, cursors[0], cursorColumns[0], *flagHeader, *flagSep, *flagRaw)
+					sum.AddRows(n)
+				} else if *flagAQEnqueue != "" {
+					target := Query{Query: *flagAQEnqueue}
+					target.ParseQueue()
+					Q, qErr := target.OpenEnqueue(ctx, db)
+					if qErr != nil {
+						return qErr
+					}
+					defer Q.Close()
+					rows, columns, qErr := cfg.Query(ctx, tx, queries[0].Query, params)
+					if qErr != nil {
+						return qErr
+					}
+					defer rows.Close()
+					var n int
+					n, err = enqueueRows(ctx, Q, target.Correlation, rows, columns, *flagAQChunk, *flagAQFormat, *flagHeader, *flagSep)
+					logger.Info("enqueued", "queue", Q.Name(), "rows", n, "error", err)
+					sum.AddRows(n)
+				} else if *flagResumeKey != "" {
+					if *flagCall || *flagRemote {
+						return errors.New("-resume-key cannot be used with -call or -remote")
+					}
+					var n int
+					// a new snapshot is needed for the continuation, so don't use the read-only transaction
+					n, err = dumpResumable(ctx, cfg, db, queries[0].Query, params, strings.Split(*flagResumeKey, ","),
+						func(ctx context.Context, rows *sql.Rows, columns []dbcsv.Column, first bool) (int, error) {
+							if first {
+								schemas = append(schemas, newTableSchema(queries[0].Name, columns))
+							}
+							return dbcsv.DumpCSVCount(ctx, w, rows, columns, first && *flagHeader, *flagSep, *flagRaw)
+						})
+					sum.AddRows(n)
+				} else if !*flagRemote {
+					var n int
+					var columns []dbcsv.Column
+					n, columns, err = cfg.DumpQuery(ctx, tx, wfh, queries[0].Query, params)
+					sum.AddRows(n)
+					schemas = append(schemas, newTableSchema(queries[0].Name, columns))
+				} else if rows, columns, qErr := cfg.Query(ctx, tx, queries[0].Query, params); qErr != nil {
+					err = qErr
+				} else {
+					defer rows.Close()
+					schemas = append(schemas, newTableSchema(queries[0].Name, columns))
+					if len(columns) != 1 {
+						return fmt.Errorf("-remote wants the queries to have only one column, this has %d", len(columns))
+					}
+					err = dumpRemoteCSV(ctx, w, rows, *flagSep)
+				}
+			}
+		} else {
+			if *flagResumeKey != "" {
+				return errors.New("-resume-key can be used only with CSV output")
+			}
+			var w spreadsheet.Writer
+			if strings.HasSuffix(origFn, ".xlsx") {
+				if !(*flagRemote || *flagAQ) {
+					w = xlsx.NewWriter(wfh)
+					defer w.Close()
+				}
+			} else if !(*flagRemote || *flagAQ) {
+				w, err = ods.NewWriter(wfh)
+				if err != nil {
+					return err
+				}
+				defer w.Close()
+			}
+
+			if *flagRemote || *flagAQ {
+				executeRemote := func(ctx context.Context, next func() ([]byte, error)) error {
+					if strings.HasSuffix(origFn, ".ods") {
+						return executeODSCommands(ctx, wfh, next)
+					}
+					return executeCommands(ctx, wfh, next, *flagRemoteStream)
+				}
+				for sheetNo := range queries {
+					qry, name := queries[sheetNo].Query, queries[sheetNo].Name
+					if name == "" {
+						name = strconv.Itoa(sheetNo + 1)
+					}
+					if *flagAQ {
+						Q, err := queries[sheetNo].OpenQueue(ctx, tx)
+						if err != nil {
+							return err
+						}
+						defer Q.Close()
+
+						shortCtx, shortCancel := context.WithTimeout(ctx, time.Hour)
+						err = executeRemote(shortCtx,
+							queueNext(ctx, Q, newDequeueControl(*flagAQMax, *flagAQIdle)))
+						shortCancel()
+						Q.Close()
+						if err != nil {
+							return err
+						}
+						continue
+					}
+					if *flagCall && *flagCursors > 1 {
+						return errors.New("multiple cursors cannot be used with -remote")
+					}
+
+					rows, columns, qErr := cfg.Query(ctx, tx, qry, params)
+					if qErr != nil {
+						return qErr
+					}
+					defer rows.Close()
+					schemas = append(schemas, newTableSchema(name, columns))
+					if len(columns) != 1 {
+						return fmt.Errorf("-remote wants the queries to have only one column, %q has %d", name, len(columns))
+					}
+					if err = executeRemote(ctx, func() ([]byte, error) {
+						if !rows.Next() {
+							return nil, io.EOF
+						}
+						var s string
+						err := rows.Scan(&s)
+						return []byte(s), err
+					}); err != nil {
+						return err
+					}
+				}
+			} else {
+				sheets := make([]csvdump.Sheet, len(queries))
+				for i, q := range queries {
+					sheets[i] = csvdump.Sheet{Name: q.Name, Query: q.Query}
+				}
+				var n int
+				var written []csvdump.Sheet
+				n, written, err = cfg.DumpSheets(ctx, tx, w, sheets, params)
+				sum.AddRows(n)
+				for _, s := range written {
+					schemas = append(schemas, newTableSchema(s.Name, s.Columns))
+				}
+			}
+			if w != nil {
+				if closeErr := w.Close(); closeErr != nil && err == nil {
+					err = closeErr
+				}
+			}
+		}
+		cancel()
+		if err != nil {
+			return err
+		}
+		if *flagSchemaOut != "" {
+			if err = writeSchema(*flagSchemaOut, schemas); err != nil {
+				return err
+			}
+		}
+		if err = wfh.Close(); err != nil {
+			return err
+		}
+		if origFn != "" {
+			sum.AddFile(origFn, cw)
+		} else {
+			sum.AddFile(fh.Name(), cw)
+		}
+		if pfh, ok := fh.(interface{ CloseAtomicallyReplace() error }); ok {
+			return pfh.CloseAtomicallyReplace()
+		}
+		return fh.Close()
+	}
+
+	if *flagSchedule != "" {
+		sched, err := parseSchedule(*flagSchedule)
+		if err != nil {
+			return fmt.Errorf("-schedule=%q: %w", *flagSchedule, err)
+		}
+		return runScheduled(ctx, sched, *flagOnFailure, func(ctx context.Context, now time.Time) error {
+			outFn, err := expandOutName(*flagOut, now)
+			if err != nil {
+				return err
+			}
+			return dump(ctx, outFn)
+		})
+	}
+	return dump(ctx, *flagOut)
+}
+
+// pendingFile is written into a temporary place, and replaces the target by CloseAtomicallyReplace.
+type pendingFile interface {
+	io.WriteCloser
+	Name() string
+	Cleanup() error
+	CloseAtomicallyReplace() error
+}
+
+// newPendingFile returns the pending file for the file name, or the object of the s3:// or gs:// URL.
+func newPendingFile(ctx context.Context, fn string) (pendingFile, error) {
+	if objstore.IsURL(fn) {
+		return objstore.Create(ctx, fn)
+	}
+	return renameio.NewPendingFile(fn, renameio.WithPermissions(0640))
+}
+
+// cursorFileName returns the file name for the n. cursor: out.csv.gz -> out_2.csv.gz
+func cursorFileName(fn string, n int) string {
+	dir, base := filepath.Split(fn)
+	if i := strings.IndexByte(base, '.'); i > 0 {
+		return dir + base[:i] + "_" + strconv.Itoa(n) + base[i:]
+	}
+	return fn + "_" + strconv.Itoa(n)
+}
+
+// dumpCSVFile dumps the rows into a separate file, with the given compression and encoding.
+func dumpCSVFile(ctx context.Context, sum *runSummary, fn, compress string, enc encoding.Encoding, rows *sql.Rows, columns []dbcsv.Column, header bool, sep string, raw bool) error {
+	pfh, err := newPendingFile(ctx, fn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	defer pfh.Cleanup()
+	cw := newCountingWriter(pfh)
+	wfh := io.WriteCloser(cw)
+	switch (strings.TrimSpace(strings.ToLower(compress)) + "  ")[:2] {
+	case "gz":
+		wfh = gzip.NewWriter(cw)
+	case "zs":
+		if wfh, err = zstd.NewWriter(cw); err != nil {
+			return err
+		}
+	}
+	w := encoding.ReplaceUnsupported(enc.NewEncoder()).Writer(wfh)
+	n, err := dbcsv.DumpCSVCount(ctx, w, rows, columns, header, sep, raw)
+	sum.AddRows(n)
+	if err != nil {
+		return err
+	}
+	if err = wfh.Close(); err != nil {
+		return err
+	}
+	sum.AddFile(fn, cw)
+	return pfh.CloseAtomicallyReplace()
+}
+
+type Query struct {
+	Query, Name            string
+	QueueName, Correlation string
+}
+
+// vim: se noet fileencoding=utf-8:
@@ -0,0 +1,306 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/godror/godror"
+
+	"github.com/UNO-SOFT/dbcsv"
+)
+
+func dumpRemoteCSVQueue(ctx context.Context, w io.Writer, next func() ([]byte, error), sep string) error {
+	return remoteCSV(ctx, w, sep, next)
+}
+
+// dequeueControl limits the dequeueing of a queue.
+type dequeueControl struct {
+	// remaining messages to dequeue, negative means unlimited.
+	remaining atomic.Int64
+	// stop is set when a CLOSE message arrives: no more Dequeue calls are issued,
+	// but the already dequeued messages are processed.
+	stop atomic.Bool
+	// IdleTimeout is the time after which a dequeuer gives up waiting for messages.
+	IdleTimeout time.Duration
+}
+
+func newDequeueControl(maxMessages int, idleTimeout time.Duration) *dequeueControl {
+	ctl := dequeueControl{IdleTimeout: idleTimeout}
+	if maxMessages > 0 {
+		ctl.remaining.Store(int64(maxMessages))
+	} else {
+		ctl.remaining.Store(-1)
+	}
+	return &ctl
+}
+
+// reserve at most n messages, returning the number of messages allowed to dequeue.
+func (ctl *dequeueControl) reserve(n int) int {
+	if ctl == nil {
+		return n
+	}
+	for {
+		if ctl.stop.Load() {
+			return 0
+		}
+		remaining := ctl.remaining.Load()
+		if remaining < 0 {
+			return n
+		}
+		k := min(int64(n), remaining)
+		if ctl.remaining.CompareAndSwap(remaining, remaining-k) {
+			return int(k)
+		}
+	}
+}
+
+// release gives back the unused part of a reservation.
+func (ctl *dequeueControl) release(n int) {
+	if ctl == nil || n <= 0 {
+		return
+	}
+	if ctl.remaining.Load() >= 0 {
+		ctl.remaining.Add(int64(n))
+	}
+}
+
+func queueNext(ctx context.Context, Q *godror.Queue, ctl *dequeueControl) func() ([]byte, error) {
+	var buf bytes.Buffer
+	var data godror.Data
+	messages := make([]godror.Message, 16)
+	off := len(messages)
+	var idleTimeout time.Duration
+	if ctl != nil {
+		idleTimeout = ctl.IdleTimeout
+	}
+	lastSeen := time.Now()
+
+	return func() ([]byte, error) {
+		if off >= len(messages) {
+			for {
+				k := ctl.reserve(cap(messages))
+				if k == 0 {
+					return nil, io.EOF
+				}
+				n, err := Q.Dequeue(messages[:k])
+				ctl.release(k - n)
+				logger.Debug("Dequeue", "n", n, "error", err)
+				if err != nil {
+					return nil, err
+				}
+				if n != 0 {
+					lastSeen = time.Now()
+					messages = messages[:n]
+					for i := 0; i < len(messages); i++ {
+						if messages[i].Object == nil {
+							logger.Warn("nil object", "i", i)
+							messages = slices.Delete(messages, i, i+1)
+						}
+					}
+					if len(messages) == 0 {
+						continue
+					}
+					off = 0
+					break
+				}
+				if idleTimeout > 0 && time.Since(lastSeen) >= idleTimeout {
+					logger.Info("idle timeout", "queue", Q.Name(), "idle", idleTimeout.String())
+					return nil, io.EOF
+				}
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+
+		obj := messages[off].Object
+		msgID := messages[off].MsgID
+		corrID := messages[off].Correlation
+		off++
+		logger := logger.With("msgID", msgID)
+		if err := obj.GetAttribute(&data, "PAYLOAD"); err != nil {
+			obj.Close()
+			return nil, fmt.Errorf("%q.get BLOB: %w", msgID, err)
+		}
+		lob := data.GetLob()
+		// This asserts that lob is a BLOB!
+		size, err := lob.Size()
+		if err != nil {
+			obj.Close()
+			return nil, fmt.Errorf("%q.getLOB: %w", msgID, err)
+		}
+		buf.Reset()
+		_, err = io.Copy(&buf, io.LimitReader(lob, size))
+		obj.Close()
+		if err != nil && buf.Len() == 0 {
+			return nil, err
+		}
+
+		payload := buf.Bytes()
+		logger.Debug("payload", "length", size, "payload", payload, "corrid", corrID)
+		if bytes.Equal(payload, []byte("CLOSE")) {
+			if ctl != nil {
+				ctl.stop.Store(true)
+			}
+			return nil, io.EOF
+		}
+		return payload, nil
+	}
+}
+
+func (Q *Query) ParseQueue() {
+	cut := func(s string) (prefix, suffix string, found bool) {
+		const sepChars = "/"
+		i := strings.IndexAny(s, sepChars)
+		if i < 0 {
+			return s, "", false
+		}
+		return s[:i], strings.TrimLeftFunc(s[i+1:], func(r rune) bool { return strings.ContainsRune(sepChars, r) }), true
+	}
+	Q.QueueName, Q.Correlation, _ = cut(Q.Query)
+	logger.Debug("ParseQueue", "src", Q.Query, "name", Q.QueueName, "correlation", Q.Correlation)
+}
+
+type queueOpener interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+	godror.Execer
+}
+
+func (Q *Query) payloadTypeName(ctx context.Context, db queueOpener) (string, error) {
+	const qry = `SELECT B.object_type FROM user_queue_tables B, user_queues A WHERE B.queue_table = A.queue_table AND A.NAME = UPPER(:1)`
+	var typeName string
+	if err := db.QueryRowContext(ctx, qry, Q.QueueName).Scan(&typeName); err != nil {
+		return "", fmt.Errorf("%s [%q]: %w", qry, Q.QueueName, err)
+	}
+	return typeName, nil
+}
+
+func (Q *Query) OpenQueue(ctx context.Context, db queueOpener) (*godror.Queue, error) {
+	typeName, err := Q.payloadTypeName(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("NewQueue", "name", Q.QueueName, "type", typeName, "correlation", Q.Correlation)
+	return godror.NewQueue(ctx, db, Q.QueueName, typeName, godror.WithDeqOptions(godror.DeqOptions{
+		Mode:        godror.DeqRemove,
+		Navigation:  godror.NavFirst,
+		Visibility:  godror.VisibleImmediate,
+		Correlation: Q.Correlation,
+		Wait:        time.Second,
+	}))
+}
+
+// OpenEnqueue opens the queue for enqueueing, with immediate visibility,
+// so the messages are committed independently of the (read-only) transaction.
+func (Q *Query) OpenEnqueue(ctx context.Context, db queueOpener) (*godror.Queue, error) {
+	typeName, err := Q.payloadTypeName(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("NewQueue", "name", Q.QueueName, "type", typeName, "enqueue", true)
+	return godror.NewQueue(ctx, db, Q.QueueName, typeName, godror.WithEnqOptions(godror.EnqOptions{
+		Visibility:   godror.VisibleImmediate,
+		DeliveryMode: godror.DeliverPersistent,
+	}))
+}
+
+// enqueueRows puts the rows into the queue, chunk rows per message,
+// serialized as CSV lines (with header if asked), or JSON lines.
+func enqueueRows(ctx context.Context, Q *godror.Queue, correlation string, rows *sql.Rows, columns []dbcsv.Column, chunk int, format string, header bool, sep string) (int, error) {
+	if Q.PayloadObjectType == nil {
+		return 0, fmt.Errorf("%s: only object payload (with PAYLOAD BLOB attribute) is supported", Q.Name())
+	}
+	if chunk <= 0 {
+		chunk = 1
+	}
+	isJSON := format != "csv"
+	values := make([]dbcsv.Stringer, len(columns))
+	dest := make([]interface{}, len(columns))
+	convSep := sep
+	if isJSON {
+		convSep = ""
+	}
+	for i, col := range columns {
+		values[i] = col.Converter(convSep)
+		dest[i] = values[i].Pointer()
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	m := make(map[string]interface{}, len(columns))
+	flush := func() error {
+		obj, err := Q.PayloadObjectType.NewObject()
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		if err = obj.Set("PAYLOAD", buf.Bytes()); err != nil {
+			return fmt.Errorf("set PAYLOAD: %w", err)
+		}
+		if err = Q.Enqueue([]godror.Message{{Object: obj, Correlation: correlation}}); err != nil {
+			return fmt.Errorf("%s.Enqueue: %w", Q.Name(), err)
+		}
+		buf.Reset()
+		return nil
+	}
+	var n, k int
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return n, fmt.Errorf("scan into %#v: %w", dest, err)
+		}
+		if isJSON {
+			rowMap(m, columns, values)
+			if err := enc.Encode(m); err != nil {
+				return n, err
+			}
+		} else {
+			if k == 0 && header {
+				for i, c := range columns {
+					if i != 0 {
+						buf.WriteString(sep)
+					}
+					buf.WriteString(c.Name)
+				}
+				buf.WriteByte('\n')
+			}
+			for i := range values {
+				if i != 0 {
+					buf.WriteString(sep)
+				}
+				buf.WriteString(values[i].String())
+			}
+			buf.WriteByte('\n')
+		}
+		n++
+		if k++; k == chunk {
+			if err := flush(); err != nil {
+				return n, err
+			}
+			k = 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if k != 0 {
+		return n, flush()
+	}
+	return n, nil
+}
@@ -0,0 +1,747 @@
+// Copyright 2023 Tamás Gulácsi.
+//
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type command struct {
+	Name string     `json:"c"`
+	Args []argument `json:"a,omitempty"`
+}
+type argument struct {
+	Date     *time.Time             `json:"d,omitempty"`
+	Coord    *coordinate            `json:"c,omitempty"`
+	String   string                 `json:"s,omitempty"`
+	Type     string                 `json:"t"`
+	Raw      json.RawMessage        `json:"r,omitempty"`
+	RichText []excelize.RichTextRun `json:"R,omitempty"`
+	Float    float64                `json:"f,omitempty"`
+	Int      int                    `json:"i,omitempty"`
+	Bool     bool                   `json:"b,omitempty"`
+}
+type coordinate struct {
+	Row int `json:"r"`
+	Col int `json:"c"`
+}
+
+func colName(i int) string {
+	s, err := excelize.ColumnNumberToName(i)
+	if err != nil {
+		panic(fmt.Errorf("%d is not a valid column: %w", i, err))
+	}
+	return s
+}
+
+// asCoord reports whether the argument is a coordinate,
+// converting "A1"-style cell name strings to coordinates.
+func (a *argument) asCoord() bool {
+	if a.Type == "c" {
+		return true
+	}
+	if a.Type != "s" || a.String == "" {
+		return false
+	}
+	col, row, err := excelize.CellNameToCoordinates(a.String)
+	if err != nil {
+		return false
+	}
+	a.Type, a.Coord = "c", &coordinate{Row: row, Col: col}
+	return true
+}
+
+func (c *coordinate) String() string {
+	if c == nil {
+		return ""
+	}
+	return colName(c.Col) + strconv.Itoa(c.Row)
+}
+
+// executeCommands executes the commands returned by next, and writes the resulting XLSX to w.
+//
+// With streaming, the row arrays are written with a StreamWriter per sheet,
+// and only the commands not touching the already written cells are allowed on those sheets.
+func executeCommands(ctx context.Context, w io.Writer, next func() ([]byte, error), streaming bool) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	var strs []string
+	var arr []any
+	row := 1
+	styles := make(map[string]int)
+	condStyles := make(map[string]int)
+	sheets := make(map[string]int)
+	streams := make(map[string]*streamSheet)
+	// stream returns the streamSheet of the sheet, starting it at the first use.
+	stream := func(name string) (*streamSheet, error) {
+		ss := streams[name]
+		if ss == nil {
+			sw, err := f.NewStreamWriter(name)
+			if err != nil {
+				return nil, fmt.Errorf("NewStreamWriter(%q): %w", name, err)
+			}
+			ss = &streamSheet{StreamWriter: sw}
+			streams[name] = ss
+		}
+		return ss, nil
+	}
+	var sheet string
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s, err := next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		data := []byte(s)
+		if len(s) != 0 && s[0] == '[' {
+			if sheet == "" {
+				idx := -1
+				for i, nm := range f.GetSheetMap() {
+					if idx < 0 || i < idx {
+						idx, sheet = i, nm
+					}
+				}
+				if sheet == "" {
+					sheet = "sheet"
+					if _, err = f.NewSheet(sheet); err != nil {
+						return err
+					}
+				}
+			}
+
+			if streaming {
+				ss, err := stream(sheet)
+				if err != nil {
+					return err
+				}
+				clear(arr)
+				arr = arr[:0]
+				if err = json.Unmarshal(data, &arr); err != nil {
+					return fmt.Errorf("decode %q into []any: %w", string(data), err)
+				}
+				if err = ss.setRow(row, arr); err != nil {
+					return fmt.Errorf("%s: %w", sheet, err)
+				}
+				row++
+				continue
+			}
+
+			clear(strs)
+			strs = strs[:0]
+			if err := json.Unmarshal(data, &strs); err == nil {
+				for i, s := range strs {
+					var cell string
+					if cell, err = excelize.CoordinatesToCellName(i+1, row); err == nil {
+						err = f.SetCellStr(sheet, cell, s)
+					}
+					if err != nil {
+						return err
+					}
+				}
+			} else {
+				clear(arr)
+				arr = arr[:0]
+				if err = json.Unmarshal(data, &arr); err != nil {
+					return fmt.Errorf("decode %q into []any: %w", string(data), err)
+				}
+				clear(strs)
+				for i, a := range arr {
+					cell, err := excelize.CoordinatesToCellName(i+1, row)
+					if err != nil {
+						return err
+					}
+					switch x := a.(type) {
+					case bool:
+						err = f.SetCellBool(sheet, cell, x)
+					case float32:
+						err = f.SetCellFloat(sheet, cell, float64(x), -1, 32)
+					case float64:
+						err = f.SetCellFloat(sheet, cell, x, -1, 64)
+					case int:
+						err = f.SetCellInt(sheet, cell, x)
+					case int32:
+						err = f.SetCellInt(sheet, cell, int(x))
+					case int64:
+						err = f.SetCellInt(sheet, cell, int(x))
+					case string:
+						err = f.SetCellStr(sheet, cell, x)
+					default:
+						err = f.SetCellStr(sheet, cell, fmt.Sprintf("%v", a))
+					}
+					if err != nil {
+						return err
+					}
+				}
+			}
+			row++
+			continue
+		}
+
+		var c command
+		if err = json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("unmarshal %q: %w", s, err)
+		}
+		for i, a := range c.Args {
+			if a.Type == "" {
+				c.Args[i].Type = "s"
+			}
+		}
+		slog.Debug("executing", "command", c)
+		if streaming && len(c.Args) != 0 && c.Args[0].Type == "s" {
+			if name := c.Args[0].String; streamCommands[c.Name] {
+				ss, err := stream(name)
+				if err != nil {
+					return err
+				}
+				if c.Name == "setCell" {
+					sheet = name
+				}
+				if err = ss.execute(c, styles); err != nil {
+					return fmt.Errorf("command %#v: %w", c, err)
+				}
+				continue
+			} else if streams[name] != nil && streamUnsupported[c.Name] {
+				return fmt.Errorf("command %#v: %s: %w", c, c.Name, errStreamUnsupported)
+			}
+		}
+		switch c.Name {
+		case "addChart":
+			// the chart is an excelize.Chart, the optional combo charts are []excelize.Chart
+			types := "scr"
+			if len(c.Args) > len(types) {
+				types += "r"
+			}
+			if err = c.checkArgs(types); err == nil {
+				var chart excelize.Chart
+				if err = json.Unmarshal(c.Args[2].Raw, &chart); err == nil {
+					var combo []*excelize.Chart
+					if len(c.Args) > 3 {
+						err = json.Unmarshal(c.Args[3].Raw, &combo)
+					}
+					if err == nil {
+						err = f.AddChart(c.Args[0].String, c.Args[1].Coord.String(), &chart, combo...)
+					}
+				}
+			}
+		case "addPicture":
+			// the picture is an excelize.Picture, with the File as base64-encoded bytes
+			if err = c.checkArgs("scr"); err == nil {
+				var pic excelize.Picture
+				if err = json.Unmarshal(c.Args[2].Raw, &pic); err == nil {
+					if pic.Extension != "" && pic.Extension[0] != '.' {
+						pic.Extension = "." + pic.Extension
+					}
+					err = f.AddPictureFromBytes(c.Args[0].String, c.Args[1].Coord.String(), &pic)
+				}
+			}
+		case "autoFilter":
+			types := "scc"
+			if len(c.Args) > len(types) {
+				types += "r"
+			}
+			if err = c.checkArgs(types); err == nil {
+				var opts []excelize.AutoFilterOptions
+				if len(c.Args) > 3 {
+					err = json.Unmarshal(c.Args[3].Raw, &opts)
+				}
+				if err == nil {
+					err = f.AutoFilter(c.Args[0].String, c.Args[1].Coord.String()+":"+c.Args[2].Coord.String(), opts)
+				}
+			}
+		case "dataValidation":
+			// the validation is an excelize.DataValidation, with an optional DropList of the allowed values
+			if err = c.checkArgs("sccr"); err == nil {
+				var dv struct {
+					excelize.DataValidation
+					DropList []string
+				}
+				if err = json.Unmarshal(c.Args[3].Raw, &dv); err == nil {
+					dv.SetSqref(c.Args[1].Coord.String() + ":" + c.Args[2].Coord.String())
+					if len(dv.DropList) != 0 {
+						err = dv.SetDropList(dv.DropList)
+					}
+					if err == nil {
+						err = f.AddDataValidation(c.Args[0].String, &dv.DataValidation)
+					}
+				}
+			}
+		case "insertPageBreak":
+			if err = c.checkArgs("sc"); err == nil {
+				err = f.InsertPageBreak(c.Args[0].String, c.Args[1].Coord.String())
+			}
+		case "mergeCell":
+			if err = c.checkArgs("scc"); err == nil {
+				err = f.MergeCell(c.Args[0].String, c.Args[1].Coord.String(), c.Args[2].Coord.String())
+			}
+		case "newSheet":
+			sheet = c.Args[0].String
+			if err = c.checkArgs("s"); err == nil {
+				sheets[sheet], err = f.NewSheet(c.Args[0].String)
+			}
+		case "newStyle":
+			if err = c.checkArgs("sr"); err == nil {
+				var s excelize.Style
+				if err = json.Unmarshal(c.Args[1].Raw, &s); err == nil {
+					styles[c.Args[0].String], err = f.NewStyle(&s)
+				}
+				slog.Debug("newStyle", "raw", string(c.Args[1].Raw), "style", s, "name", c.Args[0].String, "index", styles[c.Args[0].String], "error", err)
+			}
+		case "newConditionalStyle":
+			if err = c.checkArgs("sr"); err == nil {
+				var s excelize.Style
+				if err = json.Unmarshal(c.Args[1].Raw, &s); err == nil {
+					condStyles[c.Args[0].String], err = f.NewConditionalStyle(&s)
+				}
+				slog.Debug("newConditionalStype", "raw", string(c.Args[1].Raw), "style", s, "name", c.Args[0].String, "index", condStyles[c.Args[0].String], "error", err)
+			}
+		case "protectSheet":
+			if err = c.checkArgs("sr"); err == nil {
+				var o excelize.SheetProtectionOptions
+				if err = json.Unmarshal(c.Args[1].Raw, &o); err == nil {
+					err = f.ProtectSheet(c.Args[0].String, &o)
+				}
+			}
+		case "protectWorkbook":
+			if err = c.checkArgs("r"); err == nil {
+				var o excelize.WorkbookProtectionOptions
+				if err = json.Unmarshal(c.Args[0].Raw, &o); err == nil {
+					err = f.ProtectWorkbook(&o)
+				}
+			}
+		case "setActiveSheet":
+			if err = c.checkArgs("i"); err == nil {
+				f.SetActiveSheet(c.Args[0].Int)
+			}
+		case "setCell":
+			if len(c.Args) != 3 || c.Args[0].Type != "s" || !c.Args[1].asCoord() {
+				return fmt.Errorf("setCell requires sheet,cell,value, got %v", c.Args)
+			}
+			var cell string
+			sheet, cell = c.Args[0].String, c.Args[1].Coord.String()
+			a := c.Args[2]
+			switch a.Type {
+			case "b", "bool":
+				err = f.SetCellBool(sheet, cell, a.Bool)
+			case "f", "float":
+				err = f.SetCellFloat(sheet, cell, a.Float, -1, 64)
+			case "F", "formula":
+				err = f.SetCellFormula(sheet, cell, a.String)
+			case "i", "int":
+				err = f.SetCellInt(sheet, cell, a.Int)
+			case "R", "richtext":
+				err = f.SetCellRichText(sheet, cell, a.RichText)
+			case "s", "string":
+				err = f.SetCellStr(sheet, cell, a.String)
+			default:
+				slog.Warn("setCell", "sheet", sheet, "cell", cell, "arg", a, "unknown type", a.Type)
+				err = f.SetCellStr(sheet, cell, a.String)
+			}
+		case "setCellFormula":
+			if err = c.checkArgs("scs"); err == nil {
+				err = f.SetCellFormula(c.Args[0].String, c.Args[1].Coord.String(), c.Args[2].String)
+			}
+		case "setCellHyperlink":
+			if err = c.checkArgs("scHs"); err == nil {
+				err = f.SetCellHyperLink(c.Args[0].String, c.Args[1].Coord.String(), c.Args[2].String, c.Args[3].String)
+			}
+		case "setCellStyle":
+			if err = c.checkArgs("sccs"); err == nil {
+				if si, ok := styles[c.Args[3].String]; !ok {
+					err = fmt.Errorf("style %q is not found (have: %v)", c.Args[3].String, styles)
+				} else {
+					err = f.SetCellStyle(c.Args[0].String, c.Args[1].Coord.String(), c.Args[2].Coord.String(), si)
+				}
+			}
+		case "setConditionalFormat":
+			if err = c.checkArgs("sccr"); err == nil {
+				var cf []excelize.ConditionalFormatOptions
+				if err = json.Unmarshal(c.Args[3].Raw, &cf); err == nil {
+					s := c.Args[1].Coord.String()
+					if c.Args[2].Coord != nil {
+						s += ":" + c.Args[2].Coord.String()
+					}
+					err = f.SetConditionalFormat(c.Args[0].String, s, cf)
+				}
+			}
+		case "setColStyle":
+			if err = c.checkArgs("siis"); err == nil {
+				if si, ok := styles[c.Args[3].String]; !ok {
+					err = fmt.Errorf("style %q is not found", c.Args[3].String)
+				} else {
+					cols := colName(c.Args[1].Int)
+					if c.Args[2].Int > c.Args[1].Int {
+						cols += ":" + strconv.Itoa(c.Args[2].Int)
+					}
+					err = f.SetColStyle(c.Args[0].String, cols, si)
+				}
+			}
+		case "setColOutlineLevel":
+			if err = c.checkArgs("sii"); err == nil {
+				err = f.SetColOutlineLevel(c.Args[0].String, colName(c.Args[1].Int), uint8(c.Args[2].Int))
+			}
+		case "setColWidth":
+			if err = c.checkArgs("siif"); err == nil {
+				err = f.SetColWidth(
+					c.Args[0].String,
+					colName(c.Args[1].Int), colName(c.Args[1].Int),
+					c.Args[3].Float)
+			}
+		case "setDefaultFont":
+			if err = c.checkArgs("s"); err == nil {
+				err = f.SetDefaultFont(c.Args[0].String)
+			}
+		case "setPanes":
+			var panes *excelize.Panes
+			if panes, err = c.panes(); err == nil {
+				err = f.SetPanes(c.Args[0].String, panes)
+			}
+		case "setRowHeight":
+			if err = c.checkArgs("sif"); err == nil {
+				err = f.SetRowHeight(c.Args[0].String, c.Args[1].Int, c.Args[2].Float)
+			}
+		case "setRowOutlineLevel":
+			if err = c.checkArgs("sii"); err == nil {
+				err = f.SetRowOutlineLevel(c.Args[0].String, c.Args[1].Int, uint8(c.Args[2].Int))
+			}
+		case "setRowStyle":
+			if err = c.checkArgs("siis"); err == nil {
+				err = f.SetRowStyle(c.Args[0].String, c.Args[1].Int, c.Args[2].Int, styles[c.Args[3].String])
+			}
+		case "setSheetName":
+			if err = c.checkArgs("ss"); err == nil {
+				err = f.SetSheetName(c.Args[0].String, c.Args[1].String)
+			}
+		default:
+			return fmt.Errorf("unknown command %q", c.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("command %#v: %w", c, err)
+		}
+	}
+	for nm, ss := range streams {
+		if err := ss.Flush(); err != nil {
+			return fmt.Errorf("flush %q: %w", nm, err)
+		}
+	}
+	if _, err := f.WriteTo(w); err != nil {
+		return fmt.Errorf("WriteTo: %w", err)
+	}
+	return nil
+}
+
+var errStreamUnsupported = errors.New("not supported on streamed sheet")
+
+// streamCommands are executed by the streamSheet, in streaming mode.
+var streamCommands = map[string]bool{
+	"mergeCell": true, "setCell": true, "setCellFormula": true,
+	"setCellStyle": true, "setRowStyle": true, "setColWidth": true, "setPanes": true,
+}
+
+// streamUnsupported are not supported on a streamed sheet.
+var streamUnsupported = map[string]bool{
+	"setCellHyperlink": true, "setColOutlineLevel": true, "setColStyle": true,
+	"setRowHeight": true, "setRowOutlineLevel": true, "setSheetName": true,
+}
+
+// streamSheet is a sheet written by a StreamWriter.
+type streamSheet struct {
+	*excelize.StreamWriter
+	// styles to be applied to the not yet written rows.
+	styles []streamStyle
+	// cells are the values set for the not yet written rows, by row and column.
+	cells map[int]map[int]any
+	// last is the last written row.
+	last int
+}
+
+type streamStyle struct {
+	From, To coordinate
+	Style    int
+}
+
+func (st streamStyle) contains(row, col int) bool {
+	return st.From.Row <= row && row <= st.To.Row && st.From.Col <= col && col <= st.To.Col
+}
+
+func (ss *streamSheet) setRow(row int, values []any) error {
+	if err := ss.writeCells(row); err != nil {
+		return err
+	}
+	cells := make([]any, len(values))
+	for i, v := range values {
+		switch v.(type) {
+		case nil, bool, float64, string:
+		default:
+			v = fmt.Sprintf("%v", v)
+		}
+		cells[i] = v
+	}
+	for col, v := range ss.cells[row] {
+		for len(cells) < col {
+			cells = append(cells, nil)
+		}
+		cells[col-1] = v
+	}
+	delete(ss.cells, row)
+	for i, v := range cells {
+		for _, st := range ss.styles {
+			if !st.contains(row, i+1) {
+				continue
+			}
+			if c, ok := v.(excelize.Cell); ok {
+				c.StyleID = st.Style
+				cells[i] = c
+			} else {
+				cells[i] = excelize.Cell{StyleID: st.Style, Value: v}
+			}
+		}
+	}
+	ss.last = row
+	return ss.SetRow((&coordinate{Col: 1, Row: row}).String(), cells)
+}
+
+// writeCells writes the rows of the cells set before the row.
+func (ss *streamSheet) writeCells(row int) error {
+	rows := make([]int, 0, len(ss.cells))
+	for r := range ss.cells {
+		if r < row {
+			rows = append(rows, r)
+		}
+	}
+	sort.Ints(rows)
+	for _, r := range rows {
+		if err := ss.setRow(r, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes the remaining cells, and ends the stream.
+func (ss *streamSheet) Flush() error {
+	if err := ss.writeCells(excelize.TotalRows + 1); err != nil {
+		return err
+	}
+	return ss.StreamWriter.Flush()
+}
+
+// execute the command (one of streamCommands) on the streamed sheet.
+// The rows are written in order, so only the not yet written rows can be changed.
+func (ss *streamSheet) execute(c command, styles map[string]int) error {
+	switch c.Name {
+	case "mergeCell":
+		if err := c.checkArgs("scc"); err != nil {
+			return err
+		}
+		return ss.MergeCell(c.Args[1].Coord.String(), c.Args[2].Coord.String())
+	case "setCell", "setCellFormula":
+		var v any
+		if c.Name == "setCellFormula" {
+			if err := c.checkArgs("scs"); err != nil {
+				return err
+			}
+			v = excelize.Cell{Formula: c.Args[2].String}
+		} else {
+			if len(c.Args) != 3 || !c.Args[1].asCoord() {
+				return fmt.Errorf("setCell requires sheet,cell,value, got %v", c.Args)
+			}
+			switch a := c.Args[2]; a.Type {
+			case "b", "bool":
+				v = a.Bool
+			case "f", "float":
+				v = a.Float
+			case "F", "formula":
+				v = excelize.Cell{Formula: a.String}
+			case "i", "int":
+				v = a.Int
+			case "R", "richtext":
+				v = a.RichText
+			case "s", "string":
+				v = a.String
+			default:
+				slog.Warn("setCell", "sheet", c.Args[0].String, "cell", c.Args[1].Coord.String(), "arg", a, "unknown type", a.Type)
+				v = a.String
+			}
+		}
+		at := *c.Args[1].Coord
+		if at.Row <= ss.last {
+			return fmt.Errorf("%s: row %d is already written: %w", c.Name, at.Row, errStreamUnsupported)
+		}
+		if ss.cells == nil {
+			ss.cells = make(map[int]map[int]any)
+		}
+		if ss.cells[at.Row] == nil {
+			ss.cells[at.Row] = make(map[int]any)
+		}
+		ss.cells[at.Row][at.Col] = v
+		return nil
+	case "setCellStyle", "setRowStyle":
+		var st streamStyle
+		var name string
+		if c.Name == "setCellStyle" {
+			if err := c.checkArgs("sccs"); err != nil {
+				return err
+			}
+			st.From, st.To, name = *c.Args[1].Coord, *c.Args[2].Coord, c.Args[3].String
+		} else {
+			if err := c.checkArgs("siis"); err != nil {
+				return err
+			}
+			st.From = coordinate{Row: c.Args[1].Int, Col: 1}
+			st.To = coordinate{Row: c.Args[2].Int, Col: excelize.MaxColumns}
+			name = c.Args[3].String
+		}
+		if st.From.Row <= ss.last {
+			return fmt.Errorf("%s: row %d is already written: %w", c.Name, st.From.Row, errStreamUnsupported)
+		}
+		var ok bool
+		if st.Style, ok = styles[name]; !ok {
+			return fmt.Errorf("style %q is not found (have: %v)", name, styles)
+		}
+		ss.styles = append(ss.styles, st)
+		return nil
+	case "setColWidth", "setPanes":
+		if ss.last != 0 {
+			return fmt.Errorf("%s: only before the rows: %w", c.Name, errStreamUnsupported)
+		}
+		if c.Name == "setPanes" {
+			panes, err := c.panes()
+			if err != nil {
+				return err
+			}
+			return ss.SetPanes(panes)
+		}
+		if err := c.checkArgs("siif"); err != nil {
+			return err
+		}
+		return ss.SetColWidth(c.Args[1].Int, c.Args[2].Int, c.Args[3].Float)
+	}
+	return fmt.Errorf("%s: %w", c.Name, errStreamUnsupported)
+}
+
+// panes returns the Panes of the setPanes command:
+// either the full excelize.Panes, or the number of columns and rows to freeze.
+func (c command) panes() (*excelize.Panes, error) {
+	if len(c.Args) != 3 {
+		if err := c.checkArgs("sr"); err != nil {
+			return nil, err
+		}
+		var panes excelize.Panes
+		if err := json.Unmarshal(c.Args[1].Raw, &panes); err != nil {
+			return nil, err
+		}
+		return &panes, nil
+	}
+	if err := c.checkArgs("sii"); err != nil {
+		return nil, err
+	}
+	panes := excelize.Panes{
+		Freeze: true,
+		XSplit: c.Args[1].Int, YSplit: c.Args[2].Int,
+		TopLeftCell: (&coordinate{Col: c.Args[1].Int + 1, Row: c.Args[2].Int + 1}).String(),
+		ActivePane:  "bottomRight",
+	}
+	switch {
+	case panes.XSplit == 0:
+		panes.ActivePane = "bottomLeft"
+	case panes.YSplit == 0:
+		panes.ActivePane = "topRight"
+	}
+	return &panes, nil
+}
+
+var (
+	errArgTypeMismatch = errors.New("argument type mismatch")
+	errArgNumMismatch  = errors.New("argument number mismatch")
+)
+
+func (c command) checkArgs(types string) error {
+	if len(c.Args) != len(types) {
+		return fmt.Errorf("%s wants %d args, got %d: %w", c.Name, len(types), len(c.Args), errArgNumMismatch)
+	}
+	for i, r := range types {
+		if r == 'c' && c.Args[i].asCoord() {
+			continue
+		}
+		if c.Args[i].Type != string([]rune{r}) {
+			return fmt.Errorf("%s %d. arg wants %v, got %v: %w", c.Name, i, r, c.Args[i].Type, errArgTypeMismatch)
+		}
+	}
+	return nil
+}
+
+func dumpRemoteCSV(ctx context.Context, w io.Writer, rows *sql.Rows, sep string) error {
+	return remoteCSV(ctx, w, sep, func() ([]byte, error) {
+		if !rows.Next() {
+			err := rows.Close()
+			if err == nil {
+				err = rows.Err()
+			}
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		var s string
+		err := rows.Scan(&s)
+		return []byte(s), err
+	})
+}
+
+func remoteCSV(ctx context.Context, w io.Writer, sep string, next func() ([]byte, error)) error {
+	var strs []string
+	var arr []any
+	cw := csv.NewWriter(w)
+	if sep != "" {
+		cw.Comma = ([]rune(sep))[0]
+	}
+
+	for {
+		data, err := next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		clear(strs)
+		strs = strs[:0]
+		if err := json.Unmarshal(data, &strs); err != nil {
+			clear(arr)
+			arr = arr[:0]
+			if err = json.Unmarshal(data, &arr); err != nil {
+				return fmt.Errorf("decode %q into []any: %w", string(data), err)
+			}
+			for _, a := range arr {
+				strs = append(strs, fmt.Sprintf("%v", a))
+			}
+		}
+		if err := cw.Write(strs); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
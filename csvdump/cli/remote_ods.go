@@ -0,0 +1,376 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// executeODSCommands is like executeCommands, but renders to ODS, supporting only a subset of the commands:
+// sheets, rows, merged cells and bold header/column styles.
+// Formatting commands ODS output cannot express are skipped with a warning,
+// the cell contents (setCell*) and reopening a written sheet are errors.
+//
+// The rows of a sheet are kept in memory till the sheet is finished,
+// as a merge may cover the already appended rows.
+func executeODSCommands(ctx context.Context, w io.Writer, next func() ([]byte, error)) error {
+	ow, err := newODSWriter(w)
+	if err != nil {
+		return err
+	}
+	bold := make(map[string]bool)
+	var cur *odsSheet
+	// written holds the names of the closed sheets.
+	written := make(map[string]bool)
+	closeSheet := func() error {
+		if cur == nil {
+			return nil
+		}
+		written[cur.Name] = true
+		err := ow.writeSheet(cur)
+		cur = nil
+		return err
+	}
+	// sheets are written one after the other, so switching closes the current sheet,
+	// and a closed sheet cannot be reopened.
+	getSheet := func(name string) (*odsSheet, error) {
+		if cur != nil && cur.Name == name {
+			return cur, nil
+		}
+		if written[name] {
+			return nil, fmt.Errorf("sheet %q is already written: %w", name, errODSUnsupported)
+		}
+		if err := closeSheet(); err != nil {
+			return nil, err
+		}
+		cur = &odsSheet{Name: name}
+		return cur, nil
+	}
+	// on error, the writer must be closed to release the zip
+	defer func() {
+		if ow != nil {
+			_ = ow.Close()
+		}
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		if len(data) != 0 && data[0] == '[' {
+			var arr []any
+			if err = json.Unmarshal(data, &arr); err != nil {
+				return fmt.Errorf("decode %q into []any: %w", string(data), err)
+			}
+			if cur == nil {
+				cur = &odsSheet{Name: "sheet"}
+			}
+			cur.Rows = append(cur.Rows, arr)
+			continue
+		}
+
+		var c command
+		if err = json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("unmarshal %q: %w", data, err)
+		}
+		for i, a := range c.Args {
+			if a.Type == "" {
+				c.Args[i].Type = "s"
+			}
+		}
+		slog.Debug("executing", "command", c)
+		switch c.Name {
+		case "newSheet":
+			if err = c.checkArgs("s"); err == nil {
+				if err = closeSheet(); err == nil {
+					_, err = getSheet(c.Args[0].String)
+				}
+			}
+		case "newStyle":
+			if err = c.checkArgs("sr"); err == nil {
+				var s excelize.Style
+				if err = json.Unmarshal(c.Args[1].Raw, &s); err == nil {
+					bold[c.Args[0].String] = s.Font != nil && s.Font.Bold
+				}
+			}
+		case "setCellStyle":
+			var sh *odsSheet
+			if err = c.checkArgs("sccs"); err == nil {
+				if sh, err = getSheet(c.Args[0].String); err != nil {
+					break
+				}
+				if c.Args[1].Coord.Row == 1 && c.Args[2].Coord.Row == 1 {
+					sh.HeaderBold = bold[c.Args[3].String]
+				} else {
+					slog.Warn("ods: only the style of the header row can be set", "command", c)
+				}
+			}
+		case "setRowStyle":
+			var sh *odsSheet
+			if err = c.checkArgs("siis"); err == nil {
+				if sh, err = getSheet(c.Args[0].String); err != nil {
+					break
+				}
+				if c.Args[1].Int == 1 {
+					sh.HeaderBold = bold[c.Args[3].String]
+				} else {
+					slog.Warn("ods: only the style of the header row can be set", "command", c)
+				}
+			}
+		case "setColStyle":
+			var sh *odsSheet
+			if err = c.checkArgs("siis"); err == nil {
+				if sh, err = getSheet(c.Args[0].String); err != nil {
+					break
+				}
+				for i := c.Args[1].Int; i <= max(c.Args[1].Int, c.Args[2].Int); i++ {
+					if sh.ColBold == nil {
+						sh.ColBold = make(map[int]bool)
+					}
+					sh.ColBold[i] = bold[c.Args[3].String]
+				}
+			}
+		case "mergeCell":
+			var sh *odsSheet
+			if err = c.checkArgs("scc"); err == nil {
+				if sh, err = getSheet(c.Args[0].String); err != nil {
+					break
+				}
+				err = sh.merge(*c.Args[1].Coord, *c.Args[2].Coord)
+			}
+		case "setCell", "setCellFormula", "setCellHyperlink", "setCellRichText":
+			err = fmt.Errorf("%s: %w", c.Name, errODSUnsupported)
+		default:
+			slog.Warn("ods: skip unsupported command", "command", c.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("command %#v: %w", c, err)
+		}
+	}
+	if err := closeSheet(); err != nil {
+		return err
+	}
+	err = ow.Close()
+	ow = nil
+	return err
+}
+
+var errODSUnsupported = errors.New("not supported with ODS output")
+
+// odsSheet is collected till it is written by odsWriter.writeSheet.
+type odsSheet struct {
+	ColBold    map[int]bool
+	Name       string
+	Rows       [][]any
+	Merges     []odsMerge
+	HeaderBold bool
+}
+
+// odsMerge is a merged range of cells, with 1-based inclusive coordinates.
+type odsMerge struct {
+	Top, Left, Bottom, Right int
+}
+
+func (m odsMerge) overlaps(o odsMerge) bool {
+	return m.Left <= o.Right && o.Left <= m.Right && m.Top <= o.Bottom && o.Top <= m.Bottom
+}
+
+// merge the cells between the two corners. As with excelize, the overlapping previous merges are removed.
+func (sh *odsSheet) merge(a, b coordinate) error {
+	if a.Row < 1 || a.Col < 1 || b.Row < 1 || b.Col < 1 {
+		return fmt.Errorf("merge %s:%s: invalid range", a.String(), b.String())
+	}
+	m := odsMerge{
+		Top: min(a.Row, b.Row), Left: min(a.Col, b.Col),
+		Bottom: max(a.Row, b.Row), Right: max(a.Col, b.Col),
+	}
+	if m.Top == m.Bottom && m.Left == m.Right {
+		return nil
+	}
+	merges := sh.Merges[:0]
+	for _, o := range sh.Merges {
+		if !o.overlaps(m) {
+			merges = append(merges, o)
+		}
+	}
+	sh.Merges = append(merges, m)
+	return nil
+}
+
+// odsWriter writes an ODS file with one content.xml, written sheet by sheet.
+type odsWriter struct {
+	zw      *zip.Writer
+	content *bufio.Writer
+}
+
+const odsBoldStyle = "bold"
+
+func newODSWriter(w io.Writer) (*odsWriter, error) {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	create := func(name string, method uint16) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: now})
+	}
+	// the mimetype must be the first, uncompressed entry
+	mw, err := create("mimetype", zip.Store)
+	if err == nil {
+		_, err = io.WriteString(mw, "application/vnd.oasis.opendocument.spreadsheet")
+	}
+	if err == nil {
+		if mw, err = create("META-INF/manifest.xml", zip.Deflate); err == nil {
+			_, err = io.WriteString(mw, xml.Header+`<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+<manifest:file-entry manifest:media-type="application/vnd.oasis.opendocument.spreadsheet" manifest:full-path="/"/>
+<manifest:file-entry manifest:media-type="text/xml" manifest:full-path="content.xml"/>
+</manifest:manifest>
+`)
+		}
+	}
+	var cw io.Writer
+	if err == nil {
+		cw, err = create("content.xml", zip.Deflate)
+	}
+	if err != nil {
+		zw.Close()
+		return nil, err
+	}
+	ow := odsWriter{zw: zw, content: bufio.NewWriter(cw)}
+	ow.content.WriteString(xml.Header + `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0" xmlns:xlink="http://www.w3.org/1999/xlink" office:version="1.2">
+<office:automatic-styles><style:style style:name="` + odsBoldStyle + `" style:family="table-cell"><style:text-properties fo:font-weight="bold"/></style:style></office:automatic-styles>
+<office:body><office:spreadsheet>
+`)
+	return &ow, nil
+}
+
+// writeSheet writes the sheet as a table, the merged ranges spanning their top left cell.
+func (ow *odsWriter) writeSheet(sh *odsSheet) error {
+	w := ow.content
+	// cells maps the cells of the merges: the top left cell to its merge, the others to nil.
+	cells := make(map[coordinate]*odsMerge)
+	rowCount, colCount := len(sh.Rows), 0
+	for _, row := range sh.Rows {
+		colCount = max(colCount, len(row))
+	}
+	for i := range sh.Merges {
+		m := &sh.Merges[i]
+		rowCount, colCount = max(rowCount, m.Bottom), max(colCount, m.Right)
+		for r := m.Top; r <= m.Bottom; r++ {
+			for c := m.Left; c <= m.Right; c++ {
+				cells[coordinate{Row: r, Col: c}] = nil
+			}
+		}
+		cells[coordinate{Row: m.Top, Col: m.Left}] = m
+	}
+
+	w.WriteString(`<table:table table:name="`)
+	xml.EscapeText(w, []byte(sh.Name))
+	w.WriteString(`">`)
+	for c := 1; c <= colCount; c++ {
+		if sh.ColBold[c] {
+			w.WriteString(`<table:table-column table:default-cell-style-name="` + odsBoldStyle + `"/>`)
+		} else {
+			w.WriteString(`<table:table-column/>`)
+		}
+	}
+	for r := 1; r <= rowCount; r++ {
+		var row []any
+		if r <= len(sh.Rows) {
+			row = sh.Rows[r-1]
+		}
+		w.WriteString("<table:table-row>")
+		for c := 1; c <= max(len(row), colCount); c++ {
+			m, merged := cells[coordinate{Row: r, Col: c}]
+			if merged && m == nil {
+				w.WriteString("<table:covered-table-cell/>")
+				continue
+			}
+			w.WriteString("<table:table-cell")
+			if r == 1 && sh.HeaderBold || sh.ColBold[c] {
+				w.WriteString(` table:style-name="` + odsBoldStyle + `"`)
+			}
+			if m != nil {
+				fmt.Fprintf(w, ` table:number-columns-spanned="%d" table:number-rows-spanned="%d"`,
+					m.Right-m.Left+1, m.Bottom-m.Top+1)
+			}
+			var v any
+			if c <= len(row) {
+				v = row[c-1]
+			}
+			writeODSValue(w, v)
+		}
+		w.WriteString("</table:table-row>\n")
+	}
+	w.WriteString("</table:table>\n")
+	return w.Flush()
+}
+
+// writeODSValue writes the typed value and the closing tag of the opened table:table-cell.
+func writeODSValue(w *bufio.Writer, v any) {
+	var text string
+	switch x := v.(type) {
+	case nil:
+		w.WriteString("/>")
+		return
+	case float64:
+		text = strconv.FormatFloat(x, 'f', -1, 64)
+		w.WriteString(` office:value-type="float" office:value="` + text + `">`)
+	case bool:
+		text = strconv.FormatBool(x)
+		w.WriteString(` office:value-type="boolean" office:boolean-value="` + text + `">`)
+	case string:
+		text = x
+		w.WriteString(` office:value-type="string">`)
+	default:
+		text = fmt.Sprintf("%v", v)
+		w.WriteString(` office:value-type="string">`)
+	}
+	w.WriteString("<text:p>")
+	if strings.HasPrefix(text, "https://") || strings.HasPrefix(text, "http://") {
+		w.WriteString(`<text:a xlink:href="`)
+		xml.EscapeText(w, []byte(text))
+		w.WriteString(`">`)
+		xml.EscapeText(w, []byte(text))
+		w.WriteString("</text:a>")
+	} else {
+		xml.EscapeText(w, []byte(text))
+	}
+	w.WriteString("</text:p></table:table-cell>")
+}
+
+// Close finishes the content and the zip.
+func (ow *odsWriter) Close() error {
+	if ow == nil || ow.zw == nil {
+		return nil
+	}
+	zw := ow.zw
+	ow.zw = nil
+	ow.content.WriteString("</office:spreadsheet></office:body></office:document-content>\n")
+	err := ow.content.Flush()
+	if closeErr := zw.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,260 @@
+// Copyright 2023 Tamás Gulácsi.
+//
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestRemote(t *testing.T) {
+	logger = zlog.NewT(t).SLog()
+	ctx := zlog.NewSContext(context.Background(), logger)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	var buf bytes.Buffer
+	var pos int
+	commands := []string{
+		`{"c":"newSheet", "a":[{"s":"s"}]}`,
+		`{"c":"insertPageBreak", "a":[{"s":"s"},{"s":"A100"}]}`,
+		`{"c":"mergeCell", "a":[{"s":"s"}, {"s":"A1"}, {"s":"B1"}]}`,
+		`{"c":"setCell","a":[{"s":"s"},{"s":"A2"},{"t":"f","f":3.14}]}`,
+		`{"c":"newStyle","a":[{"s":"header"},{"t":"r","r":` + "{\"Font\":{\"Bold\":true,\"Size\":16},\"Alignment\":{\"Horizontal\":\"center\",\"WrapText\":true}}" + `}]}`,
+		`{"c":"setPanes","a":[{"s":"s"},{"t":"i","i":0},{"t":"i","i":1}]}`,
+		`{"c":"autoFilter","a":[{"s":"s"},{"s":"A1"},{"s":"C1"}]}`,
+		`{"c":"dataValidation","a":[{"s":"s"},{"s":"C2"},{"s":"C100"},{"t":"r","r":{"AllowBlank":true,"DropList":["igen","nem"]}}]}`,
+	}
+	if err := executeCommands(ctx, &buf, func() ([]byte, error) {
+		if pos >= len(commands) {
+			return nil, io.EOF
+		}
+		pos++
+		return []byte(commands[pos-1]), nil
+	}, false); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() == 0 {
+		t.Fatal("got 0 bytes")
+	}
+	if err := os.WriteFile("/tmp/remote.xlsx", buf.Bytes(), 0600); err != nil {
+		t.Error(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, err := f.GetCellValue("s", "A2"); err != nil || got != "3.14" {
+		t.Errorf("A2: got %q (%+v), wanted 3.14", got, err)
+	}
+	if merges, err := f.GetMergeCells("s"); err != nil || len(merges) != 1 ||
+		merges[0].GetStartAxis() != "A1" || merges[0].GetEndAxis() != "B1" {
+		t.Errorf("got merges %v (%+v), wanted A1:B1", merges, err)
+	}
+}
+
+func TestRemotePictureChart(t *testing.T) {
+	logger = zlog.NewT(t).SLog()
+	ctx := zlog.NewSContext(context.Background(), logger)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.Black)
+	var pic bytes.Buffer
+	if err := png.Encode(&pic, img); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	var pos int
+	commands := []string{
+		`{"c":"newSheet", "a":[{"s":"s"}]}`,
+		`["a","b"]`,
+		`[1,2]`,
+		`{"c":"addPicture","a":[{"s":"s"},{"s":"D1"},{"t":"r","r":{"Extension":"png","File":"` +
+			base64.StdEncoding.EncodeToString(pic.Bytes()) + `"}}]}`,
+		`{"c":"addChart","a":[{"s":"s"},{"t":"c","c":{"c":4,"r":5}},{"t":"r","r":{"Type":4,"Series":[{"Name":"s!$A$1","Categories":"s!$A$1:$B$1","Values":"s!$A$2:$B$2"}]}}]}`,
+	}
+	if err := executeCommands(ctx, &buf, func() ([]byte, error) {
+		if pos >= len(commands) {
+			return nil, io.EOF
+		}
+		pos++
+		return []byte(commands[pos-1]), nil
+	}, false); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() == 0 {
+		t.Fatal("got 0 bytes")
+	}
+}
+
+func TestRemoteStream(t *testing.T) {
+	logger = zlog.NewT(t).SLog()
+	ctx := zlog.NewSContext(context.Background(), logger)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	const newStyle = `{"c":"newStyle","a":[{"s":"header"},{"t":"r","r":{"Font":{"Bold":true}}}]}`
+	b, err := runCommands(ctx, true,
+		`{"c":"newSheet", "a":[{"s":"s"}]}`,
+		`{"c":"setColWidth","a":[{"s":"s"},{"t":"i","i":1},{"t":"i","i":1},{"t":"f","f":20}]}`,
+		`{"c":"setPanes","a":[{"s":"s"},{"t":"i","i":0},{"t":"i","i":1}]}`,
+		newStyle,
+		`{"c":"setRowStyle","a":[{"s":"s"},{"t":"i","i":1},{"t":"i","i":1},{"s":"header"}]}`,
+		`{"c":"setCell","a":[{"s":"s"},{"s":"A6"},{"s":"footer"}]}`,
+		`{"c":"setCell","a":[{"s":"s"},{"s":"D2"},{"t":"i","i":42}]}`,
+		`["a","b","c"]`,
+		`{"c":"setRowStyle","a":[{"s":"s"},{"t":"i","i":3},{"t":"i","i":3},{"s":"header"}]}`,
+		`[1,true,"x"]`,
+		`[2,false,null]`,
+		`{"c":"mergeCell","a":[{"s":"s"},{"s":"A4"},{"s":"C4"}]}`,
+		`{"c":"autoFilter","a":[{"s":"s"},{"s":"A1"},{"s":"C1"}]}`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for cell, want := range map[string]string{
+		"A1": "a", "C1": "c", "A2": "1", "B2": "TRUE", "C2": "x", "D2": "42",
+		"A3": "2", "B3": "FALSE", "C3": "", "A6": "footer",
+	} {
+		if got, err := f.GetCellValue("s", cell); err != nil || got != want {
+			t.Errorf("%s: got %q (%+v), wanted %q", cell, got, err, want)
+		}
+	}
+	for cell, styled := range map[string]bool{"A1": true, "C1": true, "A2": false, "B3": true, "A6": false} {
+		if got, err := f.GetCellStyle("s", cell); err != nil || (got != 0) != styled {
+			t.Errorf("%s: got style %d (%+v), wanted styled=%t", cell, got, err, styled)
+		}
+	}
+	if merges, err := f.GetMergeCells("s"); err != nil || len(merges) != 1 ||
+		merges[0].GetStartAxis() != "A4" || merges[0].GetEndAxis() != "C4" {
+		t.Errorf("got merges %v (%+v), wanted A4:C4", merges, err)
+	}
+	if got, err := f.GetColWidth("s", "A"); err != nil || got != 20 {
+		t.Errorf("column A: got width %f (%+v), wanted 20", got, err)
+	}
+	if panes, err := f.GetPanes("s"); err != nil || !panes.Freeze || panes.YSplit != 1 {
+		t.Errorf("got panes %+v (%+v), wanted frozen first row", panes, err)
+	}
+
+	// the already written rows cannot be changed
+	for _, c := range []string{
+		`{"c":"setCell","a":[{"s":"Sheet1"},{"s":"A1"},{"s":"b"}]}`,
+		`{"c":"setRowStyle","a":[{"s":"Sheet1"},{"t":"i","i":1},{"t":"i","i":2},{"s":"header"}]}`,
+		`{"c":"setCellStyle","a":[{"s":"Sheet1"},{"s":"A1"},{"s":"B1"},{"s":"header"}]}`,
+		`{"c":"setPanes","a":[{"s":"Sheet1"},{"t":"i","i":0},{"t":"i","i":1}]}`,
+		`{"c":"setColWidth","a":[{"s":"Sheet1"},{"t":"i","i":1},{"t":"i","i":1},{"t":"f","f":20}]}`,
+		`{"c":"setRowHeight","a":[{"s":"Sheet1"},{"t":"i","i":1},{"t":"f","f":20}]}`,
+	} {
+		if _, err := runCommands(ctx, true, newStyle, `["a"]`, c); !errors.Is(err, errStreamUnsupported) {
+			t.Errorf("%s: wanted errStreamUnsupported, got %+v", c, err)
+		}
+	}
+}
+
+// runCommands executes the commands, and returns the written file.
+func runCommands(ctx context.Context, streaming bool, commands ...string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := executeCommands(ctx, &buf, func() ([]byte, error) {
+		if len(commands) == 0 {
+			return nil, io.EOF
+		}
+		c := commands[0]
+		commands = commands[1:]
+		return []byte(c), nil
+	}, streaming)
+	return buf.Bytes(), err
+}
+
+func TestRemoteODS(t *testing.T) {
+	logger = zlog.NewT(t).SLog()
+	ctx := zlog.NewSContext(context.Background(), logger)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	var buf bytes.Buffer
+	var pos int
+	commands := []string{
+		`{"c":"newSheet", "a":[{"s":"s"}]}`,
+		`{"c":"newStyle","a":[{"s":"header"},{"t":"r","r":{"Font":{"Bold":true}}}]}`,
+		`{"c":"setRowStyle","a":[{"s":"s"},{"t":"i","i":1},{"t":"i","i":1},{"s":"header"}]}`,
+		`["a","b","c"]`,
+		`[1,true,"x"]`,
+		`{"c":"mergeCell","a":[{"s":"s"},{"s":"A2"},{"s":"B3"}]}`,
+		`{"c":"newSheet", "a":[{"s":"t"}]}`,
+		`[2,false,null]`,
+	}
+	if err := executeODSCommands(ctx, &buf, func() ([]byte, error) {
+		if pos >= len(commands) {
+			return nil, io.EOF
+		}
+		pos++
+		return []byte(commands[pos-1]), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := zr.Open("content.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"s", "t"} {
+		if n := bytes.Count(content, []byte(`<table:table table:name="`+name+`"`)); n != 1 {
+			t.Errorf("got %d sheets named %q, wanted 1", n, name)
+		}
+	}
+	if !bytes.Contains(content, []byte(`table:number-columns-spanned="2" table:number-rows-spanned="2" office:value-type="float" office:value="1">`)) {
+		t.Errorf("A2:B3 is not merged: %s", content)
+	}
+	if n := bytes.Count(content, []byte("<table:covered-table-cell/>")); n != 3 {
+		t.Errorf("got %d covered cells, wanted 3: %s", n, content)
+	}
+	if err = xml.Unmarshal(content, new(struct{})); err != nil {
+		t.Errorf("content.xml: %+v", err)
+	}
+
+	for _, cs := range [][]string{
+		{`["a"]`, `{"c":"setCell","a":[{"s":"sheet"},{"s":"A2"},{"s":"x"}]}`},
+		{`{"c":"newSheet", "a":[{"s":"s"}]}`, `["a"]`, `{"c":"newSheet", "a":[{"s":"t"}]}`, `{"c":"newSheet", "a":[{"s":"s"}]}`},
+	} {
+		pos, commands = 0, cs
+		if err := executeODSCommands(ctx, io.Discard, func() ([]byte, error) {
+			if pos >= len(commands) {
+				return nil, io.EOF
+			}
+			pos++
+			return []byte(commands[pos-1]), nil
+		}); !errors.Is(err, errODSUnsupported) {
+			t.Errorf("%q: wanted errODSUnsupported, got %+v", cs, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/godror/godror"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/csvdump/lib"
+)
+
+// resumableQuery returns the query ordered by the keys, and if last is not empty,
+// restricted to the rows after last.
+// The binds of the restriction are numbered after the nParams parameters.
+func resumableQuery(qry string, keys []string, nParams int, last []interface{}) (string, []interface{}) {
+	var bld strings.Builder
+	bld.WriteString("SELECT * FROM (")
+	bld.WriteString(strings.TrimSuffix(strings.TrimSpace(qry), ";"))
+	bld.WriteString(")")
+	var binds []interface{}
+	if len(last) != 0 {
+		// (k1 > :1) OR (k1 = :2 AND k2 > :3) OR ...
+		bld.WriteString(" WHERE ")
+		for i := range keys {
+			if i != 0 {
+				bld.WriteString(" OR ")
+			}
+			bld.WriteByte('(')
+			for j, k := range keys[:i+1] {
+				if j != 0 {
+					bld.WriteString(" AND ")
+				}
+				op := " = :"
+				if j == i {
+					op = " > :"
+				}
+				bld.WriteString(k)
+				bld.WriteString(op)
+				binds = append(binds, last[j])
+				bld.WriteString(strconv.Itoa(nParams + len(binds)))
+			}
+			bld.WriteByte(')')
+		}
+	}
+	bld.WriteString(" ORDER BY ")
+	bld.WriteString(strings.Join(keys, ","))
+	return bld.String(), binds
+}
+
+// dumpResumable dumps the query ordered by the keys with dump,
+// and reopens the cursor after the last dumped key on ORA-01555 (snapshot too old).
+func dumpResumable(ctx context.Context, cfg csvdump.Config, db csvdump.QueryExecer, qry string, params []interface{}, keys []string,
+	dump func(ctx context.Context, rows *sql.Rows, columns []dbcsv.Column, first bool) (int, error),
+) (int, error) {
+	cfg.Call, cfg.Sort = false, false
+	var (
+		last    []interface{}
+		keyIdx  []int
+		written int
+	)
+	for {
+		q, binds := resumableQuery(qry, keys, len(params), last)
+		rows, columns, err := cfg.Query(ctx, db, q, append(append([]interface{}(nil), params...), binds...))
+		if err != nil {
+			return written, err
+		}
+		if keyIdx == nil {
+			if keyIdx, err = keyIndexes(columns, keys); err != nil {
+				rows.Close()
+				return written, err
+			}
+		}
+		n, err := dump(dbcsv.WithRowHook(ctx, func(values []dbcsv.Stringer) {
+			if last == nil {
+				last = make([]interface{}, len(keyIdx))
+			}
+			for i, j := range keyIdx {
+				last[i], _ = values[j].Value()
+			}
+		}), rows, columns, written == 0 && last == nil)
+		rows.Close()
+		written += n
+		if err == nil {
+			return written, nil
+		}
+		if oe, ok := godror.AsOraErr(err); !ok || oe.Code() != 1555 || last == nil {
+			return written, err
+		}
+		logger.Warn("snapshot too old, resuming", "after", last, "rows", written, "error", err)
+	}
+}
+
+func keyIndexes(columns []dbcsv.Column, keys []string) ([]int, error) {
+	idx := make([]int, len(keys))
+Keys:
+	for i, k := range keys {
+		for j, c := range columns {
+			if strings.EqualFold(c.Name, k) {
+				idx[i] = j
+				continue Keys
+			}
+		}
+		return nil, fmt.Errorf("resume key %q not found in the columns", k)
+	}
+	return idx, nil
+}
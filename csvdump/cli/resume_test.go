@@ -0,0 +1,39 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResumableQuery(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		Keys  []string
+		Last  []interface{}
+		Want  string
+		Binds []interface{}
+	}{
+		{Name: "first", Keys: []string{"id"},
+			Want: "SELECT * FROM (SELECT * FROM T) ORDER BY id"},
+		{Name: "single", Keys: []string{"id"}, Last: []interface{}{1},
+			Want:  "SELECT * FROM (SELECT * FROM T) WHERE (id > :2) ORDER BY id",
+			Binds: []interface{}{1}},
+		{Name: "multi", Keys: []string{"a", "b"}, Last: []interface{}{1, 2},
+			Want:  "SELECT * FROM (SELECT * FROM T) WHERE (a > :2) OR (a = :3 AND b > :4) ORDER BY a,b",
+			Binds: []interface{}{1, 1, 2}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, binds := resumableQuery("SELECT * FROM T;", tc.Keys, 1, tc.Last)
+			if got != tc.Want {
+				t.Errorf("got %q, wanted %q", got, tc.Want)
+			}
+			if !reflect.DeepEqual(binds, tc.Binds) {
+				t.Errorf("got %v, wanted %v", binds, tc.Binds)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// schedule is a parsed cron expression: minute hour day-of-month month day-of-week.
+type schedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// parseSchedule parses the five-field cron expression,
+// supporting *, lists (1,2), ranges (1-5) and steps (*/15, 1-30/2).
+func parseSchedule(spec string) (schedule, error) {
+	var s schedule
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return s, fmt.Errorf("%q: wanted 5 fields, got %d", spec, len(fields))
+	}
+	var err error
+	for i, f := range []struct {
+		dest     *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59}, {&s.hour, 0, 23}, {&s.dom, 1, 31}, {&s.month, 1, 12}, {&s.dow, 0, 7},
+	} {
+		if *f.dest, err = parseCronField(fields[i], f.min, f.max); err != nil {
+			return s, fmt.Errorf("%q: %w", fields[i], err)
+		}
+	}
+	if s.dow&(1<<7) != 0 { // 7 is Sunday, too
+		s.dow |= 1
+	}
+	s.domStar, s.dowStar = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepS, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepS); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q", stepS)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loS, hiS, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loS); err != nil {
+				return 0, fmt.Errorf("%q: %w", loS, err)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiS); err != nil {
+					return 0, fmt.Errorf("%q: %w", hiS, err)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range [%d-%d]", part, min, max)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (s schedule) matchDay(t time.Time) bool {
+	dom, dow := s.dom&(1<<uint(t.Day())) != 0, s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first matching time after t.
+func (s schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// expandOutName replaces {{date}} and {{time}} in the output file name.
+func expandOutName(fn string, now time.Time) (string, error) {
+	if !strings.Contains(fn, "{{") {
+		return fn, nil
+	}
+	tmpl, err := template.New("o").Funcs(template.FuncMap{
+		"date": func() string { return now.Format("20060102") },
+		"time": func() string { return now.Format("150405") },
+	}).Parse(fn)
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", fn, err)
+	}
+	var buf strings.Builder
+	if err = tmpl.Execute(&buf, nil); err != nil {
+		return "", fmt.Errorf("%q: %w", fn, err)
+	}
+	return buf.String(), nil
+}
+
+// runScheduled calls run at each scheduled time, till the context is canceled.
+// The runs never overlap: the runs missed while the previous one is running are skipped.
+// When a run fails, onFailure is executed with sh -c.
+func runScheduled(ctx context.Context, sched schedule, onFailure string, run func(context.Context, time.Time) error) error {
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("schedule never fires")
+		}
+		logger.Info("next run", "at", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		start := time.Now()
+		err := run(ctx, next)
+		logger.Info("run finished", "scheduled", next, "duration", time.Since(start).String(), "error", err)
+		if missed := sched.Next(next); !missed.IsZero() && missed.Before(time.Now()) {
+			logger.Warn("skipped overlapping runs", "from", missed)
+		}
+		if err != nil && onFailure != "" {
+			cmd := exec.CommandContext(ctx, "sh", "-c", onFailure)
+			cmd.Env = append(os.Environ(), "CSVDUMP_ERROR="+err.Error(), "CSVDUMP_SCHEDULED="+next.Format(time.RFC3339))
+			cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+			if hookErr := cmd.Run(); hookErr != nil {
+				logger.Error("on-failure", "command", onFailure, "error", hookErr)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
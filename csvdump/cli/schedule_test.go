@@ -0,0 +1,47 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC) // Friday
+	for _, tc := range []struct {
+		Spec string
+		Want time.Time
+	}{
+		{"0 6 * * *", time.Date(2024, 3, 16, 6, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2024, 3, 18, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 12 29 2 *", time.Date(2028, 2, 29, 12, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+	} {
+		s, err := parseSchedule(tc.Spec)
+		if err != nil {
+			t.Fatalf("%q: %+v", tc.Spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tc.Want) {
+			t.Errorf("%q: got %s, wanted %s", tc.Spec, got, tc.Want)
+		}
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("%q: wanted error", spec)
+		}
+	}
+}
+
+func TestExpandOutName(t *testing.T) {
+	now := time.Date(2024, 3, 15, 10, 30, 5, 0, time.UTC)
+	if got, err := expandOutName("out-{{date}}_{{time}}.csv", now); err != nil {
+		t.Fatal(err)
+	} else if want := "out-20240315_103005.csv"; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/renameio/v2"
+
+	"github.com/UNO-SOFT/dbcsv"
+)
+
+// tableSchema is the column metadata of one query's result, written by -schema-out.
+type tableSchema struct {
+	Name    string         `json:"name"`
+	Columns []columnSchema `json:"columns"`
+}
+
+type columnSchema struct {
+	Name         string `json:"name"`
+	DatabaseType string `json:"dbType"`
+	Precision    int    `json:"precision,omitempty"`
+	Scale        int    `json:"scale,omitempty"`
+	Nullable     bool   `json:"nullable"`
+}
+
+func newTableSchema(name string, columns []dbcsv.Column) tableSchema {
+	ts := tableSchema{Name: name, Columns: make([]columnSchema, len(columns))}
+	for i, c := range columns {
+		ts.Columns[i] = columnSchema{
+			Name: c.Name, DatabaseType: c.DatabaseType,
+			Precision: c.Precision, Scale: c.Scale,
+			Nullable: c.Nullable,
+		}
+	}
+	return ts
+}
+
+// writeSchema writes the schemas atomically into fileName.
+func writeSchema(fileName string, schemas []tableSchema) error {
+	b, err := json.MarshalIndent(schemas, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = renameio.WriteFile(fileName, append(b, '\n'), 0640); err != nil {
+		return fmt.Errorf("write schema to %q: %w", fileName, err)
+	}
+	return nil
+}
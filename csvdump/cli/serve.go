@@ -0,0 +1,197 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/csvdump/lib"
+	"github.com/UNO-SOFT/spreadsheet"
+	"github.com/UNO-SOFT/spreadsheet/xlsx"
+)
+
+// report is an allow-listed query, with its named binds filled from the URL query parameters.
+type report struct {
+	Query  string   `json:"query"`
+	Params []string `json:"params,omitempty"`
+}
+
+// loadReports reads the {"name": {"query": "SELECT ... :from", "params": ["from"]}} JSON file.
+func loadReports(fileName string) (map[string]report, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var reports map[string]report
+	if err = json.Unmarshal(b, &reports); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", fileName, err)
+	}
+	return reports, nil
+}
+
+// reportServer serves the reports on GET /report/name?param=value&format=csv|xlsx|jsonl
+type reportServer struct {
+	db      *sql.DB
+	reports map[string]report
+	cfg     csvdump.Config
+}
+
+func (rs reportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/report/")
+	rep, ok := rs.reports[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	values := r.URL.Query()
+	format := values.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if !(format == "csv" || format == "xlsx" || format == "jsonl") {
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+	params := make([]interface{}, len(rep.Params))
+	for i, p := range rep.Params {
+		if v, ok := values[p]; ok && len(v) != 0 {
+			params[i] = sql.Named(p, v[0])
+		} else {
+			params[i] = sql.Named(p, nil)
+		}
+	}
+
+	ctx := r.Context()
+	logger := logger.With("report", name, "format", format, "remote", r.RemoteAddr)
+	// the database errors are logged, but not shown to the client
+	tx, err := rs.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		logger.Error("beginTx", "error", err)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer tx.Rollback()
+	cfg := rs.cfg
+	cfg.Call, cfg.Sort, cfg.Format, cfg.Raw = false, false, "csv", false
+	rows, columns, err := cfg.Query(ctx, tx, rep.Query, params)
+	if err != nil {
+		logger.Error("query", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	start := time.Now()
+	var n int
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		n, err = cfg.Dump(ctx, w, rows, columns)
+	case "xlsx":
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.xlsx"`)
+		n, err = dumpXLSX(ctx, w, name, rows, columns, cfg.Header)
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		n, err = dumpJSONL(ctx, w, rows, columns)
+	}
+	// the status is already sent, so just log the error
+	logger.Info("served", "rows", n, "duration", time.Since(start).String(), "error", err)
+}
+
+func dumpXLSX(ctx context.Context, w http.ResponseWriter, name string, rows *sql.Rows, columns []dbcsv.Column, header bool) (int, error) {
+	xw := xlsx.NewWriter(w)
+	hdr := make([]spreadsheet.Column, len(columns))
+	if header {
+		for i, c := range columns {
+			hdr[i].Name = c.Name
+		}
+	}
+	sheet, err := xw.NewSheet(name, hdr)
+	if err != nil {
+		return 0, err
+	}
+	n, err := dbcsv.DumpSheetCount(ctx, sheet, rows, columns)
+	if closeErr := sheet.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if closeErr := xw.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// dumpJSONL writes each row as a JSON object, one per line.
+func dumpJSONL(ctx context.Context, w io.Writer, rows *sql.Rows, columns []dbcsv.Column) (int, error) {
+	values := make([]dbcsv.Stringer, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i, col := range columns {
+		values[i] = col.Converter("")
+		dest[i] = values[i].Pointer()
+	}
+	enc := json.NewEncoder(w)
+	m := make(map[string]interface{}, len(columns))
+	var n int
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return n, fmt.Errorf("scan into %#v: %w", dest, err)
+		}
+		rowMap(m, columns, values)
+		if err := enc.Encode(m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// rowMap fills m with the column name -> raw string value of the row.
+func rowMap(m map[string]interface{}, columns []dbcsv.Column, values []dbcsv.Stringer) {
+	for i, c := range columns {
+		if v, err := values[i].Value(); err != nil || v == nil {
+			m[c.Name] = nil
+		} else if sr, ok := values[i].(interface{ StringRaw() string }); ok {
+			m[c.Name] = sr.StringRaw()
+		} else {
+			m[c.Name] = values[i].String()
+		}
+	}
+}
+
+// serve the reports on addr, till the context is canceled.
+func serve(ctx context.Context, addr string, rs reportServer) error {
+	mux := http.NewServeMux()
+	mux.Handle("/report/", rs)
+	srv := http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shortCtx)
+	}()
+	logger.Info("serving", "addr", addr, "reports", len(rs.reports))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
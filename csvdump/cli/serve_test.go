@@ -0,0 +1,98 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/dbcsv/csvdump/lib"
+)
+
+func TestServeErrors(t *testing.T) {
+	const secret = "ORA-01017: invalid username/password for scott@secret-host"
+	for _, tc := range []struct {
+		Name       string
+		BeginErr   error
+		QueryErr   error
+		WantStatus int
+	}{
+		{Name: "begin", BeginErr: errors.New(secret), WantStatus: http.StatusServiceUnavailable},
+		{Name: "query", QueryErr: errors.New(secret), WantStatus: http.StatusInternalServerError},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			db := sql.OpenDB(failConnector{beginErr: tc.BeginErr, queryErr: tc.QueryErr})
+			defer db.Close()
+			rs := reportServer{db: db, reports: map[string]report{
+				"secret": {Query: "SELECT password FROM secret_users"},
+			}}
+			w := httptest.NewRecorder()
+			rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/report/secret", nil))
+			if w.Code != tc.WantStatus {
+				t.Errorf("got status %d, wanted %d", w.Code, tc.WantStatus)
+			}
+			body := w.Body.String()
+			for _, s := range []string{"ORA-", "secret", "SELECT"} {
+				if strings.Contains(body, s) {
+					t.Errorf("body %q leaks %q", body, s)
+				}
+			}
+		})
+	}
+}
+
+func TestQuerySortError(t *testing.T) {
+	var queries []string
+	db := sql.OpenDB(failConnector{queryErr: errors.New("ORA-00942: table or view does not exist"), queries: &queries})
+	defer db.Close()
+	cfg := csvdump.Config{Sort: true}
+	if rows, _, err := cfg.Query(context.Background(), db, "SELECT * FROM nonexistent", nil); err == nil {
+		rows.Close()
+		t.Fatal("wanted error")
+	}
+	for _, qry := range queries {
+		if !strings.HasSuffix(qry, " WHERE 1=0") {
+			t.Errorf("unsorted query %q executed after the sort failed", qry)
+		}
+	}
+}
+
+// failConnector is a fake database failing to begin a transaction or to query,
+// recording the prepared queries into queries if it is not nil.
+type failConnector struct {
+	beginErr, queryErr error
+	queries            *[]string
+}
+
+func (c failConnector) Connect(context.Context) (driver.Conn, error) { return failConn(c), nil }
+func (c failConnector) Driver() driver.Driver                        { return nil }
+
+type failConn failConnector
+
+func (c failConn) Prepare(qry string) (driver.Stmt, error) {
+	if c.queries != nil {
+		*c.queries = append(*c.queries, qry)
+	}
+	return nil, c.queryErr
+}
+func (c failConn) Close() error              { return nil }
+func (c failConn) Begin() (driver.Tx, error) { return failTx{}, c.beginErr }
+func (c failConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return failTx{}, c.beginErr
+}
+
+// CheckNamedValue accepts the godror options, too.
+func (c failConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type failTx struct{}
+
+func (failTx) Commit() error   { return nil }
+func (failTx) Rollback() error { return nil }
@@ -0,0 +1,113 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/renameio/v2"
+
+	"github.com/UNO-SOFT/dbcsv"
+)
+
+// runSummary is the result of one run, written by -summary for the schedulers.
+type runSummary struct {
+	Version   dbcsv.BuildInfo `json:"version"`
+	QueryHash string          `json:"queryHash"`
+	Start     time.Time       `json:"start"`
+	Duration  string          `json:"duration"`
+	Rows      int64           `json:"rows"`
+	Files     []fileSummary   `json:"files,omitempty"`
+	Error     string          `json:"error,omitempty"`
+
+	rows  atomic.Int64
+	mu    sync.Mutex
+	start time.Time
+}
+
+type fileSummary struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+func newRunSummary(queries []Query, params []interface{}) *runSummary {
+	h := sha256.New()
+	for _, q := range queries {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\n", q.Name, q.Query, q.QueueName)
+	}
+	fmt.Fprintf(h, "%v", params)
+	now := time.Now()
+	return &runSummary{Version: dbcsv.Version(), QueryHash: hex.EncodeToString(h.Sum(nil)), Start: now, start: now}
+}
+
+// AddRows adds n to the number of rows dumped - nil-safe.
+func (s *runSummary) AddRows(n int) {
+	if s != nil {
+		s.rows.Add(int64(n))
+	}
+}
+
+// AddFile records the written file - nil-safe.
+func (s *runSummary) AddFile(name string, cw *countingWriter) {
+	if s == nil || cw == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Files = append(s.Files, fileSummary{Name: name, Bytes: cw.n, SHA256: hex.EncodeToString(cw.h.Sum(nil))})
+	s.mu.Unlock()
+}
+
+// Write the summary as JSON to fileName, or to stderr if fileName is "-".
+func (s *runSummary) Write(fileName string, runErr error) error {
+	s.Rows = s.rows.Load()
+	s.Duration = time.Since(s.start).String()
+	if runErr != nil {
+		s.Error = runErr.Error()
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if fileName == "-" {
+		_, err = os.Stderr.Write(b)
+		return err
+	}
+	if err = renameio.WriteFile(fileName, b, 0640); err != nil {
+		return fmt.Errorf("write summary to %q: %w", fileName, err)
+	}
+	return nil
+}
+
+// countingWriter counts and hashes the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func newCountingWriter(w io.Writer) *countingWriter {
+	return &countingWriter{w: w, h: sha256.New()}
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.h.Write(p[:n])
+	return n, err
+}
+
+// Close is a no-op, the underlying writer has to be closed separately.
+func (cw *countingWriter) Close() error { return nil }
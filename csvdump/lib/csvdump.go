@@ -0,0 +1,499 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package csvdump is the library behind the csvdump command:
+// query building, cursor opening and dumping the rows as CSV or spreadsheet.
+package csvdump
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/text/encoding"
+
+	"github.com/godror/godror"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/tracing"
+	"github.com/UNO-SOFT/spreadsheet"
+)
+
+// DefaultFetchBytes is the default targeted size of one fetch round trip.
+const DefaultFetchBytes = 8 << 20
+
+// Config of the query execution and the dump.
+type Config struct {
+	Logger *slog.Logger
+	// Encoding of the CSV output, defaults to dbcsv.DefaultEncoding.
+	Encoding encoding.Encoding
+	// Format is "csv" (the default) or "typed".
+	Format string
+	Sep    string
+	// FetchBytes is the targeted size of one round trip, used for sizing the fetch array
+	// from the average row width, measured by Query on the first batch of the query.
+	FetchBytes int
+	// CursorCount is the number of ref cursors (:1, :2, ...) the Call blocks of DumpSheets return, 1 by default.
+	CursorCount int
+	// Call means that the queries are PL/SQL blocks returning a cursor in :1.
+	Call, Sort  bool
+	Header, Raw bool
+}
+
+func (cfg Config) logger() *slog.Logger {
+	if cfg.Logger != nil {
+		return cfg.Logger
+	}
+	return slog.Default()
+}
+
+// Dump the rows into w as CSV or in the typed format, returning the number of rows written.
+func (cfg Config) Dump(ctx context.Context, w io.Writer, rows *sql.Rows, columns []dbcsv.Column) (int, error) {
+	if cfg.Format == "typed" {
+		return dbcsv.DumpTyped(ctx, w, rows, columns)
+	}
+	enc := cfg.Encoding
+	if enc == nil {
+		enc = dbcsv.DefaultEncoding
+	}
+	sep := cfg.Sep
+	if sep == "" {
+		sep = ","
+	}
+	return dbcsv.DumpCSVCount(ctx, encoding.ReplaceUnsupported(enc.NewEncoder()).Writer(w), rows, columns, cfg.Header, sep, cfg.Raw)
+}
+
+// DumpQuery executes the query and dumps its rows into w.
+func (cfg Config) DumpQuery(ctx context.Context, db QueryExecer, w io.Writer, qry string, params []interface{}) (int, []dbcsv.Column, error) {
+	rows, columns, err := cfg.Query(ctx, db, qry, params)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	n, err := cfg.Dump(ctx, w, rows, columns)
+	return n, columns, err
+}
+
+// Sheet is a named query for DumpSheets.
+type Sheet struct {
+	Name, Query string
+	// Columns of the written sheet, set in the sheets returned by DumpSheets.
+	Columns []dbcsv.Column
+}
+
+// DumpSheets dumps each query into its own sheet, concurrently,
+// returning the number of rows written and the written sheets with their columns.
+// With cfg.CursorCount > 1, each cursor of a Call block is dumped into its own sheet, named as name_1, name_2, ...
+// The writer is not closed.
+func (cfg Config) DumpSheets(ctx context.Context, db QueryExecer, w spreadsheet.Writer, sheets []Sheet, params []interface{}) (int, []Sheet, error) {
+	logger := cfg.logger()
+	grp, grpCtx := errgroup.WithContext(ctx)
+	var total atomic.Int64
+	var written []Sheet
+	dumpSheet := func(name, qry string, rows *sql.Rows, columns []dbcsv.Column) error {
+		transformed, err := dbcsv.TransformColumns(ctx, columns)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		header := make([]spreadsheet.Column, len(transformed))
+		if cfg.Header {
+			for j, c := range transformed {
+				header[j].Name = c.Name
+			}
+		}
+		sheet, err := w.NewSheet(name, header)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		written = append(written, Sheet{Name: name, Query: qry, Columns: columns})
+		grp.Go(func() error {
+			logger.Debug("DumpSheet", "name", name, "qry", qry)
+			n, err := dbcsv.DumpSheetCount(grpCtx, sheet, rows, columns)
+			total.Add(int64(n))
+			rows.Close()
+			if closeErr := sheet.Close(); closeErr != nil && err == nil {
+				return closeErr
+			}
+			return err
+		})
+		return nil
+	}
+	err := func() error {
+		for i, s := range sheets {
+			name := s.Name
+			if name == "" {
+				name = strconv.Itoa(i + 1)
+			}
+			if cfg.Call && cfg.CursorCount > 1 {
+				cursors, columns, err := cfg.Cursors(grpCtx, db, s.Query, params, cfg.CursorCount)
+				if err != nil {
+					return err
+				}
+				for j, rows := range cursors {
+					if err == nil {
+						err = dumpSheet(name+"_"+strconv.Itoa(j+1), s.Query, rows, columns[j])
+					} else {
+						rows.Close()
+					}
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			rows, columns, err := cfg.Query(grpCtx, db, s.Query, params)
+			if err != nil {
+				return err
+			}
+			if err = dumpSheet(name, s.Query, rows, columns); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if waitErr := grp.Wait(); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return int(total.Load()), written, err
+}
+
+// GetQuery returns the SELECT for the table with the where and columns,
+// or the query itself if table is a SELECT, or reads the query from stdin if all are empty.
+func GetQuery(table, where string, columns []string, enc encoding.Encoding) string {
+	if (table == "" || table == "-") && where == "" && len(columns) == 0 {
+		if enc == nil {
+			enc = encoding.Nop
+		}
+		b, err := io.ReadAll(enc.NewDecoder().Reader(os.Stdin))
+		if err != nil {
+			panic(err)
+		}
+		return string(b)
+	}
+	table = strings.TrimSpace(table)
+	if len(table) > 6 && strings.HasPrefix(strings.ToUpper(table), "SELECT ") {
+		return table
+	}
+	cols := "*"
+	if len(columns) > 0 {
+		cols = strings.Join(columns, ", ")
+	}
+	if where == "" {
+		return "SELECT " + cols + " FROM " + table //nolint:gas
+	}
+	return "SELECT " + cols + " FROM " + table + " WHERE " + where //nolint:gas
+}
+
+// QueryExecer is the common interface of *sql.DB, *sql.Conn and *sql.Tx.
+type QueryExecer interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}
+
+// defaultBatchSize is the size of the fetch array, if the row width of the query is not known.
+const defaultBatchSize = 1024
+
+// rowWidths is the average row width of the queries (by their text), measured on their first batch.
+var rowWidths sync.Map
+
+// Query executes the query (or the PL/SQL block returning a cursor, if cfg.Call),
+// sizing the fetch array according to cfg.FetchBytes (and the measured row width), sorting if cfg.Sort.
+//
+// The fetch array of an open cursor cannot be changed, so the first batch
+// (the first 1024 rows) of the query is fetched and measured before executing it
+// with the fetch array sized by the average row width.
+// The measured width is remembered for the next executions of the same query text.
+func (cfg Config) Query(ctx context.Context, db QueryExecer, qry string, params []interface{}) (*sql.Rows, []dbcsv.Column, error) {
+	logger := cfg.logger()
+	var rows *sql.Rows
+	var err error
+	batchSize := defaultBatchSize
+	if cfg.Call {
+		cursors, columns, err := cfg.Cursors(ctx, db, qry, params, 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cursors[0], columns[0], nil
+	} else {
+		origQry, sorted := qry, false
+		if cfg.Sort {
+			sortedQry, err := sortedQuery(ctx, db, qry, params)
+			if err != nil {
+				return nil, nil, fmt.Errorf("sort %q: %w", qry, err)
+			}
+			qry, sorted = sortedQry, sortedQry != strings.TrimSuffix(strings.TrimSpace(origQry), ";")
+		}
+		var fetchFirst bool
+		{
+			var lastIsSpace bool
+			qry := strings.Map(func(r rune) rune {
+				if r == ' ' || r == '\n' || r == '\r' || r == '\t' || r == '\v' {
+					if lastIsSpace {
+						return -1
+					}
+					lastIsSpace = true
+					return ' '
+				}
+				lastIsSpace = false
+				if 'a' <= r && r <= 'z' {
+					return r - 'a' + 'A'
+				}
+				return r
+			},
+				qry)
+			//log.Println(qry)
+			if i := strings.Index(qry, " FETCH FIRST "); i >= 0 {
+				qry = strings.TrimSpace(qry[i+len(" FETCH FIRST "):])
+				i = strings.Index(qry, " ROWS ONLY")
+				if i < 0 {
+					i = strings.Index(qry, " ROW ONLY")
+				}
+				if i >= 0 {
+					if n, err := strconv.ParseUint(qry[:i], 10, 32); err == nil && n != 0 {
+						batchSize, fetchFirst = int(n), true
+					}
+				}
+			}
+		}
+		qry = strings.TrimSuffix(strings.TrimSpace(qry), ";")
+		if cfg.FetchBytes > 0 && !(fetchFirst && batchSize <= defaultBatchSize) {
+			width, ok := rowWidths.Load(origQry)
+			if !ok {
+				if w, err := measureRowWidth(ctx, db, origQry, params); err != nil {
+					logger.Warn("cannot measure row width", "qry", origQry, "error", err)
+				} else if w > 0 {
+					logger.Debug("measured", "qry", origQry, "width", w)
+					width, ok = w, true
+					rowWidths.Store(origQry, w)
+				}
+			}
+			if ok {
+				if n := adaptiveBatchSize(width.(int64), cfg.FetchBytes); !fetchFirst || n < batchSize {
+					batchSize = n
+				}
+			}
+		}
+		logger.Debug("Query", "qry", qry, "batchSize", batchSize)
+		params = append(params, godror.FetchRowCount(batchSize), godror.PrefetchCount(batchSize+1))
+		spanCtx, span := tracing.Start(ctx, "query", attribute.String("db.statement", qry))
+		if rows, err = db.QueryContext(spanCtx, qry, params...); err != nil && !sorted && qry != origQry {
+			qry = origQry
+			rows, err = db.QueryContext(spanCtx, qry, params...)
+		}
+		tracing.End(span, err)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%q: %w", qry, err)
+	}
+	columns, err := dbcsv.GetColumns(ctx, rows)
+	logger.Info("GetColumns", "columns", columns)
+	if err != nil {
+		rows.Close()
+		return nil, nil, err
+	}
+	return rows, columns, nil
+}
+
+// sortedQuery wraps the query as "SELECT * FROM (qry) ORDER BY 1,2,...",
+// ordering by all the non-LOB columns, to have a deterministic order.
+func sortedQuery(ctx context.Context, db QueryExecer, qry string, params []interface{}) (string, error) {
+	qry = strings.TrimSuffix(strings.TrimSpace(qry), ";")
+	wrapped := "SELECT * FROM (" + qry + ")"
+	cols, err := probeColumns(ctx, db, qry, params)
+	if err != nil {
+		return "", err
+	}
+	var bld strings.Builder
+	for i, c := range cols {
+		if typ := c.DatabaseTypeName(); strings.HasSuffix(typ, "LOB") || typ == "LONG" || typ == "LONG RAW" {
+			continue
+		}
+		if bld.Len() == 0 {
+			bld.WriteString(wrapped)
+			bld.WriteString(" ORDER BY ")
+		} else {
+			bld.WriteByte(',')
+		}
+		fmt.Fprintf(&bld, "%d", i+1)
+	}
+	if bld.Len() == 0 {
+		return qry, nil
+	}
+	return bld.String(), nil
+}
+
+// probeColumns returns the column types of the query, without fetching any row.
+func probeColumns(ctx context.Context, db QueryExecer, qry string, params []interface{}) ([]*sql.ColumnType, error) {
+	qry = "SELECT * FROM (" + strings.TrimSuffix(strings.TrimSpace(qry), ";") + ") WHERE 1=0"
+	rows, err := db.QueryContext(ctx, qry, params...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", qry, err)
+	}
+	cols, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", qry, err)
+	}
+	return cols, nil
+}
+
+// measureRowWidth fetches the first batch of the query,
+// and returns the average width of its rows (0 if it has no rows).
+func measureRowWidth(ctx context.Context, db QueryExecer, qry string, params []interface{}) (int64, error) {
+	qry = "SELECT * FROM (" + strings.TrimSuffix(strings.TrimSpace(qry), ";") + ") WHERE ROWNUM <= " + strconv.Itoa(defaultBatchSize)
+	rows, err := db.QueryContext(ctx, qry,
+		append(params[:len(params):len(params)], godror.FetchRowCount(defaultBatchSize), godror.PrefetchCount(defaultBatchSize+1))...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", qry, err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var n, width int64
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		n++
+		for _, v := range values {
+			width += int64(valueWidth(v)) + 1
+		}
+	}
+	if err := rows.Err(); err != nil || n == 0 {
+		return 0, err
+	}
+	return max(1, width/n), nil
+}
+
+// valueWidth returns the approximate size of the fetched value.
+func valueWidth(v interface{}) int {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(x)
+	case []byte:
+		return len(x)
+	case godror.Number:
+		return len(x)
+	case time.Time:
+		return 13
+	case int64, uint64, float64:
+		return 8
+	case int32, uint32, float32:
+		return 4
+	default:
+		return len(fmt.Sprint(v))
+	}
+}
+
+// adaptiveBatchSize returns the number of rows of the width fitting into fetchBytes.
+func adaptiveBatchSize(width int64, fetchBytes int) int {
+	const minBatchSize, maxBatchSize = 128, 1 << 16
+	return int(min(maxBatchSize, max(minBatchSize, int64(fetchBytes)/max(1, width))))
+}
+
+// Cursors executes the PL/SQL block, which returns n ref cursors as its first n binds.
+func (cfg Config) Cursors(ctx context.Context, db QueryExecer, qry string, params []interface{}, n int) ([]*sql.Rows, [][]dbcsv.Column, error) {
+	logger := cfg.logger()
+	const batchSize = 1024
+	dRows := make([]driver.Rows, max(1, n))
+	args := make([]interface{}, 0, len(dRows)+2+len(params))
+	for i := range dRows {
+		args = append(args, sql.Out{Dest: &dRows[i]})
+	}
+	args = append(append(args, godror.FetchRowCount(batchSize), godror.PrefetchCount(batchSize+1)), params...)
+	spanCtx, span := tracing.Start(ctx, "call", attribute.String("db.statement", qry))
+	_, err := db.ExecContext(spanCtx, qry, args...)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Error("call", "qry", qry, "params", fmt.Sprintf("%#v", args), "error", err)
+		return nil, nil, fmt.Errorf("%q: %w", qry, err)
+	}
+	cursors := make([]*sql.Rows, 0, len(dRows))
+	columns := make([][]dbcsv.Column, 0, len(dRows))
+	closeAll := func() {
+		for _, rows := range cursors {
+			rows.Close()
+		}
+	}
+	for i, dr := range dRows {
+		rows, err := godror.WrapRows(ctx, db, dr)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("%q: %d. cursor: %w", qry, i+1, err)
+		}
+		cursors = append(cursors, rows)
+		cols, err := dbcsv.GetColumns(ctx, rows)
+		logger.Info("GetColumns", "cursor", i+1, "columns", cols)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		columns = append(columns, cols)
+	}
+	return cursors, columns, nil
+}
+
+// SplitParamArgs returns the PL/SQL block calling fun with the key=value args,
+// returning the cursor in :1, or fun itself if it is already a PL/SQL block.
+func SplitParamArgs(fun string, args []string) (plsql string, params []interface{}) {
+	if IsPLSQLBlock(fun) {
+		// the arguments are the positional values following the cursors
+		params = make([]interface{}, len(args))
+		for i, a := range args {
+			params[i] = a
+		}
+		return fun, params
+	}
+	haveParens := strings.Contains(fun, "(") && strings.Contains(fun, ")")
+	params = make([]interface{}, len(args))
+	var buf strings.Builder
+	buf.WriteString("BEGIN :1 := ")
+	buf.WriteString(fun)
+	if !haveParens {
+		buf.WriteByte('(')
+	}
+	for i, x := range args {
+		var key string
+		key, params[i], _ = strings.Cut(x, "=")
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(key)
+		buf.WriteString("=>:")
+		buf.WriteString(strconv.Itoa(i + 2))
+	}
+	if !haveParens {
+		buf.WriteByte(')')
+	}
+	buf.WriteString("; END;")
+	return buf.String(), params
+}
+
+// IsPLSQLBlock reports whether s is a BEGIN ... END or DECLARE ... block.
+func IsPLSQLBlock(s string) bool {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "BEGIN") || strings.HasPrefix(s, "DECLARE")
+}
@@ -0,0 +1,23 @@
+// Copyright 2020, 2023 Tamás Gulácsi.
+//
+//
+// SPDX-License-Identifier: UPL-1.0 OR Apache-2.0
+
+// Package main in csvdump represents a cursor->csv dumper
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/UNO-SOFT/dbcsv/csvdump/cli"
+)
+
+func main() {
+	// the interrupts are handled by cli.Main, logged with its logger
+	if err := cli.Main(context.Background(), os.Args); err != nil {
+		slog.Error("Main", "error", err)
+		os.Exit(1)
+	}
+}
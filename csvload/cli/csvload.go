@@ -2,7 +2,8 @@
 //
 // SPDX-License-Identifier: Apache-2.0
 
-package main
+// Package cli is the csvload command: it loads a CSV or a spreadsheet into a database table.
+package cli
 
 import (
 	"bytes"
@@ -15,6 +16,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"io"
+	"log/slog"
 	"os"
 	"reflect"
 	"runtime"
@@ -31,24 +33,22 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/godror/godror"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/completion"
+	"github.com/UNO-SOFT/dbcsv/connect"
+	"github.com/UNO-SOFT/dbcsv/tracing"
+	"github.com/UNO-SOFT/dbcsv/transform"
 
 	"github.com/UNO-SOFT/zlog/v2"
 )
 
 var (
-	verbose zlog.VerboseVar
-	logger  = zlog.NewLogger(zlog.MaybeConsoleHandler(&verbose, os.Stderr)).SLog()
+	logCfg dbcsv.LogConfig
+	logger = zlog.NewLogger(zlog.MaybeConsoleHandler(&logCfg, os.Stderr)).SLog()
 )
 
-func main() {
-	if err := Main(); err != nil {
-		logger.Error("Main", "error", err)
-		os.Exit(1)
-	}
-}
-
 var (
 	dateFormat = "2006-01-02T15:04:05"
 	xlsEpoch   = time.Date(1899, 12, 30, 0, 0, 0, 0, time.Local)
@@ -65,19 +65,18 @@ type config struct {
 	Concurrency, ChunkSize           int
 	ForceString, JustPrint, Truncate bool
 	LobSource                        bool
+	// Transform are the "NAME = EXPRESSION" assignments, Filter is the boolean expression of the rows to load (see package transform).
+	Transform []string
+	Filter    string
 }
 
-func Main() error {
-	encName := os.Getenv("LANG")
-	if i := strings.IndexByte(encName, '.'); i >= 0 {
-		encName = encName[i+1:]
-	} else if encName == "" {
-		encName = "UTF-8"
-	}
-
+// Main runs the command with the arguments (args[0] is the name of the program).
+func Main(ctx context.Context, args []string) error {
 	cfg := config{Config: new(dbcsv.Config)}
 	fs := flag.NewFlagSet("load", flag.ContinueOnError)
-	flagConnect := fs.String("connect", os.Getenv("DB_ID"), "database to connect to")
+	flagConnect := fs.String("connect", "", connect.Usage)
+	var connOpts connect.Options
+	connOpts.AddFlags(fs)
 	fs.BoolVar(&cfg.Truncate, "truncate", false, "truncate table")
 	fs.StringVar(&cfg.Tablespace, "tablespace", "DATA", "tablespace to create table in")
 	flagFields := fs.String("fields", "", "target fields, comma separated names")
@@ -85,21 +84,19 @@ func Main() error {
 	fs.BoolVar(&cfg.JustPrint, "just-print", false, "just print the INSERTs")
 	fs.StringVar(&cfg.Copy, "copy", "", "copy this table's structure")
 	fs.IntVar(&cfg.ChunkSize, "chunk-size", defaultChunkSize, "chunk size - number of rows inserted at once")
-	fs.Var(&verbose, "v", "verbose logging")
+	logCfg.AddFlags(fs)
 	fs.BoolVar(&cfg.LobSource, "lob", false, "source is not a filename but a query that returns a LOB")
-	if *flagConnect == "" {
-		if *flagConnect = os.Getenv("BRUNO_OWNER_ID"); *flagConnect == "" {
-			*flagConnect = os.Getenv("BRUNO_ID")
-		}
-	}
+	flagTransform := dbcsv.FlagStrings()
+	fs.Var(flagTransform, "transform", `each -transform='NAME = EXPRESSION' sets (or adds) a column of each row, such as 'AMOUNT = replace(AMOUNT, ",", ".")' (Starlark)`)
+	fs.StringVar(&cfg.Filter, "filter", "", `load only the rows this (Starlark) boolean expression is true for, such as 'STATUS != "X"'`)
 	loadCmd := ffcli.Command{Name: "load", FlagSet: fs,
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) != 2 {
 				return errors.New("need two args: the table and the source")
 			}
-			P, err := godror.ParseConnString(*flagConnect)
+			P, err := connect.ParseConnString(*flagConnect, connOpts)
 			if err != nil {
-				return fmt.Errorf("%q: %w", *flagConnect, err)
+				return err
 			}
 			P.StandaloneConnection = false
 			P.SetSessionParamOnInit("NLS_NUMERIC_CHARACTERS", ". ")
@@ -108,15 +105,22 @@ func Main() error {
 			defer db.Close()
 
 			db.SetMaxIdleConns(0)
+			if err = connect.LogSession(ctx, logger, db); err != nil {
+				return err
+			}
 			fields := strings.FieldsFunc(*flagFields, func(r rune) bool { return r == ',' || r == ';' || r == ' ' })
+			cfg.Transform = flagTransform.Strings
 
-			return cfg.load(ctx, db, args[0], args[1], fields)
+			ctx, span := tracing.Start(ctx, "load", attribute.String("table", args[0]), attribute.String("file", args[1]))
+			err = cfg.load(ctx, db, args[0], args[1], fields)
+			tracing.End(span, err)
+			return err
 		},
 	}
 
 	sheetCmd := ffcli.Command{Name: "sheet",
 		Exec: func(ctx context.Context, args []string) error {
-			if err := cfg.Config.Open(args[0]); err != nil {
+			if err := cfg.Config.OpenContext(ctx, args[0]); err != nil {
 				return err
 			}
 			defer cfg.Close()
@@ -137,21 +141,55 @@ func Main() error {
 	}
 
 	fs = flag.NewFlagSet("csvload", flag.ContinueOnError)
-	fs.StringVar(&cfg.Charset, "charset", encName, "input charset")
+	// the connection and logging flags are accepted before the subcommand, too (as the dbcsv command passes them)
+	fs.StringVar(flagConnect, "connect", "", connect.Usage)
+	connOpts.AddFlags(fs)
+	logCfg.AddFlags(fs)
+	fs.StringVar(&cfg.Charset, "charset", "", "input charset (detected by default)")
 	fs.StringVar(&cfg.Delim, "delim", "", "CSV separator")
 	fs.IntVar(&cfg.Concurrency, "concurrency", 4, "concurrency")
 	fs.StringVar(&dateFormat, "date", dateFormat, "date format, in Go notation")
 	fs.IntVar(&cfg.Skip, "skip", 0, "skip rows")
+	fs.IntVar(&cfg.Offset, "offset", 0, "skip this many data rows after the header (to load in slices)")
+	fs.IntVar(&cfg.MaxRows, "max-rows", 0, "load at most this many data rows (0 for all)")
 	fs.IntVar(&cfg.Sheet, "sheet", 0, "sheet of spreadsheet")
-	fs.StringVar(&cfg.ColumnsString, "columns", "", "columns, comma separated indexes")
+	fs.BoolVar(&cfg.AllSheets, "all-sheets", false, "load all the sheets of the spreadsheet (with the same columns) into the table")
+	fs.StringVar(&cfg.ColumnsString, "columns", "", "columns, comma separated indexes or ranges (such as 1-5,8,12-)")
+	fs.Func("input-type", "input type (csv, xls, xlsx, ods, typed, json, parquet), instead of detecting it", func(s string) error {
+		cfg.Config.InputType = dbcsv.FType(s)
+		return nil
+	})
 	flagMemProf := fs.String("memprofile", "", "file to output memory profile to")
 	flagCPUProf := fs.String("cpuprofile", "", "file to output CPU profile to")
+	flagVersion := fs.Bool("version", false, "print the version and exit")
+	values := map[string][]string{"input-type": {"csv", "xls", "xlsx", "ods", "typed", "json", "parquet"}}
+	completionCmd := ffcli.Command{Name: "completion", ShortUsage: "completion bash|zsh|fish",
+		ShortHelp: "print the shell completion script",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("need the shell (%s)", strings.Join(completion.Shells, ", "))
+			}
+			cmd := completion.Command{Name: "csvload"}
+			cmd.AddFlags(fs, values)
+			cmd.AddFlags(loadCmd.FlagSet, values)
+			load := completion.Command{Name: "load", Help: "load into the table"}
+			load.AddFlags(loadCmd.FlagSet, values)
+			cmd.Subcommands = []completion.Command{load,
+				{Name: "sheet", Help: "list the sheets of the spreadsheet"},
+				{Name: "completion", Help: "print the shell completion script"},
+			}
+			return completion.Write(os.Stdout, args[0], cmd)
+		},
+	}
 	app := ffcli.Command{Name: "csvload", FlagSet: fs, ShortUsage: "load from csv/xls/ods into database table",
 		Exec:        func(ctx context.Context, args []string) error { return loadCmd.Exec(ctx, args) },
-		Subcommands: []*ffcli.Command{&loadCmd, &sheetCmd},
+		Subcommands: []*ffcli.Command{&loadCmd, &sheetCmd, &completionCmd},
 	}
 
-	args := os.Args[1:]
+	if completion.Collect(ctx, values, fs, loadCmd.FlagSet) {
+		return nil
+	}
+	args = args[1:]
 	if err := app.Parse(args); err != nil {
 		if len(args) == 0 {
 			return err
@@ -160,6 +198,22 @@ func Main() error {
 			return err
 		}
 	}
+	if *flagVersion {
+		fmt.Println(dbcsv.Version())
+		return nil
+	}
+	h, err := logCfg.Handler(os.Stderr, "csvload")
+	if err != nil {
+		return err
+	}
+	logger = slog.New(h)
+	ctx, stop := dbcsv.WrapLogger(ctx, logger)
+	defer stop()
+	shutdown, err := tracing.Init(ctx, "csvload")
+	if err != nil {
+		return err
+	}
+	defer shutdown(context.WithoutCancel(ctx))
 
 	if *flagCPUProf != "" {
 		f, err := os.Create(*flagCPUProf)
@@ -188,8 +242,6 @@ func Main() error {
 		}
 	}
 
-	ctx, cancel := dbcsv.Wrap(context.Background())
-	defer cancel()
 	return app.Run(ctx)
 }
 
@@ -212,10 +264,27 @@ func (cfg config) load(ctx context.Context, db *sql.DB, tbl, src string, fields
 	defCtx, defCancel := context.WithCancel(ctx)
 	defer defCancel()
 	grp, grpCtx := errgroup.WithContext(defCtx)
+	var prog *transform.Program
 	grp.Go(func() error {
 		defer close(rows)
 		err := cfg.Config.ReadRows(grpCtx,
 			func(ctx context.Context, _ string, row dbcsv.Row) error {
+				if len(cfg.Transform) != 0 || cfg.Filter != "" {
+					if prog == nil {
+						var err error
+						if prog, err = transform.Compile(row.Columns, cfg.Transform, cfg.Filter); err != nil {
+							return err
+						}
+					}
+					values, err := prog.RunStrings(row.Values)
+					if err != nil {
+						return fmt.Errorf("line %d: %w", row.Line, err)
+					}
+					if values == nil {
+						return nil
+					}
+					row.Columns, row.Values, row.Typed = prog.Columns, values, nil
+				}
 				if firstRow.Columns == nil {
 					firstRow = row
 					firstRowErr <- nil
@@ -408,7 +477,8 @@ func (cfg config) load(ctx context.Context, db *sql.DB, tbl, src string, fields
 
 	grp, grpCtx = errgroup.WithContext(ctx)
 
-	var inserted int64
+	// the rows are committed at the end, by each worker: an interrupt rolls back the inserted rows
+	var inserted, committed int64
 	for i := 0; i < cfg.Concurrency; i++ {
 		grp.Go(func() error {
 			tx, txErr := db.BeginTx(grpCtx, nil)
@@ -423,6 +493,7 @@ func (cfg config) load(ctx context.Context, db *sql.DB, tbl, src string, fields
 			nCols := len(columns)
 			cols := make([][]string, nCols)
 			rowsI := make([]interface{}, nCols)
+			var txRows int64
 
 			for rs := range rowsCh {
 				chunk := rs.Rows
@@ -474,13 +545,16 @@ func (cfg config) load(ctx context.Context, db *sql.DB, tbl, src string, fields
 					}
 				}
 
+				_, span := tracing.Start(grpCtx, "insert", attribute.Int64("start", rs.Start), attribute.Int("rows", len(chunk)))
 				_, err = stmt.Exec(rowsI...)
+				tracing.End(span, err)
 				{
 					z := chunk[:0]
 					chunkPool.Put(&z)
 				}
 				if err == nil {
 					atomic.AddInt64(&inserted, int64(len(chunk)))
+					txRows += int64(len(chunk))
 					continue
 				}
 				if chunkSize == 1 {
@@ -514,9 +588,12 @@ func (cfg config) load(ctx context.Context, db *sql.DB, tbl, src string, fields
 
 				return err
 			}
-			if err := tx.Commit(); err != nil {
+			_, span := tracing.Start(grpCtx, "commit")
+			err := tx.Commit()
+			if tracing.End(span, err); err != nil {
 				return fmt.Errorf("COMMIT: %w", err)
 			}
+			atomic.AddInt64(&committed, txRows)
 			return nil
 		})
 	}
@@ -529,7 +606,8 @@ func (cfg config) load(ctx context.Context, db *sql.DB, tbl, src string, fields
 
 	var headerSeen bool
 	chunk := (*(chunkPool.Get().(*[][]string)))[:0]
-	if err := cfg.Config.ReadRows(grpCtx,
+	readCtx, readSpan := tracing.Start(grpCtx, "read", attribute.String("file", src))
+	err := cfg.Config.ReadRows(readCtx,
 		func(ctx context.Context, fn string, row dbcsv.Row) error {
 			var err error
 			if err = ctx.Err(); err != nil {
@@ -568,23 +646,34 @@ func (cfg config) load(ctx context.Context, db *sql.DB, tbl, src string, fields
 			chunk = (*chunkPool.Get().(*[][]string))[:0]
 			return nil
 		},
-	); err != nil {
+	)
+	tracing.End(readSpan, err, attribute.Int64("rows", n))
+	if err != nil {
 		logger.Error("ReadRows", "error", err)
 		return err
 	}
 
 	if len(chunk) != 0 {
-		rowsCh <- rowsType{Rows: chunk, Start: n}
-		n += int64(len(chunk))
+		select {
+		case rowsCh <- rowsType{Rows: chunk, Start: n}:
+			n += int64(len(chunk))
+		case <-grpCtx.Done():
+		}
 	}
 	close(rowsCh)
 
-	err := grp.Wait()
+	err = grp.Wait()
 	if err != nil {
 		logger.Error("ERROR", "error", err)
 	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		logger.Warn("interrupted", "read", n, "rows", committed, "rolledBack", inserted-committed, "file", src, "table", tbl)
+		if err == nil {
+			err = ctxErr
+		}
+	}
 	dur := time.Since(start)
-	logger.Info("timing", "read", n, "inserted", inserted, "src", src, "tbl", tbl, "dur", dur.String())
+	logger.Info("timing", "read", n, "rows", inserted, "file", src, "table", tbl, "duration", dur.String())
 	return err
 }
 
@@ -623,8 +712,29 @@ func typeOf(s string, forceString bool) Type {
 			return Date
 		}
 	}
+	if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return Date
+	}
 	return String
 }
+
+// typeOfValue returns the Type of the typed value of a cell (see dbcsv.Row.Typed).
+func typeOfValue(v interface{}) Type {
+	switch x := v.(type) {
+	case int64:
+		return Int
+	case float64:
+		return Float
+	case time.Time:
+		return Date
+	case string:
+		if x == "" {
+			return Unknown
+		}
+	}
+	return String
+}
+
 func tableSplitOwner(tbl string) (string, string) {
 	if tbl == "" {
 		panic("empty tabl name")
@@ -702,11 +812,21 @@ func CreateTable(ctx context.Context, db *sql.DB, tbl string, rows <-chan dbcsv.
 				if cols[i].Type == String {
 					continue
 				}
-				typ := typeOf(v, forceString)
+				var typ Type
+				if i < len(row.Typed) && row.Typed[i] != nil && !forceString {
+					typ = typeOfValue(row.Typed[i])
+				} else {
+					typ = typeOf(v, forceString)
+				}
 				if cols[i].Type == Unknown {
 					cols[i].Type = typ
 				} else if typ != cols[i].Type {
-					cols[i].Type = String
+					// the spreadsheets' integral numbers are Int, the others Float
+					if (typ == Int || typ == Float) && (cols[i].Type == Int || cols[i].Type == Float) {
+						cols[i].Type = Float
+					} else {
+						cols[i].Type = String
+					}
 				}
 			}
 		}
@@ -807,6 +927,11 @@ func (c Column) FromString(ss []string) (interface{}, error) {
 					continue
 				}
 			}
+			// the typed format has RFC3339 times
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				res[i] = sql.NullTime{Valid: true, Time: t}
+				continue
+			}
 			df := dateFormat
 			if len(s) < len(df) {
 				df = df[:len(s)]
@@ -1041,7 +1166,7 @@ func (cfg config) Open(ctx context.Context, db *sql.DB, fn string) (err error) {
 		os.Stdin.Close()
 		fn, os.Stdin = "", fh
 	}
-	return cfg.Config.Open(fn)
+	return cfg.Config.OpenContext(ctx, fn)
 }
 
 // vim: set fileencoding=utf-8 noet:
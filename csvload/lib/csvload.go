@@ -441,11 +441,12 @@ func (cfg Config) Load(ctx context.Context, db *sql.DB, tbl, src string, fields
 		cfg.Logger.Error("ERROR", "error", err)
 	}
 	dur := time.Since(start)
-	cfg.Logger.Info("timing", "read", n, "inserted", inserted, "src", src, "tbl", tbl, "dur", dur.String())
+	cfg.Logger.Info("timing", "read", n, "rows", inserted, "file", src, "table", tbl, "duration", dur.String())
 	return err
 }
 
-func typeOf(s string, forceString bool) Type {
+// TypeOf returns the type of the value: Int, Float, Date or String (Unknown for the empty string).
+func TypeOf(s string, forceString bool) Type {
 	if forceString {
 		return String
 	}
@@ -480,6 +481,9 @@ func typeOf(s string, forceString bool) Type {
 			return Date
 		}
 	}
+	if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return Date
+	}
 	return String
 }
 func tableSplitOwner(tbl string) (string, string) {
@@ -558,7 +562,7 @@ func CreateTable(ctx context.Context, db *sql.DB, tbl string, rows <-chan dbcsv.
 				if cols[i].Type == String {
 					continue
 				}
-				typ := typeOf(v, forceString)
+				typ := TypeOf(v, forceString)
 				if cols[i].Type == Unknown {
 					cols[i].Type = typ
 				} else if typ != cols[i].Type {
@@ -665,6 +669,11 @@ func (c Column) FromString(ss []string) (interface{}, error) {
 					continue
 				}
 			}
+			// the typed format has RFC3339 times
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				res[i] = sql.NullTime{Valid: true, Time: t}
+				continue
+			}
 			df := DateFormat
 			if len(s) < len(df) {
 				df = df[:len(s)]
@@ -893,5 +902,5 @@ func (cfg Config) Open(ctx context.Context, db *sql.DB, fn string) (err error) {
 		os.Stdin.Close()
 		fn, os.Stdin = "", fh
 	}
-	return cfg.Config.Open(fn)
+	return cfg.Config.OpenContext(ctx, fn)
 }
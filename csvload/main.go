@@ -0,0 +1,22 @@
+// Copyright 2021, 2023 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package main in csvload loads a CSV or a spreadsheet into a database table.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/UNO-SOFT/dbcsv/csvload/cli"
+)
+
+func main() {
+	// the interrupts are handled by cli.Main, logged with its logger
+	if err := cli.Main(context.Background(), os.Args); err != nil {
+		slog.Error("Main", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package main in dbcsv is the unified command of the tools, as subcommands:
+// load (csvload), dump (csvdump), copy (tablecopy), foreach (csvdbforeach), md (csv2md) and export (paraexp).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/completion"
+	"github.com/UNO-SOFT/dbcsv/connect"
+	csv2md "github.com/UNO-SOFT/dbcsv/csv2md/cli"
+	csvdbforeach "github.com/UNO-SOFT/dbcsv/csvdbforeach/cli"
+	csvdump "github.com/UNO-SOFT/dbcsv/csvdump/cli"
+	csvload "github.com/UNO-SOFT/dbcsv/csvload/cli"
+	paraexp "github.com/UNO-SOFT/dbcsv/paraexp/cli"
+	tablecopy "github.com/UNO-SOFT/dbcsv/tablecopy/cli"
+)
+
+// command is a subcommand, with the names of its connection flags, and whether it has the logging flags.
+type command struct {
+	Main    func(context.Context, []string) error
+	Help    string
+	Connect []string
+	Logging bool
+}
+
+var commands = map[string]command{
+	"load":    {Main: csvload.Main, Help: "load a CSV or a spreadsheet into a database table", Connect: []string{"connect"}, Logging: true},
+	"dump":    {Main: csvdump.Main, Help: "dump the result of a query (or a cursor) into CSV or a spreadsheet", Connect: []string{"connect"}, Logging: true},
+	"copy":    {Main: tablecopy.Main, Help: "copy tables between databases", Connect: []string{"src", "dst"}, Logging: true},
+	"foreach": {Main: csvdbforeach.Main, Help: "call a database procedure with each row of the files", Connect: []string{"connect"}, Logging: true},
+	"md":      {Main: csv2md.Main, Help: "print a CSV or a spreadsheet as a Markdown table"},
+	"export":  {Main: paraexp.Main, Help: "execute queries in parallel, into one JSON (or CSV/XLSX)", Connect: []string{"connect"}, Logging: true},
+}
+
+func main() {
+	if err := Main(); err != nil {
+		slog.Error("Main", "error", err)
+		os.Exit(1)
+	}
+}
+
+func Main() error {
+	flagConnect := flag.String("connect", "", "user/passw@sid, or a profile of ~/.dbcsv.yaml to connect to (the -connect of the subcommands, the -src and -dst of copy)")
+	var connOpts connect.Options
+	connOpts.AddFlags(flag.CommandLine)
+	var logCfg dbcsv.LogConfig
+	logCfg.AddFlags(flag.CommandLine)
+	flagVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n\t%s [options] <command> [command options] [args]\n\nCommands:\n", os.Args[0], os.Args[0])
+		names := make([]string, 0, len(commands))
+		for k := range commands {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %-8s %s\n", k, commands[k].Help)
+		}
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-8s %s\n", "completion", completionHelp)
+		fmt.Fprintf(flag.CommandLine.Output(), "\nThe options of a command are listed by %s <command> -h.\n\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *flagVersion {
+		fmt.Println(dbcsv.Version())
+		return nil
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return errors.New("command is needed")
+	}
+	name := flag.Arg(0)
+	if name == "completion" {
+		if flag.NArg() != 2 {
+			return fmt.Errorf("usage: %s completion %s", os.Args[0], strings.Join(completion.Shells, "|"))
+		}
+		return writeCompletion(context.Background(), os.Stdout, flag.Arg(1))
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	// the interrupts are handled by the command, logged with its logger
+	return cmd.Main(context.Background(), cmd.args(os.Args[0]+" "+name, *flagConnect, connOpts, &logCfg, flag.Args()[1:]))
+}
+
+// args returns the arguments of the command: the shared options precede the command's own,
+// so those override them.
+func (cmd command) args(name, conn string, connOpts connect.Options, logCfg *dbcsv.LogConfig, rest []string) []string {
+	args := []string{name}
+	if conn != "" {
+		for _, f := range cmd.Connect {
+			args = append(args, "-"+f+"="+conn)
+		}
+	}
+	if len(cmd.Connect) != 0 {
+		args = append(args, connOpts.Args()...)
+	}
+	if cmd.Logging {
+		args = append(args, logCfg.Args()...)
+	}
+	return append(args, rest...)
+}
+
+const completionHelp = "print the shell completion script (bash, zsh or fish)"
+
+// writeCompletion writes the completion script for the shell,
+// with the flags of the commands collected by running them with completion.WithCollect.
+func writeCompletion(ctx context.Context, w io.Writer, shell string) error {
+	root := completion.Command{Name: "dbcsv"}
+	root.AddFlags(flag.CommandLine, nil)
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		sub := completion.Command{Name: k, Help: commands[k].Help}
+		if err := commands[k].Main(completion.WithCollect(ctx, &sub), []string{"dbcsv " + k}); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		root.Subcommands = append(root.Subcommands, sub)
+	}
+	root.Subcommands = append(root.Subcommands, completion.Command{Name: "completion", Help: completionHelp})
+	return completion.Write(w, shell, root)
+}
@@ -0,0 +1,24 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/connect"
+)
+
+func TestLoadSharedFlags(t *testing.T) {
+	// dbcsv -connect=X -v=2 load -charset=latin2 -version
+	logCfg := dbcsv.LogConfig{Verbose: 2}
+	cmd := commands["load"]
+	args := cmd.args("dbcsv load", "user/passw@db", connect.Options{Protocol: "tcps"}, &logCfg,
+		[]string{"-charset=latin2", "-delim=;", "-version"})
+	if err := cmd.Main(context.Background(), args); err != nil {
+		t.Errorf("%q: %+v", args, err)
+	}
+}
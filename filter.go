@@ -0,0 +1,112 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/UNO-SOFT/dbcsv/transform"
+)
+
+// filterRows returns fn for the rows the filter expression is true for, and the first row of each sheet
+// if header: that gives the names of the columns. Without a header, only col(n) can be used.
+//
+// The filter gets the typed values of the cells where they are known (see Row.Typed), the strings otherwise.
+func filterRows(fn func(context.Context, string, Row) error, filter string, header bool) func(context.Context, string, Row) error {
+	var prog *transform.Program
+	var sheet string
+	var width int
+	return func(ctx context.Context, sheetName string, row Row) error {
+		if prog == nil || sheetName != sheet {
+			columns := row.Columns
+			if !header {
+				// no names, just the number of the columns
+				columns = make([]string, len(row.Values))
+			}
+			var err error
+			if prog, err = transform.Compile(columns, nil, filter); err != nil {
+				return fmt.Errorf("filter %q: %w", filter, err)
+			}
+			sheet, width = sheetName, len(columns)
+			if header {
+				return fn(ctx, sheetName, row)
+			}
+		}
+		values := make([]interface{}, min(width, len(row.Values)))
+		for i := range values {
+			if i < len(row.Typed) && row.Typed[i] != nil {
+				values[i] = row.Typed[i]
+			} else {
+				values[i] = row.Values[i]
+			}
+		}
+		if keep, err := prog.Keep(values); err != nil {
+			return fmt.Errorf("filter %q: line %d: %w", filter, row.Line, err)
+		} else if !keep {
+			return nil
+		}
+		return fn(ctx, sheetName, row)
+	}
+}
+
+// errMaxRows stops the reading when the MaxRows are passed.
+var errMaxRows = errors.New("MaxRows reached")
+
+// limitRows returns fn for the data rows after the first offset ones, at most maxRows of them (all if 0),
+// and the first row of each sheet if header; then it returns errMaxRows.
+func limitRows(fn func(context.Context, string, Row) error, offset, maxRows int, header bool) func(context.Context, string, Row) error {
+	var sheet string
+	var started bool
+	var n int
+	return func(ctx context.Context, sheetName string, row Row) error {
+		if maxRows > 0 && n >= offset+maxRows {
+			return errMaxRows
+		}
+		if header && (!started || sheetName != sheet) {
+			started, sheet = true, sheetName
+			return fn(ctx, sheetName, row)
+		}
+		if n++; n <= offset {
+			return nil
+		}
+		return fn(ctx, sheetName, row)
+	}
+}
+
+// mergeHeaders returns fn for the rows of several sheets or files: it passes only the first header,
+// the later ones (the first rows after a change of the name) must be the same (case insensitively), and are dropped.
+// Without a header, all the rows are passed.
+func mergeHeaders(fn func(context.Context, string, Row) error, header bool) func(context.Context, string, Row) error {
+	if !header {
+		return fn
+	}
+	var first []string
+	var name string
+	var started bool
+	return func(ctx context.Context, sheetName string, row Row) error {
+		if !started {
+			started, name = true, sheetName
+			// the reader may reuse the Values slice
+			first = append(make([]string, 0, len(row.Values)), row.Values...)
+			return fn(ctx, sheetName, row)
+		}
+		if sheetName == name {
+			return fn(ctx, sheetName, row)
+		}
+		name = sheetName
+		if len(row.Values) != len(first) {
+			return fmt.Errorf("%s: columns %q differ from %q", sheetName, row.Values, first)
+		}
+		for i, s := range row.Values {
+			if !strings.EqualFold(strings.TrimSpace(s), strings.TrimSpace(first[i])) {
+				return fmt.Errorf("%s: columns %q differ from %q", sheetName, row.Values, first)
+			}
+		}
+		return nil
+	}
+}
@@ -18,30 +18,68 @@ package dbcsv
 
 import (
 	"context"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
 
+// ShutdownGrace is the time the program has after an interrupt
+// to stop cleanly (roll back or commit, write its summary), before it is killed.
+var ShutdownGrace = 30 * time.Second
+
 // Wrap returns a new context with cancel that is canceled on interrupts.
+//
+// The program should call the returned cancel when it has finished:
+// after an interrupt, the program is killed only if it hasn't finished in ShutdownGrace,
+// or on a second interrupt.
 func Wrap(ctx context.Context) (context.Context, context.CancelFunc) {
-	sigCh := make(chan os.Signal, 1)
+	return WrapLogger(ctx, nil)
+}
+
+// WrapLogger is Wrap, logging the interrupt with the logger (of the tool, after its flags are parsed),
+// slog.Default() if nil.
+func WrapLogger(ctx context.Context, logger *slog.Logger) (context.Context, context.CancelFunc) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	sigCh := make(chan os.Signal, 2)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithCancel(ctx)
+	done := make(chan struct{})
 	go func() {
-		sig := <-sigCh
-		signal.Stop(sigCh)
+		var sig os.Signal
+		select {
+		case sig = <-sigCh:
+		case <-done:
+			signal.Stop(sigCh)
+			return
+		}
+		logger.Warn("interrupted, stopping", "signal", sig.String(), "grace", ShutdownGrace.String())
 		cancel()
-		go func() {
-			time.Sleep(3 * time.Second)
-			if p, _ := os.FindProcess(os.Getpid()); p != nil {
-				_ = p.Signal(sig)
-			}
-			time.Sleep(2 * time.Second)
-			os.Exit(1)
-		}()
+		timer := time.NewTimer(ShutdownGrace)
+		defer timer.Stop()
+		select {
+		case <-done:
+			signal.Stop(sigCh)
+			return
+		case <-sigCh:
+		case <-timer.C:
+		}
+		signal.Stop(sigCh)
+		logger.Error("not stopped in time, killing", "signal", sig.String())
+		if p, _ := os.FindProcess(os.Getpid()); p != nil {
+			_ = p.Signal(sig)
+		}
+		time.Sleep(2 * time.Second)
+		os.Exit(1)
 	}()
-	return ctx, cancel
+	var once sync.Once
+	return ctx, func() {
+		cancel()
+		once.Do(func() { close(done) })
+	}
 }
@@ -0,0 +1,74 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+// LogConfig is the logging configuration of the tools: -v, -q and -log-format.
+//
+// The tools log with the same keys: tool, table, file, rows and duration.
+type LogConfig struct {
+	// Format is console, json, or empty for console on a terminal, json otherwise.
+	Format  string
+	Verbose zlog.VerboseVar
+	// Quiet logs the errors only.
+	Quiet bool
+}
+
+// AddFlags adds the -v, -q and -log-format flags to the FlagSet.
+func (lc *LogConfig) AddFlags(fs *flag.FlagSet) {
+	fs.Var(&lc.Verbose, "v", "verbose logging (-v=2 for debug)")
+	fs.BoolVar(&lc.Quiet, "q", false, "quiet: log the errors only")
+	fs.StringVar(&lc.Format, "log-format", "", "log format: console or json (defaults to console on a terminal, json otherwise)")
+}
+
+// Args returns the flags (as AddFlags adds them) of the set options.
+func (lc *LogConfig) Args() []string {
+	var args []string
+	if lc.Verbose != 0 {
+		args = append(args, "-v="+strconv.Itoa(int(lc.Verbose)))
+	}
+	if lc.Quiet {
+		args = append(args, "-q")
+	}
+	if lc.Format != "" {
+		args = append(args, "-log-format="+lc.Format)
+	}
+	return args
+}
+
+// Level implements slog.Leveler.
+func (lc *LogConfig) Level() slog.Level {
+	if lc.Quiet {
+		return slog.LevelError
+	}
+	return lc.Verbose.Level()
+}
+
+// Handler returns the handler for the Format, writing to w, with the tool attribute.
+func (lc *LogConfig) Handler(w io.Writer, tool string) (slog.Handler, error) {
+	var h slog.Handler
+	switch lc.Format {
+	case "":
+		h = zlog.MaybeConsoleHandler(lc, w)
+	case "console":
+		h = zlog.NewConsoleHandler(lc, w)
+	case "json":
+		opts := zlog.DefaultHandlerOptions
+		opts.Level = lc
+		h = opts.NewJSONHandler(w)
+	default:
+		return nil, fmt.Errorf("-log-format=%q: unknown format (wanted console or json)", lc.Format)
+	}
+	return h.WithAttrs([]slog.Attr{slog.String("tool", tool)}), nil
+}
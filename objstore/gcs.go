@@ -0,0 +1,60 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// gcsRequest returns the authorized request for the object: GET downloads, POST uploads it.
+//
+// The token is got by the application default credentials, except for the emulator (STORAGE_EMULATOR_HOST).
+func gcsRequest(ctx context.Context, method, bucket, object string, body io.ReadCloser, size int64) (*http.Request, error) {
+	base := "https://storage.googleapis.com"
+	var token string
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if base = strings.TrimSuffix(host, "/"); !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+	} else {
+		ts, err := google.DefaultTokenSource(ctx, gcsScope)
+		if err != nil {
+			return nil, fmt.Errorf("credentials: %w", err)
+		}
+		tok, err := ts.Token()
+		if err != nil {
+			return nil, fmt.Errorf("token: %w", err)
+		}
+		token = tok.AccessToken
+	}
+	var u string
+	if method == http.MethodGet {
+		u = base + "/storage/v1/b/" + url.PathEscape(bucket) + "/o/" + url.PathEscape(object) + "?alt=media"
+	} else {
+		u = base + "/upload/storage/v1/b/" + url.PathEscape(bucket) + "/o?uploadType=media&name=" + url.QueryEscape(object)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package objstore reads and writes the objects of the S3 (s3://bucket/key)
+// and the Google Cloud Storage (gs://bucket/object) object storages.
+//
+// The credentials are the standard ones:
+// for S3 the default credential chain of the AWS SDK (the environment, the shared config and credentials files
+// with AWS_PROFILE, the web identity token, SSO, or the container's or the EC2 instance's IAM role);
+// AWS_REGION and AWS_ENDPOINT_URL (for the S3 compatible storages, with path style addressing) are used, too.
+// For GCS the Google application default credentials (GOOGLE_APPLICATION_CREDENTIALS, gcloud,
+// or the service account of the GCE instance); STORAGE_EMULATOR_HOST points to an emulator.
+//
+// The S3 objects bigger than 64 MiB are uploaded in parts,
+// the GCS objects in a single request (up to 5 TiB).
+package objstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// IsURL reports whether the name is an s3:// or gs:// URL.
+func IsURL(name string) bool {
+	return strings.HasPrefix(name, "s3://") || strings.HasPrefix(name, "gs://")
+}
+
+// splitURL returns the scheme, the bucket and the key of the URL.
+func splitURL(u string) (scheme, bucket, key string, err error) {
+	scheme, rest, _ := strings.Cut(u, "://")
+	bucket, key, _ = strings.Cut(rest, "/")
+	if !IsURL(u) || bucket == "" || key == "" {
+		return scheme, bucket, key, fmt.Errorf("%q: wanted s3://bucket/key or gs://bucket/object", u)
+	}
+	return scheme, bucket, key, nil
+}
+
+// Open the object for reading.
+func Open(ctx context.Context, u string) (io.ReadCloser, error) {
+	scheme, bucket, key, err := splitURL(u)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == "s3" {
+		rc, err := s3Open(ctx, bucket, key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", u, err)
+		}
+		return rc, nil
+	}
+	req, err := gcsRequest(ctx, http.MethodGet, bucket, key, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	resp, err := do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	return resp.Body, nil
+}
+
+// PendingObject is a temporary file, uploaded as the object by CloseAtomicallyReplace
+// (as renameio.PendingFile does for the local files).
+type PendingObject struct {
+	*os.File
+	ctx  context.Context
+	url  string
+	done bool
+}
+
+// Create returns a PendingObject for writing the object.
+func Create(ctx context.Context, u string) (*PendingObject, error) {
+	if _, _, _, err := splitURL(u); err != nil {
+		return nil, err
+	}
+	fh, err := os.CreateTemp("", "objstore-")
+	if err != nil {
+		return nil, err
+	}
+	return &PendingObject{File: fh, ctx: ctx, url: u}, nil
+}
+
+// Name returns the URL of the object.
+func (p *PendingObject) Name() string { return p.url }
+
+// Cleanup removes the temporary file, if the object has not been uploaded yet.
+func (p *PendingObject) Cleanup() error {
+	if p.done {
+		return nil
+	}
+	p.done = true
+	closeErr := p.File.Close()
+	if err := os.Remove(p.File.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if closeErr != nil && !errors.Is(closeErr, os.ErrClosed) {
+		return closeErr
+	}
+	return nil
+}
+
+// CloseAtomicallyReplace uploads the written content as the object, replacing it.
+func (p *PendingObject) CloseAtomicallyReplace() error {
+	defer p.Cleanup()
+	size, err := p.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = p.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	scheme, bucket, key, _ := splitURL(p.url)
+	if scheme == "s3" {
+		err = s3Upload(p.ctx, bucket, key, p.File, size)
+	} else {
+		body := io.NopCloser(p.File) // closed by Cleanup
+		var req *http.Request
+		if req, err = gcsRequest(p.ctx, http.MethodPost, bucket, key, body, size); err == nil {
+			var resp *http.Response
+			if resp, err = do(req); err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.url, err)
+	}
+	p.done = true
+	_ = p.File.Close()
+	return os.Remove(p.File.Name())
+}
+
+// do the request, returning an error for the not 2xx responses.
+func do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(b)))
+}
+
+// firstEnv returns the first not empty of the environment variables.
+func firstEnv(names ...string) string {
+	for _, nm := range names {
+		if v := os.Getenv(nm); v != "" {
+			return v
+		}
+	}
+	return ""
+}
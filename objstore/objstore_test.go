@@ -0,0 +1,201 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package objstore
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+// memStore is an object storage in memory, by the request's (escaped) path.
+// The S3 multipart uploads are kept in parts until they are completed.
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string]string
+	parts   map[string]map[string]string
+	check   func(*http.Request) string
+}
+
+func (m *memStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if msg := m.check(r); msg != "" {
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// S3: /bucket/key; GCS: /storage/v1/b/bucket/o/object or the name parameter of the upload
+	key := r.URL.EscapedPath()
+	if i := strings.Index(key, "/o/"); i >= 0 {
+		key, _ = url.PathUnescape(key[i+3:])
+	} else if name := r.URL.Query().Get("name"); name != "" {
+		key = name
+	}
+	q := r.URL.Query()
+	switch uploadID := q.Get("uploadId"); {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		if m.parts == nil {
+			m.parts = make(map[string]map[string]string)
+		}
+		uploadID = fmt.Sprintf("up/%d", len(m.parts)+1)
+		m.parts[uploadID] = make(map[string]string)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case uploadID != "":
+		parts, ok := m.parts[uploadID]
+		if !ok {
+			http.Error(w, "no upload "+uploadID, http.StatusNotFound)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			etag := fmt.Sprintf("%q", "etag-"+q.Get("partNumber"))
+			parts[etag] = string(b)
+			w.Header().Set("ETag", etag)
+		case http.MethodPost:
+			var complete struct {
+				Parts []struct {
+					Number int    `xml:"PartNumber"`
+					ETag   string `xml:"ETag"`
+				} `xml:"Part"`
+			}
+			if err := xml.Unmarshal(b, &complete); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var buf strings.Builder
+			for i, p := range complete.Parts {
+				if p.Number != i+1 || p.ETag != fmt.Sprintf("%q", fmt.Sprintf("etag-%d", i+1)) {
+					_, _ = io.WriteString(w, "<Error><Code>InvalidPart</Code></Error>")
+					return
+				}
+				buf.WriteString(parts[p.ETag])
+			}
+			m.objects[key] = buf.String()
+			delete(m.parts, uploadID)
+			_, _ = io.WriteString(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+		case http.MethodDelete:
+			delete(m.parts, uploadID)
+		}
+	case r.Method == http.MethodPut || r.Method == http.MethodPost:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.objects[key] = string(b)
+	case r.Method == http.MethodGet:
+		s, ok := m.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, s)
+	}
+}
+
+func roundTrip(t *testing.T, u, content string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	po, err := Create(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer po.Cleanup()
+	if po.Name() != u {
+		t.Errorf("got name %q, wanted %q", po.Name(), u)
+	}
+	if _, err = io.WriteString(po, content); err != nil {
+		t.Fatal(err)
+	}
+	if err = po.CloseAtomicallyReplace(); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := Open(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestS3(t *testing.T) {
+	m := memStore{objects: make(map[string]string), check: func(r *http.Request) string {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			return "bad Authorization " + r.Header.Get("Authorization")
+		}
+		return ""
+	}}
+	srv := httptest.NewServer(&m)
+	defer srv.Close()
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "eu-central-1")
+
+	if got := roundTrip(t, "s3://bucket/dir/a b.csv", "a;b\n1;2\n"); got != "a;b\n1;2\n" {
+		t.Errorf("got %q", got)
+	}
+	if _, ok := m.objects["/bucket/dir/a%20b.csv"]; !ok {
+		t.Errorf("got %v", m.objects)
+	}
+	if _, err := Open(context.Background(), "s3://bucket/missing"); err == nil {
+		t.Error("wanted error for a missing object")
+	}
+	if _, err := Open(context.Background(), "s3://bucket"); err == nil {
+		t.Error("wanted error for a missing key")
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	m := memStore{objects: make(map[string]string), check: func(*http.Request) string { return "" }}
+	srv := httptest.NewServer(&m)
+	defer srv.Close()
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer func(size int64) { s3PartSize = size }(s3PartSize)
+	s3PartSize = manager.MinUploadPartSize
+
+	big := strings.Repeat("abcdefghij", int(2*s3PartSize/10+1))
+	for _, content := range []string{"abc", big[:s3PartSize], big} {
+		if got := roundTrip(t, "s3://bucket/big.csv", content); got != content {
+			t.Errorf("got %d bytes, wanted %d", len(got), len(content))
+		}
+	}
+	if len(m.parts) != 0 {
+		t.Errorf("unfinished uploads: %v", m.parts)
+	}
+}
+
+func TestGCS(t *testing.T) {
+	m := memStore{objects: make(map[string]string), check: func(*http.Request) string { return "" }}
+	srv := httptest.NewServer(&m)
+	defer srv.Close()
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+
+	if got := roundTrip(t, "gs://bucket/dir/x.csv", "x\n"); got != "x\n" {
+		t.Errorf("got %q", got)
+	}
+}
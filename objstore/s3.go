@@ -0,0 +1,62 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3PartSize is the size of the parts of the multipart uploads:
+// the bigger objects are uploaded in parts, as a single PUT is limited to 5 GiB.
+var s3PartSize int64 = 64 << 20
+
+// newS3Client returns the client with the default configuration of the SDK (the credential chain, the region),
+// with path style addressing if AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL is set (for the S3 compatible storages).
+func newS3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	pathStyle := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL") != ""
+	return s3.NewFromConfig(cfg, func(o *s3.Options) { o.UsePathStyle = pathStyle }), nil
+}
+
+// s3Open returns the content of the object.
+func s3Open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	c, err := newS3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// s3Upload uploads the size bytes of r as the object: in one PUT, or in parts if it is bigger than s3PartSize.
+//
+// A failed multipart upload is aborted, to not leave the parts there.
+func s3Upload(ctx context.Context, bucket, key string, r io.ReaderAt, size int64) error {
+	c, err := newS3Client(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = manager.NewUploader(c, func(u *manager.Uploader) { u.PartSize = s3PartSize }).Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket), Key: aws.String(key),
+		Body: io.NewSectionReader(r, 0, size), ContentLength: aws.Int64(size),
+	})
+	return err
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// rowBuffer collects the encoded rows in memory,
+// spilling them into a temporary file when they exceed maxMemory bytes (if positive).
+type rowBuffer struct {
+	spill     *os.File
+	buf       bytes.Buffer
+	maxMemory int64
+}
+
+// Write appends p to the buffer.
+func (rb *rowBuffer) Write(p []byte) (int, error) {
+	n, _ := rb.buf.Write(p)
+	if rb.maxMemory <= 0 || int64(rb.buf.Len()) <= rb.maxMemory {
+		return n, nil
+	}
+	if rb.spill == nil {
+		var err error
+		if rb.spill, err = os.CreateTemp("", "paraexp-*.json"); err != nil {
+			return n, err
+		}
+		logger.Info("spill", "file", rb.spill.Name(), "size", rb.buf.Len())
+	}
+	_, err := rb.buf.WriteTo(rb.spill)
+	return n, err
+}
+
+// WriteTo writes the spilled and the buffered data into w, and empties the buffer.
+func (rb *rowBuffer) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	if rb.spill != nil {
+		if _, err := rb.spill.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		var err error
+		if n, err = io.Copy(w, rb.spill); err != nil {
+			return n, err
+		}
+	}
+	m, err := rb.buf.WriteTo(w)
+	n += m
+	if err != nil {
+		return n, err
+	}
+	return n, rb.Reset()
+}
+
+// Reset empties the buffer.
+func (rb *rowBuffer) Reset() error {
+	rb.buf.Reset()
+	if rb.spill == nil {
+		return nil
+	}
+	if err := rb.spill.Truncate(0); err != nil {
+		return err
+	}
+	_, err := rb.spill.Seek(0, io.SeekStart)
+	return err
+}
+
+// Close removes the temporary file.
+func (rb *rowBuffer) Close() error {
+	if rb.spill == nil {
+		return nil
+	}
+	err := rb.spill.Close()
+	if rmErr := os.Remove(rb.spill.Name()); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	rb.spill = nil
+	return err
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRowBuffer(t *testing.T) {
+	rb := rowBuffer{maxMemory: 8}
+	defer rb.Close()
+	for _, s := range []string{`{"a":1}`, `,{"a":2}`, `,{"a":3}`} {
+		if _, err := rb.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rb.spill == nil {
+		t.Fatal("not spilled")
+	}
+	var buf strings.Builder
+	if _, err := rb.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), `{"a":1},{"a":2},{"a":3}`; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	if _, err := rb.Write([]byte(`{"b":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if _, err := rb.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), `{"b":1}`; got != want {
+		t.Errorf("after reset got %q, wanted %q", got, want)
+	}
+}
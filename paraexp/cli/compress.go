@@ -0,0 +1,54 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression returns the compression ("gz", "zs" or "") of the file:
+// by the -compress flag, or else by the .gz/.zst suffix of the file name.
+func compression(compress, fn string) string {
+	if compress != "" {
+		return (strings.TrimSpace(strings.ToLower(compress)) + "  ")[:2]
+	}
+	if strings.HasSuffix(fn, ".gz") {
+		return "gz"
+	} else if strings.HasSuffix(fn, ".zst") {
+		return "zs"
+	}
+	return ""
+}
+
+// compressSuffix returns the file name suffix of the compression.
+func compressSuffix(compression string) string {
+	switch compression {
+	case "gz":
+		return ".gz"
+	case "zs":
+		return ".zst"
+	}
+	return ""
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// compressWriter returns a writer compressing into w, which must be Closed to flush the compressor
+// (but does not close w).
+func compressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "gz":
+		return gzip.NewWriter(w), nil
+	case "zs":
+		return zstd.NewWriter(w)
+	}
+	return nopCloser{w}, nil
+}
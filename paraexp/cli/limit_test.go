@@ -0,0 +1,94 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLimit(t *testing.T) {
+	fake := &numbersConnector{count: 5}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, limit := range []int{0, 2, 5, 7} {
+		fake.scanned = 0
+		var got int
+		if err := doQuery(ctx, db, "SELECT N FROM T", 0, limit, nil, nil, func(map[string]interface{}) error {
+			got++
+			return nil
+		}); err != nil {
+			t.Fatalf("%d: %+v", limit, err)
+		}
+		want := fake.count
+		if limit > 0 && limit < want {
+			want = limit
+		}
+		if got != want || fake.scanned != want {
+			t.Errorf("%d: got %d rows (%d scanned), wanted %d", limit, got, fake.scanned, want)
+		}
+	}
+
+	fn := filepath.Join(t.TempDir(), "limit.csv")
+	if err := dumpCSVFile(ctx, db, fn, "", "SELECT N FROM T", 0, 3, nil, ","); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(string(b), "\n"), 1+3; got != want {
+		t.Errorf("got %d lines, wanted %d:\n%s", got, want, b)
+	}
+}
+
+// numbersConnector is a fake database, returning the numbers 1..count for each query.
+type numbersConnector struct {
+	count, scanned int
+}
+
+func (c *numbersConnector) Connect(context.Context) (driver.Conn, error) { return numbersConn{c}, nil }
+func (c *numbersConnector) Driver() driver.Driver                        { return nil }
+
+type numbersConn struct{ *numbersConnector }
+
+func (c numbersConn) Prepare(string) (driver.Stmt, error)         { return numbersStmt(c), nil }
+func (c numbersConn) Close() error                                { return nil }
+func (c numbersConn) Begin() (driver.Tx, error)                   { return nil, driver.ErrSkip }
+func (c numbersConn) CheckNamedValue(nv *driver.NamedValue) error { return nil }
+
+type numbersStmt struct{ *numbersConnector }
+
+func (s numbersStmt) Close() error                               { return nil }
+func (s numbersStmt) NumInput() int                              { return -1 }
+func (s numbersStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s numbersStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &numbersRows{numbersConnector: s.numbersConnector}, nil
+}
+
+type numbersRows struct {
+	*numbersConnector
+	i int
+}
+
+func (r *numbersRows) Columns() []string { return []string{"N"} }
+func (r *numbersRows) Close() error      { return nil }
+func (r *numbersRows) Next(dest []driver.Value) error {
+	if r.i == r.count {
+		return io.EOF
+	}
+	r.i++
+	r.scanned++
+	dest[0] = int64(r.i)
+	return nil
+}
@@ -0,0 +1,758 @@
+// Copyright 2020, 2022 Tamás Gulácsi.
+//
+//
+// SPDX-License-Identifier: UPL-1.0 OR Apache-2.0
+
+// Package cli in paraexp represents a parallel query-to-JSON (or CSV) dumper
+package cli
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/completion"
+	"github.com/UNO-SOFT/dbcsv/connect"
+	"github.com/UNO-SOFT/dbcsv/tracing"
+	"github.com/UNO-SOFT/spreadsheet"
+	"github.com/UNO-SOFT/spreadsheet/xlsx"
+	"github.com/UNO-SOFT/zlog/v2"
+	"github.com/godror/godror"
+)
+
+const DefaultFetchRowCount = 8
+
+var (
+	logCfg dbcsv.LogConfig
+	logger = zlog.NewLogger(zlog.MaybeConsoleHandler(&logCfg, os.Stderr))
+)
+
+// Main runs the command with the arguments (args[0] is the name of the program).
+func Main(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	flagConnect := fs.String("connect", "", connect.Usage)
+	var connOpts connect.Options
+	connOpts.AddFlags(fs)
+	flagConcurrency := fs.Int("concurrency", runtime.GOMAXPROCS(-1), "concurrency to run the queries")
+	flagFetchRowCount := fs.Int("fetch-row-count", DefaultFetchRowCount, "fetch row count")
+	flagEnc := fs.String("encoding", dbcsv.DefaultEncoding.Name, "encoding to use for input")
+	flagOut := fs.String("o", "-", "output (defaults to stdout)")
+	flagFormat := fs.String("format", "json", "output format: json (all the queries into -o), xlsx (a sheet per query into -o), or csv (one NAME.csv file per query into -o-dir)")
+	flagODir := fs.String("o-dir", "", "output directory of the per-query files (-format=csv)")
+	flagOTemplate := fs.String("o-template", "", `write each query into its own file, named by this template (such as "out/{{.Name}}.json"), for -format=json or csv`)
+	flagSep := fs.String("sep", ",", "CSV separator")
+	flagCompress := fs.String("compress", "", "compress the output with gz/gzip or zst/zstd/zstandard (by default, by the .gz/.zst suffix of the output files)")
+	flagColumns := fs.Bool("columns", false, "add the metadata of the columns (name, type, precision, scale, nullable) to each table of the JSON output")
+	flagBuffered := fs.Bool("buffered", false, "collect the rows of the queries while the output is busy, instead of waiting for it")
+	flagMaxMemory := fs.Int64("max-memory", 0, "with -buffered, spill the collected rows of a query above this size (in bytes) to a temporary file")
+	flagOrdered := fs.Bool("ordered", false, "write the results in the order of the queries (executed concurrently, but each fetches its rows only after the previous ones have been written)")
+	flagRetries := fs.Int("retries", 0, "retry the queries failing with transient errors (resource busy, snapshot too old) this many times, with exponential backoff")
+	flagLimit := fs.Int("limit", 0, "fetch at most this many rows of each query (name[N]:SELECT ... overrides it per query, name[0] means no limit)")
+	flagQueries := fs.String("queries", "", `read the "name: SELECT ..." queries from this file, separated by empty or --- lines`)
+	flagValues := dbcsv.FlagStrings()
+	fs.Var(flagValues, "value", "each -value=name:value will be bond on each query")
+	logCfg.AddFlags(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.Replace(`Usage of {{.prog}}:
+{{.prog}} [options] -value v_alue1=1 -value v_value2=3.14 'name1:SELECT * FROM T_able1 WHERE F_ield=:v_alue1' 'name2:SELECT * FROM T_able2 WHERE F_ield=:v_alue2' ...
+
+will execute a "SELECT * FROM T_able1 WHERE F_ield=1" and "SELECT * FROM T_able2 WHERE F_ield=3.14"
+parallel and dump all the results in one JSON object, named as "name1" and "name2":
+
+  {"name1":[{"rownum":1,"F_IELD":1,...}],"name2":[{"rownum":2,"F_IELD":3.14,...}]}
+
+With -columns, each table has a "columns" array, too:
+
+  {"name":"name1","columns":[{"name":"F_IELD","type":"NUMBER","precision":10,"nullable":true}],"rows":[...]}
+
+A name[N]:SELECT ... query returns only its first N rows (as -limit=N for all the queries);
+name[0] returns all the rows of that query, even with -limit.
+
+The results are written in the order of completion; with -ordered, in the order of the queries
+(they are still executed in parallel, but only the one in turn fetches its rows).
+With -buffered, the queries collect their rows while the output is busy, instead of waiting for it,
+and -max-memory=N spills the collected rows of a query above N bytes to a temporary file.
+
+The cursor (SYS_REFCURSOR) columns are written as nested arrays of rows in the JSON output,
+as in 'master:SELECT A.*, CURSOR(SELECT * FROM detail B WHERE B.master_id = A.id) AS details FROM master A'.
+
+With -retries=N, the queries failing with a transient error are retried (in a new transaction),
+if nothing has been written yet (their per-query files are rewritten).
+
+With -format=csv -o-dir=DIR, the results are written into DIR/name1.csv and DIR/name2.csv,
+with -format=xlsx, into the name1 and name2 sheets of the -o workbook.
+With -o-template='out/{{.Name}}.json', each query is written into its own file (out/name1.json with one object).
+
+`, "{{.prog}}", args[0], -1))
+		fs.PrintDefaults()
+	}
+	flagVersion := fs.Bool("version", false, "print the version and exit")
+	if completion.Collect(ctx, map[string][]string{"format": {"json", "xlsx", "csv"}, "compress": {"gz", "zst"}}, fs) {
+		return nil
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *flagVersion {
+		fmt.Println(dbcsv.Version())
+		return nil
+	}
+	h, err := logCfg.Handler(os.Stderr, "paraexp")
+	if err != nil {
+		return err
+	}
+	logger.SetHandler(h)
+	ctx, stop := dbcsv.WrapLogger(ctx, logger.SLog())
+	defer stop()
+	shutdown, err := tracing.Init(ctx, "paraexp")
+	if err != nil {
+		return err
+	}
+	defer shutdown(context.WithoutCancel(ctx))
+	var oTmpl *template.Template
+	if *flagOTemplate != "" {
+		var err error
+		if oTmpl, err = template.New("o").Parse(*flagOTemplate); err != nil {
+			return fmt.Errorf("-o-template %q: %w", *flagOTemplate, err)
+		}
+	}
+	if *flagMaxMemory > 0 && !*flagBuffered {
+		return errors.New("-max-memory needs -buffered")
+	}
+	switch *flagFormat {
+	case "json":
+	case "xlsx":
+		if oTmpl != nil {
+			return errors.New("-format=xlsx writes one workbook, cannot be used with -o-template")
+		}
+	case "csv":
+		if *flagODir == "" && oTmpl == nil {
+			return errors.New("-format=csv needs -o-dir or -o-template")
+		}
+	default:
+		return fmt.Errorf("unknown format %q (wanted json, xlsx or csv)", *flagFormat)
+	}
+
+	envEnc, err := dbcsv.EncFromName(*flagEnc)
+	if err != nil {
+		return err
+	}
+
+	queries := fs.Args()
+	if *flagQueries != "" {
+		fh, err := os.Open(*flagQueries)
+		if err != nil {
+			return err
+		}
+		qs, err := parseQueries(fh)
+		fh.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", *flagQueries, err)
+		}
+		queries = append(queries, qs...)
+	} else if len(queries) == 0 || len(queries) == 1 && (queries[0] == "-" || queries[0] == "") {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			queries = append(queries, scanner.Text())
+		}
+	}
+	for i, q := range queries {
+		if queries[i], err = envEnc.NewDecoder().String(q); err != nil {
+			return fmt.Errorf("%q: %w", q, err)
+		}
+	}
+
+	params := make([]interface{}, 0, len(flagValues.Strings))
+	for _, s := range flagValues.Strings {
+		if i := strings.IndexAny(s, "-:= \t"); i < 0 {
+			return fmt.Errorf("%q does not contain a separator", s)
+		} else {
+			params = append(params, sql.Named(strings.ToLower(s[:i]), s[i+1:]))
+		}
+	}
+	db, err := connect.Open(*flagConnect, connOpts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err = connect.LogSession(ctx, logger.SLog(), db); err != nil {
+		return err
+	}
+
+	fh := os.Stdout
+	var bw *bufio.Writer
+	var cw io.WriteCloser
+	var xlw *xlsx.XLSXWriter
+	// each query is written into its own file
+	perQuery := *flagFormat == "csv" || oTmpl != nil
+	outName := func(name string) (string, error) {
+		if oTmpl == nil {
+			return filepath.Join(*flagODir, name+".csv"+compressSuffix(compression(*flagCompress, ""))), nil
+		}
+		var buf strings.Builder
+		if err := oTmpl.Execute(&buf, struct{ Name string }{Name: name}); err != nil {
+			return "", fmt.Errorf("-o-template: %w", err)
+		}
+		return buf.String(), nil
+	}
+	if perQuery {
+		if *flagODir != "" && oTmpl == nil {
+			// nosemgrep: go.lang.correctness.permissions.file_permission.incorrect-default-permission
+			if err = os.MkdirAll(*flagODir, 0750); err != nil {
+				return err
+			}
+		}
+	} else {
+		if !(*flagOut == "" || *flagOut == "-") {
+			// nosemgrep: go.lang.correctness.permissions.file_permission.incorrect-default-permission
+			_ = os.MkdirAll(filepath.Dir(*flagOut), 0750)
+			if fh, err = os.Create(*flagOut); err != nil {
+				return fmt.Errorf("%s: %w", *flagOut, err)
+			}
+		}
+		defer fh.Close()
+		logger.Info("writing", "file", fh.Name())
+
+		if *flagFormat == "xlsx" {
+			xlw = xlsx.NewWriter(fh)
+		} else {
+			if cw, err = compressWriter(fh, compression(*flagCompress, fh.Name())); err != nil {
+				return err
+			}
+			bw = bufio.NewWriter(cw)
+			defer bw.Flush()
+			if _, err := bw.WriteString("[\n"); err != nil {
+				return err
+			}
+		}
+	}
+	first := true
+	concLimit := make(chan struct{}, *flagConcurrency)
+	var bwMu sync.Mutex
+	var errsMu sync.Mutex
+	var errs []error
+	grp, grpCtx := errgroup.WithContext(ctx)
+	// the turn of the next query to write, with -ordered
+	var turn chan struct{}
+	if *flagOrdered {
+		turn = make(chan struct{})
+		close(turn)
+	}
+Loop:
+	for _, qry := range queries {
+		i := strings.IndexByte(qry, ':')
+		name, qry := qry[:i], qry[i+1:]
+		name, limit, err := splitLimit(name, *flagLimit)
+		if err != nil {
+			return err
+		}
+		fetchRowCount := *flagFetchRowCount
+		if limit > 0 && (fetchRowCount <= 0 || limit < fetchRowCount) {
+			fetchRowCount = limit
+		}
+		var sheet spreadsheet.Sheet
+		if xlw != nil {
+			// the sheets are in the order of the queries
+			if sheet, err = xlw.NewSheet(name, nil); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		// the queries start in order, so the ones waiting for their turn don't starve the previous ones
+		select {
+		case concLimit <- struct{}{}:
+		case <-grpCtx.Done():
+			break Loop
+		}
+		myTurn, done := turn, turn
+		if turn != nil {
+			done = make(chan struct{})
+			turn = done
+		}
+		grp.Go(func() error {
+			defer func() { <-concLimit }()
+
+			var tw *tableWriter
+			var fn string
+			var err error
+			if sheet != nil {
+				fn = fh.Name()
+			} else if !perQuery {
+				tw = &tableWriter{Name: name, w: bw, mu: &bwMu, first: &first, turn: myTurn, done: done, withColumns: *flagColumns}
+				if *flagBuffered {
+					tw.buffer = &rowBuffer{maxMemory: *flagMaxMemory}
+				}
+			} else if fn, err = outName(name); err == nil {
+				// nosemgrep: go.lang.correctness.permissions.file_permission.incorrect-default-permission
+				_ = os.MkdirAll(filepath.Dir(fn), 0750)
+			}
+			if err == nil {
+				// a new transaction for each attempt, for a new snapshot
+				err = withRetries(grpCtx, *flagRetries, name, func(attempt int, last bool) (bool, error) {
+					tx, err := db.BeginTx(grpCtx, &sql.TxOptions{ReadOnly: true})
+					if err != nil {
+						return true, err
+					}
+					defer tx.Rollback()
+					switch {
+					case sheet != nil:
+						written, err := dumpSheet(grpCtx, tx, sheet, qry, fetchRowCount, limit, params)
+						return !written, err
+					case tw != nil:
+						if err := tw.reset(); err != nil {
+							return false, err
+						}
+						err := doQuery(grpCtx, tx, qry, fetchRowCount, limit, params, tw.SetColumns, tw.Row)
+						return !tw.opened, err
+					case *flagFormat == "csv":
+						return true, dumpCSVFile(grpCtx, tx, fn, *flagCompress, qry, fetchRowCount, limit, params, *flagSep)
+					}
+					return true, dumpJSONFile(grpCtx, tx, fn, *flagCompress, name, qry, fetchRowCount, limit, params, *flagColumns, attempt, last)
+				})
+			}
+			if tw != nil {
+				if err != nil && errors.Is(err, context.Canceled) {
+					tw.Close(nil)
+					return nil
+				}
+				// the error is written into the Table, and returned at the end, too
+				if closeErr := tw.Close(err); closeErr != nil {
+					return closeErr
+				}
+			}
+			if sheet != nil {
+				sheet.Close()
+			}
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error(err, "dump", "name", name, "file", fn)
+				errsMu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				errsMu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err = grp.Wait(); err != nil {
+		return err
+	}
+	if xlw != nil {
+		if err = xlw.Close(); err != nil {
+			return err
+		}
+		if err = fh.Close(); err != nil {
+			return err
+		}
+	}
+	if bw == nil {
+		return errors.Join(errs...)
+	}
+	_, _ = bw.WriteString("]\n")
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = cw.Close(); err != nil {
+		return err
+	}
+	if err = fh.Close(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// Table is the JSON object written for each query.
+type Table struct {
+	Name    string                   `json:"name"`
+	Columns []ColumnInfo             `json:"columns,omitempty"`
+	Rows    []map[string]interface{} `json:"rows"`
+	Error   string                   `json:"error,omitempty"`
+}
+
+// ColumnInfo is the metadata of a column, written with -columns.
+type ColumnInfo struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Precision int    `json:"precision,omitempty"`
+	Scale     int    `json:"scale,omitempty"`
+	Nullable  bool   `json:"nullable"`
+}
+
+// tableWriter streams the rows of a query as a Table into the shared writer.
+//
+// The Table is opened lazily, at the first row: from then on the writer is locked till Close,
+// so the objects of the concurrent queries are not interleaved.
+type tableWriter struct {
+	w     *bufio.Writer
+	mu    *sync.Mutex
+	first *bool
+	Name  string
+	n     int
+	// turn is closed when the previous Tables have been written, done should be closed after this,
+	// if they are not nil (for ordered output).
+	turn <-chan struct{}
+	done chan<- struct{}
+	// columns are written before the rows, if withColumns.
+	columns     []ColumnInfo
+	withColumns bool
+	// buffer collects the rows while the writer is busy, if not nil.
+	buffer *rowBuffer
+	// keepEmpty writes the Table without rows, too.
+	keepEmpty bool
+	opened    bool
+}
+
+func (tw *tableWriter) open() error {
+	if tw.turn != nil {
+		<-tw.turn
+	}
+	tw.mu.Lock()
+	return tw.start()
+}
+
+// tryOpen opens the Table only if the writer is free now.
+func (tw *tableWriter) tryOpen() (bool, error) {
+	if tw.turn != nil {
+		select {
+		case <-tw.turn:
+		default:
+			return false, nil
+		}
+	}
+	if !tw.mu.TryLock() {
+		return false, nil
+	}
+	return true, tw.start()
+}
+
+// start writes the head of the Table and the buffered rows, under the lock.
+func (tw *tableWriter) start() error {
+	tw.opened = true
+	if *tw.first {
+		*tw.first = false
+	} else if err := tw.w.WriteByte(','); err != nil {
+		return err
+	}
+	name, err := json.Marshal(tw.Name)
+	if err != nil {
+		return err
+	}
+	tw.w.WriteString(`{"name":`)
+	tw.w.Write(name)
+	if tw.columns != nil {
+		b, err := json.Marshal(tw.columns)
+		if err != nil {
+			return err
+		}
+		tw.w.WriteString(`,"columns":`)
+		tw.w.Write(b)
+	}
+	if _, err = tw.w.WriteString(`,"rows":[`); err != nil || tw.buffer == nil {
+		return err
+	}
+	_, err = tw.buffer.WriteTo(tw.w)
+	return err
+}
+
+// reset drops the buffered rows (for a retry).
+func (tw *tableWriter) reset() error {
+	if tw.opened || tw.buffer == nil {
+		return nil
+	}
+	tw.n = 0
+	return tw.buffer.Reset()
+}
+
+// SetColumns sets the columns to be written, if withColumns.
+func (tw *tableWriter) SetColumns(columns []dbcsv.Column) {
+	if !tw.withColumns {
+		return
+	}
+	tw.columns = make([]ColumnInfo, len(columns))
+	for i, c := range columns {
+		tw.columns[i] = ColumnInfo{Name: c.Name, Type: c.DatabaseType, Precision: c.Precision, Scale: c.Scale, Nullable: c.Nullable}
+	}
+}
+
+// Row writes the row.
+func (tw *tableWriter) Row(row map[string]interface{}) error {
+	w := io.Writer(tw.w)
+	if !tw.opened {
+		if tw.buffer == nil {
+			if err := tw.open(); err != nil {
+				return err
+			}
+		} else if ok, err := tw.tryOpen(); err != nil {
+			return err
+		} else if !ok {
+			w = tw.buffer
+		}
+	}
+	b, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if tw.n != 0 {
+		b = append([]byte{','}, b...)
+	}
+	tw.n++
+	_, err = w.Write(b)
+	return err
+}
+
+// Close closes the Table with the error of the query, and releases the lock.
+// A Table without rows is written only if there is an error (or keepEmpty).
+func (tw *tableWriter) Close(qryErr error) error {
+	if tw.done != nil {
+		defer close(tw.done)
+	}
+	if tw.buffer != nil {
+		defer tw.buffer.Close()
+	}
+	if !tw.opened {
+		if qryErr == nil && !tw.keepEmpty && tw.n == 0 {
+			if tw.turn != nil {
+				<-tw.turn
+			}
+			return nil
+		}
+		if err := tw.open(); err != nil {
+			tw.mu.Unlock()
+			return err
+		}
+	}
+	defer tw.mu.Unlock()
+	tw.w.WriteByte(']')
+	if qryErr != nil {
+		b, err := json.Marshal(qryErr.Error())
+		if err != nil {
+			return err
+		}
+		tw.w.WriteString(`,"error":`)
+		tw.w.Write(b)
+	}
+	_, err := tw.w.WriteString("}\n")
+	return err
+}
+
+type queryer interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}
+
+type execer interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}
+type queryExecer interface {
+	queryer
+	execer
+}
+
+// dumpCSVFile writes the result of the query into the CSV file fn, with a header.
+func dumpCSVFile(ctx context.Context, db queryer, fn, compress, qry string, fetchRowCount, limit int, params []interface{}, sep string) error {
+	if fetchRowCount <= 0 {
+		fetchRowCount = DefaultFetchRowCount
+	}
+	rows, err := db.QueryContext(ctx, qry, append(params[:len(params):len(params)], godror.FetchRowCount(fetchRowCount))...)
+	if err != nil {
+		return fmt.Errorf("%q: %w", qry, err)
+	}
+	defer rows.Close()
+	columns, err := dbcsv.GetColumns(ctx, rows)
+	if err != nil {
+		return err
+	}
+	fh, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	cw, err := compressWriter(fh, compression(compress, fn))
+	if err != nil {
+		return err
+	}
+	n, err := dbcsv.DumpCSVCount(dbcsv.WithLimit(ctx, limit), cw, rows, columns, true, sep, false)
+	if err != nil {
+		return err
+	}
+	if err = cw.Close(); err != nil {
+		return err
+	}
+	logger.Info("written", "file", fn, "rows", n)
+	return fh.Close()
+}
+
+// dumpJSONFile writes the result of the query as one Table into the file fn.
+//
+// The error of the query is written into the Table (prefixed with the number of the attempt),
+// only the errors of the writing are returned - except the transient errors of not the last attempt,
+// which are returned (without writing the file) to be retried.
+func dumpJSONFile(ctx context.Context, db queryExecer, fn, compress, name, qry string, fetchRowCount, limit int, params []interface{}, withColumns bool, attempt int, last bool) error {
+	fh, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	cw, err := compressWriter(fh, compression(compress, fn))
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(cw)
+	first := true
+	tw := tableWriter{Name: name, w: bw, mu: new(sync.Mutex), first: &first, keepEmpty: true, withColumns: withColumns}
+	qryErr := doQuery(ctx, db, qry, fetchRowCount, limit, params, tw.SetColumns, tw.Row)
+	if qryErr != nil && (errors.Is(qryErr, context.Canceled) || !last && isTransient(qryErr)) {
+		fh.Close()
+		_ = os.Remove(fn)
+		return qryErr
+	}
+	// the error is written into the file, and returned, too (withRetries prefixes it with the attempt)
+	tableErr := qryErr
+	if qryErr != nil && attempt > 1 {
+		tableErr = fmt.Errorf("attempt %d: %w", attempt, qryErr)
+	}
+	if err = tw.Close(tableErr); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = cw.Close(); err != nil {
+		return err
+	}
+	logger.Info("written", "file", fn, "rows", tw.n)
+	if err = fh.Close(); err != nil {
+		return err
+	}
+	return qryErr
+}
+
+// dumpSheet writes the result of the query into the sheet, with a header.
+// Returns whether anything has been written into the sheet.
+func dumpSheet(ctx context.Context, db queryer, sheet spreadsheet.Sheet, qry string, fetchRowCount, limit int, params []interface{}) (bool, error) {
+	if fetchRowCount <= 0 {
+		fetchRowCount = DefaultFetchRowCount
+	}
+	rows, err := db.QueryContext(ctx, qry, append(params[:len(params):len(params)], godror.FetchRowCount(fetchRowCount))...)
+	if err != nil {
+		return false, fmt.Errorf("%q: %w", qry, err)
+	}
+	defer rows.Close()
+	columns, err := dbcsv.GetColumns(ctx, rows)
+	if err != nil {
+		return false, err
+	}
+	header := make([]interface{}, len(columns))
+	for i, c := range columns {
+		header[i] = c.Name
+	}
+	if err = sheet.AppendRow(header...); err != nil {
+		return true, err
+	}
+	_, err = dbcsv.DumpSheetCount(dbcsv.WithLimit(ctx, limit), sheet, rows, columns)
+	return true, err
+}
+
+// doQuery executes the query, and calls consume with each row (without the zero values),
+// the values typed by the column metadata (see typedValue), at most limit rows if limit is positive.
+func doQuery(ctx context.Context, db queryExecer, qry string, fetchRowCount, limit int, params []interface{}, setColumns func([]dbcsv.Column), consume func(map[string]interface{}) error) (err error) {
+	if fetchRowCount <= 0 {
+		fetchRowCount = DefaultFetchRowCount
+	}
+	ctx, span := tracing.Start(ctx, "query", attribute.String("db.statement", qry))
+	defer func() { tracing.End(span, err) }()
+	params = append(params, godror.FetchRowCount(fetchRowCount))
+	rows, err := db.QueryContext(ctx, qry, params...)
+	if err != nil {
+		return fmt.Errorf("%q: %w", qry, err)
+	}
+	defer rows.Close()
+	columns, err := dbcsv.GetColumns(ctx, rows)
+	if err != nil {
+		return err
+	}
+	if setColumns != nil {
+		setColumns(columns)
+	}
+	if err := scanRows(ctx, db, rows, columns, limit, consume); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// scanRows calls consume with each row of rows, without the empty values,
+// stopping after limit rows if limit is positive.
+// The cursor (SYS_REFCURSOR) columns are expanded into arrays of rows.
+func scanRows(ctx context.Context, db queryer, rows *sql.Rows, columns []dbcsv.Column, limit int, consume func(map[string]interface{}) error) error {
+	vals := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	for n := 0; (limit <= 0 || n < limit) && rows.Next(); n++ {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scan into %#v: %w", dest, err)
+		}
+		m := make(map[string]interface{}, len(vals))
+		for i := range vals {
+			if dr, ok := vals[i].(driver.Rows); ok {
+				nested, err := cursorRows(ctx, db, dr)
+				if err != nil {
+					return fmt.Errorf("%s: %w", columns[i].Name, err)
+				}
+				if len(nested) != 0 {
+					m[columns[i].Name] = nested
+				}
+				continue
+			}
+			if vals[i] == nil || reflect.ValueOf(vals[i]).IsZero() {
+				continue
+			}
+			m[columns[i].Name] = typedValue(columns[i], vals[i])
+		}
+		if err := consume(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// cursorRows reads all the rows of the cursor, and closes it.
+func cursorRows(ctx context.Context, db queryer, dr driver.Rows) ([]map[string]interface{}, error) {
+	rows, err := godror.WrapRows(ctx, db, dr)
+	if err != nil {
+		dr.Close()
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := dbcsv.GetColumns(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	var a []map[string]interface{}
+	if err := scanRows(ctx, db, rows, columns, 0, func(m map[string]interface{}) error {
+		a = append(a, m)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, rows.Close()
+}
+
+// vim: se noet fileencoding=utf-8:
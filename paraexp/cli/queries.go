@@ -0,0 +1,72 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseQueries reads the "name: SELECT ..." blocks, separated by empty lines or --- lines.
+//
+// The queries may span several lines, their formatting is kept.
+// The lines starting with # before the name are comments.
+func parseQueries(r io.Reader) ([]string, error) {
+	var queries []string
+	var buf strings.Builder
+	flush := func() error {
+		block := strings.TrimSpace(buf.String())
+		buf.Reset()
+		if block == "" {
+			return nil
+		}
+		i := strings.IndexByte(block, ':')
+		if i <= 0 || strings.ContainsAny(block[:i], " \t\n") {
+			return fmt.Errorf("%q: wanted name: SELECT ...", block)
+		}
+		queries = append(queries, block[:i]+":"+strings.TrimSpace(block[i+1:]))
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if trimmed := strings.TrimSpace(line); trimmed == "" || trimmed == "---" {
+			if err := flush(); err != nil {
+				return queries, err
+			}
+			continue
+		} else if buf.Len() == 0 && strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return queries, err
+	}
+	return queries, flush()
+}
+
+// splitLimit splits the per-query row limit from the "name[N]" name.
+//
+// The limit is defLimit for a name without [N]; name[0] means no limit, even with a defLimit.
+func splitLimit(name string, defLimit int) (string, int, error) {
+	if !strings.HasSuffix(name, "]") {
+		return name, defLimit, nil
+	}
+	i := strings.LastIndexByte(name, '[')
+	if i < 0 {
+		return name, defLimit, nil
+	}
+	limit, err := strconv.Atoi(name[i+1 : len(name)-1])
+	if err != nil || limit < 0 {
+		return name, 0, fmt.Errorf("%q: wanted name[LIMIT]", name)
+	}
+	return name[:i], limit, nil
+}
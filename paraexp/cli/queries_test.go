@@ -0,0 +1,75 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQueries(t *testing.T) {
+	const input = `# the customers
+customers: SELECT *
+  FROM customers
+  WHERE id = :id
+
+orders:
+SELECT * FROM orders
+---
+empty: SELECT 1 FROM DUAL
+`
+	got, err := parseQueries(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"customers:SELECT *\n  FROM customers\n  WHERE id = :id",
+		"orders:SELECT * FROM orders",
+		"empty:SELECT 1 FROM DUAL",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, wanted %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%d. got %q, wanted %q", i, got[i], want[i])
+		}
+	}
+
+	if _, err = parseQueries(strings.NewReader("SELECT * FROM DUAL\n")); err == nil {
+		t.Error("wanted error for a query without name")
+	}
+}
+
+func TestSplitLimit(t *testing.T) {
+	for _, tc := range []struct {
+		In, Name string
+		Default  int
+		Limit    int
+		Err      bool
+	}{
+		{"customers", "customers", 0, 0, false},
+		{"customers", "customers", 10, 10, false},
+		{"customers[100]", "customers", 0, 100, false},
+		{"customers[100]", "customers", 10, 100, false},
+		{"customers[0]", "customers", 10, 0, false},
+		{"customers[-1]", "", 0, 0, true},
+		{"customers[x]", "", 0, 0, true},
+	} {
+		name, limit, err := splitLimit(tc.In, tc.Default)
+		if tc.Err {
+			if err == nil {
+				t.Errorf("%q: wanted error", tc.In)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %+v", tc.In, err)
+		}
+		if name != tc.Name || limit != tc.Limit {
+			t.Errorf("%q: got %q, %d, wanted %q, %d", tc.In, name, limit, tc.Name, tc.Limit)
+		}
+	}
+}
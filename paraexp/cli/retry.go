@@ -0,0 +1,65 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/godror/godror"
+)
+
+// transientCodes are the ORA- error codes worth retrying.
+var transientCodes = map[int]bool{
+	54:    true, // resource busy
+	60:    true, // deadlock detected
+	1555:  true, // snapshot too old
+	3113:  true, // end-of-file on communication channel
+	3114:  true, // not connected to ORACLE
+	3135:  true, // connection lost contact
+	4068:  true, // existing state of packages has been discarded
+	8177:  true, // can't serialize access for this transaction
+	12516: true, // listener could not find available handler
+	12519: true, // no appropriate service handler found
+	12520: true, // listener could not find available handler for requested type of server
+}
+
+// isTransient reports whether the error is transient.
+func isTransient(err error) bool {
+	oe, ok := godror.AsOraErr(err)
+	return ok && transientCodes[oe.Code()]
+}
+
+// withRetries calls f till it succeeds, fails with a not retriable or not transient error,
+// or has been retried retries times, waiting exponentially more between the attempts.
+//
+// f gets the (1-based) number of the attempt and whether it is the last one,
+// and returns whether its error can be retried (nothing has been written yet).
+// The error of a repeated attempt is prefixed with the number of the attempts.
+func withRetries(ctx context.Context, retries int, name string, f func(attempt int, last bool) (bool, error)) error {
+	wait := time.Second
+	for attempt := 1; ; attempt++ {
+		retriable, err := f(attempt, attempt > retries)
+		if err == nil {
+			return nil
+		}
+		if !retriable || attempt > retries || !isTransient(err) {
+			if attempt > 1 {
+				return fmt.Errorf("attempt %d: %w", attempt, err)
+			}
+			return err
+		}
+		logger.Info("retry", "name", name, "attempt", attempt, "wait", wait.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > time.Minute {
+			wait = time.Minute
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/godror/godror"
+)
+
+// isNumber reports whether the column is numeric.
+func isNumber(col dbcsv.Column) bool {
+	switch strings.ToUpper(col.DatabaseType) {
+	case "NUMBER", "FLOAT", "BINARY_FLOAT", "BINARY_DOUBLE", "DECIMAL", "NUMERIC", "INTEGER":
+		return true
+	}
+	if col.Type == nil {
+		return false
+	}
+	switch col.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// typedValue returns the value to be encoded into JSON:
+// the numbers as JSON numbers, the dates and timestamps as RFC3339 strings.
+func typedValue(col dbcsv.Column, v interface{}) interface{} {
+	switch x := v.(type) {
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case godror.Number:
+		return jsonNumber(string(x))
+	case string:
+		if isNumber(col) {
+			return jsonNumber(x)
+		}
+	}
+	return v
+}
+
+// jsonNumber returns the number string as a json.Number, if it is valid (as ".5" is not), or as is.
+func jsonNumber(s string) interface{} {
+	if strings.HasPrefix(s, ".") {
+		s = "0" + s
+	} else if strings.HasPrefix(s, "-.") {
+		s = "-0" + s[1:]
+	}
+	if s == "" || !(s[0] == '-' || '0' <= s[0] && s[0] <= '9') || !json.Valid([]byte(s)) {
+		return s
+	}
+	return json.Number(s)
+}
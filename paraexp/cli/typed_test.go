@@ -0,0 +1,42 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/godror/godror"
+)
+
+func TestTypedValue(t *testing.T) {
+	num := dbcsv.Column{Name: "N", DatabaseType: "NUMBER", Type: reflect.TypeOf("")}
+	str := dbcsv.Column{Name: "S", DatabaseType: "VARCHAR2", Type: reflect.TypeOf("")}
+	date := dbcsv.Column{Name: "D", DatabaseType: "DATE", Type: reflect.TypeOf(time.Time{})}
+	for _, tc := range []struct {
+		Col  dbcsv.Column
+		In   interface{}
+		Want string
+	}{
+		{num, godror.Number("3.14"), `3.14`},
+		{num, godror.Number("-.5"), `-0.5`},
+		{num, "12", `12`},
+		{num, "NaN", `"NaN"`},
+		{str, "12", `"12"`},
+		{date, time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC), `"2024-03-15T10:30:00Z"`},
+		{num, int64(42), `42`},
+	} {
+		b, err := json.Marshal(typedValue(tc.Col, tc.In))
+		if err != nil {
+			t.Fatalf("%v: %+v", tc.In, err)
+		}
+		if got := string(b); got != tc.Want {
+			t.Errorf("%v: got %s, wanted %s", tc.In, got, tc.Want)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,8 +25,10 @@ import (
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/encoding/htmlindex"
+	xunicode "golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
 
+	"github.com/UNO-SOFT/dbcsv/objstore"
 	"github.com/extrame/xls"
 	"github.com/klauspost/compress/zstd"
 	"github.com/xuri/excelize/v2"
@@ -35,6 +38,9 @@ var DefaultEncoding = NamedEncoding{Encoding: encoding.Replacement, Name: "utf-8
 
 var ErrUnknownSheet = errors.New("unknown sheet")
 
+// ErrStreamed is returned when the streamed input (see Config.Stream) would be read again.
+var ErrStreamed = errors.New("the streamed input can be read only once")
+
 type NamedEncoding struct {
 	encoding.Encoding
 	Name string
@@ -75,8 +81,13 @@ const (
 	Csv     = FType("csv")
 	Xls     = FType("xls")
 	XlsX    = FType("xlsx")
+	Ods     = FType("ods")
 	Gzip    = FType("gzip")
 	Zstd    = FType("zstd")
+	Typed   = FType("typed")
+	Json    = FType("json")
+	Parquet = FType("parquet")
+	Zip     = FType("zip")
 )
 
 func DetectReaderType(r io.Reader, fileName string) (FileType, error) {
@@ -88,8 +99,40 @@ func DetectReaderType(r io.Reader, fileName string) (FileType, error) {
 	}
 	if bytes.Equal(b[:], []byte{0xd0, 0xcf, 0x11, 0xe0}) { // OLE2
 		return FileType{Type: Xls}, nil
-	} else if bytes.Equal(b[:], []byte{0x50, 0x4b, 0x03, 0x04}) { //PKZip, so xlsx
-		return FileType{Type: XlsX}, nil
+	} else if bytes.Equal(b[:], []byte{0x50, 0x4b, 0x03, 0x04}) { //PKZip: xlsx, ods or an archive
+		name, member, err := zipFirstMember(r)
+		if member != nil {
+			defer member.Close()
+		}
+		switch {
+		case name == "mimetype":
+			if err == nil && isODS(member) {
+				return FileType{Type: Ods}, nil
+			}
+			return FileType{Type: XlsX}, nil
+		case name == "" || isOOXMLPart(name):
+			return FileType{Type: XlsX}, nil
+		}
+		// the first member of the archive, detected again when opened (see Config.Open)
+		typ := FileType{Type: Unknown, Compression: Zip}
+		if err == nil {
+			sub, _ := DetectReaderType(member, name)
+			typ.Type = sub.Type
+		}
+		return typ, nil
+	}
+	if string(b[:]) == typedMagic[:4] {
+		rest := make([]byte, len(typedMagic)-len(b))
+		if _, err := io.ReadFull(io.TeeReader(r, &buf), rest); err == nil && string(rest) == typedMagic[len(b):] {
+			return FileType{Type: Typed}, nil
+		}
+		return FileType{Type: Csv}, nil
+	}
+	if string(b[:]) == parquetMagic {
+		return FileType{Type: Parquet}, nil
+	}
+	if isJSON(b[:]) {
+		return FileType{Type: Json}, nil
 	}
 	if bytes.Equal(b[:3], []byte{0x1f, 0x8b, 0x8}) { // GZIP
 		zr, err := gzip.NewReader(io.MultiReader(bytes.NewReader(buf.Bytes()), r))
@@ -122,13 +165,47 @@ type Config struct {
 	zr            *zstd.Decoder
 	typ           FileType
 	Delim         string
-	Charset       string
+	Charset       string // of the CSV input; detected by DetectEncoding if empty
 	ColumnsString string
-	fileName      string
-	columns       []int
-	Sheet, Skip   int
+	// InputType overrides the detected file type, if set.
+	InputType FType
+	// fileName is the path of the opened file (maybe a temporary copy),
+	// name is its name for the user (the name passed to the callback of ReadRows for CSV):
+	// archive.zip#member.csv for a ZIP member.
+	fileName, name string
+	columns        []int
+	Sheet, Skip    int
+	// AllSheets makes ReadRows read all the sheets of the spreadsheet (XLS, XLSX, ODS), instead of just the Sheet.
+	AllSheets bool
+	// Stream makes Open not copy the non-seekable (stdin, pipe) CSV input into a temporary file:
+	// it is read in one pass, so ReadRows can be called only once.
+	// The spreadsheets are still copied.
+	Stream bool
+	// streamed is set by Open when streaming, consumed by the first ReadRows.
+	streamed, consumed bool
+	// columnsFrom is the first (1-based) column of the open-ended range of ColumnsString (0 if there is none),
+	// which comes at columnsAt in columns.
+	columnsFrom, columnsAt int
+	// Filter is a (Starlark) boolean expression of the columns (see package transform),
+	// such as `STATUS == "A" and len(col(3)) > 0`: ReadRows passes only the rows it is true for.
+	// The names are of the first row of each sheet (the header), which is always passed.
+	Filter string
+	// Offset is the number of the data rows (after the header) ReadRows skips,
+	// MaxRows is the number of the data rows it passes at most (0 for all), counted before the Filter.
+	Offset, MaxRows int
+	// NoHeader means that the first row (after Skip) is data, too:
+	// Filter, Offset and MaxRows count it, the Filter can use only col(n),
+	// and the first rows of the files (sheets) read as one are not compared and dropped as headers.
+	NoHeader bool
+	// files are the files read as one (see OpenFiles), filesAt is the index of the opened one.
+	files   []string
+	filesAt int
+	// temps are the temporary files (the extracted ZIP members) Close removes.
+	temps []string
 }
 
+// Encoding returns the encoding of the Charset.
+// Without Charset, it is the encoding detected by ReadRows (DefaultEncoding before that).
 func (cfg *Config) Encoding() (encoding.Encoding, error) {
 	if cfg.encoding != nil {
 		return cfg.encoding, nil
@@ -144,6 +221,8 @@ func (cfg *Config) Encoding() (encoding.Encoding, error) {
 	return enc, err
 }
 
+// Columns returns the 0-based indexes of the columns of ColumnsString.
+// The open-ended range ("12-") is resolved by ReadRows, from the first row, so it is not included.
 func (cfg *Config) Columns() ([]int, error) {
 	err := cfg.parseColumnsString()
 	return cfg.columns, err
@@ -152,6 +231,12 @@ func (cfg *Config) Rewind() error {
 	if cfg.file == nil {
 		panic("file is nil")
 	}
+	if cfg.streamed {
+		if cfg.consumed {
+			return ErrStreamed
+		}
+		return nil
+	}
 	if cfg.zr != nil {
 		cfg.zr.Close()
 	}
@@ -183,10 +268,79 @@ func (cfg *Config) Type() (FileType, error) {
 	return cfg.typ, err
 }
 
+// Open the file for reading (stdin for "-" or empty, the object for an s3:// or gs:// URL, see package objstore).
+// A glob pattern (such as "incoming/*.csv.gz") is expanded, and the matching files are opened by OpenFiles.
+//
+// From a ZIP archive (not an xlsx or ods) the only file in it is read,
+// or the member selected as "archive.zip#member.csv".
 func (cfg *Config) Open(fileName string) error {
+	return cfg.OpenContext(context.Background(), fileName)
+}
+
+// OpenContext is like Open, but the download of the object (s3://, gs://) is canceled with the ctx.
+func (cfg *Config) OpenContext(ctx context.Context, fileName string) error {
+	if fileName != "" && fileName != "-" && !objstore.IsURL(fileName) && strings.ContainsAny(fileName, "*?[") {
+		if _, err := os.Stat(fileName); err != nil {
+			matches, err := filepath.Glob(fileName)
+			if err != nil {
+				return fmt.Errorf("%q: %w", fileName, err)
+			}
+			if len(matches) == 0 {
+				return fmt.Errorf("%q: %w", fileName, os.ErrNotExist)
+			}
+			return cfg.openFiles(ctx, matches)
+		}
+	}
+	return cfg.openFiles(ctx, []string{fileName})
+}
+
+// OpenFiles opens the files for reading them as one: ReadRows reads them after each other,
+// passing the name of the file (file#sheet for the spreadsheets) to fn,
+// and the header only once: the headers of the files must be the same.
+func (cfg *Config) OpenFiles(fileNames ...string) error {
+	return cfg.openFiles(context.Background(), fileNames)
+}
+
+func (cfg *Config) openFiles(ctx context.Context, fileNames []string) error {
+	if len(fileNames) == 0 {
+		return errors.New("no file to open")
+	}
+	cfg.files, cfg.filesAt = nil, 0
+	if len(fileNames) > 1 {
+		for _, fileName := range fileNames {
+			if fileName == "-" || fileName == "" {
+				return errors.New("stdin cannot be read with other files")
+			}
+		}
+		cfg.files = fileNames
+	}
+	return cfg.open(ctx, fileNames[0])
+}
+
+// open the file (stdin for "-" or empty, or the object of the URL),
+// copying the non-seekable input into a temporary file, unless Stream.
+func (cfg *Config) open(ctx context.Context, fileName string) error {
+	var member string
+	if i := strings.LastIndexByte(fileName, '#'); i > 0 {
+		if _, err := os.Stat(fileName); err != nil {
+			fileName, member = fileName[:i], fileName[i+1:]
+		}
+	}
 	slurp := fileName == "-" || fileName == ""
+	var remote io.Reader
 	if slurp {
 		cfg.file, fileName = os.Stdin, "-"
+	}
+	name := fileName
+	if slurp {
+	} else if objstore.IsURL(fileName) {
+		// downloaded into the temporary file
+		rc, err := objstore.Open(ctx, fileName)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		remote, slurp = rc, true
 	} else {
 		f, err := os.Open(fileName)
 		if err != nil {
@@ -203,26 +357,52 @@ func (cfg *Config) Open(fileName string) error {
 	slog.Debug("Open", "file", fileName, "slurp", slurp)
 	var buf bytes.Buffer
 	r := io.Reader(cfg.file)
-	typ, err := DetectReaderType(io.TeeReader(r, &buf), cfg.fileName)
+	if remote != nil {
+		r = remote
+	}
+	typ, err := DetectReaderType(io.TeeReader(r, &buf), fileName)
 	if err != nil {
 		return fmt.Errorf("DetectReaderType: %w", err)
 	}
+	if typ.Compression == Zip || member != "" {
+		if !slurp {
+			return cfg.openZip(ctx, nil, fileName, member)
+		}
+		return cfg.openZip(ctx, io.MultiReader(bytes.NewReader(buf.Bytes()), r), fileName, member)
+	}
+	if cfg.InputType != Unknown {
+		typ.Type = cfg.InputType
+	}
 	cfg.typ = typ
 	r = io.MultiReader(bytes.NewReader(buf.Bytes()), r)
 
+	var zr *zstd.Decoder
 	if cfg.typ.Compression != "" {
 		if cfg.typ.Compression == Gzip {
 			if r, err = gzip.NewReader(r); err != nil {
 				return err
 			}
 		} else if cfg.typ.Compression == Zstd {
-			if r, err = zstd.NewReader(r); err != nil {
+			if zr, err = zstd.NewReader(r); err != nil {
 				return err
 			}
+			defer func() {
+				if cfg.zr != zr {
+					zr.Close()
+				}
+			}()
+			r = zr
 		}
 		slurp = true
 	}
 
+	if slurp && cfg.Stream && remote == nil && (cfg.typ.Type == Csv || cfg.typ.Type == Typed || cfg.typ.Type == Json) {
+		slog.Debug("Streaming", "file", fileName)
+		cfg.streamed, cfg.consumed = true, false
+		cfg.fileName, cfg.name, cfg.rdr, cfg.zr = fileName, name, io.NopCloser(r), zr
+		return nil
+	}
+
 	var fh *os.File
 	if slurp {
 		var tmpErr error
@@ -273,13 +453,13 @@ func (cfg *Config) Open(fileName string) error {
 			cfg.rdr = zr.IOReadCloser()
 		}
 	}
-	cfg.fileName = fileName
+	cfg.fileName, cfg.name = fileName, name
 	if cfg.rdr == nil {
 		cfg.rdr = cfg.file
 	}
 	_, err = cfg.Type()
 	if err != nil {
-		return fmt.Errorf("type %s: %w", cfg.fileName, err)
+		return fmt.Errorf("type %s: %w", cfg.name, err)
 	}
 	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
 		slog.Debug("opened", "file", fmt.Sprintf("%+v", cfg.file), "rdr", fmt.Sprintf("%+v", cfg.rdr))
@@ -287,10 +467,35 @@ func (cfg *Config) Open(fileName string) error {
 	return nil
 }
 
+// Position returns the read offset and the size of the opened file,
+// usable for progress reporting.
+func (cfg *Config) Position() (offset, size int64, err error) {
+	if cfg.file == nil {
+		return 0, 0, errors.New("not opened")
+	}
+	fi, err := cfg.file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err = cfg.file.Seek(0, io.SeekCurrent)
+	return offset, fi.Size(), err
+}
+
 func (cfg *Config) Close() error {
+	cfg.files, cfg.filesAt = nil, 0
+	return cfg.close()
+}
+
+// close the opened file.
+func (cfg *Config) close() error {
 	slog.Debug("cfg.Close")
 	zr, rdr, fh := cfg.zr, cfg.rdr, cfg.file
-	cfg.zr, cfg.rdr, cfg.file, cfg.fileName, cfg.typ = nil, nil, nil, "", FileType{Type: Unknown}
+	cfg.zr, cfg.rdr, cfg.file, cfg.fileName, cfg.name, cfg.typ = nil, nil, nil, "", "", FileType{Type: Unknown}
+	cfg.streamed, cfg.consumed = false, false
+	if cfg.Charset == "" {
+		// detected for the file
+		cfg.encoding = nil
+	}
 	var err error
 	if zr != nil {
 		zr.Close()
@@ -301,6 +506,10 @@ func (cfg *Config) Close() error {
 	if fh != nil && rdr != fh {
 		err = fh.Close()
 	}
+	for _, fn := range cfg.temps {
+		_ = os.Remove(fn)
+	}
+	cfg.temps = nil
 	return err
 }
 
@@ -315,40 +524,200 @@ func (cfg *Config) ReadRows(ctx context.Context, fn func(context.Context, string
 	if err := cfg.parseColumnsString(); err != nil {
 		return fmt.Errorf("parseColumnsStrings: %w", err)
 	}
+	if cfg.AllSheets || len(cfg.files) != 0 {
+		fn = mergeHeaders(fn, !cfg.NoHeader)
+	}
+	if cfg.Filter != "" {
+		fn = filterRows(fn, cfg.Filter, !cfg.NoHeader)
+	}
+	if cfg.Offset > 0 || cfg.MaxRows > 0 {
+		fn = limitRows(fn, cfg.Offset, cfg.MaxRows, !cfg.NoHeader)
+		defer func() {
+			if errors.Is(err, errMaxRows) {
+				err = nil
+			}
+		}()
+	}
+	if cfg.columnsFrom != 0 {
+		// the readers read all the columns, the projection is done here
+		columns := cfg.columns
+		cfg.columns = nil
+		defer func() { cfg.columns = columns }()
+		fn = projectOpen(fn, columns, cfg.columnsAt, cfg.columnsFrom-1)
+	}
+	if len(cfg.files) == 0 {
+		return cfg.readRows(ctx, fn)
+	}
 
+	for i, fileName := range cfg.files {
+		if i != cfg.filesAt {
+			if err := cfg.close(); err != nil {
+				return err
+			}
+			if err := cfg.open(ctx, fileName); err != nil {
+				return err
+			}
+			cfg.filesAt = i
+		}
+		isSheet := cfg.typ.Type == Xls || cfg.typ.Type == XlsX || cfg.typ.Type == Ods
+		if err := cfg.readRows(ctx, func(ctx context.Context, name string, row Row) error {
+			if isSheet {
+				name = fileName + "#" + name
+			} else {
+				name = fileName
+			}
+			return fn(ctx, name, row)
+		}); err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+// readRows reads the rows of the opened file.
+func (cfg *Config) readRows(ctx context.Context, fn func(context.Context, string, Row) error) error {
 	if err := cfg.Rewind(); err != nil {
 		return fmt.Errorf("rewind: %w", err)
 	}
+	cfg.consumed = cfg.streamed
 	slog.Debug("ReadRows", "columns", cfg.columns, "columnsString", cfg.ColumnsString, "type", cfg.typ.Type, "delim", cfg.Delim)
 	switch cfg.typ.Type {
-	case Xls:
-		return ReadXLSFile(ctx, fn, cfg.fileName, cfg.Charset, cfg.Sheet, cfg.columns, cfg.Skip)
-	case XlsX:
-		return ReadXLSXFile(ctx, fn, cfg.fileName, cfg.Sheet, cfg.columns, cfg.Skip)
+	case Xls, XlsX, Ods:
+		if !cfg.AllSheets {
+			return cfg.readSheet(ctx, fn, cfg.Sheet)
+		}
+		m, err := cfg.ReadSheets(ctx)
+		if err != nil {
+			return fmt.Errorf("ReadSheets: %w", err)
+		}
+		for i := range len(m) {
+			if err := cfg.readSheet(ctx, fn, i); err != nil {
+				return fmt.Errorf("sheet %d: %w", i, err)
+			}
+		}
+		return nil
+	case Typed:
+		return ReadTyped(ctx, func(ctx context.Context, row Row) error { return fn(ctx, cfg.name, row) }, cfg.rdr, cfg.columns, cfg.Skip)
+	case Json:
+		return ReadJSON(ctx, func(ctx context.Context, row Row) error { return fn(ctx, cfg.name, row) }, cfg.rdr, cfg.columns, cfg.Skip)
+	case Parquet:
+		return ReadParquetFile(ctx, func(ctx context.Context, row Row) error { return fn(ctx, cfg.name, row) }, cfg.fileName, cfg.columns, cfg.Skip)
+	}
+	r := io.Reader(cfg.rdr)
+	if cfg.Charset == "" && cfg.encoding == nil {
+		br := bufio.NewReaderSize(r, SniffSize)
+		b, err := br.Peek(SniffSize)
+		if err != nil && len(b) == 0 && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("peek: %w", err)
+		}
+		ne := DetectEncoding(b)
+		slog.Info("detected encoding", "file", cfg.name, "charset", ne.Name)
+		cfg.encoding, r = ne.Encoding, br
 	}
 	enc, err := cfg.Encoding()
 	if err != nil {
 		return fmt.Errorf("encoding: %w", err)
 	}
-	r := transform.NewReader(cfg.rdr, enc.NewDecoder())
-	return ReadCSV(ctx, func(ctx context.Context, row Row) error { return fn(ctx, cfg.fileName, row) }, r, cfg.Delim, cfg.columns, cfg.Skip)
+	// a BOM overrides the charset
+	r = transform.NewReader(r, xunicode.BOMOverride(enc.NewDecoder()))
+	return ReadCSV(ctx, func(ctx context.Context, row Row) error { return fn(ctx, cfg.name, row) }, r, cfg.Delim, cfg.columns, cfg.Skip)
+}
+
+// readSheet reads the (0-based) sheetIndex-th sheet of the spreadsheet.
+func (cfg *Config) readSheet(ctx context.Context, fn func(context.Context, string, Row) error, sheetIndex int) error {
+	switch cfg.typ.Type {
+	case Xls:
+		return ReadXLSFile(ctx, fn, cfg.fileName, cfg.Charset, sheetIndex, cfg.columns, cfg.Skip)
+	case XlsX:
+		return ReadXLSXFile(ctx, fn, cfg.fileName, sheetIndex, cfg.columns, cfg.Skip)
+	case Ods:
+		return ReadODSFile(ctx, fn, cfg.fileName, sheetIndex, cfg.columns, cfg.Skip)
+	}
+	return fmt.Errorf("%s is not a spreadsheet", cfg.typ.Type)
 }
+
+// parseColumnsString parses the comma separated 1-based column numbers and ranges (such as "1-5,8,12-") of ColumnsString.
 func (cfg *Config) parseColumnsString() error {
-	if cfg.columns != nil || cfg.ColumnsString == "" {
+	if cfg.columns != nil || cfg.columnsFrom != 0 || cfg.ColumnsString == "" {
 		return nil
 	}
 
-	cfg.columns = make([]int, 0, strings.Count(cfg.ColumnsString, ",")+1)
+	columns := make([]int, 0, strings.Count(cfg.ColumnsString, ",")+1)
 	for _, x := range strings.Split(cfg.ColumnsString, ",") {
-		i, err := strconv.Atoi(x)
+		x = strings.TrimSpace(x)
+		first, last, isRange := strings.Cut(x, "-")
+		i, err := strconv.Atoi(first)
+		if err != nil {
+			return fmt.Errorf("%s: %w", x, err)
+		}
+		if i < 1 {
+			return fmt.Errorf("%s: the columns start with 1", x)
+		}
+		if !isRange {
+			columns = append(columns, i-1)
+			continue
+		}
+		if last == "" {
+			if cfg.columnsFrom != 0 {
+				return fmt.Errorf("%s: only one open-ended range is allowed", x)
+			}
+			cfg.columnsFrom, cfg.columnsAt = i, len(columns)
+			continue
+		}
+		j, err := strconv.Atoi(last)
 		if err != nil {
 			return fmt.Errorf("%s: %w", x, err)
 		}
-		cfg.columns = append(cfg.columns, i-1)
+		if j < i {
+			return fmt.Errorf("%s: empty range", x)
+		}
+		for ; i <= j; i++ {
+			columns = append(columns, i-1)
+		}
 	}
+	cfg.columns = columns
 	return nil
 }
 
+// projectOpen returns fn for the rows projected to the columns,
+// with the ones from the (0-based) from till the end of the first row (of each sheet) inserted at at.
+func projectOpen(fn func(context.Context, string, Row) error, columns []int, at, from int) func(context.Context, string, Row) error {
+	var cols []int
+	var names []string
+	var sheet string
+	project := func(row []string) []string {
+		r2 := make([]string, len(cols))
+		for i, j := range cols {
+			if j < len(row) {
+				r2[i] = row[j]
+			}
+		}
+		return r2
+	}
+	return func(ctx context.Context, sheetName string, row Row) error {
+		if cols == nil || sheetName != sheet {
+			sheet = sheetName
+			cols = append(make([]int, 0, len(columns)+len(row.Values)), columns[:at]...)
+			for j := from; j < len(row.Values); j++ {
+				cols = append(cols, j)
+			}
+			cols = append(cols, columns[at:]...)
+			names = project(row.Columns)
+		}
+		row.Columns, row.Values = names, project(row.Values)
+		if row.Typed != nil {
+			typed := make([]interface{}, len(cols))
+			for i, j := range cols {
+				if j < len(row.Typed) {
+					typed[i] = row.Typed[j]
+				}
+			}
+			row.Typed = typed
+		}
+		return fn(ctx, sheetName, row)
+	}
+}
+
 func (cfg *Config) ReadSheets(ctx context.Context) (map[int]string, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -374,9 +743,11 @@ func (cfg *Config) ReadSheets(ctx context.Context) (map[int]string, error) {
 			return nil, err
 		}
 		return xlFile.GetSheetMap(), nil
+	case Ods:
+		return ReadODSSheets(cfg.fileName)
 	}
 	// CSV
-	return map[int]string{1: cfg.fileName}, nil
+	return map[int]string{1: cfg.name}, nil
 }
 
 func ReadXLSXFile(ctx context.Context, fn func(context.Context, string, Row) error, filename string, sheetIndex int, columns []int, skip int) error {
@@ -468,6 +839,7 @@ func ReadXLSXFile(ctx context.Context, fn func(context.Context, string, Row) err
 		}
 
 		// Override dates
+		typed := make([]interface{}, len(row))
 		for j := range row {
 			axis, err := excelize.CoordinatesToCellName(j+1, i)
 			if err != nil {
@@ -491,12 +863,19 @@ func ReadXLSXFile(ctx context.Context, fn func(context.Context, string, Row) err
 					numFmtID = *sxf.NumFmtID
 				}
 			}
+			cellType, err := xlFile.GetCellType(sheetName, axis)
+			if err != nil {
+				return fmt.Errorf("GetCellType(%q, %q): %w", sheetName, axis, err)
+			}
 			if _, ok := dateFmts[numFmtID]; !ok {
-				if numFmtID != 0 && strings.IndexByte(row[j], ',') >= 0 {
-					if raw, _ := xlFile.GetCellValue(sheetName, axis, excelize.Options{RawCellValue: true}); raw != "" && strings.IndexByte(raw, ',') < 0 {
-						row[j] = raw
-					}
+				var raw string
+				if row[j] != "" && (cellType == excelize.CellTypeUnset || cellType == excelize.CellTypeNumber || cellType == excelize.CellTypeBool) {
+					raw, _ = xlFile.GetCellValue(sheetName, axis, excelize.Options{RawCellValue: true})
+				}
+				if numFmtID != 0 && strings.IndexByte(row[j], ',') >= 0 && raw != "" && strings.IndexByte(raw, ',') < 0 {
+					row[j] = raw
 				}
+				typed[j] = xlsxTyped(cellType, raw, row[j])
 				continue
 			}
 			v, err := xlFile.GetCellValue(sheetName, axis, excelize.Options{RawCellValue: true})
@@ -509,6 +888,7 @@ func ReadXLSXFile(ctx context.Context, fn func(context.Context, string, Row) err
 			f, err := strconv.ParseFloat(v, 32)
 			if err != nil && (v[0] == '-' || '0' <= v[0] && v[0] <= '9') {
 				log.Printf("%d:%d.ParseFloat(%q): %+v", i, j+1, v, err)
+				typed[j] = xlsxTyped(cellType, v, row[j])
 				continue
 			}
 
@@ -521,13 +901,14 @@ func ReadXLSXFile(ctx context.Context, fn func(context.Context, string, Row) err
 			} else {
 				row[j] = t.Format(time.RFC3339)
 			}
+			typed[j] = t
 			//log.Println("dateCols:", dateCols)
 		}
 		if colNames == nil {
 			colNames = append(make([]string, 0, len(row)), row...)
 		}
 
-		if err := fn(ctx, sheetName, Row{Columns: colNames, Line: n, Values: row}); err != nil {
+		if err := fn(ctx, sheetName, Row{Columns: colNames, Line: n, Values: row, Typed: typed}); err != nil {
 			return fmt.Errorf("fn(%q, %#v): %w", sheetName, Row{Columns: colNames, Line: n, Values: row}, err)
 		}
 		n++
@@ -535,6 +916,34 @@ func ReadXLSXFile(ctx context.Context, fn func(context.Context, string, Row) err
 	return nil
 }
 
+// xlsxTyped returns the typed value of the cell, by its type and raw value; nil if unknown.
+func xlsxTyped(cellType excelize.CellType, raw, value string) interface{} {
+	switch cellType {
+	case excelize.CellTypeBool:
+		if raw != "" {
+			return raw == "1"
+		}
+	case excelize.CellTypeUnset, excelize.CellTypeNumber:
+		if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f
+		}
+	case excelize.CellTypeDate:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, raw); err == nil {
+				return t
+			}
+		}
+	case excelize.CellTypeSharedString, excelize.CellTypeInlineString, excelize.CellTypeFormula:
+		if value != "" {
+			return value
+		}
+	}
+	return nil
+}
+
 func ReadXLSFile(ctx context.Context, fn func(context.Context, string, Row) error, filename string, charset string, sheetIndex int, columns []int, skip int) error {
 	if err := ctx.Err(); err != nil {
 		log.Printf("Ctx: +%v", err)
@@ -548,6 +957,10 @@ func ReadXLSFile(ctx context.Context, fn func(context.Context, string, Row) erro
 	if sheet == nil {
 		return fmt.Errorf("this XLS file does not contain sheet no %d", sheetIndex)
 	}
+	cells, err := xlsTypedCells(filename, sheetIndex)
+	if err != nil {
+		log.Printf("[WARN] read the cell types of %q: %+v", filename, err)
+	}
 	var need map[int]bool
 	if len(columns) != 0 {
 		need = make(map[int]bool, len(columns))
@@ -557,7 +970,8 @@ func ReadXLSFile(ctx context.Context, fn func(context.Context, string, Row) erro
 	}
 	var colNames []string
 	var maxWidth int
-	for n := 0; n < int(sheet.MaxRow); n++ {
+	// MaxRow is the index of the last row
+	for n := 0; n <= int(sheet.MaxRow); n++ {
 		row := sheet.Row(n)
 		if n < skip {
 			continue
@@ -570,6 +984,7 @@ func ReadXLSFile(ctx context.Context, fn func(context.Context, string, Row) erro
 			return err
 		}
 		vals := make([]string, 0, maxWidth)
+		var typed []interface{}
 		off := row.FirstCol()
 		if w := row.LastCol() - off; cap(vals) < w {
 			maxWidth = w
@@ -583,6 +998,22 @@ func ReadXLSFile(ctx context.Context, fn func(context.Context, string, Row) erro
 				continue
 			}
 			vals[j-off] = row.Col(j)
+			// the library gives the date formatted cells in RFC3339, the others as is
+			var v interface{}
+			if t, err := time.Parse(time.RFC3339, vals[j-off]); err == nil {
+				v = t
+			} else if v = cells[xlsCell{Row: uint16(n), Col: uint16(j)}]; v != nil {
+				// the library skips the booleans, and gives no result for the formulas
+				if s := vals[j-off]; s == "" || s == "FormulaCol" {
+					vals[j-off] = xlsString(v)
+				}
+			}
+			if v != nil {
+				if typed == nil {
+					typed = make([]interface{}, len(vals))
+				}
+				typed[j-off] = v
+			}
 		}
 		if colNames == nil {
 			colNames = append(make([]string, 0, len(vals)), vals...)
@@ -593,7 +1024,7 @@ func ReadXLSFile(ctx context.Context, fn func(context.Context, string, Row) erro
 			return ctx.Err()
 		default:
 		}
-		if err := fn(ctx, sheet.Name, Row{Columns: colNames, Line: n, Values: vals}); err != nil {
+		if err := fn(ctx, sheet.Name, Row{Columns: colNames, Line: n, Values: vals, Typed: typed}); err != nil {
 			return err
 		}
 	}
@@ -605,6 +1036,11 @@ func ReadCSV(ctx context.Context, fn func(context.Context, Row) error, r io.Read
 		return err
 	}
 	br := bufio.NewReader(r)
+	// strip the UTF-8 BOM, decode the UTF-16 with BOM
+	if b, _ := br.Peek(3); bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}) ||
+		bytes.HasPrefix(b, []byte{0xff, 0xfe}) || bytes.HasPrefix(b, []byte{0xfe, 0xff}) {
+		br = bufio.NewReader(transform.NewReader(br, xunicode.BOMOverride(transform.Nop)))
+	}
 	if delim == "" {
 		b, err := br.Peek(1024)
 		if err != nil && len(b) == 0 {
@@ -644,7 +1080,9 @@ func ReadCSV(ctx context.Context, fn func(context.Context, Row) error, r io.Read
 		if columns != nil {
 			r2 := make([]string, len(columns))
 			for i, j := range columns {
-				r2[i] = row[j]
+				if j < len(row) {
+					r2[i] = row[j]
+				}
 			}
 			row = r2
 		}
@@ -659,7 +1097,7 @@ func ReadCSV(ctx context.Context, fn func(context.Context, Row) error, r io.Read
 			return ctx.Err()
 		}
 		if err := fn(ctx, Row{Columns: colNames, Line: n - 1, Values: row}); err != nil {
-			if !errors.Is(err, context.Canceled) {
+			if !errors.Is(err, context.Canceled) && !errors.Is(err, errMaxRows) {
 				log.Printf("Consume %d. row: %+v", n, err)
 			}
 			return fmt.Errorf("fn: %w", err)
@@ -704,6 +1142,36 @@ func ReadFile(ctx context.Context, fileName string, f func(context.Context, stri
 			}
 		}
 
+	case Ods:
+		m, err := ReadODSSheets(fileName)
+		if err != nil {
+			return err
+		}
+		for i := range len(m) {
+			if err := ReadODSFile(ctx, f, fileName, i, nil, 0); err != nil {
+				errs = append(errs, fmt.Errorf("sheet %d: %w", i, err))
+			}
+		}
+
+	case Parquet:
+		if err := ReadParquetFile(ctx,
+			func(ctx context.Context, row Row) error { return f(ctx, "", row) },
+			fileName, nil, 0,
+		); err != nil {
+			errs = append(errs, err)
+		}
+
+	case Json:
+		if _, err = fh.Seek(0, 0); err != nil {
+			return err
+		}
+		if err := ReadJSON(ctx,
+			func(ctx context.Context, row Row) error { return f(ctx, "", row) },
+			fh, nil, 0,
+		); err != nil {
+			errs = append(errs, err)
+		}
+
 	case Csv:
 		if _, err = fh.Seek(0, 0); err != nil {
 			return err
@@ -723,7 +1191,10 @@ func ReadFile(ctx context.Context, fileName string, f func(context.Context, stri
 type Row struct {
 	Values  []string
 	Columns []string
-	Line    int
+	// Typed is the typed value of each of Values, if the reader knows them (XLSX, XLS):
+	// string, float64, int64, time.Time or bool; nil where unknown, there use the string of Values.
+	Typed []interface{}
+	Line  int
 }
 
 func FlagStrings() *StringsValue {
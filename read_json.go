@@ -0,0 +1,151 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// isJSON reports whether the beginning of the input looks like a JSON object.
+func isJSON(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) != 0 && b[0] == '{'
+}
+
+// ReadJSON reads the newline-delimited JSON objects (JSON Lines, NDJSON) of r.
+//
+// The columns are the keys of the first object, in their order (the first row is these names, as the CSV header);
+// the values of the keys of the later objects are put into these, the unknown keys are ignored.
+// The strings are read as is, the numbers in their exact form, the nulls as the empty string,
+// the arrays and objects as (compact) JSON.
+func ReadJSON(ctx context.Context, fn func(context.Context, Row) error, r io.Reader, columns []int, skip int) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	project := func(row []string) []string {
+		if columns == nil {
+			return row
+		}
+		r2 := make([]string, len(columns))
+		for i, j := range columns {
+			if j < len(row) {
+				r2[i] = row[j]
+			}
+		}
+		return r2
+	}
+	var names, colNames []string
+	var index map[string]int
+	ignored := make(map[string]struct{})
+	for n := 0; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		keys, values, err := readJSONObject(dec)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("%d. object: %w", n+1, err)
+		}
+		if names == nil {
+			names, index = keys, make(map[string]int, len(keys))
+			for i, k := range keys {
+				index[k] = i
+			}
+			colNames = project(names)
+			if skip < 1 {
+				if err = fn(ctx, Row{Columns: colNames, Values: append([]string(nil), colNames...)}); err != nil {
+					return fmt.Errorf("fn: %w", err)
+				}
+			}
+		}
+		row := make([]string, len(names))
+		for i, k := range keys {
+			j, ok := index[k]
+			if !ok {
+				if _, ok := ignored[k]; !ok {
+					ignored[k] = struct{}{}
+					slog.Warn("ReadJSON ignores the unknown key", "key", k, "object", n+1)
+				}
+				continue
+			}
+			row[j] = values[i]
+		}
+		if n+1 < skip {
+			continue
+		}
+		if err = fn(ctx, Row{Columns: colNames, Line: n + 1, Values: project(row)}); err != nil {
+			return fmt.Errorf("fn: %w", err)
+		}
+	}
+}
+
+// readJSONObject reads the next object from the decoder, returning its keys and values in order.
+func readJSONObject(dec *json.Decoder) ([]string, []string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, nil, fmt.Errorf("got %v, wanted an object", tok)
+	}
+	var keys, values []string
+	for dec.More() {
+		if tok, err = dec.Token(); err != nil {
+			return keys, values, unexpectedEOF(err)
+		}
+		k, ok := tok.(string)
+		if !ok {
+			return keys, values, fmt.Errorf("got %v, wanted a key", tok)
+		}
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return keys, values, fmt.Errorf("%s: %w", k, unexpectedEOF(err))
+		}
+		v, err := jsonString(raw)
+		if err != nil {
+			return keys, values, fmt.Errorf("%s: %w", k, err)
+		}
+		keys, values = append(keys, k), append(values, v)
+	}
+	// the closing }
+	_, err = dec.Token()
+	return keys, values, unexpectedEOF(err)
+}
+
+// jsonString returns the string of the JSON value: the strings unquoted, the nulls empty,
+// the numbers and booleans as is, the arrays and objects compacted.
+func jsonString(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", nil
+	}
+	switch raw[0] {
+	case 'n':
+		return "", nil
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case '[', '{':
+		var buf bytes.Buffer
+		err := json.Compact(&buf, raw)
+		return buf.String(), err
+	}
+	return string(raw), nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
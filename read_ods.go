@@ -0,0 +1,291 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// odsMimeType is the content of the first, "mimetype" member of an OpenDocument spreadsheet.
+const odsMimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+const (
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// isODS reports whether the content of the first, "mimetype" member of the ZIP
+// is of an OpenDocument spreadsheet.
+func isODS(r io.Reader) bool {
+	b := make([]byte, len(odsMimeType))
+	_, err := io.ReadFull(r, b)
+	return err == nil && string(b) == odsMimeType
+}
+
+// odsContent opens the content.xml of the OpenDocument spreadsheet.
+func odsContent(filename string) (*zip.ReadCloser, io.ReadCloser, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open %q: %w", filename, err)
+	}
+	rc, err := zr.Open("content.xml")
+	if err != nil {
+		zr.Close()
+		return nil, nil, fmt.Errorf("open %q/content.xml: %w", filename, err)
+	}
+	return zr, rc, nil
+}
+
+// ReadODSSheets returns the names of the sheets of the OpenDocument spreadsheet, by their (0-based) index.
+func ReadODSSheets(filename string) (map[int]string, error) {
+	zr, rc, err := odsContent(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	defer rc.Close()
+	m := make(map[int]string)
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return m, nil
+			}
+			return m, fmt.Errorf("%s: %w", filename, err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Space == odsTableNS && se.Name.Local == "table" {
+			m[len(m)] = odsAttr(se, odsTableNS, "name")
+			if err = dec.Skip(); err != nil {
+				return m, fmt.Errorf("%s: %w", filename, err)
+			}
+		}
+	}
+}
+
+// ReadODSFile reads the rows of the (0-based) sheetIndex-th sheet of the OpenDocument spreadsheet.
+//
+// The numbers are read as their raw value, the dates as 2006-01-02, or in RFC3339 if they have a time part;
+// the empty rows are skipped.
+func ReadODSFile(ctx context.Context, fn func(context.Context, string, Row) error, filename string, sheetIndex int, columns []int, skip int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	zr, rc, err := odsContent(filename)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	defer rc.Close()
+	dec := xml.NewDecoder(rc)
+	var sheetName string
+	tableNo := -1
+	for sheetName == "" {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%d (only %d sheets): %w", sheetIndex, tableNo+1, ErrUnknownSheet)
+			}
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Space != odsTableNS || se.Name.Local != "table" {
+			continue
+		}
+		if tableNo++; tableNo == sheetIndex {
+			sheetName = odsAttr(se, odsTableNS, "name")
+		} else if err = dec.Skip(); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+
+	var colNames []string
+	var i, n int
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			if tok.Name.Space == odsTableNS && tok.Name.Local == "table" {
+				return nil
+			}
+			continue
+		case xml.StartElement:
+			if tok.Name.Space != odsTableNS || tok.Name.Local != "table-row" {
+				continue
+			}
+			repeat := odsRepeat(tok, "number-rows-repeated")
+			row, err := readODSRow(dec)
+			if err != nil {
+				return fmt.Errorf("%s: %d. row: %w", sheetName, i+1, err)
+			}
+			if len(row) == 0 {
+				i += repeat
+				continue
+			}
+			if columns != nil {
+				r2 := make([]string, len(columns))
+				for k, j := range columns {
+					if j < len(row) {
+						r2[k] = row[j]
+					}
+				}
+				row = r2
+			}
+			for ; repeat > 0; repeat-- {
+				if i++; i <= skip {
+					continue
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if colNames == nil {
+					colNames = append(make([]string, 0, len(row)), row...)
+				}
+				if err := fn(ctx, sheetName, Row{Columns: colNames, Line: n, Values: append([]string(nil), row...)}); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+	}
+}
+
+// readODSRow reads the cells of the table-row, without the trailing empty ones.
+func readODSRow(dec *xml.Decoder) ([]string, error) {
+	var row []string
+	var empty int // the not yet appended empty cells
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return row, err
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			if tok.Name.Space == odsTableNS && tok.Name.Local == "table-row" {
+				return row, nil
+			}
+		case xml.StartElement:
+			if tok.Name.Space != odsTableNS || !(tok.Name.Local == "table-cell" || tok.Name.Local == "covered-table-cell") {
+				if err = dec.Skip(); err != nil {
+					return row, err
+				}
+				continue
+			}
+			repeat := odsRepeat(tok, "number-columns-repeated")
+			v, err := readODSCell(dec, tok)
+			if err != nil {
+				return row, err
+			}
+			if v == "" {
+				empty += repeat
+				continue
+			}
+			for ; empty > 0; empty-- {
+				row = append(row, "")
+			}
+			for ; repeat > 0; repeat-- {
+				row = append(row, v)
+			}
+		}
+	}
+}
+
+// readODSCell returns the value of the cell: the raw value of the numbers and dates, the text of the others.
+func readODSCell(dec *xml.Decoder, se xml.StartElement) (string, error) {
+	var value string
+	switch odsAttr(se, odsOfficeNS, "value-type") {
+	case "float", "percentage", "currency":
+		value = odsAttr(se, odsOfficeNS, "value")
+	case "date":
+		value = odsDate(odsAttr(se, odsOfficeNS, "date-value"))
+	}
+	if value != "" {
+		return value, dec.Skip()
+	}
+	var buf strings.Builder
+	var paragraphs, open int
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return buf.String(), err
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			if tok.Name == se.Name {
+				return buf.String(), nil
+			}
+			if tok.Name.Space == odsTextNS && (tok.Name.Local == "p" || tok.Name.Local == "h") {
+				open--
+			}
+		case xml.CharData:
+			// only the text of the paragraphs, not the whitespace between them
+			if open != 0 {
+				buf.Write(tok)
+			}
+		case xml.StartElement:
+			switch {
+			case tok.Name.Space == odsOfficeNS && tok.Name.Local == "annotation":
+				// comments are not values
+				if err = dec.Skip(); err != nil {
+					return buf.String(), err
+				}
+			case tok.Name.Space != odsTextNS:
+			case tok.Name.Local == "p" || tok.Name.Local == "h":
+				if paragraphs++; paragraphs > 1 {
+					buf.WriteByte('\n')
+				}
+				open++
+			case tok.Name.Local == "s":
+				k, _ := strconv.Atoi(odsAttr(tok, odsTextNS, "c"))
+				buf.WriteString(strings.Repeat(" ", max(1, k)))
+			case tok.Name.Local == "tab":
+				buf.WriteByte('\t')
+			case tok.Name.Local == "line-break":
+				buf.WriteByte('\n')
+			}
+		}
+	}
+}
+
+// odsDate returns the date as 2006-01-02 if it has no time part, in RFC3339 otherwise.
+func odsDate(s string) string {
+	t, err := time.Parse("2006-01-02T15:04:05.999999999", s)
+	if err != nil {
+		return s
+	}
+	if t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
+func odsAttr(se xml.StartElement, space, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// odsRepeat returns the number-*-repeated attribute, 1 by default.
+func odsRepeat(se xml.StartElement, local string) int {
+	if k, err := strconv.Atoi(odsAttr(se, odsTableNS, local)); err == nil && k > 0 {
+		return k
+	}
+	return 1
+}
@@ -0,0 +1,1191 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// parquetMagic is at the beginning and at the end of the Parquet files.
+const parquetMagic = "PAR1"
+
+// The physical types of Parquet.
+const (
+	pqBoolean = iota
+	pqInt32
+	pqInt64
+	pqInt96
+	pqFloat
+	pqDouble
+	pqByteArray
+	pqFixedLenByteArray
+)
+
+// The limits of the values read from the file, checked before allocating by them:
+// a bad (or malicious) file is an error, not a panic or an exhausted memory.
+const (
+	// pqMaxPageValues is the maximum number of the values of a page (with the nulls),
+	// as the writers start a new page at much less (20000 rows for parquet-mr and Arrow).
+	pqMaxPageValues = 1 << 26
+	// pqMaxPageSize is the maximum (uncompressed) size of a page.
+	pqMaxPageSize = 1 << 30
+	// pqMaxRatio is the compression ratio the decompressed size is preallocated up to.
+	pqMaxRatio = 256
+	// pqMaxScale is the maximum scale of the decimals.
+	pqMaxScale = 1 << 10
+	// pqMaxThriftDepth is the maximum nesting of the Thrift structs and lists.
+	pqMaxThriftDepth = 64
+)
+
+// The kinds of the logical (or converted) types of the Parquet columns, that are formatted specially.
+const (
+	pqKindPlain = iota
+	pqKindDate
+	pqKindTime
+	pqKindTimestamp
+	pqKindDecimal
+	pqKindUnsigned
+	pqKindUUID
+)
+
+// ReadParquetFile reads the rows of the Parquet file.
+//
+// Only the flat schemas (no nested or repeated columns) are supported;
+// the first row is the names of the columns, as the CSV header.
+// The values are formatted as the spreadsheet readers do: the dates as 2006-01-02,
+// the timestamps in RFC3339 (as dates at midnight), the decimals with their scale, the NULLs as the empty string.
+//
+// The supported encodings are PLAIN, the dictionary, RLE, DELTA_BINARY_PACKED, DELTA_LENGTH_BYTE_ARRAY,
+// DELTA_BYTE_ARRAY and BYTE_STREAM_SPLIT, the compressions are SNAPPY, GZIP, LZ4, LZ4_RAW and ZSTD
+// (not BROTLI and LZO).
+// The column chunks are read page by page, so only a page of each column is in memory.
+func ReadParquetFile(ctx context.Context, fn func(context.Context, Row) error, filename string, columns []int, skip int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fh, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", filename, err)
+	}
+	defer fh.Close()
+	fi, err := fh.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %q: %w", filename, err)
+	}
+	pf := parquetFile{r: fh, size: fi.Size()}
+	defer pf.Close()
+	meta, err := pf.readMeta()
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	cols, err := parquetColumns(meta)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+	}
+	need := make([]bool, len(cols))
+	for i := range need {
+		need[i] = columns == nil
+	}
+	for _, j := range columns {
+		if 0 <= j && j < len(need) {
+			need[j] = true
+		}
+	}
+	project := func(row []string) []string {
+		if columns == nil {
+			return row
+		}
+		r2 := make([]string, len(columns))
+		for i, j := range columns {
+			if 0 <= j && j < len(row) {
+				r2[i] = row[j]
+			}
+		}
+		return r2
+	}
+	colNames := project(names)
+	n := 1
+	if n > skip {
+		if err = fn(ctx, Row{Columns: colNames, Values: append([]string(nil), colNames...)}); err != nil {
+			return fmt.Errorf("fn: %w", err)
+		}
+	}
+
+	for g, rg := range meta.list(4) {
+		rg, _ := rg.(thriftStruct)
+		numRows := int(rg.int(3))
+		chunks := rg.list(1)
+		if len(chunks) != len(cols) {
+			return fmt.Errorf("%s: %d. row group has %d columns, wanted %d", filename, g, len(chunks), len(cols))
+		}
+		readers := make([]*parquetColumnReader, len(cols))
+		for i, cc := range chunks {
+			if !need[i] {
+				continue
+			}
+			cc, _ := cc.(thriftStruct)
+			if readers[i], err = pf.newColumnReader(cols[i], cc); err != nil {
+				return fmt.Errorf("%s: %d. row group %q: %w", filename, g, cols[i].name, err)
+			}
+		}
+		for k := 0; k < numRows; k++ {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			row := make([]string, len(cols))
+			for i, cr := range readers {
+				if cr == nil {
+					continue
+				}
+				if row[i], err = cr.next(); err != nil {
+					return fmt.Errorf("%s: %d. row group %q: %d. value: %w", filename, g, cols[i].name, k, err)
+				}
+			}
+			if n++; n <= skip {
+				continue
+			}
+			if err = fn(ctx, Row{Columns: colNames, Line: n - 1, Values: project(row)}); err != nil {
+				return fmt.Errorf("fn: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// parquetColumn is a (leaf) column of the Parquet schema.
+type parquetColumn struct {
+	name        string
+	typ, length int
+	optional    bool
+	kind        int
+	// unit of the times and timestamps, in nanoseconds
+	unit  int64
+	scale int
+	// utc is false for the local (not adjusted to UTC) timestamps
+	utc bool
+}
+
+// parquetColumns returns the columns of the flat schema of the FileMetaData.
+func parquetColumns(meta thriftStruct) ([]parquetColumn, error) {
+	schema := meta.list(2)
+	if len(schema) == 0 {
+		return nil, errors.New("empty schema")
+	}
+	cols := make([]parquetColumn, 0, len(schema)-1)
+	for _, se := range schema[1:] {
+		se, _ := se.(thriftStruct)
+		c := parquetColumn{name: se.str(4), typ: int(se.int(1)), length: int(se.int(2)), optional: se.int(3) == 1, utc: true}
+		if se.int(5) != 0 || se.int(3) == 2 {
+			return nil, fmt.Errorf("%q: nested and repeated columns are not supported", c.name)
+		}
+		if lt := se.st(10); len(lt) != 0 {
+			// LogicalType
+			switch {
+			case lt.has(5):
+				dec := lt.st(5)
+				c.kind, c.scale = pqKindDecimal, int(dec.int(1))
+			case lt.has(6):
+				c.kind = pqKindDate
+			case lt.has(7), lt.has(8):
+				ts := lt.st(8)
+				c.kind = pqKindTimestamp
+				if lt.has(7) {
+					ts, c.kind = lt.st(7), pqKindTime
+				}
+				c.utc = ts.bool(1)
+				switch unit := ts.st(2); {
+				case unit.has(1):
+					c.unit = int64(time.Millisecond)
+				case unit.has(2):
+					c.unit = int64(time.Microsecond)
+				default:
+					c.unit = 1
+				}
+			case lt.has(10):
+				if !lt.st(10).bool(2) {
+					c.kind = pqKindUnsigned
+				}
+			case lt.has(14):
+				c.kind = pqKindUUID
+			}
+		} else if se.has(6) {
+			// ConvertedType
+			switch se.int(6) {
+			case 5: // DECIMAL
+				c.kind, c.scale = pqKindDecimal, int(se.int(7))
+			case 6:
+				c.kind = pqKindDate
+			case 7, 8: // TIME_MILLIS, TIME_MICROS
+				c.kind, c.unit = pqKindTime, int64(time.Millisecond)
+				if se.int(6) == 8 {
+					c.unit = int64(time.Microsecond)
+				}
+			case 9, 10: // TIMESTAMP_MILLIS, TIMESTAMP_MICROS
+				c.kind, c.unit = pqKindTimestamp, int64(time.Millisecond)
+				if se.int(6) == 10 {
+					c.unit = int64(time.Microsecond)
+				}
+			case 11, 12, 13, 14: // UINT_*
+				c.kind = pqKindUnsigned
+			}
+		}
+		if c.typ == pqFixedLenByteArray && (c.length <= 0 || c.length > pqMaxPageSize) {
+			return nil, fmt.Errorf("%q: bad length %d", c.name, c.length)
+		}
+		if c.scale < 0 || c.scale > pqMaxScale {
+			return nil, fmt.Errorf("%q: bad scale %d", c.name, c.scale)
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// format the decoded value of the column.
+func (c parquetColumn) format(v interface{}) string {
+	switch x := v.(type) {
+	case bool:
+		return strconv.FormatBool(x)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case int32:
+		switch c.kind {
+		case pqKindDate:
+			return time.Unix(int64(x)*86400, 0).UTC().Format("2006-01-02")
+		case pqKindUnsigned:
+			return strconv.FormatUint(uint64(uint32(x)), 10)
+		}
+		return c.format(int64(x))
+	case int64:
+		switch c.kind {
+		case pqKindTimestamp:
+			return c.formatTime(time.Unix(0, x*c.unit).UTC())
+		case pqKindTime:
+			return time.Unix(0, x*c.unit).UTC().Format("15:04:05.999999999")
+		case pqKindDecimal:
+			return formatDecimal(big.NewInt(x), c.scale)
+		case pqKindUnsigned:
+			return strconv.FormatUint(uint64(x), 10)
+		}
+		return strconv.FormatInt(x, 10)
+	case [12]byte:
+		// INT96: nanoseconds of the day, then the Julian day
+		nanos := int64(binary.LittleEndian.Uint64(x[:8]))
+		day := int64(binary.LittleEndian.Uint32(x[8:]))
+		return c.formatTime(time.Unix((day-2440588)*86400, nanos).UTC())
+	case []byte:
+		switch c.kind {
+		case pqKindDecimal:
+			// two's complement, big-endian
+			i := new(big.Int).SetBytes(x)
+			if len(x) != 0 && x[0]&0x80 != 0 {
+				i.Sub(i, new(big.Int).Lsh(big.NewInt(1), uint(len(x))*8))
+			}
+			return formatDecimal(i, c.scale)
+		case pqKindUUID:
+			if len(x) == 16 {
+				s := hex.EncodeToString(x)
+				return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+			}
+		}
+		return string(x)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// formatTime formats the timestamp as the spreadsheet readers do: just the date at midnight.
+func (c parquetColumn) formatTime(t time.Time) string {
+	if t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())) {
+		return t.Format("2006-01-02")
+	}
+	if !c.utc {
+		return t.Format("2006-01-02T15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// formatDecimal returns the unscaled value with the decimal point put before the last scale digits.
+func formatDecimal(unscaled *big.Int, scale int) string {
+	s := unscaled.String()
+	if scale <= 0 {
+		return s
+	}
+	var sign string
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	return sign + s[:len(s)-scale] + "." + s[len(s)-scale:]
+}
+
+type parquetFile struct {
+	r    io.ReaderAt
+	size int64
+	zd   *zstd.Decoder
+}
+
+func (pf *parquetFile) Close() {
+	if pf.zd != nil {
+		pf.zd.Close()
+	}
+}
+
+// readMeta reads the FileMetaData from the footer.
+func (pf *parquetFile) readMeta() (thriftStruct, error) {
+	var footer [8]byte
+	size := pf.size
+	if size < int64(len(parquetMagic)+len(footer)) {
+		return nil, errors.New("too short for a Parquet file")
+	}
+	if _, err := pf.r.ReadAt(footer[:], size-int64(len(footer))); err != nil {
+		return nil, fmt.Errorf("read footer: %w", err)
+	}
+	if string(footer[4:]) != parquetMagic {
+		return nil, fmt.Errorf("bad magic %q", footer[4:])
+	}
+	length := int64(binary.LittleEndian.Uint32(footer[:4]))
+	if length > size-int64(len(parquetMagic)+len(footer)) {
+		return nil, fmt.Errorf("bad metadata length %d", length)
+	}
+	b := make([]byte, int(length))
+	if _, err := pf.r.ReadAt(b, size-int64(len(footer))-length); err != nil {
+		return nil, fmt.Errorf("read metadata: %w", err)
+	}
+	d := thriftDecoder{b: b}
+	meta, err := d.structValue()
+	if err != nil {
+		return nil, fmt.Errorf("decode metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// parquetColumnReader reads the values of a column chunk, page by page.
+type parquetColumnReader struct {
+	pf    *parquetFile
+	col   parquetColumn
+	codec int64
+	// pos is the offset of the next page, end is the end of the chunk.
+	pos, end int64
+	// left is the number of the values not read yet from the chunk.
+	left int64
+	dict []string
+	// values are the not yet returned values of the current page.
+	values []string
+}
+
+func (pf *parquetFile) newColumnReader(col parquetColumn, cc thriftStruct) (*parquetColumnReader, error) {
+	if cc.has(1) {
+		return nil, fmt.Errorf("column in external file %q is not supported", cc.str(1))
+	}
+	md := cc.st(3)
+	start := md.int(9)
+	if dict := md.int(11); dict > 0 && dict < start {
+		start = dict
+	}
+	size := md.int(7)
+	if size < 0 || start < 0 || size > pf.size-start {
+		return nil, fmt.Errorf("bad chunk size %d at %d", size, start)
+	}
+	left := md.int(5)
+	if left < 0 {
+		return nil, fmt.Errorf("bad number of values %d", left)
+	}
+	return &parquetColumnReader{pf: pf, col: col, codec: md.int(4), pos: start, end: start + size, left: left}, nil
+}
+
+// next returns the next value of the column.
+func (cr *parquetColumnReader) next() (string, error) {
+	for len(cr.values) == 0 {
+		if cr.pos >= cr.end {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err := cr.readPage(); err != nil {
+			return "", err
+		}
+	}
+	v := cr.values[0]
+	cr.values = cr.values[1:]
+	return v, nil
+}
+
+// pageHeader reads the header of the next page.
+func (cr *parquetColumnReader) pageHeader() (thriftStruct, error) {
+	// the header's length is not known in advance, so read more till it can be decoded
+	for n := int64(1 << 10); ; n *= 4 {
+		n = min(n, cr.end-cr.pos)
+		b := make([]byte, int(n))
+		if _, err := cr.pf.r.ReadAt(b, cr.pos); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("read page header: %w", err)
+		}
+		d := thriftDecoder{b: b}
+		ph, err := d.structValue()
+		if err == nil {
+			cr.pos += int64(d.pos)
+			return ph, nil
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) || n == cr.end-cr.pos {
+			return nil, fmt.Errorf("page header: %w", err)
+		}
+	}
+}
+
+// readPage reads the next page: the dictionary, or the values.
+func (cr *parquetColumnReader) readPage() error {
+	ph, err := cr.pageHeader()
+	if err != nil {
+		return err
+	}
+	length := ph.int(3)
+	if length < 0 || length > cr.end-cr.pos {
+		return fmt.Errorf("bad page size %d", length)
+	}
+	uncompressed := ph.int(2)
+	if uncompressed < 0 || uncompressed > pqMaxPageSize {
+		return fmt.Errorf("bad uncompressed page size %d", uncompressed)
+	}
+	data := make([]byte, int(length))
+	if _, err = cr.pf.r.ReadAt(data, cr.pos); err != nil {
+		return fmt.Errorf("read page: %w", err)
+	}
+	cr.pos += length
+	col, pf := cr.col, cr.pf
+	// checkValues checks the number of the values of the data page, against the rest of the chunk
+	checkValues := func(n int64) (int, error) {
+		if n < 0 || n > cr.left || n > pqMaxPageValues {
+			return 0, fmt.Errorf("bad number of values %d (%d left)", n, cr.left)
+		}
+		cr.left -= n
+		return int(n), nil
+	}
+	switch ph.int(1) {
+	case 2: // DICTIONARY_PAGE
+		dph := ph.st(7)
+		if data, err = pf.decompress(cr.codec, data, int(uncompressed)); err != nil {
+			return err
+		}
+		n := dph.int(1)
+		if n < 0 || n > pqMaxPageValues {
+			return fmt.Errorf("bad dictionary size %d", n)
+		}
+		if cr.dict, _, err = col.decodePlain(data, int(n)); err != nil {
+			return fmt.Errorf("dictionary: %w", err)
+		}
+
+	case 0: // DATA_PAGE
+		dph := ph.st(5)
+		if data, err = pf.decompress(cr.codec, data, int(uncompressed)); err != nil {
+			return err
+		}
+		numValues, err := checkValues(dph.int(1))
+		if err != nil {
+			return err
+		}
+		var defs []byte
+		if col.optional {
+			if len(data) < 4 {
+				return io.ErrUnexpectedEOF
+			}
+			k := int(binary.LittleEndian.Uint32(data))
+			if k > len(data)-4 {
+				return fmt.Errorf("bad definition levels length %d", k)
+			}
+			defs, data = data[4:4+k], data[4+k:]
+		}
+		if cr.values, err = col.decodeValues(nil, data, defs, numValues, dph.int(2), cr.dict); err != nil {
+			return err
+		}
+
+	case 3: // DATA_PAGE_V2
+		dph := ph.st(8)
+		numValues, err := checkValues(dph.int(1))
+		if err != nil {
+			return err
+		}
+		defLen, repLen := dph.int(5), dph.int(6)
+		if defLen < 0 || repLen < 0 || defLen+repLen > int64(len(data)) || defLen+repLen > uncompressed {
+			return fmt.Errorf("bad levels length %d+%d", defLen, repLen)
+		}
+		defs := data[repLen : repLen+defLen]
+		data = data[repLen+defLen:]
+		if !dph.has(7) || dph.bool(7) {
+			if data, err = pf.decompress(cr.codec, data, int(uncompressed-defLen-repLen)); err != nil {
+				return err
+			}
+		}
+		if !col.optional {
+			defs = nil
+		}
+		if cr.values, err = col.decodeValues(nil, data, defs, numValues, dph.int(4), cr.dict); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pf *parquetFile) decompress(codec int64, b []byte, size int) ([]byte, error) {
+	switch codec {
+	case 0:
+		return b, nil
+	case 1:
+		return snappy.Decode(nil, b)
+	case 2:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case 5: // LZ4: with the Hadoop framing, or a raw block as some writers made it
+		if out, err := lz4Hadoop(b, size); err == nil {
+			return out, nil
+		}
+		return lz4Block(b, size)
+	case 7: // LZ4_RAW
+		return lz4Block(b, size)
+	case 6:
+		if pf.zd == nil {
+			var err error
+			if pf.zd, err = zstd.NewReader(nil); err != nil {
+				return nil, err
+			}
+		}
+		return pf.zd.DecodeAll(b, make([]byte, 0, min(size, pqMaxRatio*len(b))))
+	}
+	return nil, fmt.Errorf("compression codec %d is not supported", codec)
+}
+
+// decodeValues appends the numValues values of the data page (with the defs definition levels) to out.
+func (col parquetColumn) decodeValues(out []string, data, defs []byte, numValues int, encoding int64, dict []string) ([]string, error) {
+	var levels []uint32
+	nonNull := numValues
+	if defs != nil {
+		var err error
+		if levels, err = decodeHybrid(defs, 1, numValues); err != nil {
+			return out, fmt.Errorf("definition levels: %w", err)
+		}
+		nonNull = 0
+		for _, l := range levels {
+			nonNull += int(l)
+		}
+	}
+	var values []string
+	var err error
+	switch encoding {
+	case 0: // PLAIN
+		values, _, err = col.decodePlain(data, nonNull)
+	case 2, 8: // PLAIN_DICTIONARY, RLE_DICTIONARY
+		if len(data) == 0 {
+			if nonNull != 0 {
+				return out, io.ErrUnexpectedEOF
+			}
+			break
+		}
+		var idx []uint32
+		if idx, err = decodeHybrid(data[1:], int(data[0]), nonNull); err != nil {
+			return out, fmt.Errorf("dictionary indexes: %w", err)
+		}
+		values = make([]string, len(idx))
+		for i, j := range idx {
+			if int(j) >= len(dict) {
+				return out, fmt.Errorf("dictionary index %d out of %d", j, len(dict))
+			}
+			values[i] = dict[j]
+		}
+	case 3: // RLE, for booleans
+		if col.typ != pqBoolean || len(data) < 4 {
+			return out, errors.New("RLE is supported only for booleans")
+		}
+		var bits []uint32
+		if bits, err = decodeHybrid(data[4:], 1, nonNull); err != nil {
+			return out, err
+		}
+		values = make([]string, len(bits))
+		for i, b := range bits {
+			values[i] = col.format(b != 0)
+		}
+	case 5: // DELTA_BINARY_PACKED
+		var ints []int64
+		if ints, _, err = decodeDelta(data, nonNull); err != nil {
+			return out, err
+		}
+		values = make([]string, len(ints))
+		for i, v := range ints {
+			switch col.typ {
+			case pqInt32:
+				values[i] = col.format(int32(v))
+			case pqInt64:
+				values[i] = col.format(v)
+			default:
+				return out, fmt.Errorf("DELTA_BINARY_PACKED is not supported for type %d", col.typ)
+			}
+		}
+	case 6, 7: // DELTA_LENGTH_BYTE_ARRAY, DELTA_BYTE_ARRAY
+		if col.typ != pqByteArray && col.typ != pqFixedLenByteArray {
+			return out, fmt.Errorf("encoding %d is not supported for type %d", encoding, col.typ)
+		}
+		var bb [][]byte
+		if encoding == 6 {
+			bb, _, err = decodeDeltaLength(data, nonNull)
+		} else {
+			bb, err = decodeDeltaByteArray(data, nonNull)
+		}
+		if err != nil {
+			return out, err
+		}
+		values = make([]string, len(bb))
+		for i, b := range bb {
+			values[i] = col.format(b)
+		}
+	case 9: // BYTE_STREAM_SPLIT: the k-th bytes of the values are together
+		size := col.size()
+		if size == 0 || col.typ == pqInt96 {
+			return out, fmt.Errorf("BYTE_STREAM_SPLIT is not supported for type %d", col.typ)
+		}
+		if len(data) < nonNull*size {
+			return out, io.ErrUnexpectedEOF
+		}
+		plain := make([]byte, nonNull*size)
+		for i := 0; i < nonNull; i++ {
+			for k := 0; k < size; k++ {
+				plain[i*size+k] = data[k*nonNull+i]
+			}
+		}
+		values, _, err = col.decodePlain(plain, nonNull)
+	default:
+		return out, fmt.Errorf("encoding %d is not supported", encoding)
+	}
+	if err != nil {
+		return out, err
+	}
+	if len(values) != nonNull {
+		return out, fmt.Errorf("got %d values, wanted %d", len(values), nonNull)
+	}
+	if levels == nil {
+		return append(out, values...), nil
+	}
+	var j int
+	for _, l := range levels {
+		if l == 0 {
+			out = append(out, "")
+			continue
+		}
+		out = append(out, values[j])
+		j++
+	}
+	return out, nil
+}
+
+// size returns the size of the fixed length types, 0 for the others.
+func (col parquetColumn) size() int {
+	return map[int]int{pqInt32: 4, pqInt64: 8, pqInt96: 12, pqFloat: 4, pqDouble: 8, pqFixedLenByteArray: col.length}[col.typ]
+}
+
+// decodePlain decodes n PLAIN encoded values, returning the rest of the data.
+func (col parquetColumn) decodePlain(b []byte, n int) ([]string, []byte, error) {
+	if n < 0 {
+		return nil, b, fmt.Errorf("bad number of values %d", n)
+	}
+	size := col.size()
+	switch col.typ {
+	case pqBoolean:
+		size = 0
+		if n > len(b)*8 {
+			return nil, b, io.ErrUnexpectedEOF
+		}
+	case pqByteArray: // at least the 4 bytes length of each
+		if n > len(b)/4 {
+			return nil, b, io.ErrUnexpectedEOF
+		}
+	case pqInt32, pqInt64, pqInt96, pqFloat, pqDouble, pqFixedLenByteArray:
+		if n > len(b)/size {
+			return nil, b, io.ErrUnexpectedEOF
+		}
+	default:
+		return nil, b, fmt.Errorf("unknown type %d", col.typ)
+	}
+	values := make([]string, n)
+	for i := range values {
+		var v interface{}
+		switch col.typ {
+		case pqBoolean:
+			v = b[i/8]&(1<<(i%8)) != 0
+		case pqInt32:
+			v = int32(binary.LittleEndian.Uint32(b))
+		case pqInt64:
+			v = int64(binary.LittleEndian.Uint64(b))
+		case pqInt96:
+			var x [12]byte
+			copy(x[:], b)
+			v = x
+		case pqFloat:
+			v = math.Float32frombits(binary.LittleEndian.Uint32(b))
+		case pqDouble:
+			v = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		case pqByteArray:
+			if len(b) < 4 {
+				return values, b, io.ErrUnexpectedEOF
+			}
+			size = 4 + int(binary.LittleEndian.Uint32(b))
+			if size < 4 || size > len(b) {
+				return values, b, io.ErrUnexpectedEOF
+			}
+			v = b[4:size]
+		case pqFixedLenByteArray:
+			v = b[:size]
+		}
+		values[i] = col.format(v)
+		b = b[size:]
+	}
+	if col.typ == pqBoolean {
+		b = b[(n+7)/8:]
+	}
+	return values, b, nil
+}
+
+// decodeHybrid decodes n values of the RLE/bit-packing hybrid encoding.
+func decodeHybrid(b []byte, bitWidth, n int) ([]uint32, error) {
+	if bitWidth < 0 || bitWidth > 32 {
+		return nil, fmt.Errorf("bad bit width %d", bitWidth)
+	}
+	// a run may have many values in a few bytes, but don't allocate by a bad n
+	out := make([]uint32, 0, min(n, 8*len(b)))
+	byteWidth := (bitWidth + 7) / 8
+	for len(out) < n {
+		header, k := binary.Uvarint(b)
+		if k <= 0 {
+			return out, io.ErrUnexpectedEOF
+		}
+		b = b[k:]
+		if header&1 == 0 {
+			// RLE run
+			count := int(header >> 1)
+			if len(b) < byteWidth || count > n-len(out) {
+				return out, io.ErrUnexpectedEOF
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(b[i]) << (8 * i)
+			}
+			b = b[byteWidth:]
+			for ; count > 0; count-- {
+				out = append(out, v)
+			}
+			continue
+		}
+		// bit-packed groups of 8 values
+		count := int(header>>1) * 8
+		if len(b)*8 < count*bitWidth {
+			return out, io.ErrUnexpectedEOF
+		}
+		for i := 0; i < count; i++ {
+			var v uint32
+			for j := 0; j < bitWidth; j++ {
+				bit := i*bitWidth + j
+				if b[bit/8]&(1<<(bit%8)) != 0 {
+					v |= 1 << j
+				}
+			}
+			if len(out) < n {
+				out = append(out, v)
+			}
+		}
+		b = b[count*bitWidth/8:]
+	}
+	return out, nil
+}
+
+// decodeDelta decodes the (at most n) DELTA_BINARY_PACKED values, returning the rest of the data.
+func decodeDelta(b []byte, n int) ([]int64, []byte, error) {
+	var hdr [3]uint64 // block size, miniblocks per block, number of values
+	for i := range hdr {
+		v, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, b, io.ErrUnexpectedEOF
+		}
+		hdr[i], b = v, b[k:]
+	}
+	blockSize, miniBlocks, total := hdr[0], hdr[1], hdr[2]
+	if miniBlocks == 0 || blockSize%miniBlocks != 0 || (blockSize/miniBlocks)%8 != 0 ||
+		blockSize > 1<<20 || total > uint64(n) {
+		return nil, b, fmt.Errorf("bad delta header %v", hdr)
+	}
+	last, k := binary.Varint(b)
+	if k <= 0 {
+		return nil, b, io.ErrUnexpectedEOF
+	}
+	b = b[k:]
+	out := make([]int64, 0, min(int(total), 8*len(b)))
+	if total != 0 {
+		out = append(out, last)
+	}
+	deltas := make([]uint64, int(blockSize/miniBlocks))
+	for len(out) < int(total) {
+		minDelta, k := binary.Varint(b)
+		if k <= 0 || len(b)-k < int(miniBlocks) {
+			return out, b, io.ErrUnexpectedEOF
+		}
+		widths := b[k : k+int(miniBlocks)]
+		b = b[k+int(miniBlocks):]
+		// the bodies of the miniblocks after the last value are missing
+		for _, w := range widths {
+			if len(out) == int(total) {
+				break
+			}
+			if w > 64 {
+				return out, b, fmt.Errorf("bad bit width %d", w)
+			}
+			size := len(deltas) * int(w) / 8
+			if len(b) < size {
+				return out, b, io.ErrUnexpectedEOF
+			}
+			unpackBits(deltas, b, int(w))
+			b = b[size:]
+			for _, d := range deltas {
+				if len(out) == int(total) {
+					break
+				}
+				// overflow wraps around
+				last = int64(uint64(last) + uint64(minDelta) + d)
+				out = append(out, last)
+			}
+		}
+	}
+	return out, b, nil
+}
+
+// unpackBits unpacks the bitWidth wide little-endian values of b into out.
+func unpackBits(out []uint64, b []byte, bitWidth int) {
+	for i := range out {
+		var v uint64
+		for j := 0; j < bitWidth; j++ {
+			bit := i*bitWidth + j
+			if b[bit/8]&(1<<(bit%8)) != 0 {
+				v |= 1 << j
+			}
+		}
+		out[i] = v
+	}
+}
+
+// decodeDeltaLength decodes n DELTA_LENGTH_BYTE_ARRAY values, returning the rest of the data.
+func decodeDeltaLength(b []byte, n int) ([][]byte, []byte, error) {
+	lengths, b, err := decodeDelta(b, n)
+	if err != nil {
+		return nil, b, fmt.Errorf("lengths: %w", err)
+	}
+	if len(lengths) != n {
+		return nil, b, fmt.Errorf("got %d lengths, wanted %d", len(lengths), n)
+	}
+	out := make([][]byte, n)
+	for i, l := range lengths {
+		if l < 0 || l > int64(len(b)) {
+			return out, b, io.ErrUnexpectedEOF
+		}
+		out[i], b = b[:l], b[l:]
+	}
+	return out, b, nil
+}
+
+// decodeDeltaByteArray decodes n DELTA_BYTE_ARRAY values:
+// the lengths of the prefixes shared with the previous value, then the suffixes.
+func decodeDeltaByteArray(b []byte, n int) ([][]byte, error) {
+	prefixes, b, err := decodeDelta(b, n)
+	if err != nil {
+		return nil, fmt.Errorf("prefix lengths: %w", err)
+	}
+	suffixes, _, err := decodeDeltaLength(b, n)
+	if err != nil {
+		return nil, fmt.Errorf("suffixes: %w", err)
+	}
+	if len(prefixes) != n {
+		return nil, fmt.Errorf("got %d prefix lengths, wanted %d", len(prefixes), n)
+	}
+	var prev []byte
+	for i, p := range prefixes {
+		if p < 0 || p > int64(len(prev)) {
+			return nil, fmt.Errorf("bad prefix length %d", p)
+		}
+		suffixes[i] = append(prev[:p:p], suffixes[i]...)
+		prev = suffixes[i]
+	}
+	return suffixes, nil
+}
+
+// lz4Hadoop decompresses the LZ4 blocks of the Hadoop framing (big-endian uncompressed and compressed lengths before each block).
+func lz4Hadoop(b []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, min(size, pqMaxRatio*len(b)))
+	for len(b) != 0 {
+		if len(b) < 8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		rawLen, compLen := int(binary.BigEndian.Uint32(b)), int(binary.BigEndian.Uint32(b[4:]))
+		b = b[8:]
+		if compLen > len(b) || rawLen > size-len(out) {
+			return nil, errors.New("bad LZ4 frame")
+		}
+		block, err := lz4Block(b[:compLen], rawLen)
+		if err != nil {
+			return nil, err
+		}
+		if len(block) != rawLen {
+			return nil, fmt.Errorf("got %d bytes, wanted %d", len(block), rawLen)
+		}
+		out = append(out, block...)
+		b = b[compLen:]
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("got %d bytes, wanted %d", len(out), size)
+	}
+	return out, nil
+}
+
+// lz4Block decompresses the LZ4 block, of at most size uncompressed bytes.
+func lz4Block(b []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, min(size, pqMaxRatio*len(b)))
+	length := func(n int) (int, error) {
+		if n != 15 {
+			return n, nil
+		}
+		for {
+			if len(b) == 0 {
+				return n, io.ErrUnexpectedEOF
+			}
+			c := b[0]
+			b = b[1:]
+			n += int(c)
+			if c != 255 {
+				return n, nil
+			}
+		}
+	}
+	for len(b) != 0 {
+		token := b[0]
+		b = b[1:]
+		n, err := length(int(token >> 4))
+		if err != nil {
+			return out, err
+		}
+		if n > len(b) || n > size-len(out) {
+			return out, errors.New("bad LZ4 literals length")
+		}
+		out = append(out, b[:n]...)
+		b = b[n:]
+		if len(b) == 0 { // the last sequence has only literals
+			break
+		}
+		if len(b) < 2 {
+			return out, io.ErrUnexpectedEOF
+		}
+		offset := int(b[0]) | int(b[1])<<8
+		b = b[2:]
+		if offset == 0 || offset > len(out) {
+			return out, fmt.Errorf("bad LZ4 offset %d", offset)
+		}
+		if n, err = length(int(token & 15)); err != nil {
+			return out, err
+		}
+		if n += 4; n > size-len(out) {
+			return out, errors.New("bad LZ4 match length")
+		}
+		// the match may overlap the bytes it writes
+		for i := 0; i < n; i++ {
+			out = append(out, out[len(out)-offset])
+		}
+	}
+	return out, nil
+}
+
+// thriftStruct is a decoded Thrift struct: the values by the field ids.
+type thriftStruct map[int16]interface{}
+
+func (s thriftStruct) has(id int16) bool { _, ok := s[id]; return ok }
+func (s thriftStruct) int(id int16) int64 {
+	i, _ := s[id].(int64)
+	return i
+}
+func (s thriftStruct) bool(id int16) bool {
+	b, _ := s[id].(bool)
+	return b
+}
+func (s thriftStruct) str(id int16) string {
+	b, _ := s[id].([]byte)
+	return string(b)
+}
+func (s thriftStruct) list(id int16) []interface{} {
+	l, _ := s[id].([]interface{})
+	return l
+}
+func (s thriftStruct) st(id int16) thriftStruct {
+	t, _ := s[id].(thriftStruct)
+	return t
+}
+
+// thriftDecoder decodes the Thrift compact protocol, used by the Parquet metadata.
+type thriftDecoder struct {
+	b   []byte
+	pos int
+	// depth is the nesting of the structs and lists being decoded
+	depth int
+}
+
+func (d *thriftDecoder) byte() (byte, error) {
+	if d.pos >= len(d.b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	d.pos++
+	return d.b[d.pos-1], nil
+}
+
+func (d *thriftDecoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.b[d.pos:])
+	if n <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	d.pos += n
+	return v, nil
+}
+
+func (d *thriftDecoder) varint() (int64, error) {
+	v, err := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (d *thriftDecoder) structValue() (thriftStruct, error) {
+	if d.depth++; d.depth > pqMaxThriftDepth {
+		return nil, errors.New("too deeply nested")
+	}
+	defer func() { d.depth-- }()
+	s := make(thriftStruct)
+	var last int16
+	for {
+		h, err := d.byte()
+		if err != nil {
+			return s, err
+		}
+		if h == 0 { // STOP
+			return s, nil
+		}
+		typ := h & 0x0f
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			v, err := d.varint()
+			if err != nil {
+				return s, err
+			}
+			id = int16(v)
+		}
+		last = id
+		if typ == 1 || typ == 2 { // BOOLEAN_TRUE, BOOLEAN_FALSE
+			s[id] = typ == 1
+			continue
+		}
+		if s[id], err = d.value(typ); err != nil {
+			return s, fmt.Errorf("field %d: %w", id, err)
+		}
+	}
+}
+
+func (d *thriftDecoder) value(typ byte) (interface{}, error) {
+	switch typ {
+	case 1, 2: // bool in a list
+		b, err := d.byte()
+		return b == 1, err
+	case 3:
+		b, err := d.byte()
+		return int64(int8(b)), err
+	case 4, 5, 6: // i16, i32, i64
+		return d.varint()
+	case 7:
+		if len(d.b)-d.pos < 8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		d.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(d.b[d.pos-8:])), nil
+	case 8:
+		n, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(d.b)-d.pos) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		d.pos += int(n)
+		return d.b[d.pos-int(n) : d.pos], nil
+	case 9, 10: // list, set
+		h, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(h >> 4)
+		if n == 15 {
+			if n, err = d.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if n > uint64(len(d.b)-d.pos) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if d.depth++; d.depth > pqMaxThriftDepth {
+			return nil, errors.New("too deeply nested")
+		}
+		defer func() { d.depth-- }()
+		l := make([]interface{}, int(n))
+		for i := range l {
+			if l[i], err = d.value(h & 0x0f); err != nil {
+				return l, err
+			}
+		}
+		return l, nil
+	case 11: // map, as a list of keys and values
+		n, err := d.uvarint()
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		if n > uint64(len(d.b)-d.pos) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		h, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		l := make([]interface{}, 2*int(n))
+		for i := range l {
+			typ := h >> 4
+			if i%2 == 1 {
+				typ = h & 0x0f
+			}
+			if l[i], err = d.value(typ); err != nil {
+				return l, err
+			}
+		}
+		return l, nil
+	case 12:
+		return d.structValue()
+	}
+	return nil, fmt.Errorf("unknown type %d", typ)
+}
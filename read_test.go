@@ -5,8 +5,14 @@
 package dbcsv_test
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,7 +20,10 @@ import (
 	"time"
 
 	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/spreadsheet"
+	"github.com/UNO-SOFT/spreadsheet/ods"
 	"github.com/google/go-cmp/cmp"
+	"github.com/xuri/excelize/v2"
 )
 
 func TestRead(t *testing.T) {
@@ -98,6 +107,43 @@ func TestCompressedTempCSV(t *testing.T) {
 	}
 }
 
+func TestStreamCSV(t *testing.T) {
+	stdr, stdw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdin := os.Stdin
+	os.Stdin = stdr
+	defer func() { os.Stdin = oldStdin }()
+	go func() {
+		defer stdw.Close()
+		_, _ = stdw.Write([]byte("id;str\n"))
+		for i := 0; i < 1000; i++ {
+			if _, err := fmt.Fprintf(stdw, "%d;árvíztűrő tükörfúrógép\n", i); err != nil {
+				return
+			}
+		}
+	}()
+
+	cfg := dbcsv.Config{Stream: true, Charset: "utf-8"}
+	if err = cfg.Open("-"); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var n int
+	if err := cfg.ReadRows(ctx, func(ctx context.Context, s string, r dbcsv.Row) error { n++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1001 {
+		t.Errorf("got %d rows, wanted 1001", n)
+	}
+	if err := cfg.ReadRows(ctx, func(ctx context.Context, s string, r dbcsv.Row) error { return nil }); !errors.Is(err, dbcsv.ErrStreamed) {
+		t.Errorf("got %v for the second read, wanted %v", err, dbcsv.ErrStreamed)
+	}
+}
+
 func TestReadDetectDelim(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -127,3 +173,716 @@ func TestReadDetectDelim(t *testing.T) {
 		}
 	}
 }
+
+func TestReadColumns(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "x.csv")
+	if err := os.WriteFile(fn, []byte("A;B;C;D;E\n1;2;3;4;5\n6;7\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for _, tC := range []struct {
+		Columns string
+		Want    [][]string
+	}{
+		{"2,1", [][]string{{"B", "A"}, {"2", "1"}, {"7", "6"}}},
+		{"1-3,5", [][]string{{"A", "B", "C", "E"}, {"1", "2", "3", "5"}, {"6", "7", "", ""}}},
+		{"4-,1", [][]string{{"D", "E", "A"}, {"4", "5", "1"}, {"", "", "6"}}},
+		{"0", nil},
+		{"3-2", nil},
+		{"1-,2-", nil},
+	} {
+		cfg := dbcsv.Config{ColumnsString: tC.Columns, Charset: "utf-8"}
+		if err := cfg.Open(fn); err != nil {
+			t.Fatal(err)
+		}
+		var got [][]string
+		err := cfg.ReadRows(ctx, func(ctx context.Context, _ string, row dbcsv.Row) error {
+			if len(row.Columns) != len(row.Values) {
+				t.Errorf("%s: got %d columns for %d values", tC.Columns, len(row.Columns), len(row.Values))
+			}
+			got = append(got, row.Values)
+			return nil
+		})
+		cfg.Close()
+		if tC.Want == nil {
+			if err == nil {
+				t.Errorf("%s: wanted error, got %q", tC.Columns, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %+v", tC.Columns, err)
+		}
+		if d := cmp.Diff(tC.Want, got); d != "" {
+			t.Errorf("%s: %s", tC.Columns, d)
+		}
+	}
+}
+
+func TestReadFilter(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "x.csv")
+	if err := os.WriteFile(fn, []byte("STATUS;NOTE;N\nA;x;1\nB;y;2\nA;;3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for _, tC := range []struct {
+		Filter, Columns string
+		Want            [][]string
+	}{
+		{`STATUS == "A" and len(col(2)) > 0`, "", [][]string{{"STATUS", "NOTE", "N"}, {"A", "x", "1"}}},
+		{`int(N) > 1`, "3,1", [][]string{{"N", "STATUS"}, {"2", "B"}, {"3", "A"}}},
+		{`col(1) == "B"`, "3,1", [][]string{{"N", "STATUS"}}},
+		{`STATUS ==`, "", nil},
+	} {
+		cfg := dbcsv.Config{Filter: tC.Filter, ColumnsString: tC.Columns, Charset: "utf-8"}
+		if err := cfg.Open(fn); err != nil {
+			t.Fatal(err)
+		}
+		var got [][]string
+		err := cfg.ReadRows(ctx, func(ctx context.Context, _ string, row dbcsv.Row) error {
+			got = append(got, row.Values)
+			return nil
+		})
+		cfg.Close()
+		if tC.Want == nil {
+			if err == nil {
+				t.Errorf("%s: wanted error, got %q", tC.Filter, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %+v", tC.Filter, err)
+		}
+		if d := cmp.Diff(tC.Want, got); d != "" {
+			t.Errorf("%s: %s", tC.Filter, d)
+		}
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "x.csv")
+	if err := os.WriteFile(fn, []byte("A\n1\n2\n3\n4\n5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for _, tC := range []struct {
+		Offset, MaxRows int
+		Filter          string
+		NoHeader        bool
+		Want            []string
+	}{
+		{Offset: 1, MaxRows: 2, Want: []string{"A", "2", "3"}},
+		{Offset: 4, Want: []string{"A", "5"}},
+		{MaxRows: 10, Want: []string{"A", "1", "2", "3", "4", "5"}},
+		{Offset: 5, Want: []string{"A"}},
+		{MaxRows: 3, Filter: "int(A) % 2 == 1", Want: []string{"A", "1", "3"}},
+		// the first row is data, too
+		{Offset: 1, MaxRows: 2, NoHeader: true, Want: []string{"1", "2"}},
+		{MaxRows: 3, NoHeader: true, Want: []string{"A", "1", "2"}},
+		{MaxRows: 3, Filter: `col(1) != "1"`, NoHeader: true, Want: []string{"A", "2"}},
+	} {
+		cfg := dbcsv.Config{Offset: tC.Offset, MaxRows: tC.MaxRows, Filter: tC.Filter, NoHeader: tC.NoHeader, Charset: "utf-8"}
+		if err := cfg.Open(fn); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		err := cfg.ReadRows(ctx, func(ctx context.Context, _ string, row dbcsv.Row) error {
+			got = append(got, row.Values...)
+			return nil
+		})
+		cfg.Close()
+		if err != nil {
+			t.Fatalf("%+v: %+v", tC, err)
+		}
+		if d := cmp.Diff(tC.Want, got); d != "" {
+			t.Errorf("%+v: %s", tC, d)
+		}
+	}
+}
+
+func TestReadFiles(t *testing.T) {
+	dir := t.TempDir()
+	for nm, content := range map[string]string{
+		"a.csv": "A;B\n1;2\n",
+		"b.csv": "a;b\n3;4\n5;6\n",
+		"c.txt": "A;C\n7;8\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, nm), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	type nameRow struct {
+		Name   string
+		Values []string
+	}
+	read := func(cfg *dbcsv.Config) ([]nameRow, error) {
+		defer cfg.Close()
+		var got []nameRow
+		err := cfg.ReadRows(ctx, func(ctx context.Context, name string, row dbcsv.Row) error {
+			got = append(got, nameRow{Name: filepath.Base(name), Values: row.Values})
+			return nil
+		})
+		return got, err
+	}
+
+	cfg := dbcsv.Config{Charset: "utf-8", MaxRows: 2}
+	if err := cfg.Open(filepath.Join(dir, "*.csv")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := read(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]nameRow{
+		{"a.csv", []string{"A", "B"}}, {"a.csv", []string{"1", "2"}}, {"b.csv", []string{"3", "4"}},
+	}, got); d != "" {
+		t.Error(d)
+	}
+
+	cfg = dbcsv.Config{Charset: "utf-8"}
+	if err = cfg.OpenFiles(filepath.Join(dir, "a.csv"), filepath.Join(dir, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = read(&cfg); err == nil {
+		t.Errorf("wanted error for the different headers, got %q", got)
+	}
+
+	// without a header, the first rows are data
+	cfg = dbcsv.Config{Charset: "utf-8", NoHeader: true, Offset: 1}
+	if err = cfg.OpenFiles(filepath.Join(dir, "a.csv"), filepath.Join(dir, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = read(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]nameRow{
+		{"a.csv", []string{"1", "2"}}, {"c.txt", []string{"A", "C"}}, {"c.txt", []string{"7", "8"}},
+	}, got); d != "" {
+		t.Error(d)
+	}
+
+	if err = cfg.Open(filepath.Join(dir, "*.xlsx")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %+v, wanted %v", err, os.ErrNotExist)
+	}
+}
+
+func TestReadObject(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/storage/v1/b/bucket/o/in%2Fx.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, "A;B\n1;2\n")
+	}))
+	defer srv.Close()
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.URL)
+
+	cfg := dbcsv.Config{Charset: "utf-8"}
+	if err := cfg.Open("gs://bucket/in/x.csv"); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var got [][]string
+	if err := cfg.ReadRows(ctx, func(ctx context.Context, _ string, row dbcsv.Row) error {
+		got = append(got, row.Values)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([][]string{{"A", "B"}, {"1", "2"}}, got); d != "" {
+		t.Error(d)
+	}
+	if err := cfg.Open("gs://bucket/missing.csv"); err == nil {
+		t.Error("wanted error for a missing object")
+	}
+}
+
+func TestReadZip(t *testing.T) {
+	xlsx, err := os.ReadFile(filepath.Join("testdata", "x.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeZip := func(name string, members ...string) string {
+		fn := filepath.Join(dir, name)
+		fh, err := os.Create(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fh.Close()
+		zw := zip.NewWriter(fh)
+		for i := 0; i < len(members); i += 2 {
+			w, err := zw.Create(members[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = io.WriteString(w, members[i+1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return fn
+	}
+	one := writeZip("one.zip", "data/a.csv", "A;B\n1;2\n")
+	two := writeZip("two.zip", "a.csv", "A;B\n1;2\n", "x.xlsx", string(xlsx))
+
+	fh, err := os.Open(one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, err := dbcsv.DetectReaderType(fh, fh.Name())
+	fh.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (dbcsv.FileType{Type: dbcsv.Csv, Compression: dbcsv.Zip}); typ != want {
+		t.Errorf("got %v, wanted %v", typ, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var names []string
+	read := func(fn string) ([][]string, error) {
+		cfg := dbcsv.Config{Charset: "utf-8"}
+		if err := cfg.Open(fn); err != nil {
+			return nil, err
+		}
+		defer cfg.Close()
+		var got [][]string
+		names = names[:0]
+		err := cfg.ReadRows(ctx, func(ctx context.Context, name string, row dbcsv.Row) error {
+			got = append(got, row.Values)
+			names = append(names, name)
+			return nil
+		})
+		return got, err
+	}
+	for fn, name := range map[string]string{one: one + "#data/a.csv", two + "#a.csv": two + "#a.csv"} {
+		got, err := read(fn)
+		if err != nil {
+			t.Fatalf("%s: %+v", fn, err)
+		}
+		if d := cmp.Diff([][]string{{"A", "B"}, {"1", "2"}}, got); d != "" {
+			t.Errorf("%s: %s", fn, d)
+		}
+		// the name of the member, not of the extracted temporary file
+		if d := cmp.Diff([]string{name, name}, names); d != "" {
+			t.Errorf("%s: names: %s", fn, d)
+		}
+	}
+	if got, err := read(two + "#x.xlsx"); err != nil {
+		t.Errorf("x.xlsx: %+v", err)
+	} else if len(got) == 0 {
+		t.Error("x.xlsx: no rows")
+	}
+	if _, err := read(two); err == nil {
+		t.Error("wanted error for the archive of two files")
+	}
+	if _, err := read(two + "#missing.csv"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %+v, wanted %v", err, os.ErrNotExist)
+	}
+}
+
+func TestReadBOM(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	want := []dbcsv.Row{
+		{Columns: []string{"ID", "NÉV"}, Values: []string{"ID", "NÉV"}, Line: 0},
+		{Columns: []string{"ID", "NÉV"}, Values: []string{"1", "árvíztűrő"}, Line: 1},
+	}
+	const text = "ID;NÉV\n1;árvíztűrő\n"
+	utf16le := []byte{0xff, 0xfe}
+	for _, r := range text {
+		utf16le = append(utf16le, byte(r), byte(r>>8))
+	}
+	for nm, b := range map[string][]byte{
+		"utf-8":    append([]byte{0xef, 0xbb, 0xbf}, text...),
+		"utf-16le": utf16le,
+	} {
+		var got []dbcsv.Row
+		if err := dbcsv.ReadCSV(ctx, func(ctx context.Context, r dbcsv.Row) error {
+			got = append(got, r)
+			return nil
+		}, bytes.NewReader(b), "", nil, 0); err != nil {
+			t.Fatalf("%s: %+v", nm, err)
+		}
+		if d := cmp.Diff(want, got); d != "" {
+			t.Errorf("ReadCSV %s: %s", nm, d)
+		}
+
+		// the BOM overrides the charset
+		fn := filepath.Join(t.TempDir(), nm+".csv")
+		if err := os.WriteFile(fn, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		cfg := dbcsv.Config{Charset: "iso-8859-2"}
+		if err := cfg.Open(fn); err != nil {
+			t.Fatal(err)
+		}
+		got = got[:0]
+		err := cfg.ReadRows(ctx, func(ctx context.Context, _ string, r dbcsv.Row) error {
+			got = append(got, r)
+			return nil
+		})
+		cfg.Close()
+		if err != nil {
+			t.Fatalf("%s: %+v", nm, err)
+		}
+		if d := cmp.Diff(want, got); d != "" {
+			t.Errorf("ReadRows %s: %s", nm, d)
+		}
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "x.ndjson")
+	if err := os.WriteFile(fn, []byte(`{"id": 1, "name": "a\"b", "amount": 1.50, "tags": ["x", "y"]}
+{"name": null, "id": 2, "extra": true}
+{"id": 3, "amount": 12345678901234567890, "tags": {"k": 1}}
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var cfg dbcsv.Config
+	if err := cfg.Open(fn); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	if typ, err := cfg.Type(); err != nil {
+		t.Fatal(err)
+	} else if typ.Type != dbcsv.Json {
+		t.Fatalf("got type %q, wanted %q", typ.Type, dbcsv.Json)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var got []dbcsv.Row
+	if err := cfg.ReadRows(ctx, func(ctx context.Context, _ string, row dbcsv.Row) error {
+		got = append(got, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cols := []string{"id", "name", "amount", "tags"}
+	if d := cmp.Diff([]dbcsv.Row{
+		{Columns: cols, Values: cols, Line: 0},
+		{Columns: cols, Values: []string{"1", `a"b`, "1.50", `["x","y"]`}, Line: 1},
+		{Columns: cols, Values: []string{"2", "", "", ""}, Line: 2},
+		{Columns: cols, Values: []string{"3", "", "12345678901234567890", `{"k":1}`}, Line: 3},
+	}, got); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestReadParquet(t *testing.T) {
+	var cfg dbcsv.Config
+	if err := cfg.Open(filepath.Join("testdata", "types.parquet")); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	if typ, err := cfg.Type(); err != nil {
+		t.Fatal(err)
+	} else if typ.Type != dbcsv.Parquet {
+		t.Fatalf("got type %q, wanted %q", typ.Type, dbcsv.Parquet)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var got [][]string
+	if err := cfg.ReadRows(ctx, func(ctx context.Context, _ string, row dbcsv.Row) error {
+		got = append(got, row.Values)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// two row groups: an optional dictionary encoded, snappy compressed string, dates, timestamps, decimals,
+	// a v2 data page, booleans, INT96 and fixed length decimals
+	if d := cmp.Diff([][]string{
+		{"id", "name", "day", "ts", "amount", "ratio", "flag", "spark", "big"},
+		{"1", "alma", "2024-03-15", "2024-03-15T12:34:56.5Z", "1.50", "0.5", "true", "2024-03-15T01:02:03Z", "-12345.6789"},
+		{"2", "", "1970-01-01", "2024-03-15", "-0.05", "", "false", "2024-03-16", "100000000000000000000000000.0000"},
+		{"3", "körte", "1969-12-31", "", "0.00", "100000000000000000000", "true", "1999-12-31T23:59:59.25Z", "0.0001"},
+	}, got); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestReadParquetEncodings(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	// 200 rows in two pages per column: DELTA_BINARY_PACKED int64 with LZ4_RAW, int32 with (Hadoop) LZ4,
+	// an optional DELTA_LENGTH_BYTE_ARRAY with LZ4_RAW, DELTA_BYTE_ARRAY in v2 pages
+	// and an optional BYTE_STREAM_SPLIT double.
+	got := make(map[int][]string)
+	var n int
+	if err := dbcsv.ReadParquetFile(ctx, func(ctx context.Context, row dbcsv.Row) error {
+		got[row.Line] = row.Values
+		n++
+		return nil
+	}, filepath.Join("testdata", "encodings.parquet"), nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n != 201 {
+		t.Errorf("got %d rows, wanted 201", n)
+	}
+	for line, want := range map[int][]string{
+		0:   {"n", "i", "s", "p", "f"},
+		1:   {"0", "0", "", "prefix-0000", "0"},
+		2:   {"-999", "-1", "érték 1", "prefix-0000", ""},
+		3:   {"-1996", "2", "érték 2", "prefix-0001", "0.5"},
+		100: {"8801", "-99", "érték 0", "prefix-0049", "24.75"},
+		101: {"8000", "100", "", "prefix-0050", "25"},
+		102: {"7201", "-101", "érték 2", "prefix-0050", ""},
+		200: {"36601", "-199", "érték 1", "prefix-0099", "49.75"},
+	} {
+		if d := cmp.Diff(want, got[line]); d != "" {
+			t.Errorf("%d: %s", line, d)
+		}
+	}
+}
+
+func FuzzReadParquet(f *testing.F) {
+	for _, fn := range []string{"types.parquet", "encodings.parquet"} {
+		b, err := os.ReadFile(filepath.Join("testdata", fn))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, b []byte) {
+		fn := filepath.Join(dir, "fuzz.parquet")
+		if err := os.WriteFile(fn, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		// a bad file must be an error, not a panic
+		_ = dbcsv.ReadParquetFile(ctx, func(context.Context, dbcsv.Row) error { return nil }, fn, nil, 0)
+	})
+}
+
+func TestReadTyped(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	str := func(s string) string { return string(rune(len(s))) + s }
+	text := "DBCSVT\x01" + "\x02" + str("ID") + str("NUMBER") + str("TS") + str("TIMESTAMP") +
+		"R" + "n" + str("1.000000000000000000001") + "t" + str("2024-03-15T10:30:05.123456789+01:00") +
+		"R" + "n" + str("2") + "\x00" +
+		"E"
+	want := []dbcsv.Row{
+		{Columns: []string{"ID", "TS"}, Values: []string{"ID", "TS"}, Line: 0},
+		{Columns: []string{"ID", "TS"}, Values: []string{"1.000000000000000000001", "2024-03-15T10:30:05.123456789+01:00"}, Line: 1},
+		{Columns: []string{"ID", "TS"}, Values: []string{"2", ""}, Line: 2},
+	}
+	var i int
+	if err := dbcsv.ReadTyped(ctx, func(ctx context.Context, r dbcsv.Row) error {
+		if d := cmp.Diff(want[i], r); d != "" {
+			t.Errorf("%d: %s", i, d)
+		}
+		i++
+		return nil
+	},
+		strings.NewReader(text), nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(want) {
+		t.Errorf("got %d rows, wanted %d", i, len(want))
+	}
+
+	noop := func(context.Context, dbcsv.Row) error { return nil }
+	if err := dbcsv.ReadTyped(ctx, noop, strings.NewReader(text), []int{0, 2}, 0); err == nil {
+		t.Error("wanted error for out of range column")
+	}
+	if err := dbcsv.ReadTyped(ctx, noop, strings.NewReader("DBCSVT\x01\xff\xff\xff\xff\x0f"), nil, 0); err == nil {
+		t.Error("wanted error for too many columns")
+	}
+	// a huge length with a few bytes only
+	if err := dbcsv.ReadTyped(ctx, noop, strings.NewReader("DBCSVT\x01\x01\xff\xff\xff\xff\x07ID"), nil, 0); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("wanted ErrUnexpectedEOF, got %+v", err)
+	}
+
+	for text, want := range map[string]dbcsv.FType{
+		"DBCSVT\x01\x00E": dbcsv.Typed,
+		"DBCS;ID\n1\n":    dbcsv.Csv,
+	} {
+		if typ, err := dbcsv.DetectReaderType(strings.NewReader(text), ""); err != nil {
+			t.Errorf("%q: %+v", text, err)
+		} else if typ.Type != want {
+			t.Errorf("%q: got %q, wanted %q", text, typ.Type, want)
+		}
+	}
+}
+
+func TestReadODS(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "x.ods")
+	fh, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ow, err := ods.NewWriter(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"first", "second"} {
+		sheet, err := ow.NewSheet(name, []spreadsheet.Column{{Name: "NAME"}, {Name: "AMOUNT"}, {Name: "DATE"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sheet.AppendRow(name+"  a", 1.5, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatal(err)
+		}
+		if err = sheet.AppendRow("b", 2, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err = sheet.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ow.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = fh.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg dbcsv.Config
+	if err = cfg.Open(fn); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	if typ, err := cfg.Type(); err != nil {
+		t.Fatal(err)
+	} else if typ.Type != dbcsv.Ods {
+		t.Fatalf("got type %q, wanted %q", typ.Type, dbcsv.Ods)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sheets, err := cfg.ReadSheets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(map[int]string{0: "first", 1: "second"}, sheets); d != "" {
+		t.Error(d)
+	}
+	cols := []string{"NAME", "AMOUNT", "DATE"}
+	cfg.Sheet = 1
+	var got []dbcsv.Row
+	if err = cfg.ReadRows(ctx, func(ctx context.Context, sheetName string, row dbcsv.Row) error {
+		if sheetName != "second" {
+			t.Errorf("got sheet %q, wanted second", sheetName)
+		}
+		got = append(got, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]dbcsv.Row{
+		{Columns: cols, Values: cols, Line: 0},
+		{Columns: cols, Values: []string{"second  a", "1.5", "2024-03-15T00:00:00Z"}, Line: 1},
+		{Columns: cols, Values: []string{"b", "2"}, Line: 2},
+	}, got); d != "" {
+		t.Error(d)
+	}
+
+	cfg.AllSheets = true
+	var sheetNames []string
+	if err = cfg.ReadRows(ctx, func(ctx context.Context, sheetName string, row dbcsv.Row) error {
+		sheetNames = append(sheetNames, sheetName)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the header of the second sheet is dropped
+	if d := cmp.Diff([]string{"first", "first", "first", "second", "second"}, sheetNames); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestReadXLSTyped(t *testing.T) {
+	var cfg dbcsv.Config
+	if err := cfg.Open(filepath.Join("testdata", "typed.xls")); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var got []dbcsv.Row
+	if err := cfg.ReadRows(ctx, func(ctx context.Context, sheetName string, row dbcsv.Row) error {
+		got = append(got, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("got %d rows, wanted 4", len(got))
+	}
+	if d := cmp.Diff([]string{"1.5", "42", "TRUE", "43831.5", "3.25", "abc", "FALSE"}, got[1].Values); d != "" {
+		t.Error(d)
+	}
+	if d := cmp.Diff([]interface{}{1.5, int64(42), true, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), 3.25, "abc", false}, got[1].Typed); d != "" {
+		t.Error(d)
+	}
+	if d := cmp.Diff([]interface{}{2.5, int64(-7), false, nil, nil, nil, nil}, got[2].Typed); d != "" {
+		t.Error(d)
+	}
+	if d := cmp.Diff([]string{"last"}, got[3].Values); d != "" {
+		t.Error(d)
+	}
+}
+
+func TestReadXLSXTyped(t *testing.T) {
+	xf := excelize.NewFile()
+	defer xf.Close()
+	const sheet = "Sheet1"
+	dateStyle, err := xf.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	for i, row := range [][]interface{}{
+		{"NAME", "AMOUNT", "N", "DATE", "OK"},
+		{"007", 1.5, 42, day, true},
+	} {
+		if err = xf.SetSheetRow(sheet, fmt.Sprintf("A%d", i+1), &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = xf.SetCellStyle(sheet, "D2", "D2", dateStyle); err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(t.TempDir(), "typed.xlsx")
+	if err = xf.SaveAs(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg dbcsv.Config
+	if err = cfg.Open(fn); err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var got []dbcsv.Row
+	if err = cfg.ReadRows(ctx, func(ctx context.Context, sheetName string, row dbcsv.Row) error {
+		got = append(got, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d rows, wanted 2", len(got))
+	}
+	if d := cmp.Diff([]string{"007", "1.5", "42", "2024-03-15", "TRUE"}, got[1].Values); d != "" {
+		t.Error(d)
+	}
+	if d := cmp.Diff([]interface{}{"007", 1.5, int64(42), day, true}, got[1].Typed); d != "" {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/extrame/ole2"
+)
+
+// xlsCell is the (row, column) of a cell.
+type xlsCell struct{ Row, Col uint16 }
+
+// xlsTypedCells returns the typed values of the number, boolean and formula cells of the sheet,
+// reading the BIFF records of the XLS file, as the xls library gives only the formatted strings,
+// and skips the booleans and the results of the formulas.
+//
+// The numbers are int64 if integral, float64 otherwise, time.Time if their format is a date format,
+// the results of the string formulas are strings.
+func xlsTypedCells(filename string, sheetIndex int) (map[xlsCell]interface{}, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	ole, err := ole2.Open(fh, "")
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", filename, err)
+	}
+	dir, err := ole.ListDir()
+	if err != nil {
+		return nil, fmt.Errorf("list %q: %w", filename, err)
+	}
+	var book, root *ole2.File
+	for _, f := range dir {
+		switch f.Name() {
+		case "Workbook":
+			if book == nil {
+				book = f
+			}
+		case "Book":
+			book = f
+		case "Root Entry":
+			root = f
+		}
+	}
+	if book == nil {
+		return nil, fmt.Errorf("%q: no workbook found", filename)
+	}
+	br := &biffReader{r: ole.OpenFile(book, root)}
+
+	// the globals substream, with the positions of the sheets, and the formats
+	var sheetPos []uint32
+	formats := make(map[uint16]string)
+	for {
+		id, b, err := br.next()
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case 0x0809: // BOF
+			if len(b) >= 2 {
+				br.biff8 = binary.LittleEndian.Uint16(b) == 0x0600
+			}
+		case 0x0085: // BOUNDSHEET
+			if len(b) >= 4 {
+				sheetPos = append(sheetPos, binary.LittleEndian.Uint32(b))
+			}
+		case 0x0022: // DATEMODE
+			if len(b) >= 2 {
+				br.date1904 = binary.LittleEndian.Uint16(b) == 1
+			}
+		case 0x041E: // FORMAT
+			if len(b) < 3 {
+				break
+			}
+			if br.biff8 {
+				formats[binary.LittleEndian.Uint16(b)] = br.string(b[2:])
+			} else {
+				formats[binary.LittleEndian.Uint16(b)] = string(b[3:min(len(b), 3+int(b[2]))])
+			}
+		case 0x00E0: // XF
+			if len(b) >= 4 {
+				br.xfFormats = append(br.xfFormats, binary.LittleEndian.Uint16(b[2:]))
+			}
+		}
+		if id == 0x000A { // EOF
+			break
+		}
+	}
+	br.formats = formats
+	if sheetIndex < 0 || sheetIndex >= len(sheetPos) {
+		return nil, fmt.Errorf("this XLS file does not contain sheet no %d", sheetIndex)
+	}
+	if _, err = br.r.Seek(int64(sheetPos[sheetIndex]), io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	cells := make(map[xlsCell]interface{})
+	// stringCell is the cell of the last FORMULA with string result, preceding its STRING record.
+	var stringCell *xlsCell
+	for {
+		id, b, err := br.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return cells, nil
+			}
+			return cells, err
+		}
+		if id == 0x000A { // EOF
+			return cells, nil
+		}
+		if id == 0x0207 { // STRING, the result of the preceding FORMULA
+			if stringCell != nil {
+				cells[*stringCell] = br.string(b)
+				stringCell = nil
+			}
+			continue
+		}
+		if len(b) < 6 {
+			continue
+		}
+		cell := xlsCell{Row: binary.LittleEndian.Uint16(b), Col: binary.LittleEndian.Uint16(b[2:])}
+		xf := binary.LittleEndian.Uint16(b[4:])
+		switch id {
+		case 0x0203: // NUMBER
+			if len(b) >= 14 {
+				cells[cell] = br.number(xf, math.Float64frombits(binary.LittleEndian.Uint64(b[6:])))
+			}
+		case 0x027E: // RK
+			if len(b) >= 10 {
+				cells[cell] = br.number(xf, xlsRK(binary.LittleEndian.Uint32(b[6:])))
+			}
+		case 0x00BD: // MULRK
+			for b = b[4:]; len(b) >= 6; b = b[6:] {
+				cells[cell] = br.number(binary.LittleEndian.Uint16(b), xlsRK(binary.LittleEndian.Uint32(b[2:])))
+				cell.Col++
+			}
+		case 0x0205: // BOOLERR
+			if len(b) >= 8 && b[7] == 0 {
+				cells[cell] = b[6] != 0
+			}
+		case 0x0006: // FORMULA
+			if len(b) < 14 {
+				break
+			}
+			res := b[6:14]
+			if res[6] != 0xFF || res[7] != 0xFF {
+				cells[cell] = br.number(xf, math.Float64frombits(binary.LittleEndian.Uint64(res)))
+				break
+			}
+			switch res[0] {
+			case 0: // string, in the next STRING record
+				stringCell = &cell
+			case 1:
+				cells[cell] = res[2] != 0
+			case 3:
+				cells[cell] = ""
+			}
+		}
+	}
+}
+
+// biffReader reads the records of a BIFF stream.
+type biffReader struct {
+	r       io.ReadSeeker
+	formats map[uint16]string
+	// xfFormats is the format index of each XF record.
+	xfFormats       []uint16
+	buf             []byte
+	biff8, date1904 bool
+}
+
+// next returns the next record's id and data, valid till the next call.
+func (br *biffReader) next() (uint16, []byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(br.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	id, size := binary.LittleEndian.Uint16(hdr[:]), int(binary.LittleEndian.Uint16(hdr[2:]))
+	if cap(br.buf) < size {
+		br.buf = make([]byte, size)
+	}
+	br.buf = br.buf[:size]
+	if _, err := io.ReadFull(br.r, br.buf); err != nil {
+		return id, nil, err
+	}
+	return id, br.buf, nil
+}
+
+// string decodes the STRING record: the length, and in BIFF8 the option flags
+// (compressed 8-bit or UTF-16 characters) before the characters.
+func (br *biffReader) string(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint16(b))
+	b = b[2:]
+	if !br.biff8 {
+		return string(b[:min(n, len(b))])
+	}
+	if len(b) == 0 {
+		return ""
+	}
+	flags := b[0]
+	b = b[1:]
+	if flags&1 == 0 {
+		// ISO-8859-1
+		runes := make([]rune, min(n, len(b)))
+		for i := range runes {
+			runes[i] = rune(b[i])
+		}
+		return string(runes)
+	}
+	u := make([]uint16, min(n, len(b)/2))
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// number returns the number as time.Time if the format of the XF is a date format,
+// or as int64 if it is integral, as float64 otherwise.
+func (br *biffReader) number(xf uint16, f float64) interface{} {
+	if int(xf) < len(br.xfFormats) && br.isDateFormat(br.xfFormats[xf]) {
+		base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		if br.date1904 {
+			base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		days := math.Floor(f)
+		return base.AddDate(0, 0, int(days)).Add(time.Duration(math.Round((f-days)*86400*1000)) * time.Millisecond)
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return f
+}
+
+// isDateFormat reports whether the format is a date format,
+// by the same rules as the xls library.
+func (br *biffReader) isDateFormat(format uint16) bool {
+	if format >= 164 {
+		s, ok := br.formats[format]
+		return ok && !strings.Contains(s, "#") && !strings.Contains(s, ".00")
+	}
+	return 14 <= format && format <= 17 || format == 22 || 27 <= format && format <= 36 || 50 <= format && format <= 58
+}
+
+// xlsRK decodes the RK number.
+func xlsRK(rk uint32) float64 {
+	var f float64
+	if rk&2 == 0 {
+		f = math.Float64frombits(uint64(rk>>2) << 34)
+	} else {
+		f = float64(int32(rk) >> 2)
+	}
+	if rk&1 != 0 {
+		f /= 100
+	}
+	return f
+}
+
+// xlsString formats the typed value as the XLSX reader does.
+func xlsString(v interface{}) string {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return x
+	case time.Time:
+		return x.Format(time.RFC3339)
+	}
+	return ""
+}
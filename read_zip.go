@@ -0,0 +1,127 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// zipFirstMember returns the name and the (decompressed) content of the first member of the ZIP,
+// from the rest of the PKZip local file header (after the 4 bytes signature).
+func zipFirstMember(r io.Reader) (string, io.ReadCloser, error) {
+	// version, flags, compression method, time, date, crc32, sizes: 22 bytes, then the name and extra lengths
+	var hdr [26]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", nil, err
+	}
+	method := uint16(hdr[4]) | uint16(hdr[5])<<8
+	nameLen := int(hdr[22]) | int(hdr[23])<<8
+	extraLen := int(hdr[24]) | int(hdr[25])<<8
+	b := make([]byte, nameLen+extraLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", nil, err
+	}
+	name := string(b[:nameLen])
+	switch method {
+	case zip.Store:
+		return name, io.NopCloser(r), nil
+	case zip.Deflate:
+		return name, flate.NewReader(r), nil
+	}
+	return name, nil, fmt.Errorf("%s: unsupported compression method %d", name, method)
+}
+
+// isOOXMLPart reports whether the name is of a part of an Office Open XML (xlsx) package.
+func isOOXMLPart(name string) bool {
+	if name == "[Content_Types].xml" {
+		return true
+	}
+	for _, prefix := range []string{"_rels/", "docProps/", "xl/", "customXml/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// openZip opens the member of the ZIP archive (the only file in it, if member is empty),
+// extracted into a temporary file that Close removes.
+//
+// The archive is read from r if it is not nil, from the opened (regular) file otherwise.
+func (cfg *Config) openZip(ctx context.Context, r io.Reader, archive, member string) error {
+	f := cfg.file
+	if r == nil {
+		defer f.Close()
+	} else {
+		fh, err := os.CreateTemp("", "ReadRows-*.zip")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(fh.Name())
+		defer fh.Close()
+		if _, err = io.Copy(fh, r); err != nil {
+			return err
+		}
+		f = fh
+	}
+	cfg.file = nil
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %w", archive, err)
+	}
+	var found *zip.File
+	var names []string
+	for _, zf := range zr.File {
+		// skip the directories and the resource forks of the macOS archiver
+		if zf.FileInfo().IsDir() || strings.HasPrefix(zf.Name, "__MACOSX/") {
+			continue
+		}
+		names = append(names, zf.Name)
+		if member == "" || zf.Name == member {
+			found = zf
+		}
+	}
+	if member != "" && found == nil {
+		return fmt.Errorf("%s: no member %q (has %q): %w", archive, member, names, os.ErrNotExist)
+	} else if member == "" && len(names) != 1 {
+		return fmt.Errorf("%s: has %d files (%q), select one as %s#member", archive, len(names), names, archive)
+	}
+
+	rc, err := found.Open()
+	if err != nil {
+		return fmt.Errorf("%s#%s: %w", archive, found.Name, err)
+	}
+	defer rc.Close()
+	// the extension of the member is kept, for the detection of its type
+	fh, err := os.CreateTemp("", "ReadRows-*-"+path.Base(found.Name))
+	if err != nil {
+		return err
+	}
+	cfg.temps = append(cfg.temps, fh.Name())
+	_, err = io.Copy(fh, rc)
+	if closeErr := fh.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = cfg.open(ctx, fh.Name())
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+		return fmt.Errorf("%s#%s: %w", archive, found.Name, err)
+	}
+	cfg.name = archive + "#" + found.Name
+	return nil
+}
@@ -0,0 +1,9 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build mysql
+
+package cli
+
+import _ "github.com/go-sql-driver/mysql"
@@ -0,0 +1,9 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build sqlite
+
+package cli
+
+import _ "github.com/mattn/go-sqlite3"
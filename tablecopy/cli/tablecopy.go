@@ -0,0 +1,275 @@
+// Copyright 2021, 2022 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cli in tablecopy is a table copier between databases.
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"github.com/UNO-SOFT/dbcsv/completion"
+	"github.com/UNO-SOFT/dbcsv/connect"
+	"github.com/UNO-SOFT/dbcsv/tablecopy/lib"
+	"github.com/UNO-SOFT/dbcsv/tracing"
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+var (
+	logCfg dbcsv.LogConfig
+	logger = zlog.NewLogger(zlog.MaybeConsoleHandler(&logCfg, os.Stderr))
+)
+
+// Main runs the command with the arguments (args[0] is the name of the program).
+func Main(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	flagSource := fs.String("src", "", "user/passw@sid (or /@alias for external authentication) to read from, or a profile of ~/.dbcsv.yaml (defaults to $DB_ID, $BRUNO_OWNER_ID or $BRUNO_ID)")
+	flagSourcePrep := fs.String("src-prep", "", "prepare source connection (run statements separated by ;\\n)")
+	flagDest := fs.String("dst", "", "user/passw@sid (or /@alias for external authentication) to write to, or a profile of ~/.dbcsv.yaml (defaults to $DB_ID, $BRUNO_OWNER_ID or $BRUNO_ID)")
+	var connOpts connect.Options
+	connOpts.AddFlags(fs)
+	flagDestPrep := fs.String("dst-prep", "", "prepare destination connection (run statements separated by ;\\n)")
+	flagSourceDriver := fs.String("src-driver", "godror", "source driver: godror, pgx, mysql or sqlite (non-godror drivers need the build tag)")
+	flagDestDriver := fs.String("dst-driver", "godror", "destination driver: godror, pgx, mysql or sqlite (non-godror drivers need the build tag)")
+	flagReplace := fs.String("replace", "", "replace FIELD_NAME=WITH_VALUE,OTHER=NEXT")
+	flagColumns := dbcsv.FlagStrings()
+	fs.Var(flagColumns, "column", "each -column=DST=SRC renames, -column=DST=SQL_EXPRESSION (such as TRUNC(CREATED)) transforms, -column=DST= drops a column")
+	logCfg.AddFlags(fs)
+	flagTimeout := fs.Duration("timeout", 1*time.Minute, "timeout")
+	flagTableTimeout := fs.Duration("table-timeout", 10*time.Second, "per-table-timeout")
+	flagConc := fs.Int("concurrency", 8, "concurrency")
+	flagTruncate := fs.Bool("truncate", false, "truncate dest tables (must have different name)")
+	flagDeleteWhere := fs.String("delete-where", "", `delete the dest rows WHERE this condition (such as "LOAD_DATE = :1"), in the same transaction as the copy`)
+	flagDeleteArgs := fs.String("delete-args", "", "the bind arguments of -delete-where (comma separated)")
+	flagCreateDDL := fs.Bool("create-ddl", false, "create the destination tables with full DDL (DBMS_METADATA or type-mapped), not CREATE TABLE AS SELECT")
+	var pc lib.PostCopy
+	fs.BoolVar(&pc.Indexes, "copy-indexes", false, "create the (non-constraint) indexes of the source tables on the destination after the copy")
+	fs.BoolVar(&pc.Comments, "copy-comments", false, "copy the table and column comments after the copy")
+	fs.BoolVar(&pc.Grants, "copy-grants", false, "copy the grants after the copy")
+	flagCopySequences := fs.Bool("copy-sequences", false, "create (or restart) the sequences of the tables (identity and trigger-filled primary key) on the destination above the copied maximum")
+	var sc lib.SplitConfig
+	fs.Int64Var(&sc.Rows, "split-rows", 0, "split the tables with more rows than this (by statistics) into ROWID ranges, copied concurrently, each committed separately")
+	fs.BoolVar(&sc.Parts, "split-parts", false, "split the partitioned tables into per-partition chunks, copied concurrently, each committed separately")
+	flagSince := fs.String("since", "", `incremental copy: the condition with the last copied value, as "MODIFIED_AT > :last"`)
+	flagState := fs.String("state", "tablecopy-watermarks.json", "the file storing the last copied values for -since")
+	flagMerge := fs.String("merge", "", "merge (upsert) by these key columns (comma separated), instead of insert")
+	flagStatus := fs.String("status", "", "the file storing the per-table status (pending/done/failed); each table is committed separately and the failures don't stop the others")
+	flagResume := fs.Bool("resume", false, "copy only the not done tables of -status")
+	flagTasks := fs.String("tasks", "", "YAML file describing the tables to copy (src, dst, query, where, args, truncate, merge, delete_where, delete_args, replace, columns, mask, batch_size, timeout)")
+	flagVerify := fs.Bool("verify", false, "compare the source and destination row counts after the copy")
+	flagVerifyColumns := fs.String("verify-columns", "", "compare also a checksum (ORA_HASH/MD5/CRC32 aggregate) over these columns (comma separated), between the same kind of databases")
+	flagMaxRowsPerSec := fs.Float64("max-rows-per-sec", 0, "limit the copied rows per second, over all the tables")
+	flagViaDBLink := fs.String("via-dblink", "", "copy server-side with INSERT /*+ APPEND */ INTO dst SELECT ... FROM src@LINK, through this database link of the (Oracle) destination")
+	flagExclude := fs.String("exclude", "", "exclude these tables (names, LIKE patterns with % or /REGEXP/, comma separated) from the expanded table patterns")
+	flagSchema := fs.String("schema", "", "copy all the tables of this schema of the source (parents first, by the foreign keys)")
+	flagDisableFKs := fs.Bool("disable-fks", false, "disable the foreign keys of the (Oracle) destination tables during the copy")
+	flagFilter := fs.String("filter", "", `copy only the rows this (Starlark) boolean expression of the source columns is true for, such as 'STATUS != "X"'`)
+	flagMask := dbcsv.FlagStrings()
+	fs.Var(flagMask, "mask", "each -mask=COLUMN=SPEC masks the destination COLUMN with SPEC: null, fixed:VALUE, hash[:LENGTH] or pattern:PATTERN (# digit, ? letter, * alphanumeric)")
+	flagMaskKey := fs.String("mask-key", "", "the secret key of the hash and pattern masks (HMAC-SHA256), default $TABLECOPY_MASK_KEY; without it they are only pseudonymization, as the hashes of guessable values can be recomputed")
+	flagReject := fs.String("reject", "", "write the rows failed to be inserted into this CSV file, and continue (each table is committed separately)")
+	flagBatchMemory := fs.Int64("batch-memory", 0, "tune the batch size of each table (measuring its first rows) to this memory budget per worker, in bytes (overrides -batch-size)")
+	flagSrcTZ := fs.String("src-tz", "", "the time zone of the source's DATE/TIMESTAMP values (such as Europe/Budapest), to be converted to -dst-tz")
+	flagDstTZ := fs.String("dst-tz", "", "the time zone of the destination's DATE/TIMESTAMP values")
+	flagRecode := fs.String("recode", "", "FROM:TO character sets: the strings are encoded into FROM and decoded as TO (for data stored in a different character set than the database's)")
+	flagJustPrint := fs.Bool("just-print", false, "just print the statements and the estimated row counts, don't execute them")
+	flagBatchSize := fs.Int("batch-size", lib.DefaultBatchSize, "batch size")
+
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.Replace(`Usage of {{.prog}}:
+	{{.prog}} [options] 'T_able'
+
+will execute a "SELECT * FROM T_able@source_db" and an "INSERT INTO T_able@dest_db"
+
+	{{.prog}} [options] 'Source_table' 'F_ield=1'
+
+will execute a "SELECT * FROM Source_table@source_db WHERE F_ield=1" and an "INSERT INTO Source_table@dest_db"
+
+	{{.prog}} 'Source_table' '1=1' 'Dest_table'
+will execute a "SELECT * FROM Source_table@source_db WHERE F_ield=1" and an "INSERT INTO Dest_table@dest_db", matching the fields.
+
+The source table can be a LIKE pattern ('STG_%') or a regexp ('/^STG_[0-9]+$/'), expanded to the matching tables of the source;
+a % in the destination table is replaced with the source table's name.
+
+A task of the -tasks file can have a query (SELECT with joins, functions) as its source, its columns matched by their aliases.
+
+Tables with CLOB/BLOB columns are copied row-by-row, streaming the LOBs (into Oracle):
+this bounds the memory usage, but is much slower than the array insert of the other tables.
+
+`, "{{.prog}}", args[0], -1))
+		fs.PrintDefaults()
+	}
+	flagVersion := fs.Bool("version", false, "print the version and exit")
+	if completion.Collect(ctx, nil, fs) {
+		return nil
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *flagVersion {
+		fmt.Println(dbcsv.Version())
+		return nil
+	}
+	h, err := logCfg.Handler(os.Stderr, "tablecopy")
+	if err != nil {
+		return err
+	}
+	logger.SetHandler(h)
+	ctx, stop := dbcsv.WrapLogger(ctx, logger.SLog())
+	defer stop()
+	shutdown, err := tracing.Init(ctx, "tablecopy")
+	if err != nil {
+		return err
+	}
+	defer shutdown(context.WithoutCancel(ctx))
+	if *flagTimeout == 0 {
+		*flagTimeout = time.Hour
+	}
+	if *flagTableTimeout > *flagTimeout {
+		*flagTableTimeout = *flagTimeout
+	}
+
+	if *flagResume && *flagStatus == "" {
+		return errors.New("-resume needs -status")
+	}
+	var replace map[string]string
+	if *flagReplace != "" {
+		fields := strings.Split(*flagReplace, ",")
+		replace = make(map[string]string, len(fields))
+		for _, f := range fields {
+			if i := strings.IndexByte(f, '='); i < 0 {
+				continue
+			} else {
+				replace[strings.ToUpper(f[:i])] = f[i+1:]
+			}
+		}
+	}
+
+	var mergeKeys []string
+	if *flagMerge != "" {
+		mergeKeys = strings.FieldsFunc(*flagMerge, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	columns, err := lib.ParseColumnMap(flagColumns.Strings)
+	if err != nil {
+		return err
+	}
+	var deleteArgs []interface{}
+	if *flagDeleteArgs != "" {
+		for _, a := range strings.Split(*flagDeleteArgs, ",") {
+			deleteArgs = append(deleteArgs, a)
+		}
+	}
+	mask, err := lib.ParseMasks(flagMask.Strings)
+	if err != nil {
+		return err
+	}
+	var maskKey []byte
+	if *flagMaskKey == "" {
+		*flagMaskKey = os.Getenv("TABLECOPY_MASK_KEY")
+	}
+	if *flagMaskKey != "" {
+		maskKey = []byte(*flagMaskKey)
+	}
+	defaults := lib.Task{
+		Mask: mask, Filter: *flagFilter,
+		Replace: replace, Columns: columns, Truncate: *flagTruncate, Merge: mergeKeys,
+		DeleteWhere: *flagDeleteWhere, DeleteArgs: deleteArgs,
+	}
+	tables := make([]lib.Task, 0, 4)
+	if *flagTasks != "" {
+		if tables, err = lib.LoadTasks(*flagTasks, defaults); err != nil {
+			return err
+		}
+	} else if *flagSchema != "" {
+		// listed from the source
+	} else if fs.NArg() == 0 || fs.NArg() == 1 && fs.Arg(0) == "-" {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			parts := bytes.SplitN(scanner.Bytes(), []byte(" "), 2)
+			tbl := defaults
+			if i := bytes.IndexByte(parts[0], '='); i >= 0 {
+				tbl.Src, tbl.Dst = string(parts[0][:i]), string(parts[0][i+1:])
+			} else {
+				tbl.Src = string(parts[0])
+			}
+			if len(parts) > 1 {
+				tbl.Where = string(parts[1])
+			}
+			tables = append(tables, tbl)
+		}
+	} else {
+		tbl := defaults
+		tbl.Src = fs.Arg(0)
+		if fs.NArg() > 1 {
+			tbl.Where = fs.Arg(1)
+			if fs.NArg() > 2 {
+				tbl.Dst = fs.Args()[2]
+			}
+		}
+		tables = append(tables, tbl)
+	}
+
+	if *flagSource, err = connect.DSN(*flagSourceDriver, *flagSource, connOpts); err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	if *flagDest, err = connect.DSN(*flagDestDriver, *flagDest, connOpts); err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+	srcDB, err := lib.OpenDatabase(*flagSourceDriver, *flagSource, *flagSourcePrep)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	defer srcDB.Close()
+
+	dstDB, err := lib.OpenDatabase(*flagDestDriver, *flagDest, *flagDestPrep)
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+	defer dstDB.Close()
+
+	ctx, cancel := context.WithTimeout(zlog.NewContext(ctx, logger), *flagTimeout)
+	defer cancel()
+	for _, d := range []struct {
+		Name string
+		lib.Database
+	}{{"source", srcDB}, {"destination", dstDB}} {
+		if d.Dialect.Name != "oracle" {
+			continue
+		}
+		if err = connect.LogSession(ctx, logger.SLog().With("db", d.Name), d.DB); err != nil {
+			return fmt.Errorf("%s: %w", d.Name, err)
+		}
+	}
+
+	opts := lib.Options{
+		Defaults: defaults, Schema: *flagSchema,
+		Since: *flagSince, State: *flagState, Status: *flagStatus, Resume: *flagResume,
+		Reject: *flagReject, ViaDBLink: *flagViaDBLink,
+		SrcTZ: *flagSrcTZ, DstTZ: *flagDstTZ, Recode: *flagRecode,
+		Split: sc, PostCopy: pc, CopySequences: *flagCopySequences,
+		TableTimeout: *flagTableTimeout, Concurrency: *flagConc,
+		BatchSize: *flagBatchSize, BatchMemory: *flagBatchMemory, MaxRowsPerSec: *flagMaxRowsPerSec, MaskKey: maskKey,
+		CreateDDL: *flagCreateDDL, Verify: *flagVerify, DisableFKs: *flagDisableFKs,
+	}
+	if *flagExclude != "" {
+		opts.Exclude = strings.Split(*flagExclude, ",")
+	}
+	if *flagVerifyColumns != "" {
+		opts.VerifyColumns = strings.Split(*flagVerifyColumns, ",")
+	}
+	if *flagJustPrint {
+		opts.JustPrint = os.Stdout
+	}
+	return lib.Run(ctx, srcDB, dstDB, tables, opts)
+}
+
+// vim: se noet fileencoding=utf-8:
@@ -0,0 +1,70 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	godror "github.com/godror/godror"
+)
+
+const (
+	batchSampleRows = 100
+	maxBatchSize    = 1 << 16
+)
+
+// valueSize returns the approximate in-memory size of the scanned value.
+func valueSize(v interface{}) int {
+	switch x := v.(type) {
+	case nil:
+		return 8
+	case string:
+		return 16 + len(x)
+	case []byte:
+		return 24 + len(x)
+	case godror.Number:
+		return 16 + len(x)
+	case time.Time:
+		return 24
+	case int64, float64, bool:
+		return 8
+	}
+	return 16
+}
+
+// batchTuner tunes the batch size to the memory budget, measuring the average size of the first copied rows.
+type batchTuner struct {
+	budget  int64
+	n, size int
+}
+
+// newBatchTuner returns the tuner of the budget, nil if the budget is not positive.
+func newBatchTuner(budget int64) *batchTuner {
+	if budget <= 0 {
+		return nil
+	}
+	return &batchTuner{budget: budget}
+}
+
+// Add measures the values of a copied row. After the first batchSampleRows rows,
+// it returns the batch size which fits the rows into the budget - and 0 before and after that.
+func (bt *batchTuner) Add(ctx context.Context, values []interface{}) int {
+	if bt == nil || bt.n >= batchSampleRows {
+		return 0
+	}
+	for _, v := range values {
+		bt.size += valueSize(v)
+	}
+	if bt.n++; bt.n < batchSampleRows {
+		return 0
+	}
+	// the fetched and the bound arrays
+	rowSize := max(1, 2*int64(bt.size)/int64(bt.n))
+	batchSize := int(min(maxBatchSize, max(1, bt.budget/rowSize)))
+	zlog.FromContext(ctx).Info("tuned batch size", "rowSize", rowSize, "budget", bt.budget, "batchSize", batchSize)
+	return batchSize
+}
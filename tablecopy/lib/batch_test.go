@@ -0,0 +1,129 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	godror "github.com/godror/godror"
+)
+
+func TestValueSize(t *testing.T) {
+	for _, tc := range []struct {
+		In   interface{}
+		Want int
+	}{
+		{nil, 8},
+		{"", 16},
+		{"abc", 19},
+		{[]byte("abcd"), 28},
+		{[]byte(nil), 24},
+		{godror.Number("3.14"), 20},
+		{time.Now(), 24},
+		{int64(1), 8},
+		{3.14, 8},
+		{true, 8},
+		{struct{}{}, 16},
+	} {
+		if got := valueSize(tc.In); got != tc.Want {
+			t.Errorf("%#v: got %d, wanted %d", tc.In, got, tc.Want)
+		}
+	}
+}
+
+func TestBatchTuner(t *testing.T) {
+	ctx := context.Background()
+	row := []interface{}{int64(1), "abc"} // 27 bytes, doubled
+	for _, tc := range []struct {
+		Budget int64
+		Want   int
+	}{
+		{Budget: 5400, Want: 100},
+		{Budget: 10, Want: 1},
+		{Budget: 1 << 40, Want: maxBatchSize},
+	} {
+		bt := newBatchTuner(tc.Budget)
+		for i := 1; i < batchSampleRows; i++ {
+			if got := bt.Add(ctx, row); got != 0 {
+				t.Fatalf("%d: got %d at row %d", tc.Budget, got, i)
+			}
+		}
+		if got := bt.Add(ctx, row); got != tc.Want {
+			t.Errorf("%d: got %d, wanted %d", tc.Budget, got, tc.Want)
+		}
+		if got := bt.Add(ctx, row); got != 0 {
+			t.Errorf("%d: got %d after the sample", tc.Budget, got)
+		}
+	}
+	if bt := newBatchTuner(0); bt != nil {
+		t.Errorf("got %+v for no budget", bt)
+	} else if got := bt.Add(ctx, row); got != 0 {
+		t.Errorf("nil tuner: got %d", got)
+	}
+}
+
+func TestOneBatchMemory(t *testing.T) {
+	values := make([][]driver.Value, 250)
+	for i := range values {
+		values[i] = []driver.Value{int64(i), "abc"}
+	}
+	var mu sync.Mutex
+	var selects []string
+	src := &fakeConnector{Query: func(qry string, _ []driver.Value) (*fakeRows, error) {
+		if strings.Contains(qry, "1=0") {
+			return rowsOf([]string{"ID", "NAME"}), nil
+		}
+		mu.Lock()
+		selects = append(selects, qry)
+		mu.Unlock()
+		return rowsOf([]string{"ID", "NAME"}, values...), nil
+	}}
+	dst := &fakeConnector{Query: func(string, []driver.Value) (*fakeRows, error) {
+		return rowsOf([]string{"ID", "NAME"}), nil
+	}}
+	srcDB, dstDB := sql.OpenDB(src), sql.OpenDB(dst)
+	defer srcDB.Close()
+	defer dstDB.Close()
+	ctx := context.Background()
+	srcTx, err := srcDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srcTx.Rollback()
+	dstTx, err := dstDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dstTx.Rollback()
+
+	// 54 bytes per row: 40 rows per batch
+	cfg := Config{Src: sqliteDialect, Dst: sqliteDialect, BatchSize: 1000, BatchMemory: 54 * 40}
+	n, err := One(ctx, dstTx, srcTx, Task{Src: "T", Dst: "X"}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(values)) {
+		t.Errorf("copied %d rows, wanted %d", n, len(values))
+	}
+	if len(selects) != 1 {
+		t.Errorf("queried the source %d times: %q", len(selects), selects)
+	}
+	var got []int
+	for _, qry := range dst.Execs() {
+		if strings.HasPrefix(qry, "INSERT") {
+			got = append(got, strings.Count(qry, "(?,?)"))
+		}
+	}
+	if want := []int{40, 40, 40, 40, 40, 40, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got batches of %v rows, wanted %v", got, want)
+	}
+}
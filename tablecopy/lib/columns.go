@@ -0,0 +1,44 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ColumnMap maps the (upper case) destination column to the source column or SQL expression.
+// An empty expression drops the column.
+type ColumnMap map[string]string
+
+// ParseColumnMap parses the DST=SRC_COLUMN, DST=SQL_EXPRESSION or DST= (drop) specs.
+func ParseColumnMap(specs []string) (ColumnMap, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	cm := make(ColumnMap, len(specs))
+	for _, s := range specs {
+		dst, expr, ok := strings.Cut(s, "=")
+		dst = strings.TrimSpace(dst)
+		if !ok || dst == "" {
+			return nil, fmt.Errorf("%q: wanted DST=SRC_EXPRESSION", s)
+		}
+		cm[strings.ToUpper(dst)] = strings.TrimSpace(expr)
+	}
+	return cm, nil
+}
+
+// mapped returns the destination columns with non-empty expressions, in a stable order.
+func (cm ColumnMap) mapped() []string {
+	ks := make([]string, 0, len(cm))
+	for k, v := range cm {
+		if v != "" {
+			ks = append(ks, k)
+		}
+	}
+	sort.Strings(ks)
+	return ks
+}
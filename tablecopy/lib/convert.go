@@ -0,0 +1,105 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/UNO-SOFT/dbcsv"
+	"golang.org/x/text/encoding"
+)
+
+// valueConverter converts the copied values, keeping their types:
+// the times from the source's time zone to the destination's,
+// and the strings from one character set to another.
+type valueConverter struct {
+	srcLoc, dstLoc *time.Location
+	// the string is encoded with from, then decoded with to
+	from, to encoding.Encoding
+}
+
+// newValueConverter returns the converter, or nil if there is nothing to convert.
+//
+// The time zones are IANA names (such as Europe/Budapest);
+// recode is FROM:TO, where the strings as fetched are encoded into FROM, then decoded as TO:
+// this repairs the data stored in a different character set than the database's.
+func newValueConverter(srcTZ, dstTZ, recode string) (*valueConverter, error) {
+	var vc valueConverter
+	if (srcTZ == "") != (dstTZ == "") {
+		return nil, fmt.Errorf("both the source (%q) and the destination (%q) time zones are needed", srcTZ, dstTZ)
+	}
+	if srcTZ != "" {
+		var err error
+		if vc.srcLoc, err = time.LoadLocation(srcTZ); err != nil {
+			return nil, fmt.Errorf("%q: %w", srcTZ, err)
+		}
+		if vc.dstLoc, err = time.LoadLocation(dstTZ); err != nil {
+			return nil, fmt.Errorf("%q: %w", dstTZ, err)
+		}
+	}
+	if recode != "" {
+		from, to, ok := strings.Cut(recode, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q: wanted FROM:TO", recode)
+		}
+		fromEnc, err := dbcsv.EncFromName(from)
+		if err != nil {
+			return nil, err
+		}
+		toEnc, err := dbcsv.EncFromName(to)
+		if err != nil {
+			return nil, err
+		}
+		vc.from, vc.to = fromEnc.Encoding, toEnc.Encoding
+	}
+	if vc.srcLoc == nil && vc.from == nil {
+		return nil, nil
+	}
+	return &vc, nil
+}
+
+func (vc *valueConverter) time(t time.Time) time.Time {
+	if vc.srcLoc == nil || t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), vc.srcLoc).In(vc.dstLoc)
+}
+
+func (vc *valueConverter) string(s string) string {
+	if vc.from == nil || s == "" {
+		return s
+	}
+	b, err := vc.from.NewEncoder().String(s)
+	if err != nil {
+		return s
+	}
+	if t, err := vc.to.NewDecoder().String(b); err == nil {
+		return t
+	}
+	return s
+}
+
+// Convert the value, keeping its type. A nil *valueConverter returns v as is.
+func (vc *valueConverter) Convert(v interface{}) interface{} {
+	if vc == nil {
+		return v
+	}
+	switch x := v.(type) {
+	case time.Time:
+		return vc.time(x)
+	case sql.NullTime:
+		x.Time = vc.time(x.Time)
+		return x
+	case string:
+		return vc.string(x)
+	case sql.NullString:
+		x.String = vc.string(x.String)
+		return x
+	}
+	return v
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestValueConverter(t *testing.T) {
+	if vc, err := newValueConverter("", "", ""); err != nil || vc != nil {
+		t.Errorf("got %v, %+v, wanted nil for nothing to convert", vc, err)
+	}
+	var nilConv *valueConverter
+	if got := nilConv.Convert("Ã¡"); got != "Ã¡" {
+		t.Errorf("nil converter: got %q", got)
+	}
+	for _, args := range [][3]string{
+		{"Europe/Budapest", "", ""},
+		{"", "UTC", ""},
+		{"Nowhere/City", "UTC", ""},
+		{"", "", "iso-8859-1"},
+		{"", "", "iso-8859-1:klingon"},
+	} {
+		if _, err := newValueConverter(args[0], args[1], args[2]); err == nil {
+			t.Errorf("%q: wanted error", args)
+		}
+	}
+
+	vc, err := newValueConverter("Europe/Budapest", "UTC", "iso-8859-1:utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the wall clock time in Budapest, fetched as UTC
+	fetched := time.Date(2024, 7, 1, 12, 30, 0, 0, time.UTC)
+	want := time.Date(2024, 7, 1, 10, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		In, Want interface{}
+	}{
+		{fetched, want},
+		{sql.NullTime{Time: fetched, Valid: true}, sql.NullTime{Time: want, Valid: true}},
+		{time.Time{}, time.Time{}},
+		// UTF-8 stored as Latin-1
+		{"Ã¡rvÃ­z", "árvíz"},
+		{sql.NullString{String: "tÃ¼kÃ¶r", Valid: true}, sql.NullString{String: "tükör", Valid: true}},
+		{"", ""},
+		// not representable in Latin-1: kept as is
+		{"ő", "ő"},
+		{int64(42), int64(42)},
+		{nil, nil},
+	} {
+		got := vc.Convert(tc.In)
+		if gt, ok := got.(time.Time); ok {
+			if !gt.Equal(tc.Want.(time.Time)) {
+				t.Errorf("%v: got %v, wanted %v", tc.In, got, tc.Want)
+			}
+			continue
+		}
+		if gt, ok := got.(sql.NullTime); ok {
+			if wt := tc.Want.(sql.NullTime); gt.Valid != wt.Valid || !gt.Time.Equal(wt.Time) {
+				t.Errorf("%v: got %v, wanted %v", tc.In, got, tc.Want)
+			}
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("%#v: got %#v, wanted %#v", tc.In, got, tc.Want)
+		}
+	}
+}
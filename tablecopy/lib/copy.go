@@ -0,0 +1,619 @@
+// Copyright 2021, 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+// Package lib copies tables between databases, to be run in-process (tablecopy is its command line interface).
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	godror "github.com/godror/godror"
+
+	"github.com/UNO-SOFT/dbcsv/transform"
+)
+
+// DefaultBatchSize is the batch size used when Config.BatchSize is not positive.
+const DefaultBatchSize = 8192
+
+// createStatement returns the CREATE TABLE statement for the destination table,
+// or the empty string if it cannot be created.
+func createStatement(ctx context.Context, srcTx *sql.Tx, srcDB, dstDB Database, task Task, fullDDL bool) (string, error) {
+	if fullDDL {
+		var qry string
+		var err error
+		if task.Query != "" {
+			qry, err = mappedDDL(ctx, srcTx, srcDB.Dialect, dstDB.Dialect, task.from(), task.Dst, nil)
+		} else {
+			qry, err = createDDL(ctx, srcTx, srcDB.Dialect, dstDB.Dialect, task.Src, task.Dst, dstDB.DSN == srcDB.DSN)
+		}
+		if err != nil {
+			return "", fmt.Errorf("DDL of %s: %w", task.Src, err)
+		}
+		return qry, nil
+	}
+	if dstDB.Name != srcDB.Name {
+		return "", nil
+	}
+	// CREATE TABLE AS SELECT works only within the same kind of database
+	// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+	return "CREATE TABLE " + task.Dst + " AS SELECT * FROM " + task.from() + " WHERE 1=0", nil
+}
+
+// Config is the configuration of One.
+type Config struct {
+	Src, Dst  Dialect
+	BatchSize int
+	// Convert converts the values, if not nil.
+	Convert *valueConverter
+	// BatchMemory is the memory budget of the batches, in bytes: if positive, the batch size is tuned to it,
+	// by the average size of the first rows (fetched in small arrays).
+	BatchMemory int64
+	// Limiter limits the rows per second, if not nil.
+	Limiter *rowLimiter
+	// Reject receives the rows failed to be inserted, if not nil - otherwise they stop the copy.
+	Reject *rejecter
+	// MaskKey is the secret key of the hash and pattern masks (HMAC-SHA256), if not nil.
+	MaskKey []byte
+}
+
+// Task describes the copy of one table.
+type Task struct {
+	Replace map[string]string
+	// Columns maps the destination columns to source columns or expressions.
+	Columns         ColumnMap
+	Src, Dst, Where string
+	// Query is the source SELECT (with joins, functions), instead of the Src table.
+	// Its columns are matched by their aliases, Src just names the task.
+	Query string
+	// Args are the bind arguments of Where.
+	Args []interface{}
+	// Merge are the key columns: the rows are merged (upserted) by them, not just inserted.
+	Merge []string
+	// DeleteWhere is the condition of the rows to be deleted from Dst before the copy,
+	// DeleteArgs are its bind arguments.
+	DeleteWhere string
+	DeleteArgs  []interface{}
+	// Mask maps the destination columns to masking specs.
+	Mask map[string]string
+	// Filter is a (Starlark) boolean expression of the source columns (see package transform):
+	// the rows it is false for are not copied.
+	Filter string
+	// After are the sources of the tasks to be finished before this.
+	After []string
+	// BatchSize and Timeout override the global ones, if positive.
+	BatchSize int
+	Timeout   time.Duration
+	Truncate  bool
+}
+
+// key identifies the task in the state files.
+func (task Task) key() string {
+	if task.Dst == "" {
+		return task.Src + "=" + task.Src
+	}
+	return task.Src + "=" + task.Dst
+}
+
+// from returns the source of the FROM clause: the Src table or the Query.
+func (task Task) from() string {
+	if task.Query == "" {
+		return task.Src
+	}
+	return "(" + task.Query + ") Q"
+}
+
+// deleteWhere deletes the task's DeleteWhere rows from the destination.
+func deleteWhere(ctx context.Context, dstTx *sql.Tx, task Task) error {
+	if task.DeleteWhere == "" {
+		return nil
+	}
+	// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+	qry := "DELETE FROM " + task.Dst + " WHERE " + task.DeleteWhere
+	res, err := dstTx.ExecContext(ctx, qry, task.DeleteArgs...)
+	if err != nil {
+		return fmt.Errorf("%s %v: %w", qry, task.DeleteArgs, err)
+	}
+	n, _ := res.RowsAffected()
+	zlog.FromContext(ctx).Info("DELETE", "table", task.Dst, "where", task.DeleteWhere, "args", task.DeleteArgs, "deleted", n)
+	return nil
+}
+
+// One copies the rows of task.Src into task.Dst, returning the number of the copied rows.
+//
+// The columns are matched by name (see Columns), the logger is taken from the context (zlog.FromContext).
+func One(ctx context.Context, dstTx, srcTx *sql.Tx, task Task, cfg Config) (int64, error) {
+	zlog.FromContext(ctx).Info("One", "task", task)
+	if task.Dst == "" {
+		task.Dst = task.Src
+	}
+	batchSize := cfg.BatchSize
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	var n int64
+	plan, srcQry, buildQry, err := copyQueries(ctx, dstTx, srcTx, task, cfg)
+	if err != nil {
+		return n, err
+	}
+
+	// the column types decide how the rows are fetched
+	// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+	probeQry := "SELECT " + strings.Join(plan.SrcExprs, ",") + " FROM " + task.from() + " WHERE 1=0"
+	if task.Where != "" {
+		probeQry += " AND (" + task.Where + ")"
+	}
+	probe, err := srcTx.QueryContext(ctx, probeQry, task.Args...)
+	if err != nil {
+		return n, fmt.Errorf("%s: %w", probeQry, err)
+	}
+	types, err := probe.ColumnTypes()
+	probe.Close()
+	if err != nil {
+		return n, fmt.Errorf("%s: %w", probeQry, err)
+	}
+	keep, err := rowFilter(task, types)
+	if err != nil {
+		return n, err
+	}
+	// the batches are sized to BatchMemory by the first rows
+	tuner := newBatchTuner(cfg.BatchMemory)
+	lobs := cfg.Src.isOracle() && hasLOB(types)
+	var qryOpts []interface{}
+	if lobs {
+		// fetch the LOBs as streams, not all of them into memory
+		qryOpts = append(qryOpts, godror.LobAsReader())
+	} else if cfg.Src.isOracle() {
+		fetchSize := batchSize
+		if tuner != nil {
+			fetchSize = batchSampleRows
+		}
+		qryOpts = append(qryOpts, godror.FetchArraySize(fetchSize), godror.PrefetchCount(fetchSize+1))
+	}
+	rows, err := srcTx.QueryContext(ctx, srcQry, append(append([]interface{}(nil), task.Args...), qryOpts...)...)
+	if err != nil {
+		return n, fmt.Errorf("%s: %w", srcQry, err)
+	}
+	defer rows.Close()
+	if lobs {
+		return n, copyLOBRows(ctx, dstTx, rows, len(types), buildQry(1), cfg.Dst.isOracle(), keep, plan.Masks, cfg.Convert, cfg.Limiter,
+			rowRejecter(ctx, cfg, dstTx, task.Dst, plan), &n)
+	}
+
+	if !(cfg.Src.isOracle() && cfg.Dst.ArrayBind) {
+		if cfg.Dst.isOracle() { // no multi-row INSERT
+			batchSize, tuner = 1, nil
+		}
+		return n, copyMultiRow(ctx, dstTx, rows, len(types), buildQry, cfg.Dst.MaxParams, batchSize, tuner, keep, plan.Masks, cfg.Convert, cfg.Limiter,
+			rowRejecter(ctx, cfg, dstTx, task.Dst, plan), &n)
+	}
+
+	dstQry := buildQry(1)
+	stmt, err := dstTx.PrepareContext(ctx, dstQry)
+	if err != nil {
+		return n, fmt.Errorf("%s: %w", dstQry, err)
+	}
+	defer stmt.Close()
+	zlog.FromContext(ctx).Info("qry", "src", srcQry, "dst", dstQry)
+
+	values := make([]interface{}, len(types))
+	rBatch := make([]reflect.Value, len(values))
+	batchValues := make([]interface{}, 0, len(rBatch))
+	for i, t := range types {
+		et := t.ScanType()
+		if plan.Masks != nil && plan.Masks[i] != nil {
+			// the masked values are bound as strings
+			values[i] = new(sql.NullString)
+			rBatch[i] = reflect.MakeSlice(reflect.TypeOf([]string(nil)), 0, batchSize)
+			continue
+		}
+		values[i] = reflect.New(et).Interface()
+		rBatch[i] = reflect.MakeSlice(reflect.SliceOf(et), 0, batchSize)
+	}
+	// insert the rows [lo, hi) of the batch
+	insert := func(lo, hi int) (int64, error) {
+		m := hi - lo
+		if err := cfg.Limiter.Wait(ctx, m); err != nil {
+			return 0, err
+		}
+		batchValues = batchValues[:0]
+		for _, v := range rBatch {
+			batchValues = append(batchValues, v.Slice(lo, hi).Interface())
+		}
+		if cfg.Reject != nil {
+			if err := savepoint(ctx, dstTx, batchSavepoint); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, batchValues...); err != nil {
+			if cfg.Reject == nil {
+				return 0, fmt.Errorf("%s %v: %w", dstQry, batchValues, err)
+			}
+			batchRows := make([][]interface{}, m)
+			for j := range batchRows {
+				batchRows[j] = make([]interface{}, len(rBatch))
+				for i, v := range rBatch {
+					batchRows[j][i] = v.Index(lo + j).Interface()
+				}
+			}
+			return cfg.Reject.retryRows(ctx, dstTx, cfg.Dst, task.Dst, plan.DstNames[:len(plan.SrcExprs)], err, batchRows,
+				func(args ...interface{}) error { _, err := stmt.ExecContext(ctx, args...); return err })
+		}
+		return int64(m), nil
+	}
+	// insert the full batches (and the rest, if all), keep the rest
+	doInsert := func(all bool) error {
+		m := rBatch[0].Len()
+		var lo int
+		for m-lo >= batchSize || all && lo < m {
+			hi := min(lo+batchSize, m)
+			k, err := insert(lo, hi)
+			n += k
+			if err != nil {
+				return err
+			}
+			lo = hi
+		}
+		for i, v := range rBatch {
+			rBatch[i] = reflect.AppendSlice(v.Slice(0, 0), v.Slice(lo, m))
+		}
+		return nil
+	}
+
+	var row []interface{}
+	if keep != nil || tuner != nil {
+		row = make([]interface{}, len(values))
+	}
+	for rows.Next() {
+		if err = rows.Scan(values...); err != nil {
+			return n, err
+		}
+		if row != nil {
+			for i, v := range values {
+				row[i] = reflect.ValueOf(v).Elem().Interface()
+			}
+		}
+		if keep != nil {
+			if ok, err := keep(row); err != nil {
+				return n, err
+			} else if !ok {
+				continue
+			}
+		}
+		if size := tuner.Add(ctx, row); size != 0 {
+			batchSize = size
+		}
+		for i, v := range values {
+			if plan.Masks != nil && plan.Masks[i] != nil {
+				rBatch[i] = reflect.Append(rBatch[i], reflect.ValueOf(maskedString(plan.Masks[i], *(v.(*sql.NullString)))))
+				continue
+			}
+			rv := reflect.ValueOf(v).Elem()
+			if cfg.Convert != nil {
+				if c := cfg.Convert.Convert(rv.Interface()); c != nil {
+					rv = reflect.ValueOf(c)
+				}
+			}
+			rBatch[i] = reflect.Append(rBatch[i], rv)
+		}
+		if rBatch[0].Len() >= batchSize {
+			if err = doInsert(false); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, doInsert(true)
+}
+
+// rowRejecter returns the row-by-row retrying function of the failed batches, nil if cfg.Reject is nil.
+func rowRejecter(ctx context.Context, cfg Config, dstTx *sql.Tx, table string, plan copyPlan) func(error, [][]interface{}, func(...interface{}) error) (int64, error) {
+	if cfg.Reject == nil {
+		return nil
+	}
+	cols := plan.DstNames[:len(plan.SrcExprs)]
+	return func(batchErr error, rows [][]interface{}, exec func(...interface{}) error) (int64, error) {
+		return cfg.Reject.retryRows(ctx, dstTx, cfg.Dst, table, cols, batchErr, rows, exec)
+	}
+}
+
+// copyPlan is the column mapping of a task.
+type copyPlan struct {
+	// SrcExprs are the selected source columns (or expressions),
+	// bound to the first len(SrcExprs) of DstNames.
+	SrcExprs []string
+	// DstNames are the quoted destination columns: the bound ones, then the replaced ones.
+	DstNames []string
+	// Constants are the literals of the replaced columns.
+	Constants []string
+	// Keys are the quoted merge keys.
+	Keys []string
+	// Masks are the maskers of the SrcExprs (nil for the not masked ones).
+	Masks []masker
+}
+
+// planCopy maps the source columns to the destination columns.
+func planCopy(ctx context.Context, dstTx, srcTx *sql.Tx, task Task, cfg Config) (copyPlan, error) {
+	var plan copyPlan
+	srcCols, err := Columns(ctx, srcTx, task.from())
+	if err != nil {
+		return plan, fmt.Errorf("sources: %w", err)
+	}
+
+	dstCols, err := Columns(ctx, dstTx, task.Dst)
+	if err != nil {
+		return plan, fmt.Errorf("dest: %w", err)
+	}
+	// the databases may report the names with different case
+	m := make(map[string]string, len(dstCols))
+	for _, c := range dstCols {
+		m[strings.ToUpper(c)] = c
+	}
+
+	tbr := make([]string, 0, len(task.Replace))
+	var bound []string
+	for _, k := range srcCols {
+		K := strings.ToUpper(k)
+		d, ok := m[K]
+		if !ok {
+			continue
+		}
+		if _, ok := task.Replace[K]; ok {
+			tbr = append(tbr, d)
+			continue
+		}
+		if _, ok := task.Columns[K]; ok {
+			continue
+		}
+		plan.SrcExprs = append(plan.SrcExprs, cfg.Src.Quote(k))
+		plan.DstNames = append(plan.DstNames, cfg.Dst.Quote(d))
+		bound = append(bound, d)
+	}
+	for _, K := range task.Columns.mapped() {
+		if _, ok := task.Replace[K]; ok {
+			continue
+		}
+		d, ok := m[K]
+		if !ok {
+			return plan, fmt.Errorf("mapped column %q is not in %s", K, task.Dst)
+		}
+		plan.SrcExprs = append(plan.SrcExprs, task.Columns[K])
+		plan.DstNames = append(plan.DstNames, cfg.Dst.Quote(d))
+		bound = append(bound, d)
+	}
+	if len(task.Mask) != 0 {
+		plan.Masks = make([]masker, len(bound))
+		var masked int
+		for i, d := range bound {
+			spec, ok := task.Mask[strings.ToUpper(d)]
+			if !ok {
+				continue
+			}
+			if plan.Masks[i], err = parseMask(spec, cfg.MaskKey); err != nil {
+				return plan, fmt.Errorf("mask of %s: %w", d, err)
+			}
+			masked++
+		}
+		if masked != len(task.Mask) {
+			return plan, fmt.Errorf("some masked columns of %v are not copied into %s", task.Mask, task.Dst)
+		}
+	}
+	for _, k := range tbr {
+		plan.DstNames = append(plan.DstNames, cfg.Dst.Quote(k))
+		plan.Constants = append(plan.Constants, "'"+strings.ReplaceAll(task.Replace[strings.ToUpper(k)], "'", "''")+"'")
+	}
+	for _, k := range task.Merge {
+		d, ok := m[strings.ToUpper(k)]
+		if !ok {
+			return plan, fmt.Errorf("merge key %q is not in %s", k, task.Dst)
+		}
+		plan.Keys = append(plan.Keys, cfg.Dst.Quote(d))
+	}
+	return plan, nil
+}
+
+// copyQueries returns the SELECT from the source, and the INSERT (or MERGE) for rowCount rows into the destination.
+func copyQueries(ctx context.Context, dstTx, srcTx *sql.Tx, task Task, cfg Config) (copyPlan, string, func(rowCount int) string, error) {
+	plan, err := planCopy(ctx, dstTx, srcTx, task, cfg)
+	if err != nil {
+		return plan, "", nil, err
+	}
+	srcQry := "SELECT " + strings.Join(plan.SrcExprs, ",") + " FROM " + task.from()
+	if task.Where != "" {
+		srcQry += " WHERE " + task.Where
+	}
+	nCols := len(plan.SrcExprs)
+	// rowValues returns the :1,:2,... for the r-th row
+	rowValues := func(r int) []string {
+		vals := make([]string, 0, len(plan.DstNames))
+		for j := 1; j <= nCols; j++ {
+			vals = append(vals, cfg.Dst.Placeholder(r*nCols+j))
+		}
+		return append(vals, plan.Constants...)
+	}
+	// buildQry returns the INSERT (or MERGE) for rowCount rows
+	buildQry := func(rowCount int) string {
+		if len(plan.Keys) != 0 && cfg.Dst.isOracle() {
+			return oracleMerge(task.Dst, plan.DstNames, rowValues(0), plan.Keys, "DUAL")
+		}
+		var bld strings.Builder
+		fmt.Fprintf(&bld, "INSERT INTO %s (%s) VALUES ", task.Dst, strings.Join(plan.DstNames, ","))
+		for r := 0; r < rowCount; r++ {
+			if r != 0 {
+				bld.WriteByte(',')
+			}
+			bld.WriteString("(" + strings.Join(rowValues(r), ",") + ")")
+		}
+		if len(plan.Keys) != 0 {
+			bld.WriteString(upsertSuffix(cfg.Dst, plan.DstNames, plan.Keys))
+		}
+		return bld.String()
+	}
+
+	return plan, srcQry, buildQry, nil
+}
+
+// copyMultiRow copies the rows with multi-row INSERT ... VALUES (...),(...) statements,
+// for the drivers without array binding.
+func copyMultiRow(ctx context.Context, dstTx *sql.Tx, rows *sql.Rows, nCols int,
+	buildQry func(rowCount int) string, maxParams, batchSize int, tuner *batchTuner, keep func([]interface{}) (bool, error), masks []masker, conv *valueConverter, limiter *rowLimiter,
+	reject func(batchErr error, rows [][]interface{}, exec func(...interface{}) error) (int64, error), n *int64,
+) error {
+	if nCols == 0 {
+		return nil
+	}
+	if maxParams > 0 && batchSize*nCols > maxParams {
+		batchSize = max(1, maxParams/nCols)
+	}
+	stmts := make(map[int]*sql.Stmt)
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+	getStmt := func(rowCount int) (*sql.Stmt, error) {
+		if stmt := stmts[rowCount]; stmt != nil {
+			return stmt, nil
+		}
+		qry := buildQry(rowCount)
+		stmt, err := dstTx.PrepareContext(ctx, qry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", qry, err)
+		}
+		stmts[rowCount] = stmt
+		return stmt, nil
+	}
+	batch := make([]interface{}, 0, batchSize*nCols)
+	// insert the rows of part
+	insert := func(part []interface{}) error {
+		rowCount := len(part) / nCols
+		if err := limiter.Wait(ctx, rowCount); err != nil {
+			return err
+		}
+		stmt, err := getStmt(rowCount)
+		if err != nil {
+			return err
+		}
+		if reject != nil {
+			if err := savepoint(ctx, dstTx, batchSavepoint); err != nil {
+				return err
+			}
+		}
+		if _, err = stmt.ExecContext(ctx, part...); err != nil {
+			if reject == nil {
+				return fmt.Errorf("insert %d rows: %w", rowCount, err)
+			}
+			one, oneErr := getStmt(1)
+			if oneErr != nil {
+				return oneErr
+			}
+			batchRows := make([][]interface{}, rowCount)
+			for j := range batchRows {
+				batchRows[j] = part[j*nCols : (j+1)*nCols]
+			}
+			k, err := reject(err, batchRows, func(args ...interface{}) error { _, err := one.ExecContext(ctx, args...); return err })
+			*n += k
+			if err != nil {
+				return err
+			}
+		} else {
+			*n += int64(rowCount)
+		}
+		return nil
+	}
+	// insert the full batches (and the rest, if all), keep the rest
+	doInsert := func(all bool) error {
+		size := batchSize * nCols
+		var i int
+		for len(batch)-i >= size || all && i < len(batch) {
+			j := min(i+size, len(batch))
+			if err := insert(batch[i:j]); err != nil {
+				return err
+			}
+			i = j
+		}
+		batch = append(batch[:0], batch[i:]...)
+		return nil
+	}
+	values := make([]interface{}, nCols)
+	dest := make([]interface{}, nCols)
+	for i := range dest {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if keep != nil {
+			if ok, err := keep(values); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+		}
+		if size := tuner.Add(ctx, values); size != 0 {
+			if batchSize = size; maxParams > 0 && batchSize*nCols > maxParams {
+				batchSize = max(1, maxParams/nCols)
+			}
+		}
+		for i, v := range values {
+			values[i] = conv.Convert(v)
+		}
+		for i, m := range masks {
+			if m != nil {
+				values[i] = m(values[i])
+			}
+		}
+		batch = append(batch, values...)
+		if len(batch) >= batchSize*nCols {
+			if err := doInsert(false); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return doInsert(true)
+}
+
+// rowFilter returns the compiled Filter of the task for the columns (nil if there is no Filter),
+// which reports whether the row is to be copied.
+func rowFilter(task Task, types []*sql.ColumnType) (func([]interface{}) (bool, error), error) {
+	if task.Filter == "" {
+		return nil, nil
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.Name()
+	}
+	prog, err := transform.Compile(names, nil, task.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", task.Src, err)
+	}
+	return func(row []interface{}) (bool, error) {
+		ok, err := prog.Keep(row)
+		if err != nil {
+			return false, fmt.Errorf("%s: filter %q: %w", task.Src, task.Filter, err)
+		}
+		return ok, nil
+	}, nil
+}
+
+// Columns returns the column names of the table.
+func Columns(ctx context.Context, tx *sql.Tx, tbl string) ([]string, error) {
+	// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+	qry := "SELECT * FROM " + tbl + " WHERE 1=0"
+	rows, err := tx.QueryContext(ctx, qry)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", qry, err)
+	}
+	cols, err := rows.Columns()
+	rows.Close()
+	return cols, err
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"slices"
+	"sync"
+)
+
+// fakeConnector is a fake database: the queries are answered by Query,
+// the statements are recorded, and fail with the error returned by Exec.
+type fakeConnector struct {
+	Query func(qry string, args []driver.Value) (*fakeRows, error)
+	Exec  func(qry string, args []driver.Value) error
+	mu    sync.Mutex
+	execs []string
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return nil }
+
+// Execs returns the executed statements.
+func (c *fakeConnector) Execs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.execs)
+}
+
+type fakeConn struct{ *fakeConnector }
+
+func (c fakeConn) Prepare(qry string) (driver.Stmt, error) {
+	return fakeStmt{c.fakeConnector, qry}, nil
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c, nil
+}
+func (c fakeConn) Commit() error   { return nil }
+func (c fakeConn) Rollback() error { return nil }
+
+type fakeStmt struct {
+	*fakeConnector
+	qry string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.mu.Lock()
+	s.execs = append(s.execs, s.qry)
+	s.mu.Unlock()
+	if s.fakeConnector.Exec != nil {
+		if err := s.fakeConnector.Exec(s.qry, args); err != nil {
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.fakeConnector.Query == nil {
+		return &fakeRows{}, nil
+	}
+	return s.fakeConnector.Query(s.qry, args)
+}
+
+// fakeRows is the result of a query.
+type fakeRows struct {
+	Cols   []fakeColumn
+	Values [][]driver.Value
+}
+
+// fakeColumn is a column of fakeRows, the Length and the Precision is reported if positive.
+type fakeColumn struct {
+	Name, Type               string
+	Length, Precision, Scale int64
+	NotNull                  bool
+}
+
+// rowsOf returns the rows of the values, with the named columns.
+func rowsOf(names []string, values ...[]driver.Value) *fakeRows {
+	r := fakeRows{Cols: make([]fakeColumn, len(names)), Values: values}
+	for i, nm := range names {
+		r.Cols[i].Name = nm
+	}
+	return &r
+}
+
+// stringRows returns the strings as the rows of one column.
+func stringRows(ss ...string) *fakeRows {
+	values := make([][]driver.Value, len(ss))
+	for i, s := range ss {
+		values[i] = []driver.Value{s}
+	}
+	return rowsOf([]string{"name"}, values...)
+}
+
+func (r *fakeRows) Columns() []string {
+	names := make([]string, len(r.Cols))
+	for i, c := range r.Cols {
+		names[i] = c.Name
+	}
+	return names
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.Values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.Values[0])
+	r.Values = r.Values[1:]
+	return nil
+}
+func (r *fakeRows) ColumnTypeDatabaseTypeName(i int) string { return r.Cols[i].Type }
+func (r *fakeRows) ColumnTypeLength(i int) (int64, bool) {
+	return r.Cols[i].Length, r.Cols[i].Length > 0
+}
+func (r *fakeRows) ColumnTypeNullable(i int) (bool, bool) { return !r.Cols[i].NotNull, true }
+func (r *fakeRows) ColumnTypePrecisionScale(i int) (int64, int64, bool) {
+	return r.Cols[i].Precision, r.Cols[i].Scale, r.Cols[i].Precision > 0
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+// copyViaDBLink copies the table entirely in the destination database,
+// selecting the source through the database link.
+func copyViaDBLink(ctx context.Context, dstTx, srcTx *sql.Tx, task Task, cfg Config, link string) (int64, error) {
+	if !(cfg.Src.isOracle() && cfg.Dst.isOracle()) {
+		return 0, fmt.Errorf("-via-dblink needs Oracle on both ends, not %s and %s", cfg.Src.Name, cfg.Dst.Name)
+	}
+	if task.Query != "" {
+		return 0, fmt.Errorf("%s: a query cannot be copied via a database link", task.Src)
+	}
+	if task.Filter != "" {
+		return 0, fmt.Errorf("%s: a filtered table cannot be copied via a database link", task.Src)
+	}
+	plan, err := planCopy(ctx, dstTx, srcTx, task, cfg)
+	if err != nil {
+		return 0, err
+	}
+	from := task.Src + "@" + link
+	if task.Where != "" {
+		from += " WHERE " + task.Where
+	}
+	values := append(append(make([]string, 0, len(plan.DstNames)), plan.SrcExprs...), plan.Constants...)
+	var qry string
+	if len(plan.Keys) != 0 {
+		qry = oracleMerge(task.Dst, plan.DstNames, values, plan.Keys, from)
+	} else {
+		qry = "INSERT /*+ APPEND */ INTO " + task.Dst + " (" + strings.Join(plan.DstNames, ",") + ") SELECT " +
+			strings.Join(values, ",") + " FROM " + from
+	}
+	zlog.FromContext(ctx).Info("via dblink", "qry", qry)
+	res, err := dstTx.ExecContext(ctx, qry, task.Args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", qry, err)
+	}
+	return res.RowsAffected()
+}
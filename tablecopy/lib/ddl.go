@@ -0,0 +1,232 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// createDDL returns the CREATE TABLE statement for dstTable, with the columns of srcTable.
+//
+// Between Oracle databases, DBMS_METADATA.GET_DDL is used (without storage attributes),
+// otherwise the column types are mapped to the destination's types, keeping NOT NULL and
+// the primary key (if the source is Oracle).
+func createDDL(ctx context.Context, srcTx *sql.Tx, src, dst Dialect, srcTable, dstTable string, sameDB bool) (string, error) {
+	if src.isOracle() && dst.isOracle() {
+		return metadataDDL(ctx, srcTx, srcTable, dstTable, sameDB)
+	}
+	var pk []string
+	if src.isOracle() {
+		var err error
+		if pk, err = oraclePrimaryKey(ctx, srcTx, srcTable); err != nil {
+			return "", err
+		}
+	}
+	return mappedDDL(ctx, srcTx, src, dst, srcTable, dstTable, pk)
+}
+
+// mappedDDL returns the CREATE TABLE statement for dstTable, with the columns of from
+// (a table or a subquery) mapped to the destination's types, and the primary key pk.
+func mappedDDL(ctx context.Context, srcTx *sql.Tx, src, dst Dialect, from, dstTable string, pk []string) (string, error) {
+	// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+	qry := "SELECT * FROM " + from + " WHERE 1=0"
+	rows, err := srcTx.QueryContext(ctx, qry)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", qry, err)
+	}
+	types, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", qry, err)
+	}
+
+	var bld strings.Builder
+	bld.WriteString("CREATE TABLE ")
+	bld.WriteString(dstTable)
+	bld.WriteString(" (")
+	for i, t := range types {
+		if i != 0 {
+			bld.WriteString(", ")
+		}
+		bld.WriteString(dst.Quote(t.Name()))
+		bld.WriteByte(' ')
+		bld.WriteString(mapType(src, dst, t))
+		if nullable, ok := t.Nullable(); ok && !nullable {
+			bld.WriteString(" NOT NULL")
+		}
+	}
+	if len(pk) != 0 {
+		bld.WriteString(", PRIMARY KEY (")
+		for i, c := range pk {
+			if i != 0 {
+				bld.WriteByte(',')
+			}
+			bld.WriteString(dst.Quote(c))
+		}
+		bld.WriteByte(')')
+	}
+	bld.WriteByte(')')
+	return bld.String(), nil
+}
+
+// splitOwner splits the OWNER.TABLE name, the owner is empty for the current schema.
+func splitOwner(tbl string) (owner, name string) {
+	if i := strings.IndexByte(tbl, '.'); i >= 0 {
+		return strings.ToUpper(tbl[:i]), strings.ToUpper(tbl[i+1:])
+	}
+	return "", strings.ToUpper(tbl)
+}
+
+func metadataDDL(ctx context.Context, srcTx *sql.Tx, srcTable, dstTable string, sameDB bool) (string, error) {
+	const setQry = `BEGIN
+  DBMS_METADATA.SET_TRANSFORM_PARAM(DBMS_METADATA.SESSION_TRANSFORM, 'SEGMENT_ATTRIBUTES', FALSE);
+  DBMS_METADATA.SET_TRANSFORM_PARAM(DBMS_METADATA.SESSION_TRANSFORM, 'STORAGE', FALSE);
+  DBMS_METADATA.SET_TRANSFORM_PARAM(DBMS_METADATA.SESSION_TRANSFORM, 'REF_CONSTRAINTS', FALSE);
+  DBMS_METADATA.SET_TRANSFORM_PARAM(DBMS_METADATA.SESSION_TRANSFORM, 'EMIT_SCHEMA', FALSE);
+  DBMS_METADATA.SET_TRANSFORM_PARAM(DBMS_METADATA.SESSION_TRANSFORM, 'SQLTERMINATOR', FALSE);
+  DBMS_METADATA.SET_TRANSFORM_PARAM(DBMS_METADATA.SESSION_TRANSFORM, 'CONSTRAINTS', :1 = 1);
+END;`
+	// the named constraints would collide in the same database
+	constraints := 1
+	if sameDB {
+		constraints = 0
+	}
+	if _, err := srcTx.ExecContext(ctx, setQry, constraints); err != nil {
+		return "", fmt.Errorf("%s: %w", setQry, err)
+	}
+	owner, name := splitOwner(srcTable)
+	const qry = "SELECT DBMS_METADATA.GET_DDL('TABLE', :1, NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))) FROM DUAL"
+	var ddl string
+	if err := srcTx.QueryRowContext(ctx, qry, name, owner).Scan(&ddl); err != nil {
+		return "", fmt.Errorf("%s [%q, %q]: %w", qry, name, owner, err)
+	}
+	ddl = strings.TrimSpace(ddl)
+	quoted := `"` + name + `"`
+	i := strings.Index(ddl, quoted)
+	if i < 0 {
+		return "", fmt.Errorf("no %s in %q", quoted, ddl)
+	}
+	return "CREATE TABLE " + dstTable + ddl[i+len(quoted):], nil
+}
+
+func oraclePrimaryKey(ctx context.Context, srcTx *sql.Tx, tbl string) ([]string, error) {
+	owner, name := splitOwner(tbl)
+	const qry = `SELECT B.column_name
+  FROM all_cons_columns B, all_constraints A
+  WHERE B.position IS NOT NULL AND B.constraint_name = A.constraint_name AND B.owner = A.owner AND
+        A.constraint_type = 'P' AND A.table_name = :1 AND A.owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))
+  ORDER BY B.position`
+	rows, err := srcTx.QueryContext(ctx, qry, name, owner)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", qry, err)
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return cols, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, rows.Err()
+}
+
+// mapType returns the destination's type for the source column.
+func mapType(src, dst Dialect, t *sql.ColumnType) string {
+	length, hasLength := t.Length()
+	prec, scale, hasDecimal := t.DecimalSize()
+	typ := strings.ToUpper(t.DatabaseTypeName())
+	var kind string
+	switch typ {
+	case "VARCHAR2", "NVARCHAR2", "VARCHAR", "NVARCHAR", "CHARACTER VARYING", "TEXT", "LONG", "ROWID", "UROWID":
+		kind = "text"
+	case "CHAR", "NCHAR", "BPCHAR", "CHARACTER":
+		kind = "char"
+	case "NUMBER", "NUMERIC", "DECIMAL":
+		kind = "number"
+		if hasDecimal && scale == 0 && prec > 0 && prec <= 18 {
+			kind = "int"
+		}
+	case "INT", "INT2", "INT4", "INT8", "INTEGER", "SMALLINT", "BIGINT", "TINYINT":
+		kind = "int"
+	case "BINARY_DOUBLE", "BINARY_FLOAT", "FLOAT", "FLOAT4", "FLOAT8", "REAL", "DOUBLE", "DOUBLE PRECISION":
+		kind = "float"
+	case "DATE":
+		kind = "date"
+	case "TIMESTAMP", "DATETIME":
+		kind = "timestamp"
+	case "TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITH LOCAL TIME ZONE", "TIMESTAMPTZ":
+		kind = "timestamptz"
+	case "CLOB", "NCLOB", "LONGTEXT", "MEDIUMTEXT":
+		kind = "clob"
+	case "BLOB", "BYTEA", "LONGBLOB", "MEDIUMBLOB", "LONG RAW":
+		kind = "blob"
+	case "RAW", "VARBINARY", "BINARY":
+		kind = "raw"
+	case "BOOLEAN", "BOOL":
+		kind = "bool"
+	default:
+		kind = "text"
+	}
+	if (kind == "text" || kind == "char" || kind == "raw") && (!hasLength || length <= 0 || length > 4000) {
+		switch kind {
+		case "raw":
+			kind = "blob"
+		default:
+			kind = "clob"
+		}
+	}
+	numArgs := func() string {
+		if !hasDecimal || prec <= 0 {
+			return ""
+		}
+		return "(" + strconv.FormatInt(prec, 10) + "," + strconv.FormatInt(scale, 10) + ")"
+	}
+	lengthArg := "(" + strconv.FormatInt(length, 10) + ")"
+	// Oracle's DATE has time, too
+	oraDate := kind == "date" && src.isOracle()
+
+	switch dst.Name {
+	case "oracle":
+		return map[string]string{
+			"text": "VARCHAR2(" + strconv.FormatInt(length, 10) + " CHAR)", "char": "CHAR" + lengthArg,
+			"number": "NUMBER" + numArgs(), "int": "NUMBER(19)", "float": "BINARY_DOUBLE",
+			"date": "DATE", "timestamp": "TIMESTAMP", "timestamptz": "TIMESTAMP WITH TIME ZONE",
+			"clob": "CLOB", "blob": "BLOB", "raw": "RAW" + lengthArg, "bool": "NUMBER(1)",
+		}[kind]
+	case "postgres":
+		date := "date"
+		if oraDate {
+			date = "timestamp(0)"
+		}
+		return map[string]string{
+			"text": "varchar" + lengthArg, "char": "char" + lengthArg,
+			"number": "numeric" + numArgs(), "int": "bigint", "float": "double precision",
+			"date": date, "timestamp": "timestamp", "timestamptz": "timestamptz",
+			"clob": "text", "blob": "bytea", "raw": "bytea", "bool": "boolean",
+		}[kind]
+	case "mysql":
+		date := "date"
+		if oraDate {
+			date = "datetime"
+		}
+		return map[string]string{
+			"text": "varchar" + lengthArg, "char": "char" + lengthArg,
+			"number": "decimal" + numArgs(), "int": "bigint", "float": "double",
+			"date": date, "timestamp": "datetime(6)", "timestamptz": "timestamp(6)",
+			"clob": "longtext", "blob": "longblob", "raw": "varbinary" + lengthArg, "bool": "tinyint(1)",
+		}[kind]
+	}
+	return map[string]string{
+		"text": "TEXT", "char": "TEXT", "number": "NUMERIC", "int": "INTEGER", "float": "REAL",
+		"date": "TEXT", "timestamp": "TEXT", "timestamptz": "TEXT",
+		"clob": "TEXT", "blob": "BLOB", "raw": "BLOB", "bool": "INTEGER",
+	}[kind]
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestCreateDDL(t *testing.T) {
+	fake := &fakeConnector{Query: func(qry string, _ []driver.Value) (*fakeRows, error) {
+		switch {
+		case strings.Contains(qry, "constraint_type = 'P'"):
+			return stringRows("ID"), nil
+		case strings.Contains(qry, "DBMS_METADATA.GET_DDL"):
+			return stringRows("\n  CREATE TABLE \"SCOTT\".\"EMP\" \n   (\t\"ID\" NUMBER(10,0) NOT NULL ENABLE)"), nil
+		}
+		return &fakeRows{Cols: []fakeColumn{
+			{Name: "ID", Type: "NUMBER", Precision: 10, NotNull: true},
+			{Name: "NAME", Type: "VARCHAR2", Length: 30},
+			{Name: "AMOUNT", Type: "NUMBER", Precision: 12, Scale: 2},
+			{Name: "BORN", Type: "DATE"},
+			{Name: "NOTE", Type: "CLOB"},
+			{Name: "DATA", Type: "RAW"},
+		}}, nil
+	}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	for _, tc := range []struct {
+		Src, Dst Dialect
+		Want     string
+	}{
+		{oracleDialect, postgresDialect,
+			`CREATE TABLE X ("ID" bigint NOT NULL, "NAME" varchar(30), "AMOUNT" numeric(12,2), "BORN" timestamp(0), "NOTE" text, "DATA" bytea, PRIMARY KEY ("ID"))`},
+		{oracleDialect, mysqlDialect,
+			"CREATE TABLE X (`ID` bigint NOT NULL, `NAME` varchar(30), `AMOUNT` decimal(12,2), `BORN` datetime, `NOTE` longtext, `DATA` longblob, PRIMARY KEY (`ID`))"},
+		{oracleDialect, sqliteDialect,
+			`CREATE TABLE X ("ID" INTEGER NOT NULL, "NAME" TEXT, "AMOUNT" NUMERIC, "BORN" TEXT, "NOTE" TEXT, "DATA" BLOB, PRIMARY KEY ("ID"))`},
+		{sqliteDialect, oracleDialect,
+			`CREATE TABLE X ("ID" NUMBER(19) NOT NULL, "NAME" VARCHAR2(30 CHAR), "AMOUNT" NUMBER(12,2), "BORN" DATE, "NOTE" CLOB, "DATA" BLOB)`},
+		{sqliteDialect, postgresDialect,
+			`CREATE TABLE X ("ID" bigint NOT NULL, "NAME" varchar(30), "AMOUNT" numeric(12,2), "BORN" date, "NOTE" text, "DATA" bytea)`},
+		{oracleDialect, oracleDialect,
+			"CREATE TABLE X \n   (\t\"ID\" NUMBER(10,0) NOT NULL ENABLE)"},
+	} {
+		got, err := createDDL(ctx, tx, tc.Src, tc.Dst, "scott.emp", "X", false)
+		if err != nil {
+			t.Errorf("%s->%s: %+v", tc.Src.Name, tc.Dst.Name, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("%s->%s: got\n%s\nwanted\n%s", tc.Src.Name, tc.Dst.Name, got, tc.Want)
+		}
+	}
+}
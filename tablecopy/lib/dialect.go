@@ -0,0 +1,163 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	godror "github.com/godror/godror"
+)
+
+// Dialect describes the differences of the databases.
+type Dialect struct {
+	// Name of the dialect: oracle, postgres, mysql or sqlite.
+	Name string
+	// Placeholder returns the i-th (1-based) placeholder.
+	Placeholder func(i int) string
+	// Quote the identifier.
+	Quote func(string) string
+	// ArrayBind is true if the driver can execute an INSERT with slices as parameters (array DML).
+	// Otherwise multi-row INSERTs are used.
+	ArrayBind bool
+	// MaxParams is the maximum number of parameters in one statement.
+	MaxParams int
+	// AlreadyExists reports whether the error is "table already exists".
+	AlreadyExists func(error) bool
+}
+
+func (d Dialect) isOracle() bool { return d.Name == "oracle" }
+
+func quoteWith(q string) func(string) string {
+	return func(s string) string { return q + strings.ReplaceAll(s, q, q+q) + q }
+}
+
+var (
+	oracleDialect = Dialect{
+		Name:          "oracle",
+		Placeholder:   func(i int) string { return ":" + strconv.Itoa(i) },
+		Quote:         quoteWith(`"`),
+		ArrayBind:     true,
+		MaxParams:     65535,
+		AlreadyExists: func(err error) bool { return strings.Contains(err.Error(), "ORA-00955:") },
+	}
+	postgresDialect = Dialect{
+		Name:          "postgres",
+		Placeholder:   func(i int) string { return "$" + strconv.Itoa(i) },
+		Quote:         quoteWith(`"`),
+		MaxParams:     65535,
+		AlreadyExists: func(err error) bool { return strings.Contains(err.Error(), "42P07") },
+	}
+	mysqlDialect = Dialect{
+		Name:          "mysql",
+		Placeholder:   func(int) string { return "?" },
+		Quote:         quoteWith("`"),
+		MaxParams:     65535,
+		AlreadyExists: func(err error) bool { return strings.Contains(err.Error(), "1050") },
+	}
+	sqliteDialect = Dialect{
+		Name:          "sqlite",
+		Placeholder:   func(int) string { return "?" },
+		Quote:         quoteWith(`"`),
+		MaxParams:     32766,
+		AlreadyExists: func(err error) bool { return strings.Contains(err.Error(), "already exists") },
+	}
+)
+
+// DialectOf returns the dialect of the database/sql driver name.
+func DialectOf(driverName string) (Dialect, error) {
+	switch driverName {
+	case "godror", "oracle":
+		return oracleDialect, nil
+	case "pgx", "postgres":
+		return postgresDialect, nil
+	case "mysql":
+		return mysqlDialect, nil
+	case "sqlite", "sqlite3":
+		return sqliteDialect, nil
+	}
+	return Dialect{}, fmt.Errorf("unknown driver %q", driverName)
+}
+
+// Database is an opened database with its Dialect.
+type Database struct {
+	*sql.DB
+	Dialect
+	DSN string
+	// prep statements to run at the beginning of each transaction, for non-godror drivers.
+	prep []string
+}
+
+// OpenDatabase opens the database with the driver.
+// The prep statements (separated by ;\n) are run on each new connection (godror),
+// or at the beginning of each transaction (other drivers).
+//
+// The non-godror drivers must be linked in with build tags (pgx, mysql, sqlite).
+func OpenDatabase(driverName, dsn, prep string) (Database, error) {
+	d := Database{DSN: driverName + ":" + dsn}
+	var err error
+	if d.Dialect, err = DialectOf(driverName); err != nil {
+		return d, err
+	}
+	var qs []string
+	if prep != "" {
+		qs = strings.Split(prep, ";\n")
+	}
+	if !d.isOracle() {
+		if driverName == "postgres" {
+			driverName = "pgx"
+		}
+		if driverName == "sqlite" {
+			driverName = "sqlite3"
+		}
+		d.prep = qs
+		if d.DB, err = sql.Open(driverName, dsn); err != nil {
+			return d, fmt.Errorf("%s: %w", driverName, err)
+		}
+		return d, nil
+	}
+
+	P, err := godror.ParseDSN(dsn)
+	if err != nil {
+		return d, fmt.Errorf("%q: %w", dsn, err)
+	}
+	if len(qs) != 0 {
+		P.OnInit = func(ctx context.Context, conn driver.ConnPrepareContext) error {
+			for _, qry := range qs {
+				stmt, err := conn.PrepareContext(ctx, qry)
+				if err != nil {
+					return fmt.Errorf("%s: %w", qry, err)
+				}
+				_, err = stmt.(driver.StmtExecContext).ExecContext(ctx, nil)
+				stmt.Close()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	d.DB = sql.OpenDB(godror.NewConnector(P))
+	return d, nil
+}
+
+// BeginTx begins a transaction, running the prep statements.
+func (d Database) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, qry := range d.prep {
+		if _, err = tx.ExecContext(ctx, qry); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("%s: %w", qry, err)
+		}
+	}
+	return tx, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDialectOf(t *testing.T) {
+	for _, tc := range []struct {
+		Driver, Name, Placeholder, Quoted string
+		ArrayBind                         bool
+	}{
+		{"godror", "oracle", ":3", `"a""b"`, true},
+		{"oracle", "oracle", ":3", `"a""b"`, true},
+		{"pgx", "postgres", "$3", `"a""b"`, false},
+		{"postgres", "postgres", "$3", `"a""b"`, false},
+		{"mysql", "mysql", "?", "`a\"b`", false},
+		{"sqlite", "sqlite", "?", `"a""b"`, false},
+		{"sqlite3", "sqlite", "?", `"a""b"`, false},
+	} {
+		d, err := DialectOf(tc.Driver)
+		if err != nil {
+			t.Errorf("%s: %+v", tc.Driver, err)
+			continue
+		}
+		if d.Name != tc.Name || d.ArrayBind != tc.ArrayBind || d.MaxParams <= 0 {
+			t.Errorf("%s: got %s (array bind %t, max params %d), wanted %s (array bind %t)", tc.Driver, d.Name, d.ArrayBind, d.MaxParams, tc.Name, tc.ArrayBind)
+		}
+		if got := d.Placeholder(3); got != tc.Placeholder {
+			t.Errorf("%s: got placeholder %q, wanted %q", tc.Driver, got, tc.Placeholder)
+		}
+		if got := d.Quote(`a"b`); got != tc.Quoted {
+			t.Errorf("%s: got quoted %q, wanted %q", tc.Driver, got, tc.Quoted)
+		}
+	}
+	for driver, msg := range map[string]string{
+		"godror": "ORA-00955: name is already used by an existing object",
+		"pgx":    "ERROR: relation \"t\" already exists (SQLSTATE 42P07)",
+		"mysql":  "Error 1050 (42S01): Table 't' already exists",
+		"sqlite": "table t already exists",
+	} {
+		d, _ := DialectOf(driver)
+		if !d.AlreadyExists(errors.New(msg)) {
+			t.Errorf("%s: %q is not recognized as already exists", driver, msg)
+		}
+		if d.AlreadyExists(errors.New("syntax error")) {
+			t.Errorf("%s: syntax error is recognized as already exists", driver)
+		}
+	}
+	if _, err := DialectOf("sqlserver"); err == nil {
+		t.Error("wanted error for an unknown driver")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// justPrint prints the statements of the tasks, and the estimated row counts, without executing them.
+func justPrint(ctx context.Context, w io.Writer, srcTx *sql.Tx, srcDB, dstDB Database, tables []Task, cfg Config, fullDDL bool) error {
+	dstTx, err := dstDB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer dstTx.Rollback()
+	for _, task := range tables {
+		if task.Src == "" {
+			continue
+		}
+		if task.Dst == "" {
+			task.Dst = task.Src
+		}
+		fmt.Fprintf(w, "-- %s => %s\n", task.Src, task.Dst)
+		if !strings.EqualFold(task.Dst, task.Src) || dstDB.DSN != srcDB.DSN || task.Query != "" {
+			qry, err := createStatement(ctx, srcTx, srcDB, dstDB, task, fullDDL)
+			if err != nil {
+				return err
+			}
+			if qry != "" {
+				fmt.Fprintf(w, "%s;\n", qry)
+			}
+			if task.Truncate {
+				fmt.Fprintf(w, "TRUNCATE TABLE %s;\n", task.Dst)
+			}
+			if task.DeleteWhere != "" {
+				fmt.Fprintf(w, "DELETE FROM %s WHERE %s; -- %v\n", task.Dst, task.DeleteWhere, task.DeleteArgs)
+			}
+		}
+		_, srcQry, buildQry, err := copyQueries(ctx, dstTx, srcTx, task, cfg)
+		if err != nil {
+			// the destination table may not exist yet
+			fmt.Fprintf(w, "-- %v\n", err)
+		} else {
+			fmt.Fprintf(w, "%s; -- %v\n%s;\n", srcQry, task.Args, buildQry(1))
+		}
+		n, err := estimateRows(ctx, srcTx, srcDB.Dialect, task)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "-- rows: %d\n\n", n)
+	}
+	return nil
+}
+
+// estimateRows returns the number of rows to be copied:
+// by the optimizer statistics for a whole Oracle table, otherwise counted.
+func estimateRows(ctx context.Context, srcTx *sql.Tx, src Dialect, task Task) (int64, error) {
+	var n int64
+	if src.isOracle() && task.Where == "" && task.Query == "" {
+		owner, name := splitOwner(task.Src)
+		const qry = `SELECT num_rows FROM all_tables
+  WHERE num_rows IS NOT NULL AND table_name = :1 AND owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))`
+		err := srcTx.QueryRowContext(ctx, qry, name, owner).Scan(&n)
+		if err == nil {
+			return n, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return n, fmt.Errorf("%s: %w", qry, err)
+		}
+	}
+	// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+	qry := "SELECT COUNT(*) FROM " + task.from()
+	if task.Where != "" {
+		qry += " WHERE " + task.Where
+	}
+	if err := srcTx.QueryRowContext(ctx, qry, task.Args...).Scan(&n); err != nil {
+		return n, fmt.Errorf("%s: %w", qry, err)
+	}
+	return n, nil
+}
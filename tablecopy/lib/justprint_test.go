@@ -0,0 +1,68 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJustPrint(t *testing.T) {
+	src := &fakeConnector{Query: func(qry string, _ []driver.Value) (*fakeRows, error) {
+		if strings.HasPrefix(qry, "SELECT COUNT(*)") {
+			return rowsOf([]string{"n"}, []driver.Value{int64(42)}), nil
+		}
+		return rowsOf([]string{"ID", "NAME"}), nil
+	}}
+	dst := &fakeConnector{Query: func(qry string, _ []driver.Value) (*fakeRows, error) {
+		if strings.Contains(qry, " Y ") {
+			return nil, errors.New("no such table")
+		}
+		return rowsOf([]string{"id", "name"}), nil
+	}}
+	srcDB := Database{DB: sql.OpenDB(src), Dialect: sqliteDialect, DSN: "sqlite:src"}
+	defer srcDB.Close()
+	dstDB := Database{DB: sql.OpenDB(dst), Dialect: sqliteDialect, DSN: "sqlite:dst"}
+	defer dstDB.Close()
+	ctx := context.Background()
+	srcTx, err := srcDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srcTx.Rollback()
+
+	var buf strings.Builder
+	tasks := []Task{
+		{Src: "T", Dst: "X", Where: "ID > ?", Args: []interface{}{1}, Truncate: true},
+		{Src: "T", Dst: "Y"},
+	}
+	cfg := Config{Src: sqliteDialect, Dst: sqliteDialect}
+	if err = justPrint(ctx, &buf, srcTx, srcDB, dstDB, tasks, cfg, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `-- T => X
+CREATE TABLE X AS SELECT * FROM T WHERE 1=0;
+TRUNCATE TABLE X;
+SELECT "ID","NAME" FROM T WHERE ID > ?; -- [1]
+INSERT INTO X ("id","name") VALUES (?,?);
+-- rows: 42
+
+-- T => Y
+CREATE TABLE Y AS SELECT * FROM T WHERE 1=0;
+-- dest: SELECT * FROM Y WHERE 1=0: no such table
+-- rows: 42
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwanted\n%s", got, want)
+	}
+	if execs := append(src.Execs(), dst.Execs()...); len(execs) != 0 {
+		t.Errorf("executed %q", execs)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	godror "github.com/godror/godror"
+)
+
+// hasLOB reports whether any of the columns is a CLOB, NCLOB or BLOB.
+func hasLOB(types []*sql.ColumnType) bool {
+	for _, t := range types {
+		switch t.DatabaseTypeName() {
+		case "CLOB", "NCLOB", "BLOB":
+			return true
+		}
+	}
+	return false
+}
+
+// copyLOBRows copies the rows one by one, the LOBs (fetched with godror.LobAsReader) streamed into
+// the destination (if stream), or read into memory one row at a time.
+//
+// This is much slower than the array insert, but the memory usage is bounded,
+// as only one row's LOBs are held at a time.
+func copyLOBRows(ctx context.Context, dstTx *sql.Tx, rows *sql.Rows, nCols int, dstQry string, stream bool, keep func([]interface{}) (bool, error), masks []masker, conv *valueConverter, limiter *rowLimiter,
+	reject func(batchErr error, rows [][]interface{}, exec func(...interface{}) error) (int64, error), n *int64,
+) error {
+	stmt, err := dstTx.PrepareContext(ctx, dstQry)
+	if err != nil {
+		return fmt.Errorf("%s: %w", dstQry, err)
+	}
+	defer stmt.Close()
+	zlog.FromContext(ctx).Info("LOB copy row-by-row", "dst", dstQry)
+	values := make([]interface{}, nCols)
+	dest := make([]interface{}, nCols)
+	for i := range dest {
+		dest[i] = &values[i]
+	}
+	var row []interface{}
+	if keep != nil {
+		row = make([]interface{}, nCols)
+	}
+	for rows.Next() {
+		if err := limiter.Wait(ctx, 1); err != nil {
+			return err
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if keep != nil {
+			// the LOBs are not read for the filter
+			for i, v := range values {
+				if _, ok := v.(*godror.Lob); ok {
+					v = nil
+				}
+				row[i] = v
+			}
+			if ok, err := keep(row); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+		}
+		for i, v := range values {
+			values[i] = conv.Convert(v)
+		}
+		for i, m := range masks {
+			if m == nil {
+				continue
+			}
+			if L, ok := values[i].(*godror.Lob); ok {
+				b, err := io.ReadAll(L)
+				if err != nil {
+					return fmt.Errorf("read LOB: %w", err)
+				}
+				values[i] = string(b)
+			}
+			values[i] = m(values[i])
+		}
+		for i, v := range values {
+			L, ok := v.(*godror.Lob)
+			if !ok {
+				continue
+			}
+			if stream {
+				values[i] = *L
+				continue
+			}
+			b, err := io.ReadAll(L)
+			if err != nil {
+				return fmt.Errorf("read LOB: %w", err)
+			}
+			if L.IsClob {
+				values[i] = string(b)
+			} else {
+				values[i] = b
+			}
+		}
+		if reject == nil {
+			if _, err := stmt.ExecContext(ctx, values...); err != nil {
+				return fmt.Errorf("%s: %w", dstQry, err)
+			}
+			*n++
+			continue
+		}
+		if err := savepoint(ctx, dstTx, batchSavepoint); err != nil {
+			return err
+		}
+		if _, execErr := stmt.ExecContext(ctx, values...); execErr != nil {
+			// the streamed LOBs cannot be re-read: reject the row without retrying, with placeholders for the LOBs
+			if _, err := reject(execErr, [][]interface{}{lobPlaceholders(values)}, func(...interface{}) error { return execErr }); err != nil {
+				return err
+			}
+			continue
+		}
+		*n++
+	}
+	return rows.Err()
+}
+
+// lobPlaceholders returns a copy of the values with the streamed (already consumed) LOBs
+// replaced by a placeholder, for the rejected rows.
+func lobPlaceholders(values []interface{}) []interface{} {
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		if L, ok := v.(godror.Lob); ok {
+			if L.IsClob {
+				v = "<CLOB not read>"
+			} else {
+				v = "<BLOB not read>"
+			}
+		}
+		row[i] = v
+	}
+	return row
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	godror "github.com/godror/godror"
+)
+
+func TestRejectLOB(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "rejected.csv")
+	r, err := newRejecter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := []interface{}{int64(1), godror.Lob{IsClob: true}, godror.Lob{}}
+	if err = r.Reject("T", []string{"ID", "TXT", "BIN"}, lobPlaceholders(row), errors.New("ORA-12899")); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "TABLE,ERROR,ID,TXT,BIN\nT,ORA-12899,1,<CLOB not read>,<BLOB not read>\n"; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if _, ok := row[1].(godror.Lob); !ok {
+		t.Errorf("the values are changed: %v", row)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// masker replaces the value with a masked one.
+type masker func(interface{}) interface{}
+
+// parseMask parses the masking spec:
+//
+//	null           NULL
+//	fixed:VALUE    the fixed VALUE
+//	hash[:N]       the hex HMAC-SHA256 of the value with the key (its first N characters)
+//	pattern:PAT    PAT with # replaced by a digit, ? by a letter, * by a letter or digit,
+//	               derived from the HMAC of the value (the same value is always masked the same way)
+//
+// NULLs are kept as NULLs (except for fixed).
+//
+// Without a key, hash is the plain SHA-256 of the value, and pattern is derived from its FNV hash:
+// this is only pseudonymization, as the values of a small domain (such as the phone numbers)
+// can be recovered by hashing all of them.
+func parseMask(spec string, key []byte) (masker, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch strings.ToLower(kind) {
+	case "null":
+		return func(interface{}) interface{} { return nil }, nil
+	case "fixed":
+		return func(interface{}) interface{} { return arg }, nil
+	case "hash":
+		length := sha256.Size * 2
+		if arg != "" {
+			var err error
+			if length, err = strconv.Atoi(arg); err != nil || length <= 0 {
+				return nil, fmt.Errorf("%q: wanted hash:LENGTH", spec)
+			}
+		}
+		return func(v interface{}) interface{} {
+			s, ok := valueString(v)
+			if !ok {
+				return nil
+			}
+			h := hex.EncodeToString(maskSum(key, s))
+			if length < len(h) {
+				h = h[:length]
+			}
+			return h
+		}, nil
+	case "pattern":
+		if arg == "" {
+			return nil, fmt.Errorf("%q: wanted pattern:PATTERN", spec)
+		}
+		const (
+			digits  = "0123456789"
+			letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+		)
+		return func(v interface{}) interface{} {
+			s, ok := valueString(v)
+			if !ok {
+				return nil
+			}
+			var seed uint64
+			if key == nil {
+				h := fnv.New64a()
+				h.Write([]byte(s))
+				seed = h.Sum64()
+			} else {
+				seed = binary.BigEndian.Uint64(maskSum(key, s))
+			}
+			rnd := rand.New(rand.NewSource(int64(seed)))
+			var bld strings.Builder
+			for _, r := range arg {
+				switch r {
+				case '#':
+					bld.WriteByte(digits[rnd.Intn(len(digits))])
+				case '?':
+					bld.WriteByte(letters[rnd.Intn(len(letters))])
+				case '*':
+					bld.WriteByte((digits + letters)[rnd.Intn(len(digits)+len(letters))])
+				default:
+					bld.WriteRune(r)
+				}
+			}
+			return bld.String()
+		}, nil
+	}
+	return nil, fmt.Errorf("%q: unknown mask (null, fixed:VALUE, hash[:N], pattern:PAT)", spec)
+}
+
+// maskSum returns the HMAC-SHA256 of s with the key, the plain SHA-256 without key.
+func maskSum(key []byte, s string) []byte {
+	if key == nil {
+		sum := sha256.Sum256([]byte(s))
+		return sum[:]
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// valueString returns the string representation of the value, false for NULL.
+func valueString(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return x, true
+	case []byte:
+		return string(x), x != nil
+	case time.Time:
+		return x.Format(time.RFC3339Nano), !x.IsZero()
+	case driver.Valuer: // sql.NullString and the like
+		w, err := x.Value()
+		if err != nil || w == nil {
+			return "", false
+		}
+		return valueString(w)
+	}
+	return fmt.Sprintf("%v", v), true
+}
+
+// maskedString returns the masked value as a string, the empty string for NULL.
+func maskedString(m masker, v interface{}) string {
+	s, _ := valueString(m(v))
+	return s
+}
+
+// ParseMasks parses the COLUMN=SPEC masks into a map of the upper case columns to the specs.
+func ParseMasks(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	mask := make(map[string]string, len(specs))
+	for _, s := range specs {
+		k, spec, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("mask %q: wanted COLUMN=SPEC", s)
+		}
+		if _, err := parseMask(spec, nil); err != nil {
+			return nil, fmt.Errorf("mask %q: %w", s, err)
+		}
+		mask[strings.ToUpper(k)] = spec
+	}
+	return mask, nil
+}
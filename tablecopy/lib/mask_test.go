@@ -0,0 +1,121 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"database/sql"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseMask(t *testing.T) {
+	const abcSHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	for _, tc := range []struct {
+		Spec string
+		In   interface{}
+		Want interface{}
+	}{
+		{"null", "abc", nil},
+		{"NULL", 42, nil},
+		{"fixed:XXX", "abc", "XXX"},
+		{"fixed:XXX", nil, "XXX"},
+		{"fixed:", "abc", ""},
+		{"hash", "abc", abcSHA256},
+		{"hash", []byte("abc"), abcSHA256},
+		{"hash", sql.NullString{String: "abc", Valid: true}, abcSHA256},
+		{"hash:8", "abc", abcSHA256[:8]},
+		{"hash:100", "abc", abcSHA256},
+		{"hash", nil, nil},
+		{"hash", sql.NullString{}, nil},
+		{"hash", time.Time{}, nil},
+		{"pattern:###", nil, nil},
+	} {
+		m, err := parseMask(tc.Spec, nil)
+		if err != nil {
+			t.Errorf("%q: %+v", tc.Spec, err)
+			continue
+		}
+		if got := m(tc.In); got != tc.Want {
+			t.Errorf("%q: %#v: got %#v, wanted %#v", tc.Spec, tc.In, got, tc.Want)
+		}
+	}
+
+	m, err := parseMask("pattern:HU-##-??-**", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rPattern := regexp.MustCompile(`^HU-[0-9]{2}-[A-Z]{2}-[0-9A-Z]{2}$`)
+	a, b := m("alma"), m("körte")
+	for _, s := range []interface{}{a, b} {
+		if !rPattern.MatchString(s.(string)) {
+			t.Errorf("%q does not match the pattern", s)
+		}
+	}
+	if again := m("alma"); again != a {
+		t.Errorf("got %q for the same value, wanted %q", again, a)
+	}
+	if a == b {
+		t.Errorf("got the same %q for different values", a)
+	}
+
+	for _, spec := range []string{"", "blur", "hash:x", "hash:0", "pattern", "pattern:"} {
+		if _, err := parseMask(spec, nil); err == nil {
+			t.Errorf("%q: wanted error", spec)
+		}
+	}
+}
+
+func TestParseMaskKey(t *testing.T) {
+	// RFC 4231 test case 2
+	const want = "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	m, err := parseMask("hash", []byte("Jefe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m("what do ya want for nothing?"); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	const spec = "pattern:######"
+	plain, err := parseMask(spec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := parseMask(spec, []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parseMask(spec, []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a("alma") != a("alma") {
+		t.Errorf("got different masks for the same value and key")
+	}
+	if x, y, z := plain("alma"), a("alma"), b("alma"); x == y || y == z {
+		t.Errorf("got %q, %q, %q: wanted different masks with different keys", x, y, z)
+	}
+}
+
+func TestParseMasks(t *testing.T) {
+	got, err := ParseMasks([]string{"email=hash:12", "Tax_ID=pattern:########", "note=null"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"EMAIL": "hash:12", "TAX_ID": "pattern:########", "NOTE": "null"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	if got, err := ParseMasks(nil); err != nil || got != nil {
+		t.Errorf("got %v, %+v for no masks", got, err)
+	}
+	for _, specs := range [][]string{{"email"}, {"email=blur"}, {"a=null", "b=hash:-1"}} {
+		if _, err := ParseMasks(specs); err == nil {
+			t.Errorf("%q: wanted error", specs)
+		}
+	}
+}
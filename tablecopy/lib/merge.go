@@ -0,0 +1,83 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import "strings"
+
+// oracleMerge returns a MERGE statement of the values selected FROM from (DUAL for one array-bound row).
+func oracleMerge(table string, names, values, keys []string, from string) string {
+	var bld strings.Builder
+	bld.WriteString("MERGE INTO " + table + " D USING (SELECT ")
+	for i, nm := range names {
+		if i != 0 {
+			bld.WriteByte(',')
+		}
+		bld.WriteString(values[i] + " AS " + nm)
+	}
+	bld.WriteString(" FROM " + from + ") S ON (")
+	for i, k := range keys {
+		if i != 0 {
+			bld.WriteString(" AND ")
+		}
+		bld.WriteString("D." + k + "=S." + k)
+	}
+	bld.WriteByte(')')
+	if nonKeys := nonKeyColumns(names, keys); len(nonKeys) != 0 {
+		bld.WriteString(" WHEN MATCHED THEN UPDATE SET ")
+		for i, nm := range nonKeys {
+			if i != 0 {
+				bld.WriteByte(',')
+			}
+			bld.WriteString("D." + nm + "=S." + nm)
+		}
+	}
+	bld.WriteString(" WHEN NOT MATCHED THEN INSERT (" + strings.Join(names, ",") + ") VALUES (")
+	for i, nm := range names {
+		if i != 0 {
+			bld.WriteByte(',')
+		}
+		bld.WriteString("S." + nm)
+	}
+	bld.WriteByte(')')
+	return bld.String()
+}
+
+// upsertSuffix returns the ON CONFLICT / ON DUPLICATE KEY clause of the multi-row INSERT.
+func upsertSuffix(d Dialect, names, keys []string) string {
+	nonKeys := nonKeyColumns(names, keys)
+	if d.Name == "mysql" {
+		if len(nonKeys) == 0 {
+			nonKeys = keys[:1]
+		}
+		sets := make([]string, len(nonKeys))
+		for i, nm := range nonKeys {
+			sets[i] = nm + "=VALUES(" + nm + ")"
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+	}
+	suffix := " ON CONFLICT (" + strings.Join(keys, ",") + ") DO "
+	if len(nonKeys) == 0 {
+		return suffix + "NOTHING"
+	}
+	sets := make([]string, len(nonKeys))
+	for i, nm := range nonKeys {
+		sets[i] = nm + "=EXCLUDED." + nm
+	}
+	return suffix + "UPDATE SET " + strings.Join(sets, ",")
+}
+
+func nonKeyColumns(names, keys []string) []string {
+	nonKeys := make([]string, 0, len(names))
+Names:
+	for _, nm := range names {
+		for _, k := range keys {
+			if k == nm {
+				continue Names
+			}
+		}
+		nonKeys = append(nonKeys, nm)
+	}
+	return nonKeys
+}
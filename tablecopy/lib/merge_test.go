@@ -0,0 +1,48 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import "testing"
+
+func TestOracleMerge(t *testing.T) {
+	for _, tc := range []struct {
+		Names, Values, Keys []string
+		From, Want          string
+	}{
+		{[]string{"ID", "NAME", "AMOUNT"}, []string{":1", ":2", ":3"}, []string{"ID"}, "DUAL",
+			"MERGE INTO T D USING (SELECT :1 AS ID,:2 AS NAME,:3 AS AMOUNT FROM DUAL) S ON (D.ID=S.ID)" +
+				" WHEN MATCHED THEN UPDATE SET D.NAME=S.NAME,D.AMOUNT=S.AMOUNT" +
+				" WHEN NOT MATCHED THEN INSERT (ID,NAME,AMOUNT) VALUES (S.ID,S.NAME,S.AMOUNT)"},
+		{[]string{"A", "B", "C"}, []string{"A", "B", "C"}, []string{"A", "B"}, "src@link",
+			"MERGE INTO T D USING (SELECT A AS A,B AS B,C AS C FROM src@link) S ON (D.A=S.A AND D.B=S.B)" +
+				" WHEN MATCHED THEN UPDATE SET D.C=S.C" +
+				" WHEN NOT MATCHED THEN INSERT (A,B,C) VALUES (S.A,S.B,S.C)"},
+		{[]string{"ID"}, []string{":1"}, []string{"ID"}, "DUAL",
+			"MERGE INTO T D USING (SELECT :1 AS ID FROM DUAL) S ON (D.ID=S.ID)" +
+				" WHEN NOT MATCHED THEN INSERT (ID) VALUES (S.ID)"},
+	} {
+		if got := oracleMerge("T", tc.Names, tc.Values, tc.Keys, tc.From); got != tc.Want {
+			t.Errorf("%q/%q: got\n%s\nwanted\n%s", tc.Names, tc.Keys, got, tc.Want)
+		}
+	}
+}
+
+func TestUpsertSuffix(t *testing.T) {
+	for _, tc := range []struct {
+		Dialect     Dialect
+		Names, Keys []string
+		Want        string
+	}{
+		{postgresDialect, []string{"ID", "NAME", "AMOUNT"}, []string{"ID"}, " ON CONFLICT (ID) DO UPDATE SET NAME=EXCLUDED.NAME,AMOUNT=EXCLUDED.AMOUNT"},
+		{sqliteDialect, []string{"A", "B", "C"}, []string{"A", "B"}, " ON CONFLICT (A,B) DO UPDATE SET C=EXCLUDED.C"},
+		{postgresDialect, []string{"ID"}, []string{"ID"}, " ON CONFLICT (ID) DO NOTHING"},
+		{mysqlDialect, []string{"ID", "NAME"}, []string{"ID"}, " ON DUPLICATE KEY UPDATE NAME=VALUES(NAME)"},
+		{mysqlDialect, []string{"A", "B"}, []string{"A", "B"}, " ON DUPLICATE KEY UPDATE A=VALUES(A)"},
+	} {
+		if got := upsertSuffix(tc.Dialect, tc.Names, tc.Keys); got != tc.Want {
+			t.Errorf("%s %q/%q: got\n%q\nwanted\n%q", tc.Dialect.Name, tc.Names, tc.Keys, got, tc.Want)
+		}
+	}
+}
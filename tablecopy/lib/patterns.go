@@ -0,0 +1,148 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+// tablePattern matches the table names of an owner.
+type tablePattern struct {
+	Owner string
+	Re    *regexp.Regexp
+}
+
+// parseTablePattern parses the [OWNER.]LIKE_PATTERN (with %) or [OWNER.]/REGEXP/ spec.
+// Returns false if spec is a plain table name.
+func parseTablePattern(spec string) (tablePattern, bool, error) {
+	var tp tablePattern
+	name := spec
+	if i := strings.IndexByte(spec, '.'); i >= 0 && !strings.HasPrefix(spec, "/") {
+		tp.Owner, name = strings.ToUpper(spec[:i]), spec[i+1:]
+	}
+	var expr string
+	if len(name) > 2 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/") {
+		expr = name[1 : len(name)-1]
+	} else if strings.Contains(name, "%") {
+		var bld strings.Builder
+		bld.WriteString("(?i)^")
+		for _, r := range name {
+			switch r {
+			case '%':
+				bld.WriteString(".*")
+			case '_':
+				bld.WriteByte('.')
+			default:
+				bld.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		bld.WriteByte('$')
+		expr = bld.String()
+	} else {
+		return tp, false, nil
+	}
+	var err error
+	if tp.Re, err = regexp.Compile(expr); err != nil {
+		return tp, true, fmt.Errorf("%q: %w", spec, err)
+	}
+	return tp, true, nil
+}
+
+// listTables returns the tables of the owner (the current schema if empty).
+func listTables(ctx context.Context, srcTx *sql.Tx, d Dialect, owner string) ([]string, error) {
+	var qry string
+	switch d.Name {
+	case "oracle":
+		qry = "SELECT table_name FROM all_tables WHERE owner = NVL(:1, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA')) ORDER BY 1"
+	case "postgres":
+		qry = "SELECT table_name FROM information_schema.tables WHERE table_schema = COALESCE(LOWER($1::text), current_schema()) ORDER BY 1"
+	case "mysql":
+		qry = "SELECT table_name FROM information_schema.tables WHERE table_schema = COALESCE(?, DATABASE()) ORDER BY 1"
+	default:
+		return queryStrings(ctx, srcTx, "SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY 1")
+	}
+	return queryStrings(ctx, srcTx, qry, sql.NullString{String: owner, Valid: owner != ""})
+}
+
+// expandTasks replaces the tasks with table patterns with the tasks of the matching tables of the source,
+// except the excluded ones (names or patterns).
+//
+// A "%" in the destination name is replaced with the source table name.
+func expandTasks(ctx context.Context, srcTx *sql.Tx, d Dialect, tasks []Task, exclude []string) ([]Task, error) {
+	var excludes []tablePattern
+	excluded := make(map[string]bool)
+	for _, e := range exclude {
+		tp, ok, err := parseTablePattern(e)
+		if err != nil {
+			return tasks, err
+		}
+		if ok {
+			excludes = append(excludes, tp)
+		} else {
+			excluded[strings.ToUpper(e)] = true
+		}
+	}
+	isExcluded := func(owner, name string) bool {
+		full := name
+		if owner != "" {
+			full = owner + "." + name
+		}
+		if excluded[strings.ToUpper(full)] || excluded[strings.ToUpper(name)] {
+			return true
+		}
+		for _, tp := range excludes {
+			if tp.Owner == owner && tp.Re.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	tables := make(map[string][]string)
+	expanded := make([]Task, 0, len(tasks))
+	for _, task := range tasks {
+		if task.Query != "" {
+			expanded = append(expanded, task)
+			continue
+		}
+		tp, ok, err := parseTablePattern(task.Src)
+		if err != nil {
+			return tasks, err
+		}
+		if !ok {
+			expanded = append(expanded, task)
+			continue
+		}
+		names, ok := tables[tp.Owner]
+		if !ok {
+			if names, err = listTables(ctx, srcTx, d, tp.Owner); err != nil {
+				return tasks, err
+			}
+			tables[tp.Owner] = names
+		}
+		var n int
+		for _, name := range names {
+			if !tp.Re.MatchString(name) || isExcluded(tp.Owner, name) {
+				continue
+			}
+			t := task
+			t.Src = name
+			if tp.Owner != "" {
+				t.Src = tp.Owner + "." + name
+			}
+			t.Dst = strings.ReplaceAll(task.Dst, "%", name)
+			expanded = append(expanded, t)
+			n++
+		}
+		zlog.FromContext(ctx).Info("expand", "pattern", task.Src, "tables", n)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestParseTablePattern(t *testing.T) {
+	for _, tc := range []struct {
+		Spec, Owner     string
+		IsPattern       bool
+		Match, NotMatch []string
+	}{
+		{Spec: "EMP"},
+		{Spec: "scott.EMP"},
+		{Spec: "scott.EMP%", Owner: "SCOTT", IsPattern: true, Match: []string{"EMP", "EMPLOYEES", "emp_hist"}, NotMatch: []string{"XEMP"}},
+		{Spec: "A_B%", IsPattern: true, Match: []string{"AXB", "A_B1"}, NotMatch: []string{"AB", "XAXB"}},
+		{Spec: "%.x", IsPattern: false},
+		{Spec: "/^T_[0-9]+$/", IsPattern: true, Match: []string{"T_1", "T_42"}, NotMatch: []string{"T_X", "t_1"}},
+		{Spec: "hr./^JOB/", Owner: "HR", IsPattern: true, Match: []string{"JOBS", "JOB_HISTORY"}, NotMatch: []string{"EMP_JOB"}},
+	} {
+		tp, ok, err := parseTablePattern(tc.Spec)
+		if err != nil {
+			t.Errorf("%q: %+v", tc.Spec, err)
+			continue
+		}
+		if ok != tc.IsPattern {
+			t.Errorf("%q: got pattern %t, wanted %t", tc.Spec, ok, tc.IsPattern)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if tp.Owner != tc.Owner {
+			t.Errorf("%q: got owner %q, wanted %q", tc.Spec, tp.Owner, tc.Owner)
+		}
+		for _, s := range tc.Match {
+			if !tp.Re.MatchString(s) {
+				t.Errorf("%q: %q does not match", tc.Spec, s)
+			}
+		}
+		for _, s := range tc.NotMatch {
+			if tp.Re.MatchString(s) {
+				t.Errorf("%q: %q matches", tc.Spec, s)
+			}
+		}
+	}
+	if _, _, err := parseTablePattern("/[/"); err == nil {
+		t.Error("wanted error for an invalid regexp")
+	}
+}
+
+func TestExpandTasks(t *testing.T) {
+	var queries int
+	fake := &fakeConnector{Query: func(string, []driver.Value) (*fakeRows, error) {
+		queries++
+		return stringRows("DEPT", "EMP", "EMP_HIST", "EMPLOYEES"), nil
+	}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	for _, tc := range []struct {
+		Name    string
+		Tasks   []Task
+		Exclude []string
+		Want    []Task
+	}{
+		{Name: "plain",
+			Tasks: []Task{{Src: "EMP", Dst: "X"}, {Src: "q", Query: "SELECT 1 FROM DUAL"}},
+			Want:  []Task{{Src: "EMP", Dst: "X"}, {Src: "q", Query: "SELECT 1 FROM DUAL"}},
+		},
+		{Name: "like",
+			Tasks: []Task{{Src: "EMP%", Dst: "ARCH_%"}, {Src: "DEPT"}},
+			Want:  []Task{{Src: "EMP", Dst: "ARCH_EMP"}, {Src: "EMP_HIST", Dst: "ARCH_EMP_HIST"}, {Src: "EMPLOYEES", Dst: "ARCH_EMPLOYEES"}, {Src: "DEPT"}},
+		},
+		{Name: "exclude",
+			Tasks:   []Task{{Src: "%", Dst: "%"}},
+			Exclude: []string{"emp_hist", "/^EMPL/"},
+			Want:    []Task{{Src: "DEPT", Dst: "DEPT"}, {Src: "EMP", Dst: "EMP"}},
+		},
+		{Name: "owner",
+			Tasks:   []Task{{Src: "scott./^D/", Dst: "%"}, {Src: "scott.E%", Dst: "%"}},
+			Exclude: []string{"SCOTT.EMP"},
+			Want:    []Task{{Src: "SCOTT.DEPT", Dst: "DEPT"}, {Src: "SCOTT.EMP_HIST", Dst: "EMP_HIST"}, {Src: "SCOTT.EMPLOYEES", Dst: "EMPLOYEES"}},
+		},
+	} {
+		queries = 0
+		got, err := expandTasks(ctx, tx, sqliteDialect, tc.Tasks, tc.Exclude)
+		if err != nil {
+			t.Errorf("%s: %+v", tc.Name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%s: got\n%+v\nwanted\n%+v", tc.Name, got, tc.Want)
+		}
+		if queries > 1 {
+			t.Errorf("%s: the tables are listed %d times", tc.Name, queries)
+		}
+	}
+	if _, err := expandTasks(ctx, tx, sqliteDialect, []Task{{Src: "/(/"}}, nil); err == nil {
+		t.Error("wanted error for an invalid pattern")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+// PostCopy selects what to replicate after the data copy.
+type PostCopy struct {
+	Indexes, Comments, Grants bool
+}
+
+func (pc PostCopy) any() bool { return pc.Indexes || pc.Comments || pc.Grants }
+
+// postCopyStatements returns the statements which replicate the indexes, comments and grants
+// of the (Oracle) source table onto the destination table.
+func postCopyStatements(ctx context.Context, srcTx *sql.Tx, src, dst Dialect, srcTable, dstTable string, sameDB bool, pc PostCopy) ([]string, error) {
+	if !src.isOracle() {
+		return nil, fmt.Errorf("copying indexes, comments and grants needs an Oracle source, not %s", src.Name)
+	}
+	owner, name := splitOwner(srcTable)
+	var stmts []string
+	query := func(qry string, scan func(*sql.Rows) error) error {
+		rows, err := srcTx.QueryContext(ctx, qry, name, owner)
+		if err != nil {
+			return fmt.Errorf("%s: %w", qry, err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				return fmt.Errorf("%s: %w", qry, err)
+			}
+		}
+		return rows.Err()
+	}
+	quoteString := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+
+	if pc.Indexes {
+		// the indexes of the constraints are created with the constraints
+		const qry = `SELECT A.index_name, A.uniqueness, B.column_name, B.descend
+  FROM all_ind_columns B, all_indexes A
+  WHERE B.index_owner = A.owner AND B.index_name = A.index_name AND
+        A.table_name = :1 AND A.table_owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA')) AND
+        A.index_type IN ('NORMAL', 'BITMAP') AND
+        NOT EXISTS (SELECT 1 FROM all_constraints C WHERE C.owner = A.table_owner AND C.index_name = A.index_name)
+  ORDER BY A.index_name, B.column_position`
+		type index struct {
+			Name, Uniqueness string
+			Columns          []string
+		}
+		var indexes []index
+		if err := query(qry, func(rows *sql.Rows) error {
+			var ixName, uniq, col, desc string
+			if err := rows.Scan(&ixName, &uniq, &col, &desc); err != nil {
+				return err
+			}
+			if desc == "DESC" {
+				col = dst.Quote(col) + " DESC"
+			} else {
+				col = dst.Quote(col)
+			}
+			if len(indexes) == 0 || indexes[len(indexes)-1].Name != ixName {
+				indexes = append(indexes, index{Name: ixName, Uniqueness: uniq})
+			}
+			ix := &indexes[len(indexes)-1]
+			ix.Columns = append(ix.Columns, col)
+			return nil
+		}); err != nil {
+			return stmts, err
+		}
+		for _, ix := range indexes {
+			ixName := ix.Name
+			if sameDB { // avoid the name collision
+				ixName = "C_" + ixName
+				if len(ixName) > 128 {
+					ixName = ixName[:128]
+				}
+			}
+			unique := ""
+			if ix.Uniqueness == "UNIQUE" {
+				unique = "UNIQUE "
+			}
+			stmts = append(stmts, "CREATE "+unique+"INDEX "+dst.Quote(ixName)+" ON "+dstTable+
+				" ("+strings.Join(ix.Columns, ",")+")")
+		}
+	}
+
+	if pc.Comments {
+		if !(dst.isOracle() || dst.Name == "postgres") {
+			zlog.FromContext(ctx).Info("comments are not supported", "dialect", dst.Name)
+		} else {
+			const tabQry = `SELECT comments FROM all_tab_comments
+  WHERE comments IS NOT NULL AND table_name = :1 AND owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))`
+			if err := query(tabQry, func(rows *sql.Rows) error {
+				var comment string
+				if err := rows.Scan(&comment); err != nil {
+					return err
+				}
+				stmts = append(stmts, "COMMENT ON TABLE "+dstTable+" IS "+quoteString(comment))
+				return nil
+			}); err != nil {
+				return stmts, err
+			}
+			const colQry = `SELECT column_name, comments FROM all_col_comments
+  WHERE comments IS NOT NULL AND table_name = :1 AND owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))`
+			if err := query(colQry, func(rows *sql.Rows) error {
+				var col, comment string
+				if err := rows.Scan(&col, &comment); err != nil {
+					return err
+				}
+				stmts = append(stmts, "COMMENT ON COLUMN "+dstTable+"."+dst.Quote(col)+" IS "+quoteString(comment))
+				return nil
+			}); err != nil {
+				return stmts, err
+			}
+		}
+	}
+
+	if pc.Grants {
+		const qry = `SELECT privilege, grantee, grantable FROM all_tab_privs
+  WHERE table_name = :1 AND table_schema = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))
+  ORDER BY grantee, privilege`
+		if err := query(qry, func(rows *sql.Rows) error {
+			var priv, grantee, grantable string
+			if err := rows.Scan(&priv, &grantee, &grantable); err != nil {
+				return err
+			}
+			qry := "GRANT " + priv + " ON " + dstTable + " TO " + dst.Quote(grantee)
+			if grantable == "YES" {
+				qry += " WITH GRANT OPTION"
+			}
+			stmts = append(stmts, qry)
+			return nil
+		}); err != nil {
+			return stmts, err
+		}
+	}
+	return stmts, nil
+}
+
+// execPostCopy executes the statements, continuing after the failed ones.
+func execPostCopy(ctx context.Context, db *sql.DB, stmts []string) error {
+	var errs []error
+	for _, qry := range stmts {
+		zlog.FromContext(ctx).Info("post-copy", "qry", qry)
+		if _, err := db.ExecContext(ctx, qry); err != nil {
+			zlog.FromContext(ctx).Error(err, "post-copy", "qry", qry)
+			errs = append(errs, fmt.Errorf("%s: %w", qry, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rowLimiter limits the rate of the rows, shared by all the workers.
+// A nil *rowLimiter does not limit.
+type rowLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+	per  time.Duration // the time of one row
+}
+
+func newRowLimiter(rowsPerSec float64) *rowLimiter {
+	if rowsPerSec <= 0 {
+		return nil
+	}
+	return &rowLimiter{per: time.Duration(float64(time.Second) / rowsPerSec)}
+}
+
+// Wait until the n rows are allowed.
+func (L *rowLimiter) Wait(ctx context.Context, n int) error {
+	if L == nil || n <= 0 {
+		return nil
+	}
+	L.mu.Lock()
+	now := time.Now()
+	if L.next.Before(now) {
+		L.next = now
+	}
+	at := L.next
+	L.next = L.next.Add(time.Duration(n) * L.per)
+	L.mu.Unlock()
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
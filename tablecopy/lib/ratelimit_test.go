@@ -0,0 +1,50 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRowLimiter(t *testing.T) {
+	ctx := context.Background()
+	for _, rate := range []float64{0, -1} {
+		if L := newRowLimiter(rate); L != nil {
+			t.Errorf("%f: got %v, wanted no limit", rate, L)
+		}
+	}
+	var nilLimiter *rowLimiter
+	if err := nilLimiter.Wait(ctx, 1000); err != nil {
+		t.Errorf("nil limiter: %+v", err)
+	}
+
+	L := newRowLimiter(1000)
+	if L.per != time.Millisecond {
+		t.Errorf("got %s per row, wanted 1ms", L.per)
+	}
+	start := time.Now()
+	for _, n := range []int{0, 20, 20, 20} {
+		if err := L.Wait(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first 40 rows are allowed at once, the next 20 after them
+	if d := time.Since(start); d < 35*time.Millisecond || d > time.Second {
+		t.Errorf("60 rows at 1000 rows/s took %s", d)
+	}
+
+	L = newRowLimiter(1)
+	if err := L.Wait(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := L.Wait(cctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %+v, wanted context.Canceled", err)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+const batchSavepoint = "tablecopy_batch"
+
+// rejecter writes the rows which could not be inserted into a CSV file:
+// before the first row of a table, a TABLE,ERROR,columns... header,
+// then the table,error,values... of each rejected row.
+type rejecter struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *csv.Writer
+	counts map[string]int64
+}
+
+func newRejecter(fileName string) (*rejecter, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &rejecter{f: f, w: csv.NewWriter(f), counts: make(map[string]int64)}, nil
+}
+
+// Reject writes the row.
+func (r *rejecter) Reject(table string, cols []string, row []interface{}, rowErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.counts[table]; !ok {
+		if err := r.w.Write(append([]string{"TABLE", "ERROR"}, cols...)); err != nil {
+			return err
+		}
+	}
+	r.counts[table]++
+	rec := make([]string, 0, 2+len(row))
+	rec = append(rec, table, rowErr.Error())
+	for _, v := range row {
+		s, _ := valueString(v)
+		rec = append(rec, s)
+	}
+	if err := r.w.Write(rec); err != nil {
+		return err
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
+
+// Count returns the number of rejected rows of the table.
+func (r *rejecter) Count(table string) int64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[table]
+}
+
+// LogSummary logs the rejected rows' counts.
+func (r *rejecter) LogSummary(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tables := make([]string, 0, len(r.counts))
+	var total int64
+	for t, n := range r.counts {
+		tables = append(tables, t)
+		total += n
+	}
+	sort.Strings(tables)
+	for _, t := range tables {
+		zlog.FromContext(ctx).Info("rejected", "table", t, "rows", r.counts[t])
+	}
+	zlog.FromContext(ctx).Info("rejected", "total", total, "file", r.f.Name())
+}
+
+func (r *rejecter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Flush()
+	err := r.w.Error()
+	if closeErr := r.f.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// savepoint sets the savepoint in the transaction.
+func savepoint(ctx context.Context, tx *sql.Tx, name string) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("SAVEPOINT %s: %w", name, err)
+	}
+	return nil
+}
+
+// rollbackTo rolls back the transaction to the savepoint.
+func rollbackTo(ctx context.Context, tx *sql.Tx, name string) error {
+	if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("ROLLBACK TO SAVEPOINT %s: %w", name, err)
+	}
+	return nil
+}
+
+// retryRows rolls back the failed batch (to batchSavepoint) and inserts its rows one by one
+// with exec, rejecting the failing ones. Returns the number of inserted rows.
+//
+// Oracle rolls back only the failed statement, the others need a savepoint for each row.
+func (r *rejecter) retryRows(ctx context.Context, tx *sql.Tx, d Dialect, table string, cols []string,
+	batchErr error, rows [][]interface{}, exec func(...interface{}) error,
+) (int64, error) {
+	if len(rows) > 1 {
+		zlog.FromContext(ctx).Info("batch failed, retrying row-by-row", "table", table, "rows", len(rows), "error", batchErr)
+	}
+	if err := rollbackTo(ctx, tx, batchSavepoint); err != nil {
+		return 0, err
+	}
+	const rowSavepoint = "tablecopy_row"
+	var n int64
+	for _, row := range rows {
+		if !d.isOracle() {
+			if err := savepoint(ctx, tx, rowSavepoint); err != nil {
+				return n, err
+			}
+		}
+		err := exec(row...)
+		if err == nil {
+			n++
+			continue
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return n, ctxErr
+		}
+		if !d.isOracle() {
+			if err := rollbackTo(ctx, tx, rowSavepoint); err != nil {
+				return n, err
+			}
+		}
+		if err := r.Reject(table, cols, row, err); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
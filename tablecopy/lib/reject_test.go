@@ -0,0 +1,74 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRetryRows(t *testing.T) {
+	const insQry = "INSERT INTO T (ID,NAME) VALUES (?,?)"
+	ctx := context.Background()
+	for _, tc := range []struct {
+		Dialect Dialect
+		Execs   []string
+	}{
+		{oracleDialect, []string{"ROLLBACK TO SAVEPOINT tablecopy_batch", insQry, insQry, insQry}},
+		{sqliteDialect, []string{"ROLLBACK TO SAVEPOINT tablecopy_batch",
+			"SAVEPOINT tablecopy_row", insQry,
+			"SAVEPOINT tablecopy_row", insQry, "ROLLBACK TO SAVEPOINT tablecopy_row",
+			"SAVEPOINT tablecopy_row", insQry,
+		}},
+	} {
+		fake := &fakeConnector{Exec: func(qry string, args []driver.Value) error {
+			if qry == insQry && args[0] == int64(2) {
+				return errors.New("unique constraint violated")
+			}
+			return nil
+		}}
+		db := sql.OpenDB(fake)
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := filepath.Join(t.TempDir(), "rejected.csv")
+		r, err := newRejecter(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := [][]interface{}{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}}
+		n, err := r.retryRows(ctx, tx, tc.Dialect, "T", []string{"ID", "NAME"}, errors.New("batch failed"), rows,
+			func(args ...interface{}) error { _, err := tx.ExecContext(ctx, insQry, args...); return err })
+		tx.Rollback()
+		db.Close()
+		if closeErr := r.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			t.Errorf("%s: %+v", tc.Dialect.Name, err)
+			continue
+		}
+		if n != 2 || r.Count("T") != 1 {
+			t.Errorf("%s: got %d inserted, %d rejected, wanted 2, 1", tc.Dialect.Name, n, r.Count("T"))
+		}
+		if got := fake.Execs(); !reflect.DeepEqual(got, tc.Execs) {
+			t.Errorf("%s: got\n%q\nwanted\n%q", tc.Dialect.Name, got, tc.Execs)
+		}
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), "TABLE,ERROR,ID,NAME\nT,unique constraint violated,2,b\n"; got != want {
+			t.Errorf("%s: got %q, wanted %q", tc.Dialect.Name, got, want)
+		}
+	}
+}
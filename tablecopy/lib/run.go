@@ -0,0 +1,460 @@
+// Copyright 2021, 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/UNO-SOFT/dbcsv/tracing"
+)
+
+// Options of Run.
+type Options struct {
+	// JustPrint writes the statements and the estimated row counts here, without executing them.
+	JustPrint io.Writer
+	// Defaults is the template of the tasks listed from Schema.
+	Defaults Task
+	// Schema lists all the tables of this schema of the source (parents first, by the foreign keys) as tasks.
+	Schema string
+	// Since is the incremental copy's condition with the last copied value, as "MODIFIED_AT > :last".
+	Since string
+	// State is the file storing the last copied values for Since.
+	State string
+	// Status is the file storing the per-table status (pending/done/failed):
+	// each table is committed separately and the failures don't stop the others.
+	Status string
+	// Reject is the CSV file of the rows failed to be inserted: the copy continues (each table is committed separately).
+	Reject string
+	// ViaDBLink copies server-side, through this database link of the (Oracle) destination.
+	ViaDBLink string
+	// SrcTZ and DstTZ are the time zones of the source's and the destination's DATE/TIMESTAMP values.
+	SrcTZ, DstTZ string
+	// Recode is the FROM:TO character sets of the strings.
+	Recode string
+	// Exclude these tables (names, LIKE patterns or /REGEXP/) from the expanded table patterns.
+	Exclude []string
+	// VerifyColumns are the columns of the checksum of Verify.
+	VerifyColumns []string
+	// Split configures the splitting of the large tables.
+	Split SplitConfig
+	// PostCopy selects what to replicate after the copy.
+	PostCopy PostCopy
+	// TableTimeout is the timeout of each table (if the task has no Timeout).
+	TableTimeout time.Duration
+	// MaskKey is the secret key of the hash and pattern masks: without it they are only pseudonymization.
+	MaskKey []byte
+	// BatchMemory tunes the batch size to this memory budget, in bytes, measuring the first copied rows.
+	BatchMemory int64
+	// MaxRowsPerSec limits the copied rows per second, over all the tables.
+	MaxRowsPerSec float64
+	// Concurrency is the number of tables copied concurrently.
+	Concurrency int
+	BatchSize   int
+	// CreateDDL creates the destination tables with full DDL, not CREATE TABLE AS SELECT.
+	CreateDDL bool
+	// CopySequences creates (or restarts) the sequences of the tables above the copied maximum.
+	CopySequences bool
+	// Resume copies only the not done tables of Status.
+	Resume bool
+	// Verify compares the source and destination row counts after the copy.
+	Verify bool
+	// DisableFKs disables the foreign keys of the (Oracle) destination tables during the copy.
+	DisableFKs bool
+}
+
+// Run copies the tables from srcDB to dstDB: creates the destination tables, copies the rows
+// concurrently, then verifies and replicates the indexes, comments, grants and sequences, as opts says.
+//
+// The logger is taken from the context (zlog.FromContext).
+func Run(ctx context.Context, srcDB, dstDB Database, tables []Task, opts Options) error {
+	logger := zlog.FromContext(ctx)
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.TableTimeout <= 0 {
+		opts.TableTimeout = time.Hour
+	}
+	conv, err := newValueConverter(opts.SrcTZ, opts.DstTZ, opts.Recode)
+	if err != nil {
+		return err
+	}
+
+	var sinceCol string
+	var watermarks *watermarkState
+	newWatermarks := make(map[string]watermark)
+	var newWatermarksMu sync.Mutex
+	if opts.Since != "" {
+		if sinceCol, err = sinceColumn(opts.Since); err != nil {
+			return err
+		}
+		if watermarks, err = loadWatermarks(opts.State); err != nil {
+			return err
+		}
+	}
+
+	grp, subCtx := errgroup.WithContext(ctx)
+	concLimit := make(chan struct{}, opts.Concurrency)
+	srcTx, err := srcDB.BeginTx(subCtx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		logger.Error(err, "[WARN] Read-Only transaction")
+		if srcTx, err = srcDB.BeginTx(subCtx, nil); err != nil {
+			return fmt.Errorf("%s: %w", "beginTx", err)
+		}
+	}
+	defer srcTx.Rollback()
+
+	if opts.Schema != "" {
+		if tables, err = schemaTasks(subCtx, srcTx, srcDB.Dialect, opts.Schema, opts.Defaults); err != nil {
+			return err
+		}
+	}
+	if tables, err = expandTasks(subCtx, srcTx, srcDB.Dialect, tables, opts.Exclude); err != nil {
+		return err
+	}
+
+	var status *copyStatus
+	if opts.Status != "" {
+		if status, err = loadStatus(opts.Status); err != nil {
+			return err
+		}
+		todo := tables[:0]
+		for _, task := range tables {
+			if task.Src == "" {
+				continue
+			}
+			if opts.Resume && status.Get(task.key()).Status == statusDone {
+				logger.Info("already done", "src", task.Src, "dst", task.Dst)
+				continue
+			}
+			if err = status.Set(task.key(), tableStatus{Status: statusPending}); err != nil {
+				return fmt.Errorf("save %q: %w", opts.Status, err)
+			}
+			todo = append(todo, task)
+		}
+		tables = todo
+	} else if opts.Resume {
+		return errors.New("resume needs status")
+	}
+
+	if opts.MaskKey == nil {
+		for _, task := range tables {
+			for k, spec := range task.Mask {
+				if kind, _, _ := strings.Cut(strings.ToLower(spec), ":"); kind == "hash" || kind == "pattern" {
+					zlog.FromContext(ctx).Warn("masking without key is only pseudonymization", "table", task.Src, "column", k, "mask", spec)
+				}
+			}
+		}
+	}
+
+	if opts.JustPrint != nil {
+		cfg := Config{Src: srcDB.Dialect, Dst: dstDB.Dialect, BatchSize: opts.BatchSize, MaskKey: opts.MaskKey}
+		return justPrint(ctx, opts.JustPrint, srcTx, srcDB, dstDB, tables, cfg, opts.CreateDDL)
+	}
+
+	dstTx, err := dstDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer dstTx.Rollback()
+
+	for _, task := range tables {
+		if task.Src == "" {
+			continue
+		}
+		if task.Dst == "" {
+			task.Dst = task.Src
+		}
+		if !strings.EqualFold(task.Dst, task.Src) || dstDB.DSN != srcDB.DSN || task.Query != "" {
+			qry, err := createStatement(subCtx, srcTx, srcDB, dstDB, task, opts.CreateDDL)
+			if err != nil {
+				return err
+			}
+			if qry != "" {
+				logger.Info("create", "table", task.Dst, "ddl", qry)
+				if _, err = dstDB.ExecContext(subCtx, qry); err != nil && !dstDB.AlreadyExists(err) {
+					return fmt.Errorf("%s: %w", qry, err)
+				}
+			}
+			if task.Truncate {
+				logger.Info("TRUNCATE", "table", task.Dst)
+				// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+				if _, err := dstDB.ExecContext(subCtx, "TRUNCATE TABLE "+task.Dst); err != nil {
+					// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+					if _, err = dstDB.ExecContext(subCtx, "DELETE FROM "+task.Dst); err != nil {
+						return fmt.Errorf("TRUNCATE TABLE %s: %w", task.Dst, err)
+					}
+				}
+			}
+		}
+	}
+	var enableFKs []string
+	if opts.DisableFKs {
+		enableFKs, err = disableForeignKeys(ctx, dstDB, tables)
+		defer func() {
+			if len(enableFKs) != 0 {
+				if err := execPostCopy(context.WithoutCancel(ctx), dstDB.DB, enableFKs); err != nil {
+					logger.Error(err, "enable foreign keys")
+				}
+			}
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	// the tasks wait for the tasks in their After
+	finished := newSrcBarrier(tables)
+	var rej *rejecter
+	if opts.Reject != "" {
+		if rej, err = newRejecter(opts.Reject); err != nil {
+			return err
+		}
+		defer func() {
+			rej.LogSummary(ctx)
+			if err := rej.Close(); err != nil {
+				logger.Error(err, "close", "file", opts.Reject)
+			}
+		}()
+	}
+	// each table is committed separately
+	perTableTx := status != nil || rej != nil
+	limiter := newRowLimiter(opts.MaxRowsPerSec)
+	var errsMu sync.Mutex
+	var copyErrs []error
+	var copiedTables, copiedRows atomic.Int64
+	defer func() {
+		if ctx.Err() != nil {
+			// without perTableTx, the copied tables are rolled back
+			logger.Warn("interrupted", "tables", len(tables), "copied", copiedTables.Load(), "rows", copiedRows.Load(),
+				"rolledBack", !perTableTx, "status", opts.Status)
+		}
+	}()
+	for _, task := range tables {
+		if task.Src == "" {
+			continue
+		}
+		task := task
+		if task.Dst == "" {
+			task.Dst = task.Src
+		}
+		grp.Go(func() error {
+			defer finished.Done(task.Src)
+			for _, p := range task.After {
+				if err := finished.Wait(subCtx, p); err != nil {
+					return err
+				}
+			}
+			select {
+			case concLimit <- struct{}{}:
+				defer func() { <-concLimit }()
+			case <-subCtx.Done():
+				return subCtx.Err()
+			}
+			start := time.Now()
+			timeout := opts.TableTimeout
+			if task.Timeout > 0 {
+				timeout = task.Timeout
+			}
+			oneCtx, oneCancel := context.WithTimeout(subCtx, timeout)
+			cfg := Config{
+				Src: srcDB.Dialect, Dst: dstDB.Dialect, BatchSize: opts.BatchSize,
+				Limiter: limiter, Reject: rej, BatchMemory: opts.BatchMemory, Convert: conv,
+				MaskKey: opts.MaskKey,
+			}
+			if task.BatchSize > 0 {
+				cfg.BatchSize = task.BatchSize
+			}
+			var n int64
+			var err error
+			oneCtx, span := tracing.Start(oneCtx, "copy", attribute.String("src", task.Src), attribute.String("table", task.Dst))
+			defer func() { tracing.End(span, err, attribute.Int64("rows", n)) }()
+			tx := dstTx
+			if perTableTx {
+				if tx, err = dstDB.BeginTx(oneCtx, nil); err != nil {
+					oneCancel()
+					return err
+				}
+				defer tx.Rollback()
+			}
+			// the chunks are committed separately, which would wait for the DELETE's locks
+			split := (opts.Split.Rows > 0 || opts.Split.Parts) && srcDB.isOracle() && task.DeleteWhere == "" && task.Query == "" && opts.ViaDBLink == ""
+			var wmKey string
+			var newWM watermark
+			var hasNewWM bool
+			if sinceCol != "" {
+				wmKey = task.key()
+				if newWM, hasNewWM, err = maxWatermark(oneCtx, srcTx, task, sinceCol); err != nil {
+					oneCancel()
+					return err
+				}
+				if wm, ok := watermarks.Get(wmKey); ok {
+					arg, err := wm.arg()
+					if err != nil {
+						oneCancel()
+						return fmt.Errorf("watermark of %s: %w", wmKey, err)
+					}
+					cond := strings.Replace(opts.Since, ":last", srcDB.Placeholder(len(task.Args)+1), 1)
+					if task.Where == "" {
+						task.Where = cond
+					} else {
+						task.Where = "(" + task.Where + ") AND " + cond
+					}
+					task.Args = append(task.Args, arg)
+					logger.Info("since", "src", task.Src, "last", wm.Value)
+				}
+				if split && hasNewWM {
+					// the chunks are read in their own snapshots: the rows committed since are left for the next run
+					arg, err := newWM.arg()
+					if err != nil {
+						oneCancel()
+						return fmt.Errorf("watermark of %s: %w", wmKey, err)
+					}
+					cond := sinceCol + " <= " + srcDB.Placeholder(len(task.Args)+1)
+					if task.Where == "" {
+						task.Where = cond
+					} else {
+						task.Where = "(" + task.Where + ") AND " + cond
+					}
+					task.Args = append(task.Args, arg)
+				}
+			}
+			var chunks []Task
+			if split {
+				if chunks, err = splitTask(oneCtx, srcTx, task, opts.Split); err != nil {
+					oneCancel()
+					return err
+				}
+			}
+			if len(chunks) != 0 {
+				logger.Info("split", "src", task.Src, "chunks", len(chunks))
+				n, err = copyChunks(oneCtx, srcDB, dstDB, chunks, cfg, opts.Concurrency)
+			} else if err = deleteWhere(oneCtx, tx, task); err == nil {
+				if opts.ViaDBLink != "" {
+					n, err = copyViaDBLink(oneCtx, tx, srcTx, task, cfg, opts.ViaDBLink)
+				} else {
+					n, err = One(oneCtx, tx, srcTx, task, cfg)
+				}
+			}
+			if err == nil && perTableTx && len(chunks) == 0 {
+				_, commitSpan := tracing.Start(oneCtx, "commit")
+				err = tx.Commit()
+				tracing.End(commitSpan, err)
+			}
+			oneCancel()
+			if err == nil && hasNewWM {
+				if perTableTx { // already committed
+					watermarks.Set(wmKey, newWM)
+					if err = watermarks.Save(); err != nil {
+						return fmt.Errorf("save %q: %w", opts.State, err)
+					}
+				} else {
+					newWatermarksMu.Lock()
+					newWatermarks[wmKey] = newWM
+					newWatermarksMu.Unlock()
+				}
+			}
+			dur := time.Since(start)
+			logger.Info("one", "src", task.Src, "table", task.Dst, "rows", n, "duration", dur.String())
+			if err == nil {
+				copiedTables.Add(1)
+				copiedRows.Add(n)
+			}
+			if status == nil {
+				return err
+			}
+			ts := tableStatus{Status: statusDone, Rows: n, Rejected: rej.Count(task.Dst)}
+			if err != nil {
+				logger.Error(err, "copy", "src", task.Src, "dst", task.Dst)
+				ts = tableStatus{Status: statusFailed, Error: err.Error(), Rows: n, Rejected: rej.Count(task.Dst)}
+				errsMu.Lock()
+				copyErrs = append(copyErrs, fmt.Errorf("%s: %w", task.Src, err))
+				errsMu.Unlock()
+			}
+			if err := status.Set(task.key(), ts); err != nil {
+				return fmt.Errorf("save %q: %w", opts.Status, err)
+			}
+			return nil
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		return err
+	}
+	_, span := tracing.Start(ctx, "commit")
+	err = dstTx.Commit()
+	if tracing.End(span, err); err != nil {
+		return err
+	}
+	if err := errors.Join(copyErrs...); err != nil {
+		return err
+	}
+	if watermarks != nil && !perTableTx {
+		for k, w := range newWatermarks {
+			watermarks.Set(k, w)
+		}
+		if err := watermarks.Save(); err != nil {
+			return fmt.Errorf("save %q: %w", opts.State, err)
+		}
+	}
+	var errs []error
+	if opts.Verify {
+		for _, task := range tables {
+			if task.Src == "" {
+				continue
+			}
+			if err := verifyTask(ctx, srcTx, srcDB, dstDB, task, opts.VerifyColumns); err != nil {
+				logger.Error(err, "verify")
+				errs = append(errs, err)
+			}
+		}
+	}
+	if !opts.PostCopy.any() && !opts.CopySequences {
+		return errors.Join(errs...)
+	}
+	// the DDL needs the committed data
+	for _, task := range tables {
+		if task.Src == "" {
+			continue
+		}
+		if task.Dst == "" {
+			task.Dst = task.Src
+		}
+		if task.Query != "" {
+			logger.Info("no indexes, comments, grants and sequences of a query", "src", task.Src, "dst", task.Dst)
+			continue
+		}
+		var stmts []string
+		if opts.PostCopy.any() {
+			if stmts, err = postCopyStatements(ctx, srcTx, srcDB.Dialect, dstDB.Dialect, task.Src, task.Dst, dstDB.DSN == srcDB.DSN, opts.PostCopy); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if opts.CopySequences {
+			if dstDB.DSN == srcDB.DSN {
+				logger.Info("the sequences are shared in the same database", "table", task.Dst)
+			} else {
+				seqs, err := sequenceStatements(ctx, srcTx, srcDB, dstDB, task.Src, task.Dst)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				stmts = append(stmts, seqs...)
+			}
+		}
+		if err = execPostCopy(ctx, dstDB.DB, stmts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
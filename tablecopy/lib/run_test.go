@@ -0,0 +1,76 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunResume(t *testing.T) {
+	var mu sync.Mutex
+	var srcQueries []string
+	src := &fakeConnector{Query: func(qry string, _ []driver.Value) (*fakeRows, error) {
+		mu.Lock()
+		srcQueries = append(srcQueries, qry)
+		mu.Unlock()
+		if strings.HasSuffix(qry, " WHERE 1=0") {
+			return rowsOf([]string{"ID"}), nil
+		}
+		return rowsOf([]string{"ID"}, []driver.Value{int64(1)}, []driver.Value{int64(2)}), nil
+	}}
+	dst := &fakeConnector{Query: func(string, []driver.Value) (*fakeRows, error) {
+		return rowsOf([]string{"ID"}), nil
+	}}
+	srcDB := Database{DB: sql.OpenDB(src), Dialect: sqliteDialect, DSN: "sqlite:db"}
+	defer srcDB.Close()
+	dstDB := Database{DB: sql.OpenDB(dst), Dialect: sqliteDialect, DSN: "sqlite:db"}
+	defer dstDB.Close()
+	ctx := context.Background()
+
+	fn := filepath.Join(t.TempDir(), "status.json")
+	st, err := loadStatus(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = st.Set("T1=T1", tableStatus{Status: statusDone, Rows: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.Set("T2=T2", tableStatus{Status: statusFailed, Error: "ORA-03113"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []Task{{Src: "T1"}, {Src: "T2"}}
+	if err = Run(ctx, srcDB, dstDB, tasks, Options{Resume: true}); err == nil {
+		t.Error("wanted error for resume without status")
+	}
+	if err = Run(ctx, srcDB, dstDB, tasks, Options{Status: fn, Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, qry := range srcQueries {
+		if strings.Contains(qry, "T1") {
+			t.Errorf("the done T1 is copied again: %s", qry)
+		}
+	}
+	if got, want := dst.Execs(), []string{`INSERT INTO T2 ("ID") VALUES (?),(?)`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	if st, err = loadStatus(fn); err != nil {
+		t.Fatal(err)
+	}
+	if ts := st.Get("T1=T1"); ts.Status != statusDone || ts.Rows != 5 {
+		t.Errorf("T1: got %+v", ts)
+	}
+	if ts := st.Get("T2=T2"); ts.Status != statusDone || ts.Rows != 2 || ts.Error != "" {
+		t.Errorf("T2: got %+v", ts)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+// schemaTasks returns the tasks copying all the tables of the owner's schema into the destination's current schema,
+// ordered parents first, each with its parents (by the foreign keys) in After.
+func schemaTasks(ctx context.Context, srcTx *sql.Tx, d Dialect, owner string, defaults Task) ([]Task, error) {
+	owner = strings.ToUpper(owner)
+	names, err := listTables(ctx, srcTx, d, owner)
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[string][]string)
+	if d.isOracle() {
+		if parents, err = foreignKeyParents(ctx, srcTx, owner); err != nil {
+			return nil, err
+		}
+	} else {
+		zlog.FromContext(ctx).Info("foreign key ordering needs an Oracle source", "dialect", d.Name)
+	}
+	names = orderByParents(ctx, names, parents)
+	tasks := make([]Task, 0, len(names))
+	for _, name := range names {
+		task := defaults
+		task.Src, task.Dst = owner+"."+name, name
+		for _, p := range parents[name] {
+			task.After = append(task.After, owner+"."+p)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// foreignKeyParents returns the parent tables of the tables of the owner, by the foreign keys within the schema.
+func foreignKeyParents(ctx context.Context, srcTx *sql.Tx, owner string) (map[string][]string, error) {
+	const qry = `SELECT DISTINCT A.table_name, B.table_name
+  FROM all_constraints B, all_constraints A
+  WHERE A.owner = :1 AND A.constraint_type = 'R' AND
+        B.owner = A.r_owner AND B.constraint_name = A.r_constraint_name AND
+        B.owner = :1 AND B.table_name <> A.table_name`
+	rows, err := srcTx.QueryContext(ctx, qry, owner)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", qry, err)
+	}
+	defer rows.Close()
+	parents := make(map[string][]string)
+	for rows.Next() {
+		var child, parent string
+		if err := rows.Scan(&child, &parent); err != nil {
+			return parents, fmt.Errorf("%s: %w", qry, err)
+		}
+		parents[child] = append(parents[child], parent)
+	}
+	return parents, rows.Err()
+}
+
+// orderByParents orders the names parents first.
+// The tables in a cycle lose their dependencies within the cycle (they need -disable-fks).
+func orderByParents(ctx context.Context, names []string, parents map[string][]string) []string {
+	known := make(map[string]bool, len(names))
+	for _, nm := range names {
+		known[nm] = true
+	}
+	ordered := make([]string, 0, len(names))
+	done := make(map[string]bool, len(names))
+	for len(ordered) < len(names) {
+		progress := false
+		for _, nm := range names {
+			if done[nm] {
+				continue
+			}
+			ready := true
+			for _, p := range parents[nm] {
+				if known[p] && !done[p] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[nm] = true
+				ordered = append(ordered, nm)
+				progress = true
+			}
+		}
+		if progress {
+			continue
+		}
+		// a cycle: release the first remaining table
+		for _, nm := range names {
+			if !done[nm] {
+				zlog.FromContext(ctx).Info("foreign key cycle", "table", nm, "parents", parents[nm])
+				parents[nm] = nil
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+// disableForeignKeys disables the enabled foreign keys of the (Oracle) destination tables,
+// and returns the statements which enable them.
+func disableForeignKeys(ctx context.Context, dstDB Database, tables []Task) ([]string, error) {
+	if !dstDB.isOracle() {
+		return nil, fmt.Errorf("disabling foreign keys needs an Oracle destination, not %s", dstDB.Name)
+	}
+	const qry = `SELECT constraint_name FROM all_constraints
+  WHERE constraint_type = 'R' AND status = 'ENABLED' AND
+        table_name = :1 AND owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))`
+	var enable []string
+	for _, task := range tables {
+		dst := task.Dst
+		if dst == "" {
+			dst = task.Src
+		}
+		owner, name := splitOwner(dst)
+		rows, err := dstDB.QueryContext(ctx, qry, name, owner)
+		if err != nil {
+			return enable, fmt.Errorf("%s: %w", qry, err)
+		}
+		var names []string
+		for rows.Next() {
+			var c string
+			if err = rows.Scan(&c); err != nil {
+				break
+			}
+			names = append(names, c)
+		}
+		rows.Close()
+		if err == nil {
+			err = rows.Err()
+		}
+		if err != nil {
+			return enable, fmt.Errorf("%s: %w", qry, err)
+		}
+		for _, c := range names {
+			disable := "ALTER TABLE " + dst + " DISABLE CONSTRAINT " + dstDB.Quote(c)
+			zlog.FromContext(ctx).Info("disable", "qry", disable)
+			if _, err := dstDB.ExecContext(ctx, disable); err != nil {
+				return enable, fmt.Errorf("%s: %w", disable, err)
+			}
+			enable = append(enable, "ALTER TABLE "+dst+" ENABLE CONSTRAINT "+dstDB.Quote(c))
+		}
+	}
+	return enable, nil
+}
+
+// srcBarrier is closed for a source when all the tasks of that source are finished.
+type srcBarrier struct {
+	mu      sync.Mutex
+	pending map[string]int
+	done    map[string]chan struct{}
+}
+
+func newSrcBarrier(tasks []Task) *srcBarrier {
+	b := srcBarrier{pending: make(map[string]int, len(tasks)), done: make(map[string]chan struct{}, len(tasks))}
+	for _, task := range tasks {
+		if b.pending[task.Src]++; b.pending[task.Src] == 1 {
+			b.done[task.Src] = make(chan struct{})
+		}
+	}
+	return &b
+}
+
+// Done marks one task of the source finished.
+func (b *srcBarrier) Done(src string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending[src]--; b.pending[src] == 0 {
+		close(b.done[src])
+	}
+}
+
+// Wait for the tasks of the source - returns immediately for an unknown source.
+func (b *srcBarrier) Wait(ctx context.Context, src string) error {
+	ch := b.done[src]
+	if ch == nil {
+		return nil
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
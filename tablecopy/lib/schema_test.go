@@ -0,0 +1,67 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderByParents(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		Name        string
+		Names, Want []string
+		Parents     map[string][]string
+	}{
+		{Name: "chain", Names: []string{"A", "B", "C"}, Parents: map[string][]string{"A": {"B"}, "B": {"C"}},
+			Want: []string{"C", "B", "A"}},
+		{Name: "tree", Names: []string{"A", "B", "C", "D"}, Parents: map[string][]string{"A": {"B", "C"}, "C": {"D"}},
+			Want: []string{"B", "D", "C", "A"}},
+		{Name: "unknown", Names: []string{"A", "B"}, Parents: map[string][]string{"A": {"X"}},
+			Want: []string{"A", "B"}},
+		{Name: "cycle", Names: []string{"A", "B", "C"}, Parents: map[string][]string{"A": {"B"}, "B": {"A"}, "C": {"A"}},
+			Want: []string{"A", "B", "C"}},
+	} {
+		if got := orderByParents(ctx, tc.Names, tc.Parents); !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%s: got %q, wanted %q", tc.Name, got, tc.Want)
+		}
+	}
+}
+
+func TestSchemaTasks(t *testing.T) {
+	fake := &fakeConnector{Query: func(qry string, _ []driver.Value) (*fakeRows, error) {
+		if strings.Contains(qry, "constraint_type = 'R'") {
+			return rowsOf([]string{"child", "parent"},
+				[]driver.Value{"EMP", "DEPT"}, []driver.Value{"BONUS", "EMP"}, []driver.Value{"BONUS", "DEPT"}), nil
+		}
+		return stringRows("BONUS", "DEPT", "EMP"), nil
+	}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	got, err := schemaTasks(ctx, tx, oracleDialect, "scott", Task{Truncate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Task{
+		{Src: "SCOTT.DEPT", Dst: "DEPT", Truncate: true},
+		{Src: "SCOTT.EMP", Dst: "EMP", Truncate: true, After: []string{"SCOTT.DEPT"}},
+		{Src: "SCOTT.BONUS", Dst: "BONUS", Truncate: true, After: []string{"SCOTT.EMP", "SCOTT.DEPT"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%+v\nwanted\n%+v", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/UNO-SOFT/zlog/v2"
+)
+
+// sequenceStatements returns the statements which create (or restart) the sequences of the
+// (Oracle) source table on the destination, starting above the maximum of the key column.
+//
+// The sequences are the identity columns' and the ones used by the table's triggers,
+// the latter are assumed to fill the single-column primary key.
+func sequenceStatements(ctx context.Context, srcTx *sql.Tx, srcDB, dstDB Database, srcTable, dstTable string) ([]string, error) {
+	if !srcDB.isOracle() {
+		return nil, fmt.Errorf("copying sequences needs an Oracle source, not %s", srcDB.Name)
+	}
+	if !(dstDB.isOracle() || dstDB.Name == "postgres") {
+		zlog.FromContext(ctx).Info("sequences are not supported", "dialect", dstDB.Name)
+		return nil, nil
+	}
+	owner, name := splitOwner(srcTable)
+	dstOwner, _ := splitOwner(dstTable)
+	maxOf := func(col string) (int64, error) {
+		// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+		qry := "SELECT MAX(" + dstDB.Quote(col) + ") FROM " + dstTable
+		var n sql.NullInt64
+		if err := dstDB.QueryRowContext(ctx, qry).Scan(&n); err != nil {
+			return 0, fmt.Errorf("%s: %w", qry, err)
+		}
+		return n.Int64, nil
+	}
+
+	var stmts []string
+	if dstDB.isOracle() {
+		const qry = `SELECT column_name, generation_type FROM all_tab_identity_cols
+  WHERE table_name = :1 AND owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))`
+		rows, err := srcTx.QueryContext(ctx, qry, name, owner)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", qry, err)
+		}
+		for rows.Next() {
+			var col, gen string
+			if err = rows.Scan(&col, &gen); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("%s: %w", qry, err)
+			}
+			stmts = append(stmts, "ALTER TABLE "+dstTable+" MODIFY ("+dstDB.Quote(col)+
+				" GENERATED "+gen+" AS IDENTITY (START WITH LIMIT VALUE))")
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", qry, err)
+		}
+	}
+
+	const qry = `SELECT DISTINCT S.sequence_name, S.increment_by
+  FROM all_sequences S, all_dependencies D, all_triggers T
+  WHERE S.sequence_owner = D.referenced_owner AND S.sequence_name = D.referenced_name AND
+        D.referenced_type = 'SEQUENCE' AND D.type = 'TRIGGER' AND
+        D.owner = T.owner AND D.name = T.trigger_name AND
+        T.table_name = :1 AND T.table_owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))`
+	rows, err := srcTx.QueryContext(ctx, qry, name, owner)
+	if err != nil {
+		return stmts, fmt.Errorf("%s: %w", qry, err)
+	}
+	type sequence struct {
+		Name      string
+		Increment int64
+	}
+	var seqs []sequence
+	for rows.Next() {
+		var s sequence
+		if err = rows.Scan(&s.Name, &s.Increment); err != nil {
+			rows.Close()
+			return stmts, fmt.Errorf("%s: %w", qry, err)
+		}
+		seqs = append(seqs, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(seqs) == 0 {
+		return stmts, err
+	}
+	pk, err := oraclePrimaryKey(ctx, srcTx, srcTable)
+	if err != nil {
+		return stmts, err
+	}
+	if len(pk) != 1 {
+		zlog.FromContext(ctx).Info("no single-column primary key, the sequences are not copied", "table", srcTable, "pk", pk)
+		return stmts, nil
+	}
+	start, err := maxOf(pk[0])
+	if err != nil {
+		return stmts, err
+	}
+	start++
+	for _, s := range seqs {
+		seqName := dstDB.Quote(s.Name)
+		if dstOwner != "" {
+			seqName = dstDB.Quote(dstOwner) + "." + seqName
+		}
+		startWith := strconv.FormatInt(start, 10)
+		if dstDB.isOracle() {
+			create := "CREATE SEQUENCE " + seqName + " START WITH " + startWith + " INCREMENT BY " + strconv.FormatInt(s.Increment, 10)
+			restart := "ALTER SEQUENCE " + seqName + " RESTART START WITH " + startWith
+			stmts = append(stmts, `BEGIN
+  EXECUTE IMMEDIATE '`+strings.ReplaceAll(create, "'", "''")+`';
+EXCEPTION WHEN OTHERS THEN
+  IF SQLCODE <> -955 THEN RAISE; END IF;
+  EXECUTE IMMEDIATE '`+strings.ReplaceAll(restart, "'", "''")+`';
+END;`)
+		} else {
+			stmts = append(stmts,
+				"CREATE SEQUENCE IF NOT EXISTS "+seqName+" INCREMENT BY "+strconv.FormatInt(s.Increment, 10),
+				"ALTER SEQUENCE "+seqName+" RESTART WITH "+startWith)
+		}
+	}
+	return stmts, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSequenceStatements(t *testing.T) {
+	pk := []string{"ID"}
+	src := &fakeConnector{Query: func(qry string, _ []driver.Value) (*fakeRows, error) {
+		switch {
+		case strings.Contains(qry, "all_tab_identity_cols"):
+			return rowsOf([]string{"column_name", "generation_type"}, []driver.Value{"ID", "BY DEFAULT"}), nil
+		case strings.Contains(qry, "all_sequences"):
+			return rowsOf([]string{"sequence_name", "increment_by"}, []driver.Value{"T_SEQ", int64(1)}), nil
+		}
+		return stringRows(pk...), nil
+	}}
+	var maxQry string
+	dst := &fakeConnector{Query: func(qry string, _ []driver.Value) (*fakeRows, error) {
+		maxQry = qry
+		return rowsOf([]string{"max"}, []driver.Value{int64(41)}), nil
+	}}
+	srcDB := Database{DB: sql.OpenDB(src), Dialect: oracleDialect, DSN: "oracle:src"}
+	defer srcDB.Close()
+	ctx := context.Background()
+	srcTx, err := srcDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srcTx.Rollback()
+
+	for _, tc := range []struct {
+		Dst  Dialect
+		PK   []string
+		Want []string
+	}{
+		{Dst: oracleDialect, PK: pk, Want: []string{
+			`ALTER TABLE hr.x MODIFY ("ID" GENERATED BY DEFAULT AS IDENTITY (START WITH LIMIT VALUE))`,
+			`BEGIN
+  EXECUTE IMMEDIATE 'CREATE SEQUENCE "HR"."T_SEQ" START WITH 42 INCREMENT BY 1';
+EXCEPTION WHEN OTHERS THEN
+  IF SQLCODE <> -955 THEN RAISE; END IF;
+  EXECUTE IMMEDIATE 'ALTER SEQUENCE "HR"."T_SEQ" RESTART START WITH 42';
+END;`,
+		}},
+		{Dst: postgresDialect, PK: pk, Want: []string{
+			`CREATE SEQUENCE IF NOT EXISTS "HR"."T_SEQ" INCREMENT BY 1`,
+			`ALTER SEQUENCE "HR"."T_SEQ" RESTART WITH 42`,
+		}},
+		{Dst: postgresDialect, PK: []string{"ID", "SUB"}},
+		{Dst: mysqlDialect, PK: pk},
+	} {
+		pk, maxQry = tc.PK, ""
+		dstDB := Database{DB: sql.OpenDB(dst), Dialect: tc.Dst, DSN: tc.Dst.Name + ":dst"}
+		got, err := sequenceStatements(ctx, srcTx, srcDB, dstDB, "scott.t", "hr.x")
+		dstDB.Close()
+		if err != nil {
+			t.Errorf("%s %q: %+v", tc.Dst.Name, tc.PK, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%s %q: got\n%q\nwanted\n%q", tc.Dst.Name, tc.PK, got, tc.Want)
+		}
+		if tc.Want != nil && maxQry != `SELECT MAX("ID") FROM hr.x` {
+			t.Errorf("%s: got %q", tc.Dst.Name, maxQry)
+		}
+	}
+
+	sqliteDB := Database{DB: srcDB.DB, Dialect: sqliteDialect}
+	if _, err := sequenceStatements(ctx, srcTx, sqliteDB, srcDB, "t", "x"); err == nil {
+		t.Error("wanted error for a non-Oracle source")
+	}
+}
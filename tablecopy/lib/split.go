@@ -0,0 +1,168 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/UNO-SOFT/zlog/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// SplitConfig configures the splitting of the large tables into concurrently copied chunks.
+type SplitConfig struct {
+	// Rows is the number of rows (by the optimizer statistics) above which a table is split into ROWID ranges.
+	Rows int64
+	// Parts splits the partitioned tables per partition.
+	Parts bool
+}
+
+// splitTask splits the task into chunks, by partition or ROWID ranges.
+// Returns nil if the table should not be split.
+func splitTask(ctx context.Context, srcTx *sql.Tx, task Task, sc SplitConfig) ([]Task, error) {
+	if task.Dst == "" {
+		task.Dst = task.Src
+	}
+	owner, name := splitOwner(task.Src)
+	if sc.Parts {
+		const qry = `SELECT partition_name FROM all_tab_partitions
+  WHERE table_name = :1 AND table_owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))
+  ORDER BY partition_position`
+		parts, err := queryStrings(ctx, srcTx, qry, name, owner)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) != 0 {
+			chunks := make([]Task, len(parts))
+			for i, p := range parts {
+				chunks[i] = task
+				chunks[i].Src = task.Src + " PARTITION (" + p + ")"
+			}
+			return chunks, nil
+		}
+	}
+	if sc.Rows <= 0 {
+		return nil, nil
+	}
+	const cntQry = `SELECT NVL(num_rows, 0) FROM all_tables
+  WHERE table_name = :1 AND owner = NVL(:2, SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA'))`
+	var numRows int64
+	if err := srcTx.QueryRowContext(ctx, cntQry, name, owner).Scan(&numRows); err != nil {
+		return nil, fmt.Errorf("%s: %w", cntQry, err)
+	}
+	if numRows <= sc.Rows {
+		return nil, nil
+	}
+	n := (numRows + sc.Rows - 1) / sc.Rows
+	// the first ROWID of each tile
+	// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+	qry := `SELECT ROWIDTOCHAR(MIN(rid)) FROM (
+  SELECT ROWID AS rid, NTILE(:1) OVER (ORDER BY ROWID) AS tile FROM ` + task.Src + `)
+  GROUP BY tile ORDER BY tile`
+	starts, err := queryStrings(ctx, srcTx, qry, n)
+	if err != nil {
+		return nil, err
+	}
+	if len(starts) < 2 {
+		return nil, nil
+	}
+	// gapless ranges: [start_i, start_{i+1}), the first and the last are open
+	chunks := make([]Task, len(starts))
+	for i := range starts {
+		var cond string
+		switch i {
+		case 0:
+			cond = "ROWID < CHARTOROWID('" + starts[1] + "')"
+		case len(starts) - 1:
+			cond = "ROWID >= CHARTOROWID('" + starts[i] + "')"
+		default:
+			cond = "ROWID >= CHARTOROWID('" + starts[i] + "') AND ROWID < CHARTOROWID('" + starts[i+1] + "')"
+		}
+		chunks[i] = task
+		if task.Where == "" {
+			chunks[i].Where = cond
+		} else {
+			chunks[i].Where = "(" + task.Where + ") AND " + cond
+		}
+	}
+	return chunks, nil
+}
+
+func queryStrings(ctx context.Context, tx *sql.Tx, qry string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", qry, err)
+	}
+	defer rows.Close()
+	var ss []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return ss, fmt.Errorf("%s: %w", qry, err)
+		}
+		ss = append(ss, s)
+	}
+	return ss, rows.Err()
+}
+
+// copyChunks copies the chunks concurrently, each in its own source and destination transaction.
+//
+// The commits are ordered: a chunk is committed only after all the previous chunks have been committed,
+// so a failure leaves a contiguous prefix of the chunks copied.
+// Each chunk reads its own snapshot of the source.
+func copyChunks(ctx context.Context, srcDB, dstDB Database, chunks []Task, cfg Config, concurrency int) (int64, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	grp, grpCtx := errgroup.WithContext(ctx)
+	grp.SetLimit(concurrency)
+	counts := make([]int64, len(chunks))
+	prev := make(chan bool, 1)
+	prev <- true
+	for i, chunk := range chunks {
+		i, chunk, wait, done := i, chunk, prev, make(chan bool, 1)
+		prev = done
+		grp.Go(func() (err error) {
+			defer func() { done <- err == nil }()
+			srcTx, err := srcDB.BeginTx(grpCtx, &sql.TxOptions{ReadOnly: true})
+			if err != nil {
+				return err
+			}
+			defer srcTx.Rollback()
+			dstTx, err := dstDB.BeginTx(grpCtx, nil)
+			if err != nil {
+				return err
+			}
+			defer dstTx.Rollback()
+			n, err := One(grpCtx, dstTx, srcTx, chunk, cfg)
+			if err != nil {
+				return fmt.Errorf("chunk %d (%s WHERE %s): %w", i, chunk.Src, chunk.Where, err)
+			}
+			select {
+			case ok := <-wait:
+				if !ok {
+					return fmt.Errorf("chunk %d: previous chunk failed", i)
+				}
+			case <-grpCtx.Done():
+				return grpCtx.Err()
+			}
+			if err = dstTx.Commit(); err != nil {
+				return err
+			}
+			counts[i] = n
+			zlog.FromContext(ctx).Info("chunk", "src", chunk.Src, "where", strings.TrimSpace(chunk.Where), "rows", n)
+			return nil
+		})
+	}
+	err := grp.Wait()
+	var n int64
+	for _, c := range counts {
+		n += c
+	}
+	return n, err
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTask(t *testing.T) {
+	var parts, starts []string
+	var numRows, tiles int64
+	fake := &fakeConnector{Query: func(qry string, args []driver.Value) (*fakeRows, error) {
+		switch {
+		case strings.Contains(qry, "all_tab_partitions"):
+			return stringRows(parts...), nil
+		case strings.Contains(qry, "NTILE"):
+			tiles = args[0].(int64)
+			return stringRows(starts...), nil
+		}
+		return rowsOf([]string{"num_rows"}, []driver.Value{numRows}), nil
+	}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	for _, tc := range []struct {
+		Name          string
+		Split         SplitConfig
+		Parts, Starts []string
+		NumRows       int64
+		Task          Task
+		Want          []Task
+	}{
+		{Name: "parts", Split: SplitConfig{Parts: true}, Parts: []string{"P1", "P2"},
+			Task: Task{Src: "T", Where: "x = 1"},
+			Want: []Task{{Src: "T PARTITION (P1)", Dst: "T", Where: "x = 1"}, {Src: "T PARTITION (P2)", Dst: "T", Where: "x = 1"}},
+		},
+		{Name: "no parts", Split: SplitConfig{Parts: true}, Task: Task{Src: "T"}},
+		{Name: "small", Split: SplitConfig{Rows: 10}, NumRows: 10, Task: Task{Src: "T"}},
+		{Name: "rowid", Split: SplitConfig{Rows: 10}, NumRows: 25, Starts: []string{"A", "B", "C"},
+			Task: Task{Src: "T", Dst: "X"},
+			Want: []Task{
+				{Src: "T", Dst: "X", Where: "ROWID < CHARTOROWID('B')"},
+				{Src: "T", Dst: "X", Where: "ROWID >= CHARTOROWID('B') AND ROWID < CHARTOROWID('C')"},
+				{Src: "T", Dst: "X", Where: "ROWID >= CHARTOROWID('C')"},
+			},
+		},
+		{Name: "rowid where", Split: SplitConfig{Rows: 10, Parts: true}, NumRows: 11, Starts: []string{"A", "B"},
+			Task: Task{Src: "T", Where: "x = 1"},
+			Want: []Task{
+				{Src: "T", Dst: "T", Where: "(x = 1) AND ROWID < CHARTOROWID('B')"},
+				{Src: "T", Dst: "T", Where: "(x = 1) AND ROWID >= CHARTOROWID('B')"},
+			},
+		},
+		{Name: "one tile", Split: SplitConfig{Rows: 10}, NumRows: 11, Starts: []string{"A"}, Task: Task{Src: "T"}},
+	} {
+		parts, starts, numRows, tiles = tc.Parts, tc.Starts, tc.NumRows, 0
+		got, err := splitTask(ctx, tx, tc.Task, tc.Split)
+		if err != nil {
+			t.Errorf("%s: %+v", tc.Name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%s: got\n%+v\nwanted\n%+v", tc.Name, got, tc.Want)
+		}
+		if want := (tc.NumRows + tc.Split.Rows - 1) / max(1, tc.Split.Rows); tc.Starts != nil && tiles != want {
+			t.Errorf("%s: got %d tiles, wanted %d", tc.Name, tiles, want)
+		}
+	}
+}
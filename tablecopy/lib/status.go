@@ -0,0 +1,72 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/renameio/v2"
+)
+
+const (
+	statusPending = "pending"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+// tableStatus is the outcome of one table's copy.
+type tableStatus struct {
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Rows     int64     `json:"rows,omitempty"`
+	Rejected int64     `json:"rejected,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// copyStatus is the per-table status store, saved after each change.
+type copyStatus struct {
+	fileName string
+	mu       sync.Mutex
+	M        map[string]tableStatus
+}
+
+func loadStatus(fileName string) (*copyStatus, error) {
+	st := copyStatus{fileName: fileName, M: make(map[string]tableStatus)}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &st, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &st.M); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", fileName, err)
+	}
+	return &st, nil
+}
+
+func (st *copyStatus) Get(key string) tableStatus {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.M[key]
+}
+
+// Set the status of the table and save the store.
+func (st *copyStatus) Set(key string, ts tableStatus) error {
+	ts.Time = time.Now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.M[key] = ts
+	b, err := json.MarshalIndent(st.M, "", "  ")
+	if err != nil {
+		return err
+	}
+	return renameio.WriteFile(st.fileName, append(b, '\n'), 0640)
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "status.json")
+	st, err := loadStatus(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := st.Get("A=A"); ts.Status != "" {
+		t.Errorf("got %+v for an empty store", ts)
+	}
+	if err = st.Set("A=A", tableStatus{Status: statusDone, Rows: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err = st.Set("B=X", tableStatus{Status: statusFailed, Error: "ORA-00942", Rows: 1, Rejected: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st, err = loadStatus(fn); err != nil {
+		t.Fatal(err)
+	}
+	if ts := st.Get("A=A"); ts.Status != statusDone || ts.Rows != 3 || ts.Time.IsZero() {
+		t.Errorf("A: got %+v", ts)
+	}
+	if ts := st.Get("B=X"); ts.Status != statusFailed || ts.Error != "ORA-00942" || ts.Rows != 1 || ts.Rejected != 2 {
+		t.Errorf("B: got %+v", ts)
+	}
+	if ts := st.Get("C=C"); ts.Status != "" {
+		t.Errorf("C: got %+v", ts)
+	}
+
+	if err = os.WriteFile(fn, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadStatus(fn); err == nil {
+		t.Error("wanted error for an invalid file")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// taskFile is the -tasks file:
+//
+//	tables:
+//	  - src: SRC_TABLE
+//	    dst: DST_TABLE
+//	    where: "F_IELD = :1"
+//	    args: [1]
+//	    truncate: true
+//	    merge: [ID]
+//	    delete_where: "LOAD_DATE = :1"
+//	    delete_args: ["2024-01-01"]
+//	    replace: {F_IELD: value}
+//	    columns: {DST_COL: "TRUNC(SRC_COL)"}
+//	    mask: {EMAIL: "hash:32", PHONE: "pattern:+36-##-###-####", NOTE: "null"}
+//	    filter: 'STATUS != "X" and AMOUNT > 0'
+//	    batch_size: 1000
+//	    timeout: 30m
+//	  - dst: DST_SUMMARY
+//	    query: "SELECT A.id, B.name AS customer, TRUNC(A.created) AS created FROM orders A, customers B WHERE B.id = A.customer_id"
+//
+// The columns of a query are matched by their aliases; its src defaults to dst.
+// The unset fields get the values of the flags.
+type taskFile struct {
+	Tables []taskSpec `yaml:"tables"`
+}
+
+type taskSpec struct {
+	Truncate    *bool             `yaml:"truncate"`
+	Replace     map[string]string `yaml:"replace"`
+	Columns     map[string]string `yaml:"columns"`
+	Mask        map[string]string `yaml:"mask"`
+	Src         string            `yaml:"src"`
+	Dst         string            `yaml:"dst"`
+	Query       string            `yaml:"query"`
+	Where       string            `yaml:"where"`
+	Filter      string            `yaml:"filter"`
+	DeleteWhere string            `yaml:"delete_where"`
+	Args        []string          `yaml:"args"`
+	DeleteArgs  []string          `yaml:"delete_args"`
+	Merge       []string          `yaml:"merge"`
+	BatchSize   int               `yaml:"batch_size"`
+	Timeout     time.Duration     `yaml:"timeout"`
+}
+
+// LoadTasks reads the tasks from the YAML file, with the defaults for the unset fields.
+func LoadTasks(fileName string, defaults Task) ([]Task, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var tf taskFile
+	if err = yaml.Unmarshal(b, &tf); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", fileName, err)
+	}
+	tasks := make([]Task, 0, len(tf.Tables))
+	for i, ts := range tf.Tables {
+		if ts.Query != "" {
+			if ts.Dst == "" {
+				return nil, fmt.Errorf("%s: %d. table has a query but no dst", fileName, i+1)
+			}
+			if ts.Src == "" {
+				ts.Src = ts.Dst
+			}
+		}
+		if ts.Src == "" {
+			return nil, fmt.Errorf("%s: %d. table has no src", fileName, i+1)
+		}
+		task := defaults
+		task.Src, task.Dst, task.Where, task.Query = ts.Src, ts.Dst, ts.Where, ts.Query
+		if ts.Args != nil {
+			task.Args = make([]interface{}, len(ts.Args))
+			for j, a := range ts.Args {
+				task.Args[j] = a
+			}
+		}
+		if ts.Truncate != nil {
+			task.Truncate = *ts.Truncate
+		}
+		if ts.Merge != nil {
+			task.Merge = ts.Merge
+		}
+		if ts.DeleteWhere != "" {
+			task.DeleteWhere, task.DeleteArgs = ts.DeleteWhere, nil
+			for _, a := range ts.DeleteArgs {
+				task.DeleteArgs = append(task.DeleteArgs, a)
+			}
+		}
+		if ts.Replace != nil {
+			task.Replace = make(map[string]string, len(ts.Replace))
+			for k, v := range ts.Replace {
+				task.Replace[strings.ToUpper(k)] = v
+			}
+		}
+		if ts.Columns != nil {
+			task.Columns = make(ColumnMap, len(ts.Columns))
+			for k, v := range ts.Columns {
+				task.Columns[strings.ToUpper(k)] = strings.TrimSpace(v)
+			}
+		}
+		if ts.Mask != nil {
+			task.Mask = make(map[string]string, len(ts.Mask))
+			for k, v := range ts.Mask {
+				if _, err := parseMask(v, nil); err != nil {
+					return nil, fmt.Errorf("%s: %s.mask.%s: %w", fileName, ts.Src, k, err)
+				}
+				task.Mask[strings.ToUpper(k)] = v
+			}
+		}
+		if ts.Filter != "" {
+			task.Filter = ts.Filter
+		}
+		if ts.BatchSize > 0 {
+			task.BatchSize = ts.BatchSize
+		}
+		if ts.Timeout > 0 {
+			task.Timeout = ts.Timeout
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,27 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import "testing"
+
+func TestChecksumExpr(t *testing.T) {
+	cols := []string{"ID", "NAME"}
+	for _, tc := range []struct {
+		Dialect Dialect
+		Cols    []string
+		Want    string
+	}{
+		{oracleDialect, cols, "SUM(ORA_HASH(ID||'|'||NAME))"},
+		{oracleDialect, cols[:1], "SUM(ORA_HASH(ID))"},
+		{postgresDialect, cols, "SUM(('x'||LEFT(MD5(CONCAT_WS('|',ID,NAME)),8))::bit(32)::bigint)"},
+		{mysqlDialect, cols, "SUM(CRC32(CONCAT_WS('|',ID,NAME)))"},
+		{sqliteDialect, cols, ""},
+		{oracleDialect, nil, ""},
+	} {
+		if got := checksumExpr(tc.Dialect, tc.Cols); got != tc.Want {
+			t.Errorf("%s %q: got %q, wanted %q", tc.Dialect.Name, tc.Cols, got, tc.Want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/renameio/v2"
+)
+
+// watermark is the maximum copied value of the watermark column.
+type watermark struct {
+	Value string `json:"value"`
+	// Type is time, number or string.
+	Type string `json:"type"`
+}
+
+// arg returns the value to be bound.
+func (w watermark) arg() (interface{}, error) {
+	if w.Type == "time" {
+		return time.Parse(time.RFC3339Nano, w.Value)
+	}
+	return w.Value, nil
+}
+
+func watermarkOf(v interface{}) (watermark, bool) {
+	switch x := v.(type) {
+	case nil:
+		return watermark{}, false
+	case time.Time:
+		return watermark{Value: x.Format(time.RFC3339Nano), Type: "time"}, !x.IsZero()
+	case int64:
+		return watermark{Value: strconv.FormatInt(x, 10), Type: "number"}, true
+	case float64:
+		return watermark{Value: strconv.FormatFloat(x, 'f', -1, 64), Type: "number"}, true
+	case []byte:
+		return watermark{Value: string(x), Type: "string"}, true
+	case string:
+		return watermark{Value: x, Type: "string"}, true
+	case fmt.Stringer: // godror.Number
+		return watermark{Value: x.String(), Type: "number"}, true
+	}
+	return watermark{Value: fmt.Sprintf("%v", v), Type: "string"}, true
+}
+
+// watermarkState is the store of the watermarks per task.
+type watermarkState struct {
+	fileName string
+	mu       sync.Mutex
+	M        map[string]watermark
+}
+
+func loadWatermarks(fileName string) (*watermarkState, error) {
+	st := watermarkState{fileName: fileName, M: make(map[string]watermark)}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &st, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &st.M); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", fileName, err)
+	}
+	return &st, nil
+}
+
+func (st *watermarkState) Get(key string) (watermark, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	w, ok := st.M[key]
+	return w, ok
+}
+func (st *watermarkState) Set(key string, w watermark) {
+	st.mu.Lock()
+	st.M[key] = w
+	st.mu.Unlock()
+}
+
+// Save the state.
+func (st *watermarkState) Save() error {
+	st.mu.Lock()
+	b, err := json.MarshalIndent(st.M, "", "  ")
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return renameio.WriteFile(st.fileName, append(b, '\n'), 0640)
+}
+
+var rSinceColumn = regexp.MustCompile(`^\s*([A-Za-z_"][A-Za-z0-9_$#."]*)`)
+
+// sinceColumn returns the watermark column of the "MODIFIED_AT > :last" condition.
+func sinceColumn(cond string) (string, error) {
+	m := rSinceColumn.FindStringSubmatch(cond)
+	if m == nil || !strings.Contains(cond, ":last") {
+		return "", fmt.Errorf("%q: wanted COLUMN > :last", cond)
+	}
+	return m[1], nil
+}
+
+// maxWatermark returns the maximum of the column, within the task's WHERE.
+// It must be called in the same transaction as the copy, to see the same snapshot.
+func maxWatermark(ctx context.Context, srcTx *sql.Tx, task Task, column string) (watermark, bool, error) {
+	// nosemgrep: go.lang.security.audit.database.string-formatted-query.string-formatted-query
+	qry := "SELECT MAX(" + column + ") FROM " + task.from()
+	if task.Where != "" {
+		qry += " WHERE " + task.Where
+	}
+	var v interface{}
+	if err := srcTx.QueryRowContext(ctx, qry, task.Args...).Scan(&v); err != nil {
+		return watermark{}, false, fmt.Errorf("%s: %w", qry, err)
+	}
+	w, ok := watermarkOf(v)
+	return w, ok, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+package lib
+
+import (
+	"testing"
+	"time"
+
+	godror "github.com/godror/godror"
+)
+
+func TestSinceColumn(t *testing.T) {
+	for cond, want := range map[string]string{
+		"MODIFIED_AT > :last":      "MODIFIED_AT",
+		"  t.modified_at >= :last": "t.modified_at",
+		"ID$#>:last":               "ID$#",
+		"SCN > :last AND x = 1":    "SCN",
+	} {
+		if got, err := sinceColumn(cond); err != nil {
+			t.Errorf("%q: %+v", cond, err)
+		} else if got != want {
+			t.Errorf("%q: got %q, wanted %q", cond, got, want)
+		}
+	}
+	for _, cond := range []string{"", "MODIFIED_AT > :1", "> :last", "1 < :last"} {
+		if got, err := sinceColumn(cond); err == nil {
+			t.Errorf("%q: got %q, wanted error", cond, got)
+		}
+	}
+}
+
+func TestWatermarkOf(t *testing.T) {
+	ts := time.Date(2024, 3, 15, 12, 34, 56, 789000000, time.UTC)
+	for _, tc := range []struct {
+		In   interface{}
+		Want watermark
+		OK   bool
+	}{
+		{nil, watermark{}, false},
+		{time.Time{}, watermark{Value: "0001-01-01T00:00:00Z", Type: "time"}, false},
+		{ts, watermark{Value: "2024-03-15T12:34:56.789Z", Type: "time"}, true},
+		{int64(-42), watermark{Value: "-42", Type: "number"}, true},
+		{1.5e10, watermark{Value: "15000000000", Type: "number"}, true},
+		{godror.Number("123.45"), watermark{Value: "123.45", Type: "number"}, true},
+		{[]byte("abc"), watermark{Value: "abc", Type: "string"}, true},
+		{"xyz", watermark{Value: "xyz", Type: "string"}, true},
+		{true, watermark{Value: "true", Type: "string"}, true},
+	} {
+		got, ok := watermarkOf(tc.In)
+		if got != tc.Want || ok != tc.OK {
+			t.Errorf("%#v: got %+v, %t, wanted %+v, %t", tc.In, got, ok, tc.Want, tc.OK)
+		}
+	}
+	if v, err := (watermark{Value: "2024-03-15T12:34:56.789Z", Type: "time"}).arg(); err != nil {
+		t.Fatal(err)
+	} else if !v.(time.Time).Equal(ts) {
+		t.Errorf("got %v, wanted %v", v, ts)
+	}
+}
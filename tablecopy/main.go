@@ -0,0 +1,22 @@
+// Copyright 2021, 2022 Tamás Gulácsi. All rights reserved.
+
+// SPDX-License-Identifier: Apache-2.0
+
+// Package main in tablecopy is a table copier between databases.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/UNO-SOFT/dbcsv/tablecopy/cli"
+)
+
+func main() {
+	// the interrupts are handled by cli.Main, logged with its logger
+	if err := cli.Main(context.Background(), os.Args); err != nil {
+		slog.Error("Main", "error", err)
+		os.Exit(1)
+	}
+}
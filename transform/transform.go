@@ -0,0 +1,366 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package transform is the per-row expression engine of the tools, using Starlark (a Python dialect):
+//
+//	AMOUNT = replace(AMOUNT, ",", ".")
+//	TOTAL = float(PRICE) * QTY
+//
+// The columns are the variables (by their names), and are in the row dict, too: row["column name"];
+// col("column name") or col(3) (1-based) returns the original value of the column.
+// An assignment to a new name appends a column; the filter is a boolean expression, the rows it is false for are dropped.
+//
+// Besides the Starlark built-ins (str, int, float, len ...) and the string methods,
+// replace, upper, lower, strip, coalesce and the time module are available.
+package transform
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	startime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const funcName = "transform"
+
+// Program is a compiled transformation of the rows of the columns.
+type Program struct {
+	fn *starlark.Function
+	// Columns are the columns of the transformed rows: the original ones, then the new ones.
+	Columns []string
+	// params are the indexes of the columns passed as variables
+	params []int
+	// the number of the original columns
+	inputs int
+}
+
+// Compile the assignments ("NAME = EXPRESSION") and the filter (a boolean expression, may be empty)
+// for the rows of the columns.
+func Compile(columns, assignments []string, filter string) (*Program, error) {
+	prog := Program{Columns: append(make([]string, 0, len(columns)+len(assignments)), columns...), inputs: len(columns)}
+	known := make(map[string]struct{}, len(columns))
+	var params []string
+	for i, c := range columns {
+		if _, ok := known[c]; ok || c == "row" || c == "col" || !isIdent(c) {
+			continue
+		}
+		known[c] = struct{}{}
+		prog.params = append(prog.params, i)
+		params = append(params, c)
+	}
+
+	var buf strings.Builder
+	buf.WriteString("def " + funcName + "(row, col")
+	for _, p := range params {
+		buf.WriteString(", " + p)
+	}
+	buf.WriteString("):\n")
+	for _, a := range assignments {
+		name, err := assignedName(a)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", a, err)
+		}
+		if _, ok := known[name]; !ok {
+			known[name] = struct{}{}
+			prog.Columns = append(prog.Columns, name)
+		}
+		buf.WriteString(indent(a))
+	}
+	if filter != "" {
+		if _, err := syntax.ParseExpr("filter", filter, 0); err != nil {
+			return nil, fmt.Errorf("filter %q: %w", filter, err)
+		}
+		buf.WriteString("    if not (" + strings.TrimSpace(filter) + "):\n        return None\n")
+	}
+	buf.WriteString("    return (")
+	for _, c := range prog.Columns {
+		if _, ok := known[c]; ok && isIdent(c) && c != "row" && c != "col" {
+			buf.WriteString(c)
+		} else {
+			buf.WriteString("row[" + strconv.Quote(c) + "]")
+		}
+		buf.WriteString(", ")
+	}
+	buf.WriteString(")\n")
+
+	thread := &starlark.Thread{Name: "compile"}
+	globals, err := starlark.ExecFile(thread, funcName, buf.String(), Predeclared)
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+	prog.fn = globals[funcName].(*starlark.Function)
+	return &prog, nil
+}
+
+// Run transforms the row (the values of the columns), returning the values of Columns,
+// or nil if the filter drops the row.
+func (prog *Program) Run(row []interface{}) ([]interface{}, error) {
+	v, err := prog.call(row)
+	if err != nil || v == starlark.None {
+		return nil, err
+	}
+	tup := v.(starlark.Tuple)
+	out := make([]interface{}, len(tup))
+	for i, x := range tup {
+		out[i] = FromValue(x)
+	}
+	return out, nil
+}
+
+// RunStrings is Run for string rows: the results are formatted by Format.
+func (prog *Program) RunStrings(row []string) ([]string, error) {
+	vals := make([]interface{}, len(row))
+	for i, s := range row {
+		vals[i] = s
+	}
+	out, err := prog.Run(vals)
+	if out == nil {
+		return nil, err
+	}
+	ss := make([]string, len(out))
+	for i, v := range out {
+		ss[i] = Format(v)
+	}
+	return ss, nil
+}
+
+// Keep reports whether the filter keeps the row.
+func (prog *Program) Keep(row []interface{}) (bool, error) {
+	v, err := prog.call(row)
+	return err == nil && v != starlark.None, err
+}
+
+func (prog *Program) call(row []interface{}) (starlark.Value, error) {
+	if len(row) > prog.inputs {
+		return nil, fmt.Errorf("got %d values for %d columns", len(row), prog.inputs)
+	}
+	// the missing values are None
+	vals := make([]starlark.Value, prog.inputs)
+	d := starlark.NewDict(prog.inputs)
+	for i := range vals {
+		vals[i] = starlark.None
+		if i < len(row) {
+			var err error
+			if vals[i], err = ToValue(row[i]); err != nil {
+				return nil, fmt.Errorf("%s: %w", prog.Columns[i], err)
+			}
+		}
+		if err := d.SetKey(starlark.String(prog.Columns[i]), vals[i]); err != nil {
+			return nil, err
+		}
+	}
+	col := starlark.NewBuiltin("col", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var c starlark.Value
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &c); err != nil {
+			return nil, err
+		}
+		switch c := c.(type) {
+		case starlark.String:
+			if v, ok, _ := d.Get(c); ok {
+				return v, nil
+			}
+		case starlark.Int:
+			if i, ok := c.Int64(); ok && 1 <= i && i <= int64(len(vals)) {
+				return vals[i-1], nil
+			}
+		}
+		return nil, fmt.Errorf("col: unknown column %s", c)
+	})
+	args := make(starlark.Tuple, 2, 2+len(prog.params))
+	args[0], args[1] = d, col
+	for _, i := range prog.params {
+		args = append(args, vals[i])
+	}
+	thread := &starlark.Thread{Name: funcName}
+	return starlark.Call(thread, prog.fn, args, nil)
+}
+
+// isIdent reports whether the name is usable as a variable.
+func isIdent(name string) bool {
+	expr, err := syntax.ParseExpr("", name, 0)
+	if err != nil {
+		return false
+	}
+	id, ok := expr.(*syntax.Ident)
+	return ok && id.Name == name
+}
+
+// assignedName returns the NAME of a "NAME = EXPRESSION".
+func assignedName(assignment string) (string, error) {
+	f, err := syntax.Parse("", assignment, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(f.Stmts) == 1 {
+		if as, ok := f.Stmts[0].(*syntax.AssignStmt); ok && as.Op == syntax.EQ {
+			if id, ok := as.LHS.(*syntax.Ident); ok && id.Name != "row" && id.Name != "col" {
+				return id.Name, nil
+			}
+		}
+	}
+	return "", errors.New("wanted NAME = EXPRESSION")
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n    ") + "\n"
+}
+
+// ToValue converts the Go value into a Starlark value.
+// The NULLs (nil, invalid sql.Null*) are None, the named string types (such as godror.Number) are parsed as numbers.
+func ToValue(v interface{}) (starlark.Value, error) {
+	switch x := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case starlark.Value:
+		return x, nil
+	case string:
+		return starlark.String(x), nil
+	case []byte:
+		if x == nil {
+			return starlark.None, nil
+		}
+		return starlark.Bytes(x), nil
+	case bool:
+		return starlark.Bool(x), nil
+	case int:
+		return starlark.MakeInt(x), nil
+	case int32:
+		return starlark.MakeInt64(int64(x)), nil
+	case int64:
+		return starlark.MakeInt64(x), nil
+	case uint64:
+		return starlark.MakeUint64(x), nil
+	case float32:
+		return starlark.Float(x), nil
+	case float64:
+		return starlark.Float(x), nil
+	case time.Time:
+		if x.IsZero() {
+			return starlark.None, nil
+		}
+		return startime.Time(x), nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+		// godror.Number, json.Number
+		return parseNumber(rv.String()), nil
+	}
+	if x, ok := v.(driver.Valuer); ok {
+		// sql.NullString and the like
+		w, err := x.Value()
+		if err != nil {
+			return nil, err
+		}
+		return ToValue(w)
+	}
+	return nil, fmt.Errorf("unknown type %T", v)
+}
+
+// parseNumber returns the number, None for the empty string, or the string if it is not a number.
+func parseNumber(s string) starlark.Value {
+	if s == "" {
+		return starlark.None
+	}
+	if i, ok := new(big.Int).SetString(s, 10); ok {
+		return starlark.MakeBigInt(i)
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return starlark.Float(f)
+	}
+	return starlark.String(s)
+}
+
+// FromValue converts the Starlark value into a Go value:
+// None is nil, and the ints are int64 (or string when they do not fit).
+func FromValue(v starlark.Value) interface{} {
+	switch x := v.(type) {
+	case starlark.NoneType:
+		return nil
+	case starlark.Bool:
+		return bool(x)
+	case starlark.Int:
+		if i, ok := x.Int64(); ok {
+			return i
+		}
+		return x.String()
+	case starlark.Float:
+		return float64(x)
+	case starlark.String:
+		return string(x)
+	case starlark.Bytes:
+		return []byte(x)
+	case startime.Time:
+		return time.Time(x)
+	}
+	return v.String()
+}
+
+// Format the Go value (as returned by Run) as string: nil is the empty string, the times are in RFC3339.
+func Format(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case []byte:
+		return string(x)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Predeclared are the functions (and modules) available to the expressions.
+var Predeclared = starlark.StringDict{
+	"time":     startime.Module,
+	"replace":  stringMethod("replace"),
+	"upper":    stringMethod("upper"),
+	"lower":    stringMethod("lower"),
+	"strip":    stringMethod("strip"),
+	"coalesce": starlark.NewBuiltin("coalesce", coalesce),
+}
+
+// stringMethod returns the method of the string as a function: replace(s, old, new) is s.replace(old, new).
+// None is kept as None.
+func stringMethod(name string) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: missing argument", name)
+		}
+		if args[0] == starlark.None {
+			return starlark.None, nil
+		}
+		s, ok := args[0].(starlark.String)
+		if !ok {
+			s = starlark.String(Format(FromValue(args[0])))
+		}
+		m, err := s.Attr(name)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Call(thread, m, args[1:], kwargs)
+	})
+}
+
+// coalesce returns the first not None argument.
+func coalesce(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+	for _, a := range args {
+		if a != starlark.None {
+			return a, nil
+		}
+	}
+	return starlark.None, nil
+}
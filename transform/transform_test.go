@@ -0,0 +1,93 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package transform_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/UNO-SOFT/dbcsv/transform"
+	"github.com/godror/godror"
+)
+
+func TestProgram(t *testing.T) {
+	prog, err := transform.Compile(
+		[]string{"AMOUNT", "QTY", "unit price"},
+		[]string{`AMOUNT = replace(AMOUNT, ",", ".")`, `TOTAL = float(AMOUNT) * QTY`, `NOTE = coalesce(row["unit price"], "-")`},
+		"QTY > 0",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"AMOUNT", "QTY", "unit price", "TOTAL", "NOTE"}; !reflect.DeepEqual(prog.Columns, want) {
+		t.Errorf("got %q, wanted %q", prog.Columns, want)
+	}
+	for i, tc := range []struct {
+		In, Want []interface{}
+	}{
+		{In: []interface{}{"1,5", int64(2), nil}, Want: []interface{}{"1.5", int64(2), nil, 3.0, "-"}},
+		{In: []interface{}{"2", godror.Number("3"), sql.NullString{String: "x", Valid: true}}, Want: []interface{}{"2", int64(3), "x", 6.0, "x"}},
+		{In: []interface{}{"2", int64(0), nil}},
+	} {
+		got, err := prog.Run(tc.In)
+		if err != nil {
+			t.Fatalf("%d. %+v", i, err)
+		}
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("%d. got %#v, wanted %#v", i, got, tc.Want)
+		}
+	}
+
+	ss, err := prog.RunStrings([]string{"1,25", "4"})
+	if err == nil {
+		t.Errorf("wanted error for string * int, got %q", ss)
+	}
+
+	if _, err = transform.Compile([]string{"A"}, []string{"A + 1"}, ""); err == nil {
+		t.Error("wanted error for a non-assignment")
+	}
+}
+
+func TestRunStrings(t *testing.T) {
+	prog, err := transform.Compile([]string{"NAME", "CODE"}, []string{"NAME = upper(strip(NAME))"}, `CODE != "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := prog.RunStrings([]string{" abc ", "y"}); err != nil {
+		t.Fatal(err)
+	} else if want := []string{"ABC", "y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if got, err := prog.RunStrings([]string{"abc", "x"}); err != nil || got != nil {
+		t.Errorf("got %q (%+v), wanted nil", got, err)
+	}
+	if keep, err := prog.Keep([]interface{}{"abc"}); err != nil || !keep {
+		t.Errorf("got %t (%+v), wanted true for the missing CODE", keep, err)
+	}
+
+	if prog, err = transform.Compile([]string{"STATUS", "x y", "NOTE"}, nil, `col("STATUS") == "A" and len(col(3)) > 0 and col("x y") != None`); err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range []struct {
+		In   []interface{}
+		Want bool
+	}{
+		{In: []interface{}{"A", "1", "n"}, Want: true},
+		{In: []interface{}{"B", "1", "n"}},
+		{In: []interface{}{"A", "1", ""}},
+		{In: []interface{}{"A", nil, "n"}},
+	} {
+		if keep, err := prog.Keep(tc.In); err != nil || keep != tc.Want {
+			t.Errorf("%d. got %t (%+v), wanted %t", i, keep, err, tc.Want)
+		}
+	}
+	if prog, err = transform.Compile([]string{"A"}, nil, "col(2) == 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = prog.Keep([]interface{}{"a"}); err == nil {
+		t.Error("wanted error for an unknown column")
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The typed format is a compact, binary-safe stream, which keeps the values
+// as precise as the database had them (no separator/quoting or date format issues):
+//
+//	magic:  "DBCSVT\x01"
+//	header: uvarint(number of columns), then for each column: str(name), str(database type)
+//	rows:   'R', then for each column: a tag byte and, unless the tag is TypedNull, str(value)
+//	end:    'E'
+//
+// where str is uvarint(length) + bytes.
+// Numbers are in their exact decimal form, times are in RFC3339 with nanoseconds.
+const typedMagic = "DBCSVT\x01"
+
+// The limits of the typed format, checked before allocating by the read lengths.
+const (
+	typedMaxColumns = 1 << 16
+	typedMaxLength  = 1<<31 - 1
+)
+
+// Tags of the typed format's values.
+const (
+	TypedNull   = byte(0)
+	TypedString = byte('s')
+	TypedNumber = byte('n')
+	TypedTime   = byte('t')
+	TypedBytes  = byte('b')
+)
+
+// DumpTyped dumps the rows in the typed format, returning the number of rows written.
+func DumpTyped(ctx context.Context, w io.Writer, rows *sql.Rows, columns []Column) (int, error) {
+	bw := bufio.NewWriterSize(w, 65536)
+	defer bw.Flush()
+	var a [binary.MaxVarintLen64]byte
+	writeStr := func(s string) {
+		_, _ = bw.Write(binary.AppendUvarint(a[:0], uint64(len(s))))
+		_, _ = bw.WriteString(s)
+	}
+	_, _ = bw.WriteString(typedMagic)
+	_, _ = bw.Write(binary.AppendUvarint(a[:0], uint64(len(columns))))
+	dest := make([]interface{}, len(columns))
+	values := make([]Stringer, len(columns))
+	for i, col := range columns {
+		writeStr(col.Name)
+		writeStr(col.DatabaseType)
+		values[i] = col.Converter("")
+		dest[i] = values[i].Pointer()
+	}
+	hook := rowHookFromContext(ctx)
+	limit := limitFromContext(ctx)
+	n := 0
+	for (limit == 0 || n < limit) && rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return n, fmt.Errorf("scan into %#v: %w", dest, err)
+		}
+		_ = bw.WriteByte('R')
+		for _, v := range values {
+			tag, s := typedValue(v)
+			_ = bw.WriteByte(tag)
+			if tag != TypedNull {
+				writeStr(s)
+			}
+		}
+		n++
+		if hook != nil {
+			hook(values)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if err := bw.WriteByte('E'); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+func typedValue(v Stringer) (byte, string) {
+	switch x := v.(type) {
+	case *ValTime:
+		if !x.value.Valid || x.value.Time.IsZero() {
+			return TypedNull, ""
+		}
+		return TypedTime, x.value.Time.Format(time.RFC3339Nano)
+	case *ValNumber:
+		if x.value == "" {
+			return TypedNull, ""
+		}
+		return TypedNumber, string(x.value)
+	case *ValInt:
+		if !x.value.Valid {
+			return TypedNull, ""
+		}
+		return TypedNumber, x.String()
+	case *ValFloat:
+		if !x.value.Valid {
+			return TypedNull, ""
+		}
+		return TypedNumber, x.String()
+	case *ValBytes:
+		if x.value == nil {
+			return TypedNull, ""
+		}
+		return TypedBytes, string(x.value)
+	case *ValString:
+		if !x.value.Valid {
+			return TypedNull, ""
+		}
+		return TypedString, x.value.String
+	}
+	return TypedString, v.String()
+}
+
+// ReadTyped reads the typed format, calling fn with the header (column names) first, then each row.
+// Time values are in RFC3339 format with nanoseconds, NULLs are empty strings.
+func ReadTyped(ctx context.Context, fn func(context.Context, Row) error, r io.Reader, columns []int, skip int) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(typedMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("read magic: %w", err)
+	}
+	if string(magic) != typedMagic {
+		return fmt.Errorf("bad magic %q", magic)
+	}
+	readStr := func() (string, error) {
+		length, err := binary.ReadUvarint(br)
+		if err != nil {
+			return "", err
+		}
+		if length > typedMaxLength {
+			return "", fmt.Errorf("length %d is bigger than %d", length, typedMaxLength)
+		}
+		if length <= 1<<16 {
+			b := make([]byte, int(length))
+			_, err = io.ReadFull(br, b)
+			return string(b), err
+		}
+		// do not trust the length: allocate only what is read
+		var sb strings.Builder
+		if _, err = io.CopyN(&sb, br, int64(length)); errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return sb.String(), err
+	}
+	nCols, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if nCols > typedMaxColumns {
+		return fmt.Errorf("read header: %d columns is more than %d", nCols, typedMaxColumns)
+	}
+	names := make([]string, int(nCols))
+	types := make([]string, len(names))
+	for i := range names {
+		if names[i], err = readStr(); err != nil {
+			return fmt.Errorf("read %d. column name: %w", i, err)
+		}
+		if types[i], err = readStr(); err != nil {
+			return fmt.Errorf("read %d. column type: %w", i, err)
+		}
+	}
+	for _, j := range columns {
+		if j < 0 || j >= len(names) {
+			return fmt.Errorf("column %d is out of range (have %d columns)", j+1, len(names))
+		}
+	}
+	project := func(row []string) []string {
+		if columns == nil {
+			return row
+		}
+		r2 := make([]string, len(columns))
+		for i, j := range columns {
+			r2[i] = row[j]
+		}
+		return r2
+	}
+	colNames := project(names)
+	n := 1
+	if n > skip {
+		if err = fn(ctx, Row{Columns: colNames, Values: append([]string(nil), colNames...)}); err != nil {
+			return fmt.Errorf("fn: %w", err)
+		}
+	}
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		marker, err := br.ReadByte()
+		if err != nil {
+			return fmt.Errorf("read row marker: %w", err)
+		}
+		if marker == 'E' {
+			return nil
+		}
+		if marker != 'R' {
+			return fmt.Errorf("%d. row: bad marker %q", n, marker)
+		}
+		row := make([]string, len(names))
+		for i := range row {
+			tag, err := br.ReadByte()
+			if err != nil {
+				return fmt.Errorf("%d. row %d. column: %w", n, i, err)
+			}
+			if tag == TypedNull {
+				continue
+			}
+			if row[i], err = readStr(); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return fmt.Errorf("%d. row %d. column: %w", n, i, err)
+			}
+		}
+		n++
+		if n <= skip {
+			continue
+		}
+		if err = fn(ctx, Row{Columns: colNames, Line: n - 1, Values: project(row)}); err != nil {
+			return fmt.Errorf("fn: %w", err)
+		}
+	}
+}
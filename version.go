@@ -0,0 +1,71 @@
+// Copyright 2024 Tamás Gulácsi. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbcsv
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// BuildDate is the date of the build, set by
+//
+//	go build -ldflags="-X github.com/UNO-SOFT/dbcsv.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// By default, it is the time of the VCS revision.
+var BuildDate string
+
+// BuildInfo is the version of the binary.
+type BuildInfo struct {
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// Version returns the version of the binary, from debug.ReadBuildInfo.
+func Version() BuildInfo {
+	bi := BuildInfo{Version: "(devel)", Date: BuildDate}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+	bi.Module, bi.GoVersion = info.Main.Path, info.GoVersion
+	if info.Main.Version != "" {
+		bi.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.Revision = s.Value
+		case "vcs.time":
+			if bi.Date == "" {
+				bi.Date = s.Value
+			}
+		case "vcs.modified":
+			bi.Modified = s.Value == "true"
+		}
+	}
+	return bi
+}
+
+// String returns the version as "module version (revision[+modified], date, go version)".
+func (bi BuildInfo) String() string {
+	var buf strings.Builder
+	buf.WriteString(bi.Module + " " + bi.Version + " (")
+	if bi.Revision != "" {
+		buf.WriteString(bi.Revision)
+		if bi.Modified {
+			buf.WriteString("+modified")
+		}
+		buf.WriteString(", ")
+	}
+	if bi.Date != "" {
+		buf.WriteString(bi.Date + ", ")
+	}
+	buf.WriteString(bi.GoVersion + ")")
+	return buf.String()
+}
@@ -23,10 +23,106 @@ import (
 	"github.com/UNO-SOFT/zlog/v2/slog"
 
 	"github.com/godror/godror"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/UNO-SOFT/dbcsv/tracing"
+	"github.com/UNO-SOFT/dbcsv/transform"
 )
 
+type rowHookCtxKey struct{}
+
+// WithRowHook returns a context which makes DumpCSV and DumpSheet call hook
+// with the values of each row, after the row has been written.
+// The hook already in ctx is called before it.
+func WithRowHook(ctx context.Context, hook func([]Stringer)) context.Context {
+	if prev := rowHookFromContext(ctx); prev != nil {
+		next := hook
+		hook = func(values []Stringer) { prev(values); next(values) }
+	}
+	return context.WithValue(ctx, rowHookCtxKey{}, hook)
+}
+
+func rowHookFromContext(ctx context.Context) func([]Stringer) {
+	hook, _ := ctx.Value(rowHookCtxKey{}).(func([]Stringer))
+	return hook
+}
+
+type limitCtxKey struct{}
+
+// WithLimit returns a context which makes DumpCSV, DumpSheet and DumpTyped
+// stop after limit rows (if limit is positive), without reading the rest.
+func WithLimit(ctx context.Context, limit int) context.Context {
+	return context.WithValue(ctx, limitCtxKey{}, limit)
+}
+
+// limitFromContext returns the row limit of the context, 0 for no limit.
+func limitFromContext(ctx context.Context) int {
+	limit, _ := ctx.Value(limitCtxKey{}).(int)
+	return max(0, limit)
+}
+
+type transformCtxKey struct{}
+
+// WithTransform returns a context which makes DumpCSV and DumpSheet transform each row
+// by the "NAME = EXPRESSION" assignments (see package transform) before writing it:
+// the assigned new columns are appended to the written ones.
+func WithTransform(ctx context.Context, assignments []string) context.Context {
+	return context.WithValue(ctx, transformCtxKey{}, assignments)
+}
+
+// TransformColumns returns the written columns of the rows of the columns (see WithTransform).
+func TransformColumns(ctx context.Context, columns []Column) ([]Column, error) {
+	prog, err := transformFromContext(ctx, columns)
+	if prog == nil {
+		return columns, err
+	}
+	cols := append(make([]Column, 0, len(prog.Columns)), columns...)
+	for _, nm := range prog.Columns[len(columns):] {
+		cols = append(cols, Column{Name: nm, Type: typeOfString, DatabaseType: "VARCHAR2", Nullable: true})
+	}
+	return cols, nil
+}
+
+// transformFromContext compiles the assignments of the context for the columns, returns nil if there are none.
+func transformFromContext(ctx context.Context, columns []Column) (*transform.Program, error) {
+	assignments, _ := ctx.Value(transformCtxKey{}).([]string)
+	if len(assignments) == 0 {
+		return nil, nil
+	}
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	return transform.Compile(names, assignments, "")
+}
+
+// transformRow returns the transformed values of the row.
+func transformRow(prog *transform.Program, values []Stringer) ([]interface{}, error) {
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		row[i], _ = v.Value()
+	}
+	return prog.Run(row)
+}
+
+// formatValue formats the transformed value for CSV.
+func formatValue(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(DateFormat)
+	}
+	return transform.Format(v)
+}
+
 func DumpCSV(ctx context.Context, w io.Writer, rows *sql.Rows, columns []Column, header bool, sep string, raw bool) error {
+	_, err := DumpCSVCount(ctx, w, rows, columns, header, sep, raw)
+	return err
+}
+
+// DumpCSVCount is like DumpCSV, but returns the number of rows written, too.
+func DumpCSVCount(ctx context.Context, w io.Writer, rows *sql.Rows, columns []Column, header bool, sep string, raw bool) (n int, err error) {
 	logger := zlog.SFromContext(ctx)
+	ctx, span := tracing.Start(ctx, "dump", attribute.String("format", "csv"))
+	defer func() { tracing.End(span, err, attribute.Int("rows", n)) }()
 	sepB := []byte(sep)
 	dest := make([]interface{}, len(columns))
 	bw := bufio.NewWriterSize(w, 65536)
@@ -37,30 +133,60 @@ func DumpCSV(ctx context.Context, w io.Writer, rows *sql.Rows, columns []Column,
 		values[i] = c
 		dest[i] = c.Pointer()
 	}
+	prog, err := transformFromContext(ctx, columns)
+	if err != nil {
+		return 0, err
+	}
 	if header && !raw {
+		names := make([]string, len(columns))
 		for i, col := range columns {
+			names[i] = col.Name
+		}
+		if prog != nil {
+			names = prog.Columns
+		}
+		for i, nm := range names {
 			if i > 0 {
 				_, _ = bw.Write(sepB)
 			}
-			if _, err := csvQuote(bw, sep, col.Name); err != nil {
-				return err
+			if _, err := csvQuote(bw, sep, nm); err != nil {
+				return 0, err
 			}
 		}
 		if _, err := bw.Write([]byte{'\n'}); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
+	hook := rowHookFromContext(ctx)
+	limit := limitFromContext(ctx)
 	start := time.Now()
-	n := 0
-	for rows.Next() {
+	for (limit == 0 || n < limit) && rows.Next() {
 		if err := ctx.Err(); err != nil {
-			return err
+			return n, err
 		}
 		if err := rows.Scan(dest...); err != nil {
-			return fmt.Errorf("scan into %#v: %w", dest, err)
+			return n, fmt.Errorf("scan into %#v: %w", dest, err)
 		}
-		if raw {
+		if prog != nil {
+			out, err := transformRow(prog, values)
+			if err != nil {
+				return n, fmt.Errorf("transform row %d: %w", n+1, err)
+			}
+			for i, v := range out {
+				if i > 0 && !raw {
+					_, _ = bw.Write(sepB)
+				}
+				if v == nil {
+					continue
+				}
+				if raw {
+					_, _ = bw.WriteString(formatValue(v))
+				} else {
+					_, _ = bw.WriteString(csvQuoteString(sep, formatValue(v)))
+				}
+			}
+		} else if raw {
 			for i, data := range dest {
 				if data == nil {
 					continue
@@ -83,18 +209,29 @@ func DumpCSV(ctx context.Context, w io.Writer, rows *sql.Rows, columns []Column,
 			}
 		}
 		if _, err := bw.Write([]byte{'\n'}); err != nil {
-			return err
+			return n, err
 		}
 		n++
+		if hook != nil {
+			hook(values)
+		}
 	}
-	err := rows.Err()
+	err = rows.Err()
 	dur := time.Since(start)
-	logger.Debug("dump finished", "rows", n, "dur", dur.String(), "speed", fmt.Sprintf("%.3f 1/s", float64(n)/float64(dur*time.Second)), "error", err)
-	return err
+	logger.Debug("dump finished", "rows", n, "duration", dur.String(), "speed", fmt.Sprintf("%.3f 1/s", float64(n)/float64(dur*time.Second)), "error", err)
+	return n, err
 }
 
 func DumpSheet(ctx context.Context, sheet spreadsheet.Sheet, rows *sql.Rows, columns []Column) error {
+	_, err := DumpSheetCount(ctx, sheet, rows, columns)
+	return err
+}
+
+// DumpSheetCount is like DumpSheet, but returns the number of rows written, too.
+func DumpSheetCount(ctx context.Context, sheet spreadsheet.Sheet, rows *sql.Rows, columns []Column) (n int, err error) {
 	logger := zlog.SFromContext(ctx)
+	ctx, span := tracing.Start(ctx, "dump", attribute.String("format", "sheet"))
+	defer func() { tracing.End(span, err, attribute.Int("rows", n)) }()
 	dest := make([]interface{}, len(columns))
 	vals := make([]interface{}, len(columns))
 	values := make([]Stringer, len(columns))
@@ -104,33 +241,51 @@ func DumpSheet(ctx context.Context, sheet spreadsheet.Sheet, rows *sql.Rows, col
 		vals[i] = c
 		dest[i] = c.Pointer()
 	}
+	prog, err := transformFromContext(ctx, columns)
+	if err != nil {
+		return 0, err
+	}
+	hook := rowHookFromContext(ctx)
+	limit := limitFromContext(ctx)
 	start := time.Now()
-	n := 0
-	for rows.Next() {
+	for (limit == 0 || n < limit) && rows.Next() {
 		if err := ctx.Err(); err != nil {
-			return err
+			return n, err
 		}
 		if err := rows.Scan(dest...); err != nil {
-			return fmt.Errorf("scan into %#v: %w", dest, err)
+			return n, fmt.Errorf("scan into %#v: %w", dest, err)
 		}
 		if logger.Enabled(ctx, slog.LevelDebug) {
 			logger.Debug("scan", "rows", dest, "vals", fmt.Sprintf("%#v", vals))
 		}
-		if err := sheet.AppendRow(vals...); err != nil {
-			return err
+		if prog == nil {
+			err = sheet.AppendRow(vals...)
+		} else {
+			var out []interface{}
+			if out, err = transformRow(prog, values); err != nil {
+				return n, fmt.Errorf("transform row %d: %w", n+1, err)
+			}
+			err = sheet.AppendRow(out...)
+		}
+		if err != nil {
+			return n, err
 		}
 		n++
+		if hook != nil {
+			hook(values)
+		}
 	}
-	err := rows.Err()
+	err = rows.Err()
 	dur := time.Since(start)
-	logger.Debug("dump finished", "rows", n, "dur", dur.String(), "speed", float64(n)/float64(dur)*float64(time.Second), "error", err)
-	return err
+	logger.Debug("dump finished", "rows", n, "duration", dur.String(), "speed", float64(n)/float64(dur)*float64(time.Second), "error", err)
+	return n, err
 }
 
 type Column struct {
 	reflect.Type
 	Name, DatabaseType string
 	Precision, Scale   int
+	Nullable           bool
 }
 
 func (col Column) Converter(sep string) Stringer {
@@ -247,6 +402,8 @@ type ValTime struct {
 var (
 	DateEnd    string
 	DateFormat = "2006-01-02"
+	// DateLocation, if set, is the time zone the scanned times are converted into.
+	DateLocation *time.Location
 )
 
 func (v ValTime) Value() (driver.Value, error) { return v.value, nil }
@@ -285,11 +442,15 @@ func (vt *ValTime) Scan(v interface{}) error {
 	default:
 		return fmt.Errorf("unknown scan source %T", v)
 	}
+	if DateLocation != nil && vt.value.Valid && vt.value.Time.Year() > 0 {
+		vt.value.Time = vt.value.Time.In(DateLocation)
+	}
 	return nil
 }
 func (v *ValTime) Pointer() interface{} { return v }
 
 var typeOfTime, typeOfNullTime, typeOfByteSlice = reflect.TypeOf(time.Time{}), reflect.TypeOf(sql.NullTime{}), reflect.TypeOf(([]byte)(nil))
+var typeOfString = reflect.TypeOf("")
 
 var bufPool = sync.Pool{New: func() interface{} { return bytes.NewBuffer(make([]byte, 0, 1024)) }}
 
@@ -334,11 +495,13 @@ func GetColumns(ctx context.Context, rows interface{}) ([]Column, error) {
 		cols := make([]Column, len(types))
 		for i, t := range types {
 			precision, scale, _ := t.DecimalSize()
+			nullable, _ := t.Nullable()
 			cols[i] = Column{
 				Name:         t.Name(),
 				DatabaseType: t.DatabaseTypeName(),
 				Type:         t.ScanType(),
 				Precision:    int(precision), Scale: int(scale),
+				Nullable: nullable,
 			}
 			logger.Debug("column", "i", i, "t", fmt.Sprintf("%#v", t), "col", cols[i])
 		}
@@ -350,6 +513,7 @@ func GetColumns(ctx context.Context, rows interface{}) ([]Column, error) {
 	st := rows.(driver.RowsColumnTypeScanType)
 	dtn := rows.(driver.RowsColumnTypeDatabaseTypeName)
 	ps := rows.(driver.RowsColumnTypePrecisionScale)
+	cn, _ := rows.(driver.RowsColumnTypeNullable)
 	for i, name := range colNames {
 		precision, scale, _ := ps.ColumnTypePrecisionScale(i)
 		cols[i] = Column{
@@ -358,6 +522,9 @@ func GetColumns(ctx context.Context, rows interface{}) ([]Column, error) {
 			Type:         st.ColumnTypeScanType(i),
 			Precision:    int(precision), Scale: int(scale),
 		}
+		if cn != nil {
+			cols[i].Nullable, _ = cn.ColumnTypeNullable(i)
+		}
 	}
 	return cols, nil
 }